@@ -0,0 +1,146 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"queue-manager/internal/queue"
+	"queue-manager/internal/reconciliation"
+	"queue-manager/internal/repository"
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// expectedBinding is a binding in the shape of /expectation
+type expectedBinding struct {
+	ExchangeName string `json:"exchange_name"`
+	QueueName    string `json:"queue_name"`
+	RoutingKey   string `json:"routing_key"`
+}
+
+func toExpectedBinding(b reconciliation.BindingRef) expectedBinding {
+	return expectedBinding{ExchangeName: b.Exchange, QueueName: b.Queue, RoutingKey: b.RoutingKey}
+}
+
+// mismatchedResource is an exchange or queue whose live properties differ from the expected ones
+type mismatchedResource struct {
+	Name   string                     `json:"name"`
+	Fields []reconciliation.FieldDiff `json:"fields"`
+}
+
+// mismatchedBinding pairs an expected binding with the live binding that differs from it
+type mismatchedBinding struct {
+	Expected expectedBinding            `json:"expected"`
+	Actual   reconciliation.BindingRef  `json:"actual"`
+	Fields   []reconciliation.FieldDiff `json:"fields"`
+}
+
+// getDetails handles GET /details and returns the diff between the expected topology in
+// PostgreSQL and the live topology, grouped into missing, unexpected, mismatched and healthy
+// resources. It is read-only: unlike POST /sync?dryRun=true, no plan is stored. The live
+// topology is the snapshot served by /reality, so it may be up to REALITY_CACHE_TTL old.
+func getDetails(repo *repository.Repository, cache *queue.TopologyCache, qp queue.Provider) gin.HandlerFunc {
+	if cache == nil && qp != nil {
+		cache = queue.NewTopologyCache(qp, 0)
+	}
+	return func(c *gin.Context) {
+		if repo == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
+			return
+		}
+		if cache == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "queue provider not available"))
+			return
+		}
+
+		page, pageSize, errs := parsePagination(c.Query)
+		if len(errs) > 0 {
+			response.Fail(c, response.Invalid(errs...))
+			return
+		}
+
+		filter := repository.TopologyFilter{
+			Service:  c.Query("service"),
+			Queue:    c.Query("queue"),
+			Exchange: c.Query("exchange"),
+		}
+		expected, err := reconciliation.LoadExpected(repo.WithContext(c.Request.Context()), filter)
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to load expected topology"))
+			return
+		}
+		snapshot, err := cache.Get(c.Request.Context())
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusBadGateway, response.CodeProviderError, "failed to read provider state"))
+			return
+		}
+
+		diff := reconciliation.Compare(expected, reconciliation.ScopeActual(snapshot, expected, filter))
+		summary := diff.Summary()
+		metadata := map[string]interface{}{
+			"page":      page,
+			"pageSize":  pageSize,
+			"total":     summary["missing"] + summary["unexpected"] + summary["mismatched"] + summary["healthy"],
+			"summary":   summary,
+			"inSync":    diff.InSync(),
+			"timestamp": snapshot.Timestamp.UTC().Format(time.RFC3339),
+		}
+		if filters := echoFilters(filter); len(filters) > 0 {
+			metadata["filters"] = filters
+		}
+		response.JSON(c, http.StatusOK, "ok", detailsData(diff, page, pageSize), metadata)
+	}
+}
+
+// detailsData formats one page of every group and resource kind as specified in
+// @apis/comparative-details.md
+func detailsData(diff *reconciliation.Diff, page, pageSize int) map[string]interface{} {
+	bindings := func(list []reconciliation.BindingRef) []expectedBinding {
+		out := []expectedBinding{}
+		for _, b := range pageOf(list, page, pageSize) {
+			out = append(out, toExpectedBinding(b))
+		}
+		return out
+	}
+	mismatched := func(list []reconciliation.Mismatch) []mismatchedResource {
+		out := []mismatchedResource{}
+		for _, m := range pageOf(list, page, pageSize) {
+			out = append(out, mismatchedResource{Name: m.Name, Fields: m.Fields})
+		}
+		return out
+	}
+	mismatchedBindings := []mismatchedBinding{}
+	for _, m := range pageOf(diff.Mismatched.Bindings, page, pageSize) {
+		mismatchedBindings = append(mismatchedBindings, mismatchedBinding{
+			Expected: toExpectedBinding(*m.Expected), Actual: *m.Actual, Fields: m.Fields,
+		})
+	}
+	healthyBindings := []string{}
+	for _, b := range pageOf(diff.Healthy.Bindings, page, pageSize) {
+		healthyBindings = append(healthyBindings, b.String())
+	}
+
+	return map[string]interface{}{
+		"missing": map[string]interface{}{
+			"queues":    pageOf(diff.Missing.Queues, page, pageSize),
+			"exchanges": pageOf(diff.Missing.Exchanges, page, pageSize),
+			"bindings":  bindings(diff.Missing.Bindings),
+		},
+		"unexpected": map[string]interface{}{
+			"queues":    pageOf(diff.Unexpected.Queues, page, pageSize),
+			"exchanges": pageOf(diff.Unexpected.Exchanges, page, pageSize),
+			"bindings":  pageOf(diff.Unexpected.Bindings, page, pageSize),
+		},
+		"mismatched": map[string]interface{}{
+			"queues":    mismatched(diff.Mismatched.Queues),
+			"exchanges": mismatched(diff.Mismatched.Exchanges),
+			"bindings":  mismatchedBindings,
+		},
+		"healthy": map[string]interface{}{
+			"queues":    pageOf(diff.Healthy.Queues, page, pageSize),
+			"exchanges": pageOf(diff.Healthy.Exchanges, page, pageSize),
+			"bindings":  healthyBindings,
+		},
+	}
+}
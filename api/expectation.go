@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+
+	"queue-manager/internal/repository"
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getExpectation handles GET /expectation and returns the expected topology from PostgreSQL.
+// Filters (service, queue, exchange) and pagination (page, pageSize) are applied in SQL to each
+// resource kind separately; metadata.total is the number of matches across all kinds.
+func getExpectation(repo *repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if repo == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
+			return
+		}
+
+		page, pageSize, errs := parsePagination(c.Query)
+		if len(errs) > 0 {
+			response.Fail(c, response.Invalid(errs...))
+			return
+		}
+
+		filter := repository.TopologyFilter{
+			Service:  c.Query("service"),
+			Queue:    c.Query("queue"),
+			Exchange: c.Query("exchange"),
+		}
+		data, totals, err := loadExpectation(repo.WithContext(c.Request.Context()), filter,
+			repository.Page{Limit: pageSize, Offset: (page - 1) * pageSize})
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to load expected topology"))
+			return
+		}
+
+		total := 0
+		for _, n := range totals {
+			total += n
+		}
+		metadata := map[string]interface{}{
+			"page":     page,
+			"pageSize": pageSize,
+			"total":    total,
+			"totals":   totals,
+		}
+		if filters := echoFilters(filter); len(filters) > 0 {
+			metadata["filters"] = filters
+		}
+		response.JSON(c, http.StatusOK, "ok", data, metadata)
+	}
+}
+
+// loadExpectation loads one page of every resource kind and the number of matches per kind
+func loadExpectation(r *repository.Repository, filter repository.TopologyFilter, page repository.Page) (
+	map[string]interface{}, map[string]int, error) {
+	data, totals := map[string]interface{}{}, map[string]int{}
+	var err error
+
+	if data["queues"], totals["queues"], err = r.FindQueues(filter, page); err != nil {
+		return nil, nil, err
+	}
+	if data["exchanges"], totals["exchanges"], err = r.FindExchanges(filter, page); err != nil {
+		return nil, nil, err
+	}
+	if data["service_assignments"], totals["service_assignments"], err = r.FindServiceAssignments(filter, page); err != nil {
+		return nil, nil, err
+	}
+	if data["bindings"], totals["bindings"], err = r.FindBindings(filter, page); err != nil {
+		return nil, nil, err
+	}
+	return data, totals, nil
+}
+
+// echoFilters returns the filters that were set, to be echoed back in metadata
+func echoFilters(f repository.TopologyFilter) map[string]string {
+	filters := map[string]string{}
+	for k, v := range map[string]string{"service": f.Service, "queue": f.Queue, "exchange": f.Exchange} {
+		if v != "" {
+			filters[k] = v
+		}
+	}
+	return filters
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+
+	"queue-manager/internal/bootstrap"
+	"queue-manager/internal/queue/rabbitmq"
+	"queue-manager/internal/repository"
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportDefinitions handles GET /export and returns the expected topology as a RabbitMQ
+// definitions file. The body is the file itself rather than the response envelope, so it can be
+// loaded into a broker as it is; errors use the envelope.
+func exportDefinitions(repo *repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if repo == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
+			return
+		}
+
+		vhost := c.DefaultQuery("vhost", rabbitmq.DefaultVhost)
+		if vhost == "" {
+			response.Fail(c, response.InvalidParameter("vhost", "must not be empty"))
+			return
+		}
+
+		defs, err := bootstrap.ExportDefinitions(c.Request.Context(), repo, vhost)
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to load expected topology"))
+			return
+		}
+		if c.Query("download") == "true" {
+			c.Header("Content-Disposition", `attachment; filename="definitions.json"`)
+		}
+		c.IndentedJSON(http.StatusOK, defs)
+	}
+}
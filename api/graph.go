@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"queue-manager/internal/graph"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/reconciliation"
+	"queue-manager/internal/repository"
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// graphContentTypes are the content types of the rendered formats
+var graphContentTypes = map[graph.Format]string{
+	graph.FormatDOT:     "text/vnd.graphviz; charset=utf-8",
+	graph.FormatMermaid: "text/plain; charset=utf-8",
+}
+
+// getTopologyGraph handles GET /topology/graph and maps the expected topology, read from where the
+// reconciler reads it, as a graph of producers, exchanges, queues and services. With drift=true, the diff against the live
+// topology (the snapshot served by /reality) is overlaid on it. JSON uses the response envelope;
+// DOT and Mermaid are returned as they are, so they can be piped to a renderer.
+func getTopologyGraph(repo *repository.Repository, rec *reconciliation.Reconciler, cache *queue.TopologyCache, qp queue.Provider) gin.HandlerFunc {
+	if cache == nil && qp != nil {
+		cache = queue.NewTopologyCache(qp, 0)
+	}
+	return func(c *gin.Context) {
+		format := graph.Format(c.DefaultQuery("format", string(graph.FormatJSON)))
+		if format != graph.FormatJSON && graphContentTypes[format] == "" {
+			response.Fail(c, response.InvalidParameter("format", "must be one of json, dot, mermaid"))
+			return
+		}
+		drift := false
+		if v := c.Query("drift"); v != "" {
+			var err error
+			drift, err = strconv.ParseBool(v)
+			if err != nil {
+				response.Fail(c, response.InvalidParameter("drift", "must be a boolean value"))
+				return
+			}
+		}
+
+		src := expectedSource(repo, rec)
+		if src == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
+			return
+		}
+		if drift && cache == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "queue provider not available"))
+			return
+		}
+
+		defs, err := src.Load(c.Request.Context())
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to load expected topology"))
+			return
+		}
+		g := graph.Build(defs)
+		if drift {
+			snapshot, err := cache.Get(c.Request.Context())
+			if err != nil {
+				response.Fail(c, response.NewError(http.StatusBadGateway, response.CodeProviderError, "failed to read provider state"))
+				return
+			}
+			expected := reconciliation.ExpectedTopology{Exchanges: defs.Exchanges, Queues: defs.Queues, Bindings: defs.Bindings}
+			g = graph.Overlay(g, reconciliation.Compare(expected, snapshot))
+		}
+
+		switch format {
+		case graph.FormatDOT:
+			c.Data(http.StatusOK, graphContentTypes[format], []byte(g.DOT()))
+		case graph.FormatMermaid:
+			c.Data(http.StatusOK, graphContentTypes[format], []byte(g.Mermaid()))
+		default:
+			response.OK(c, g)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"queue-manager/internal/adoption"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/queue/rabbitmq"
+	"queue-manager/internal/repository"
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// importRequest is the body of POST /import
+type importRequest struct {
+	// Source is broker (the live provider) or definitions (a RabbitMQ definitions file)
+	Source      string          `json:"source"`
+	Definitions json.RawMessage `json:"definitions"`
+	// Vhost selects the resources of a definitions file; defaults to "/"
+	Vhost string `json:"vhost"`
+	// Token confirms the import; without it only the preview is returned
+	Token string `json:"token"`
+}
+
+// importTopology handles POST /import. Without a token it returns the rows that would be inserted
+// and the token confirming them; with the token of an unchanged preview it writes the rows in one
+// transaction. A token that no longer matches is refused with the new preview.
+func importTopology(repo *repository.Repository, qp queue.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if repo == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
+			return
+		}
+
+		var req importRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, response.Invalid(response.FieldError{Field: "body", Issue: "must be a JSON object"}))
+			return
+		}
+
+		var top queue.Topology
+		switch req.Source {
+		case adoption.SourceBroker:
+			if qp == nil {
+				response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "queue provider not available"))
+				return
+			}
+			var err error
+			if top, err = queue.ReadTopology(queue.WithContext(c.Request.Context(), qp)); err != nil {
+				response.Fail(c, response.NewError(http.StatusBadGateway, response.CodeProviderError, "failed to read provider state"))
+				return
+			}
+		case adoption.SourceDefinitions:
+			if len(req.Definitions) == 0 || string(req.Definitions) == "null" {
+				response.Fail(c, response.Invalid(response.FieldError{Field: "definitions", Issue: "is required for the definitions source"}))
+				return
+			}
+			defs, err := rabbitmq.ParseDefinitions(bytes.NewReader(req.Definitions))
+			if err != nil {
+				response.Fail(c, response.Invalid(response.FieldError{Field: "definitions", Issue: "must be a RabbitMQ definitions object"}))
+				return
+			}
+			vhost := req.Vhost
+			if vhost == "" {
+				vhost = rabbitmq.DefaultVhost
+			}
+			top = defs.Topology(vhost)
+		default:
+			response.Fail(c, response.Invalid(response.FieldError{Field: "source", Issue: "must be broker or definitions"}))
+			return
+		}
+
+		repo := repo.WithContext(c.Request.Context())
+		preview, err := adoption.NewPreview(repo, req.Source, top)
+		if errors.Is(err, adoption.ErrNotDetailed) {
+			response.Fail(c, response.Invalid(response.FieldError{Field: "source", Issue: err.Error()}))
+			return
+		}
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to load expected topology"))
+			return
+		}
+
+		switch {
+		case req.Token == "":
+			response.JSON(c, http.StatusOK, "import preview", preview, nil)
+			return
+		case req.Token != preview.Token:
+			response.Fail(c, response.NewError(http.StatusPreconditionFailed, response.CodePreconditionFailed,
+				"the broker or the database changed since the preview; review the new preview and confirm it").
+				WithData(preview))
+			return
+		case preview.Empty():
+			response.JSON(c, http.StatusOK, "nothing to import", map[string]interface{}{
+				"imported": adoption.Counts{}, "preview": preview,
+			}, nil)
+			return
+		}
+
+		imported, err := adoption.Apply(repo, preview)
+		if err != nil {
+			response.Fail(c, changeError(err, ""))
+			return
+		}
+		response.JSON(c, http.StatusCreated, "imported", map[string]interface{}{
+			"imported": imported, "preview": preview,
+		}, nil)
+	}
+}
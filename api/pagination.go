@@ -0,0 +1,41 @@
+package api
+
+import (
+	"math"
+	"strconv"
+
+	"queue-manager/internal/response"
+)
+
+// Pagination defaults and limits shared by the paged endpoints
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 500
+)
+
+// parsePagination reads the page and pageSize query parameters, returning the defaults for
+// missing ones and a field error for each invalid one
+func parsePagination(query func(string) string) (page, pageSize int, errs []response.FieldError) {
+	page, pageSize = 1, DefaultPageSize
+	if v := query("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			errs = append(errs, response.FieldError{Field: "page", Issue: "must be a positive integer"})
+		} else {
+			page = n
+		}
+	}
+	if v := query("pageSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxPageSize {
+			errs = append(errs, response.FieldError{Field: "pageSize", Issue: "must be between 1 and " + strconv.Itoa(MaxPageSize)})
+		} else {
+			pageSize = n
+		}
+	}
+	// The offset of the page must fit in an int, or it overflows before reaching the query
+	if page > 1 && page-1 > math.MaxInt/pageSize {
+		errs = append(errs, response.FieldError{Field: "page", Issue: "is too large for the page size"})
+	}
+	return page, pageSize, errs
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestPageOf(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+	for _, tc := range []struct {
+		page, pageSize int
+		want           []int
+	}{
+		{1, 2, []int{1, 2}},
+		{3, 2, []int{5}},
+		{4, 2, []int{}},
+		{math.MaxInt, 100, []int{}},
+		{math.MaxInt / 2, 3, []int{}},
+	} {
+		if got := pageOf(items, tc.page, tc.pageSize); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("page %d of size %d: expected %v, got %v", tc.page, tc.pageSize, tc.want, got)
+		}
+	}
+	if got := pageOf([]int{}, 1, 10); len(got) != 0 {
+		t.Fatalf("expected an empty page, got %v", got)
+	}
+}
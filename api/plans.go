@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"queue-manager/internal/reconciliation"
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createPlan handles POST /sync/plans: computes and stores a plan without changing the provider
+func createPlan(rec *reconciliation.Reconciler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rec == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "queue provider not available"))
+			return
+		}
+
+		force := false
+		if forceStr := c.Query("force"); forceStr != "" {
+			var err error
+			force, err = strconv.ParseBool(forceStr)
+			if err != nil {
+				response.Fail(c, response.InvalidParameter("force", "must be a boolean value"))
+				return
+			}
+		}
+
+		plan, err := rec.Plan(runContext(c), force)
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeReconciliationError, err.Error()))
+			return
+		}
+
+		response.JSON(c, http.StatusCreated, "ok", planResponse(*plan), nil)
+	}
+}
+
+// getPlan handles GET /sync/plans/:id
+func getPlan(rec *reconciliation.Reconciler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rec == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "queue provider not available"))
+			return
+		}
+
+		plan, ok := rec.GetPlan(c.Param("id"))
+		if !ok {
+			response.Fail(c, response.NewError(http.StatusNotFound, response.CodePlanNotFound, "plan not found or expired"))
+			return
+		}
+
+		response.OK(c, planResponse(plan))
+	}
+}
+
+// applyPlan handles POST /sync/plans/:id/apply. The plan is only applied if the expected and
+// actual state still match the state it was computed from.
+func applyPlan(rec *reconciliation.Reconciler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rec == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "queue provider not available"))
+			return
+		}
+
+		result, err := rec.Apply(runContext(c), c.Param("id"), syncTrigger(c))
+		switch {
+		case errors.Is(err, reconciliation.ErrAlreadyRunning):
+			alreadyRunning(c, err)
+		case errors.Is(err, reconciliation.ErrPlanNotFound):
+			response.Fail(c, response.NewError(http.StatusNotFound, response.CodePlanNotFound, "plan not found or expired"))
+		case errors.Is(err, reconciliation.ErrPlanAlreadyApplied):
+			response.Fail(c, response.NewError(http.StatusConflict, response.CodePlanAlreadyApplied, err.Error()))
+		case invalidTopology(c, err):
+		case errors.Is(err, reconciliation.ErrPlanStale):
+			response.Fail(c, response.NewError(http.StatusConflict, response.CodePlanStale, err.Error()+"; create a new plan"))
+		case errors.Is(err, reconciliation.ErrPruningAborted):
+			response.Fail(c, response.NewError(http.StatusConflict, response.CodeReconciliationAborted, err.Error()).WithData(reconciliationResponse(result)))
+		case err != nil:
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeReconciliationError, err.Error()))
+		default:
+			response.OK(c, reconciliationResponse(result))
+		}
+	}
+}
+
+// planResponse formats a plan together with its action summary
+func planResponse(plan reconciliation.Plan) map[string]interface{} {
+	return map[string]interface{}{
+		"plan":    plan,
+		"summary": plan.Summary(),
+	}
+}
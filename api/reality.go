@@ -0,0 +1,210 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"queue-manager/internal/queue"
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Resource states reported by /reality
+const (
+	stateHealthy   = "healthy"
+	stateDegraded  = "degraded"  // the broker is throttling publishers (flow control)
+	stateUnhealthy = "unhealthy" // the queue is down, crashed or lost its quorum
+)
+
+// realityQueue is a live queue as specified in @apis/actual-state.md
+type realityQueue struct {
+	Name            string          `json:"name"`
+	Exists          bool            `json:"exists"`
+	State           string          `json:"state"`
+	BrokerState     string          `json:"brokerState,omitempty"`
+	Consumers       int             `json:"consumers"`
+	Messages        int             `json:"messages"`
+	MessagesReady   int             `json:"messagesReady"`
+	MessagesUnacked int             `json:"messagesUnacked"`
+	Properties      queueProperties `json:"properties"`
+}
+
+type queueProperties struct {
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Exclusive  bool                   `json:"exclusive"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+// realityExchange is a live exchange as specified in @apis/actual-state.md
+type realityExchange struct {
+	Name       string             `json:"name"`
+	Exists     bool               `json:"exists"`
+	State      string             `json:"state"`
+	Properties exchangeProperties `json:"properties"`
+}
+
+type exchangeProperties struct {
+	Type       string                 `json:"type,omitempty"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Internal   bool                   `json:"internal"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+// realityBinding is a live binding as specified in @apis/actual-state.md
+type realityBinding struct {
+	Exchange   string                 `json:"exchange"`
+	Queue      string                 `json:"queue"`
+	RoutingKey string                 `json:"routing_key"`
+	Exists     bool                   `json:"exists"`
+	State      string                 `json:"state"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+// getReality handles GET /reality and returns the live topology of the provider. Snapshots are
+// served from the cache for a few seconds (REALITY_CACHE_TTL); metadata.timestamp is the time
+// the snapshot was taken. Filters and pagination follow /expectation.
+func getReality(cache *queue.TopologyCache, qp queue.Provider) gin.HandlerFunc {
+	if cache == nil && qp != nil {
+		cache = queue.NewTopologyCache(qp, 0)
+	}
+	return func(c *gin.Context) {
+		if cache == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "queue provider not available"))
+			return
+		}
+
+		page, pageSize, errs := parsePagination(c.Query)
+		if len(errs) > 0 {
+			response.Fail(c, response.Invalid(errs...))
+			return
+		}
+
+		snapshot, err := cache.Get(c.Request.Context())
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusBadGateway, response.CodeProviderError, "failed to read provider state"))
+			return
+		}
+
+		queueFilter, exchangeFilter := c.Query("queue"), c.Query("exchange")
+		live := snapshot.Filter(queueFilter, exchangeFilter)
+		totals := map[string]int{
+			"queues":    len(live.Queues),
+			"exchanges": len(live.Exchanges),
+			"bindings":  len(live.Bindings),
+		}
+		data := map[string]interface{}{
+			"queues":    realityQueues(pageOf(live.Queues, page, pageSize)),
+			"exchanges": realityExchanges(pageOf(live.Exchanges, page, pageSize)),
+			"bindings":  realityBindings(pageOf(live.Bindings, page, pageSize)),
+		}
+
+		metadata := map[string]interface{}{
+			"page":      page,
+			"pageSize":  pageSize,
+			"total":     totals["queues"] + totals["exchanges"] + totals["bindings"],
+			"totals":    totals,
+			"timestamp": live.Timestamp.UTC().Format(time.RFC3339),
+		}
+		filters := map[string]string{}
+		if queueFilter != "" {
+			filters["queue"] = queueFilter
+		}
+		if exchangeFilter != "" {
+			filters["exchange"] = exchangeFilter
+		}
+		if len(filters) > 0 {
+			metadata["filters"] = filters
+		}
+		response.JSON(c, http.StatusOK, "ok", data, metadata)
+	}
+}
+
+// pageOf returns the given 1-based page of items. The bounds are checked before multiplying so
+// that a huge page cannot overflow the offset.
+func pageOf[T any](items []T, page, pageSize int) []T {
+	if len(items) == 0 || page-1 > (len(items)-1)/pageSize {
+		return []T{}
+	}
+	start := (page - 1) * pageSize
+	return items[start:min(start+pageSize, len(items))]
+}
+
+// queueState maps the broker's queue state to the states reported by the API
+func queueState(brokerState string) string {
+	switch brokerState {
+	case "", "running", "idle":
+		return stateHealthy
+	case "flow":
+		return stateDegraded
+	default:
+		return stateUnhealthy
+	}
+}
+
+func realityQueues(queues []queue.QueueInfo) []realityQueue {
+	out := make([]realityQueue, 0, len(queues))
+	for _, q := range queues {
+		out = append(out, realityQueue{
+			Name:            q.Name,
+			Exists:          true,
+			State:           queueState(q.State),
+			BrokerState:     q.State,
+			Consumers:       q.Consumers,
+			Messages:        q.Messages,
+			MessagesReady:   q.MessagesReady,
+			MessagesUnacked: q.MessagesUnacked,
+			Properties: queueProperties{
+				Durable:    q.Durable,
+				AutoDelete: q.AutoDelete,
+				Exclusive:  q.Exclusive,
+				Arguments:  nonNil(q.Arguments),
+			},
+		})
+	}
+	return out
+}
+
+func realityExchanges(exchanges []queue.ExchangeInfo) []realityExchange {
+	out := make([]realityExchange, 0, len(exchanges))
+	for _, x := range exchanges {
+		out = append(out, realityExchange{
+			Name:   x.Name,
+			Exists: true,
+			State:  stateHealthy,
+			Properties: exchangeProperties{
+				Type:       x.Type,
+				Durable:    x.Durable,
+				AutoDelete: x.AutoDelete,
+				Internal:   x.Internal,
+				Arguments:  nonNil(x.Arguments),
+			},
+		})
+	}
+	return out
+}
+
+func realityBindings(bindings []queue.BindingInfo) []realityBinding {
+	out := make([]realityBinding, 0, len(bindings))
+	for _, b := range bindings {
+		out = append(out, realityBinding{
+			Exchange:   b.Exchange,
+			Queue:      b.Queue,
+			RoutingKey: b.RoutingKey,
+			Exists:     true,
+			State:      stateHealthy,
+			Arguments:  nonNil(b.Arguments),
+		})
+	}
+	return out
+}
+
+// nonNil returns an empty map instead of nil, so arguments are always encoded as an object
+func nonNil(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return map[string]interface{}{}
+	}
+	return m
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+
+	"queue-manager/internal/queue"
+	"queue-manager/internal/reconciliation"
+	"queue-manager/internal/repository"
+	"queue-manager/internal/response"
+	"queue-manager/internal/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// simulateRequest is the body of POST /route/simulate
+type simulateRequest struct {
+	// Exchange is required; the empty string is the default exchange
+	Exchange   *string                `json:"exchange"`
+	RoutingKey string                 `json:"routing_key"`
+	Headers    map[string]interface{} `json:"headers"`
+	// Actual also simulates the message on the live topology of the provider
+	Actual bool `json:"actual"`
+}
+
+// simulatedDelivery is a queue the message reaches, with the services assigned to the queue
+type simulatedDelivery struct {
+	routing.Delivery
+	Services []string `json:"services"`
+}
+
+// simulation is the outcome of routing the message through one topology
+type simulation struct {
+	Routed     bool                `json:"routed"`
+	Deliveries []simulatedDelivery `json:"deliveries"`
+	Notes      []string            `json:"notes"`
+}
+
+// simulateRoute handles POST /route/simulate. The message is routed through the expected
+// topology and, with actual=true, through the live topology as well, so the two can be compared.
+// Each queue reached is listed with the path of exchanges and matching bindings leading to it and
+// the services assigned to it.
+func simulateRoute(repo *repository.Repository, rec *reconciliation.Reconciler, cache *queue.TopologyCache, qp queue.Provider) gin.HandlerFunc {
+	if cache == nil && qp != nil {
+		cache = queue.NewTopologyCache(qp, 0)
+	}
+	return func(c *gin.Context) {
+		var req simulateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, response.Invalid(response.FieldError{Field: "body", Issue: "must be a JSON object"}))
+			return
+		}
+		if req.Exchange == nil {
+			response.Fail(c, response.Invalid(response.FieldError{Field: "exchange", Issue: `is required; use "" for the default exchange`}))
+			return
+		}
+		msg := routing.Message{Exchange: *req.Exchange, RoutingKey: req.RoutingKey, Headers: req.Headers}
+
+		src := expectedSource(repo, rec)
+		if src == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
+			return
+		}
+		if req.Actual && cache == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "queue provider not available"))
+			return
+		}
+
+		defs, err := src.Load(c.Request.Context())
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to load expected topology"))
+			return
+		}
+		services := map[string][]string{}
+		for _, a := range defs.Assignments {
+			services[a.QueueName] = append(services[a.QueueName], a.ServiceName)
+		}
+
+		data := map[string]interface{}{
+			"message":  msg,
+			"expected": simulated(routing.Simulate(defs.Detailed(), msg), services),
+		}
+		if req.Actual {
+			live, err := cache.Get(c.Request.Context())
+			if err != nil {
+				response.Fail(c, response.NewError(http.StatusBadGateway, response.CodeProviderError, "failed to read provider state"))
+				return
+			}
+			if !live.Detailed {
+				response.Fail(c, response.Invalid(response.FieldError{Field: "actual", Issue: "the provider does not report exchange types and binding arguments"}))
+				return
+			}
+			data["actual"] = simulated(routing.Simulate(live, msg), services)
+		}
+		response.OK(c, data)
+	}
+}
+
+// simulated adds the services assigned to each queue to a simulation result
+func simulated(r routing.Result, services map[string][]string) simulation {
+	out := simulation{Routed: r.Routed, Deliveries: make([]simulatedDelivery, len(r.Deliveries)), Notes: r.Notes}
+	for i, d := range r.Deliveries {
+		out.Deliveries[i] = simulatedDelivery{Delivery: d, Services: services[d.Queue]}
+		if out.Deliveries[i].Services == nil {
+			out.Deliveries[i].Services = []string{}
+		}
+	}
+	return out
+}
@@ -1,27 +1,24 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strconv"
 
+	appcron "queue-manager/internal/cron"
+	"queue-manager/internal/leader"
+	"queue-manager/internal/middleware"
 	"queue-manager/internal/queue"
+	"queue-manager/internal/readiness"
 	"queue-manager/internal/reconciliation"
 	"queue-manager/internal/repository"
+	"queue-manager/internal/response"
 
 	"github.com/gin-gonic/gin"
 )
 
-type APIResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   *APIError   `json:"error,omitempty"`
-}
-
-type APIError struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-}
-
 // QueueDetailResponse represents a queue with its assignment details for API responses
 type QueueDetailResponse struct {
 	QueueName     string                 `json:"queue_name"`
@@ -36,50 +33,88 @@ type QueueDetailResponse struct {
 	Meta          map[string]interface{} `json:"meta"`
 }
 
-func RegisterRoutes(r *gin.Engine, repo *repository.Repository, qp queue.Provider) {
+// Dependencies groups the collaborators the HTTP handlers need. Any of them may be nil
+// when the corresponding integration is not configured.
+type Dependencies struct {
+	Repo       *repository.Repository
+	Provider   queue.Provider
+	Reconciler *reconciliation.Reconciler
+	// Leader is nil when leader election is disabled
+	Leader    *leader.Elector
+	Scheduler *appcron.Scheduler
+	// LiveTopology serves /reality and /details; when nil, the provider is read on every request
+	LiveTopology *queue.TopologyCache
+	// Readiness backs /ready; nil reports ready without checking anything
+	Readiness *readiness.Tracker
+	// Logger is used for request logs; nil means the default logger
+	Logger *slog.Logger
+	// APITokens are the bearer tokens accepted by the write API; without tokens it rejects writes
+	APITokens []string
+}
+
+func RegisterRoutes(r *gin.Engine, deps Dependencies) {
 	r.GET("/healthz", func(c *gin.Context) {
-		c.JSON(http.StatusOK, APIResponse{Success: true, Data: map[string]string{"status": "ok"}})
+		response.OK(c, map[string]interface{}{
+			"status":     "ok",
+			"leadership": deps.Leader.Status(),
+		})
 	})
 
-	r.GET("/services/:service_name/queues", getServiceQueues(repo))
-	r.POST("/sync", syncTopology(repo, qp))
+	r.GET("/services/:service_name/queues", getServiceQueues(deps.Repo))
+	r.GET("/expectation", getExpectation(deps.Repo))
+	r.GET("/reality", getReality(deps.LiveTopology, deps.Provider))
+	r.GET("/details", getDetails(deps.Repo, deps.LiveTopology, deps.Provider))
+	r.GET("/export", exportDefinitions(deps.Repo))
+	r.POST("/validate", validateTopology(deps.Repo, deps.Reconciler))
+	r.POST("/route/simulate", simulateRoute(deps.Repo, deps.Reconciler, deps.LiveTopology, deps.Provider))
+	r.GET("/topology/graph", getTopologyGraph(deps.Repo, deps.Reconciler, deps.LiveTopology, deps.Provider))
+	r.POST("/sync", requireLeader(deps.Leader), syncTopology(deps.Repo, deps.Provider, deps.Reconciler))
+	auth := middleware.RequireToken(deps.APITokens)
+	r.POST("/sync/plans", auth, requireLeader(deps.Leader), createPlan(deps.Reconciler))
+	r.GET("/sync/plans/:id", getPlan(deps.Reconciler))
+	r.POST("/sync/plans/:id/apply", auth, requireLeader(deps.Leader), applyPlan(deps.Reconciler))
+	r.GET("/sync/runs", listRuns(deps.Repo))
+	r.GET("/sync/runs/:id", getRun(deps.Repo))
+	r.GET("/webhooks/deliveries", listWebhookDeliveries(deps.Repo))
+	registerTopologyRoutes(r, deps)
+
+	r.GET("/scheduler/jobs", listJobs(deps.Scheduler))
+	r.POST("/scheduler/jobs/:name/pause", auth, pauseJob(deps.Scheduler, true))
+	r.POST("/scheduler/jobs/:name/resume", auth, pauseJob(deps.Scheduler, false))
+}
+
+// requireLeader refuses reconciliation requests on followers, so only the leader mutates the
+// provider. Plans are stored in memory by the instance that created them, so planning is
+// restricted to the leader as well.
+func requireLeader(e *leader.Elector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if e.IsLeader() {
+			c.Next()
+			return
+		}
+		response.Abort(c, response.NewError(http.StatusServiceUnavailable, response.CodeNotLeader,
+			"this instance is not the leader; send reconciliation requests to the leader").
+			WithData(map[string]interface{}{"leadership": e.Status()}))
+	}
 }
 
 // getServiceQueues returns all queues assigned to a service
 func getServiceQueues(repo *repository.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if repo == nil {
-			c.JSON(http.StatusServiceUnavailable, APIResponse{
-				Success: false,
-				Error: &APIError{
-					Code:    "SERVICE_UNAVAILABLE",
-					Message: "Database connection not available",
-				},
-			})
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
 			return
 		}
 
 		serviceName := c.Param("service_name")
 		if serviceName == "" {
-			c.JSON(http.StatusBadRequest, APIResponse{
-				Success: false,
-				Error: &APIError{
-					Code:    "INVALID_PARAMETER",
-					Message: "service_name parameter is required",
-				},
-			})
+			response.Fail(c, response.InvalidParameter("service_name", "is required"))
 			return
 		}
 
-		queues, err := repo.GetQueuesByServiceName(serviceName)
+		queues, err := repo.WithContext(c.Request.Context()).GetQueuesByServiceName(serviceName)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, APIResponse{
-				Success: false,
-				Error: &APIError{
-					Code:    "DATABASE_ERROR",
-					Message: "Failed to retrieve queues for service",
-				},
-			})
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to retrieve queues for service"))
 			return
 		}
 
@@ -100,35 +135,20 @@ func getServiceQueues(repo *repository.Repository) gin.HandlerFunc {
 			}
 		}
 
-		c.JSON(http.StatusOK, APIResponse{
-			Success: true,
-			Data:    queueDetails,
-		})
+		response.OK(c, queueDetails)
 	}
 }
 
 // syncTopology handles the POST /sync endpoint for manual synchronization
-func syncTopology(repo *repository.Repository, qp queue.Provider) gin.HandlerFunc {
+func syncTopology(repo *repository.Repository, qp queue.Provider, rec *reconciliation.Reconciler) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if qp == nil {
-			c.JSON(http.StatusServiceUnavailable, APIResponse{
-				Success: false,
-				Error: &APIError{
-					Code:    "SERVICE_UNAVAILABLE",
-					Message: "Queue provider not available",
-				},
-			})
+		if qp == nil || rec == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "queue provider not available"))
 			return
 		}
 
 		if repo == nil {
-			c.JSON(http.StatusServiceUnavailable, APIResponse{
-				Success: false,
-				Error: &APIError{
-					Code:    "SERVICE_UNAVAILABLE",
-					Message: "Database connection not available",
-				},
-			})
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
 			return
 		}
 
@@ -138,56 +158,104 @@ func syncTopology(repo *repository.Repository, qp queue.Provider) gin.HandlerFun
 			var err error
 			dryRun, err = strconv.ParseBool(dryRunStr)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, APIResponse{
-					Success: false,
-					Error: &APIError{
-						Code:    "INVALID_PARAMETER",
-						Message: "dryRun must be a boolean value",
-					},
-				})
+				response.Fail(c, response.InvalidParameter("dryRun", "must be a boolean value"))
 				return
 			}
 		}
 
-		// Perform reconciliation
-		result, err := reconciliation.ReconcileTopology(qp, repo, dryRun)
+		// Parse force query parameter (deletes unexpected queues even if they are in use)
+		force := false
+		if forceStr := c.Query("force"); forceStr != "" {
+			var err error
+			force, err = strconv.ParseBool(forceStr)
+			if err != nil {
+				response.Fail(c, response.InvalidParameter("force", "must be a boolean value"))
+				return
+			}
+		}
+
+		// Perform reconciliation, unless another run is changing the provider
+		result, err := rec.TryReconcile(runContext(c), reconciliation.Request{
+			DryRun:  dryRun,
+			Force:   force,
+			Trigger: syncTrigger(c),
+		})
+		if errors.Is(err, reconciliation.ErrAlreadyRunning) {
+			alreadyRunning(c, err)
+			return
+		}
+		if invalidTopology(c, err) {
+			return
+		}
+		if err != nil && !errors.Is(err, reconciliation.ErrPruningAborted) {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeReconciliationError, err.Error()))
+			return
+		}
+
+		responseData := reconciliationResponse(result)
+
+		// A guard held back deletions: report the actions taken but surface a distinct error state
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, APIResponse{
-				Success: false,
-				Error: &APIError{
-					Code:    "RECONCILIATION_ERROR",
-					Message: err.Error(),
-				},
-			})
+			response.Fail(c, response.NewError(http.StatusConflict, response.CodeReconciliationAborted, err.Error()).WithData(responseData))
 			return
 		}
 
-		// Format response according to API spec
-		responseData := map[string]interface{}{
-			"actions": map[string]interface{}{
-				"toCreate": map[string]interface{}{
-					"exchanges": result.CreatedExchanges,
-					"queues":    result.CreatedQueues,
-					"bindings":  result.CreatedBindings,
-				},
-				"toDelete": map[string]interface{}{
-					"exchanges": result.DeletedExchanges,
-					"queues":    result.DeletedQueues,
-					"bindings":  result.DeletedBindings,
-				},
+		response.OK(c, responseData)
+	}
+}
+
+// reconciliationResponse formats a reconciliation result according to the API spec. Dry runs
+// include the ID of the stored plan, which can be applied via POST /sync/plans/:id/apply, and
+// every run includes its ID in the run history (GET /sync/runs/:id).
+func reconciliationResponse(result *reconciliation.ReconciliationResult) map[string]interface{} {
+	data := map[string]interface{}{
+		"actions": map[string]interface{}{
+			"toCreate": map[string]interface{}{
+				"exchanges": result.CreatedExchanges,
+				"queues":    result.CreatedQueues,
+				"bindings":  result.CreatedBindings,
 			},
-		}
+			"toDelete": map[string]interface{}{
+				"exchanges": result.DeletedExchanges,
+				"queues":    result.DeletedQueues,
+				"bindings":  result.DeletedBindings,
+			},
+			"pendingDeletion":   result.PendingDeletions,
+			"scheduledDeletion": result.ScheduledDeletions,
+		},
+	}
+	if result.PlanID != "" {
+		data["planId"] = result.PlanID
+	}
+	if result.RunID != "" {
+		data["runId"] = result.RunID
+	}
+	if len(result.Findings) > 0 {
+		data["findings"] = result.Findings
+	}
+	return data
+}
 
-		response := APIResponse{
-			Success: true,
-			Data:    responseData,
-		}
+// syncTrigger identifies a reconciliation started through the API, for the run history
+func syncTrigger(c *gin.Context) reconciliation.Trigger {
+	return reconciliation.Trigger{
+		Source:    reconciliation.TriggerSync,
+		RequestID: c.GetString("request_id"),
+	}
+}
 
-		if dryRun {
-			c.JSON(http.StatusOK, response)
-		} else {
-			// For actual sync, return 200 OK with results
-			c.JSON(http.StatusOK, response)
-		}
+// runContext returns the context for a reconciliation started by the request: it carries the
+// request's trace but is not cancelled when the client goes away, so a run is never cut short
+func runContext(c *gin.Context) context.Context {
+	return context.WithoutCancel(c.Request.Context())
+}
+
+// alreadyRunning responds 409 with the run that is in progress
+func alreadyRunning(c *gin.Context, err error) {
+	var running *reconciliation.AlreadyRunningError
+	var data interface{}
+	if errors.As(err, &running) {
+		data = running.Running
 	}
+	response.Fail(c, response.NewError(http.StatusConflict, response.CodeAlreadyRunning, err.Error()).WithData(data))
 }
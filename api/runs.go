@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"queue-manager/internal/models"
+	"queue-manager/internal/repository"
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// listRuns handles GET /sync/runs. Supported filters: resource (name of an exchange, queue or
+// binding touched by the run), trigger, since and until (RFC3339, on the run start time) and limit.
+func listRuns(repo *repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if repo == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
+			return
+		}
+
+		filter := repository.RunFilter{
+			Resource: c.Query("resource"),
+			Trigger:  c.Query("trigger"),
+		}
+		for param, dst := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+			if v := c.Query(param); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					response.Fail(c, response.InvalidParameter(param, "must be an RFC3339 timestamp"))
+					return
+				}
+				*dst = &t
+			}
+		}
+		if v := c.Query("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > 500 {
+				response.Fail(c, response.InvalidParameter("limit", "must be between 1 and 500"))
+				return
+			}
+			filter.Limit = limit
+		}
+
+		runs, err := repo.WithContext(c.Request.Context()).ListReconciliationRuns(filter)
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to retrieve reconciliation runs"))
+			return
+		}
+
+		response.OK(c, runs)
+	}
+}
+
+// getRun handles GET /sync/runs/:id and returns the run with all of its actions
+func getRun(repo *repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if repo == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
+			return
+		}
+
+		id := c.Param("id")
+		var run *models.ReconciliationRun
+		var actions []models.ReconciliationAction
+		var err error
+		// Run IDs are UUIDs; anything else cannot exist
+		if _, parseErr := uuid.Parse(id); parseErr == nil {
+			run, actions, err = repo.WithContext(c.Request.Context()).GetReconciliationRun(id)
+		}
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to retrieve reconciliation run"))
+			return
+		}
+		if run == nil {
+			response.Fail(c, response.NewError(http.StatusNotFound, response.CodeRunNotFound, "reconciliation run not found"))
+			return
+		}
+
+		response.OK(c, map[string]interface{}{
+			"run":     run,
+			"actions": actions,
+		})
+	}
+}
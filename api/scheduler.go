@@ -0,0 +1,50 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	appcron "queue-manager/internal/cron"
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listJobs handles GET /scheduler/jobs
+func listJobs(s *appcron.Scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s == nil {
+			schedulerUnavailable(c)
+			return
+		}
+		response.OK(c, s.Jobs())
+	}
+}
+
+// pauseJob handles POST /scheduler/jobs/:name/pause and /resume
+func pauseJob(s *appcron.Scheduler, pause bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s == nil {
+			schedulerUnavailable(c)
+			return
+		}
+
+		var status appcron.JobStatus
+		var err error
+		if pause {
+			status, err = s.Pause(c.Param("name"))
+		} else {
+			status, err = s.Resume(c.Param("name"))
+		}
+		if errors.Is(err, appcron.ErrJobNotFound) {
+			response.Fail(c, response.NewError(http.StatusNotFound, response.CodeJobNotFound, "job not found"))
+			return
+		}
+
+		response.OK(c, status)
+	}
+}
+
+func schedulerUnavailable(c *gin.Context) {
+	response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "scheduler not running"))
+}
@@ -0,0 +1,696 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"queue-manager/internal/leader"
+	"queue-manager/internal/middleware"
+	"queue-manager/internal/models"
+	"queue-manager/internal/reconciliation"
+	"queue-manager/internal/repository"
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Resource kinds and operations of the write API
+const (
+	kindQueue      = "queue"
+	kindExchange   = "exchange"
+	kindBinding    = "binding"
+	kindAssignment = "assignment"
+
+	opCreate = "create"
+	opUpdate = "update"
+	opDelete = "delete"
+)
+
+// MaxChanges is the largest number of changes accepted by POST /topology/changes
+const MaxChanges = 100
+
+// maxNameLength is the AMQP limit for exchange and queue names and routing keys
+const maxNameLength = 255
+
+// topologyChange is one write to the expected topology, as sent to POST /topology/changes
+type topologyChange struct {
+	Op   string `json:"op"`
+	Kind string `json:"kind"`
+	// Key identifies the resource to update or delete: the queue or exchange name, or the
+	// binding or assignment ID
+	Key string `json:"key"`
+	// UpdatedAt is the updated_at the client read; updates and deletes are refused if the
+	// resource changed since
+	UpdatedAt *time.Time      `json:"updated_at"`
+	Data      json.RawMessage `json:"data"`
+
+	// unconditional skips the updated_at check (If-Match: *)
+	unconditional bool
+}
+
+// changeResult is the outcome of one change
+type changeResult struct {
+	Op       string      `json:"op"`
+	Kind     string      `json:"kind"`
+	Key      string      `json:"key"`
+	ETag     string      `json:"etag"`
+	Resource interface{} `json:"resource"`
+
+	scope reconciliation.Scope
+}
+
+// preparedChange is a validated change, ready to be applied in a transaction
+type preparedChange struct {
+	topologyChange
+	apply func(tx *repository.Tx, since time.Time) (changeResult, error)
+}
+
+type queueInput struct {
+	QueueName   string       `json:"queue_name"`
+	Durable     *bool        `json:"durable"`
+	AutoDelete  bool         `json:"auto_delete"`
+	Arguments   models.JSONB `json:"arguments"`
+	Description string       `json:"description"`
+	Meta        models.JSONB `json:"meta"`
+}
+
+type exchangeInput struct {
+	ExchangeName string       `json:"exchange_name"`
+	ExchangeType string       `json:"exchange_type"`
+	Durable      *bool        `json:"durable"`
+	AutoDelete   bool         `json:"auto_delete"`
+	Internal     bool         `json:"internal"`
+	Arguments    models.JSONB `json:"arguments"`
+	Description  string       `json:"description"`
+	Meta         models.JSONB `json:"meta"`
+}
+
+type bindingInput struct {
+	ExchangeName string       `json:"exchange_name"`
+	QueueName    string       `json:"queue_name"`
+	RoutingKey   *string      `json:"routing_key"`
+	Arguments    models.JSONB `json:"arguments"`
+	Mandatory    bool         `json:"mandatory"`
+	Meta         models.JSONB `json:"meta"`
+}
+
+type assignmentInput struct {
+	ServiceName   string       `json:"service_name"`
+	QueueName     string       `json:"queue_name"`
+	PrefetchCount *int         `json:"prefetch_count"`
+	MaxInflight   *int         `json:"max_inflight"`
+	Notes         string       `json:"notes"`
+	Meta          models.JSONB `json:"meta"`
+}
+
+// fieldErrors collects validation errors
+type fieldErrors []response.FieldError
+
+func (e *fieldErrors) add(field, issue string) {
+	*e = append(*e, response.FieldError{Field: field, Issue: issue})
+}
+
+// name checks an exchange or queue name. Names starting with "amq." are reserved by RabbitMQ.
+func (e *fieldErrors) name(field, name string) {
+	switch {
+	case name == "":
+		e.add(field, "is required")
+	case len(name) > maxNameLength:
+		e.add(field, fmt.Sprintf("must be at most %d bytes", maxNameLength))
+	case strings.HasPrefix(name, "amq."):
+		e.add(field, `must not start with "amq.", which is reserved by the broker`)
+	}
+}
+
+// reference checks the name of an exchange or queue a binding or assignment refers to
+func (e *fieldErrors) reference(field, name string) {
+	switch {
+	case name == "":
+		e.add(field, "is required")
+	case len(name) > maxNameLength:
+		e.add(field, fmt.Sprintf("must be at most %d bytes", maxNameLength))
+	}
+}
+
+// identity checks that an update does not rename the resource
+func (e *fieldErrors) identity(op, field, value, current string) {
+	if op == opUpdate && value != "" && value != current {
+		e.add(field, "cannot be changed")
+	}
+}
+
+// prepareChange validates a change. Field errors refer to the change ("op", "kind", "key",
+// "updated_at") or to its data ("data.queue_name").
+func prepareChange(ch topologyChange) (preparedChange, fieldErrors) {
+	p := preparedChange{topologyChange: ch}
+	var errs fieldErrors
+
+	switch ch.Op {
+	case opCreate:
+	case opUpdate, opDelete:
+		if ch.Key == "" {
+			errs.add("key", "is required")
+		} else if ch.Kind == kindBinding || ch.Kind == kindAssignment {
+			if _, err := uuid.Parse(ch.Key); err != nil {
+				errs.add("key", "must be a UUID")
+			}
+		}
+		if ch.UpdatedAt == nil && !ch.unconditional {
+			errs.add("updated_at", "is required for updates and deletes")
+		}
+	default:
+		errs.add("op", "must be create, update or delete")
+	}
+
+	decode := func(v interface{}) {
+		if ch.Op == opDelete {
+			return
+		}
+		if len(ch.Data) == 0 || string(ch.Data) == "null" {
+			errs.add("data", "is required")
+			return
+		}
+		if err := json.Unmarshal(ch.Data, v); err != nil {
+			errs.add("data", "must be a JSON object with valid field types")
+		}
+	}
+
+	switch ch.Kind {
+	case kindQueue:
+		var in queueInput
+		decode(&in)
+		if ch.Op == opCreate {
+			errs.name("data.queue_name", in.QueueName)
+			p.Key = in.QueueName
+		}
+		errs.identity(ch.Op, "data.queue_name", in.QueueName, ch.Key)
+		q := models.Queue{
+			QueueName: p.Key, Durable: in.Durable == nil || *in.Durable, AutoDelete: in.AutoDelete,
+			Arguments: in.Arguments, Description: in.Description, Meta: in.Meta,
+		}
+		p.apply = func(tx *repository.Tx, since time.Time) (changeResult, error) {
+			var err error
+			switch ch.Op {
+			case opCreate:
+				q, err = tx.CreateQueue(q)
+			case opUpdate:
+				q, err = tx.UpdateQueue(q, since)
+			case opDelete:
+				q, err = tx.DeleteQueue(p.Key, since)
+			}
+			return changeResult{Key: q.QueueName, ETag: etag(q.UpdatedAt), Resource: q,
+				scope: reconciliation.Scope{Queues: []string{q.QueueName}}}, err
+		}
+
+	case kindExchange:
+		var in exchangeInput
+		decode(&in)
+		if ch.Op == opCreate {
+			errs.name("data.exchange_name", in.ExchangeName)
+			p.Key = in.ExchangeName
+		}
+		errs.identity(ch.Op, "data.exchange_name", in.ExchangeName, ch.Key)
+		if ch.Op != opDelete {
+			switch in.ExchangeType {
+			case "direct", "topic", "fanout", "headers":
+			default:
+				errs.add("data.exchange_type", "must be direct, topic, fanout or headers")
+			}
+		}
+		x := models.Exchange{
+			ExchangeName: p.Key, ExchangeType: in.ExchangeType, Durable: in.Durable == nil || *in.Durable,
+			AutoDelete: in.AutoDelete, Internal: in.Internal, Arguments: in.Arguments,
+			Description: in.Description, Meta: in.Meta,
+		}
+		p.apply = func(tx *repository.Tx, since time.Time) (changeResult, error) {
+			var err error
+			switch ch.Op {
+			case opCreate:
+				x, err = tx.CreateExchange(x)
+			case opUpdate:
+				x, err = tx.UpdateExchange(x, since)
+			case opDelete:
+				x, err = tx.DeleteExchange(p.Key, since)
+			}
+			return changeResult{Key: x.ExchangeName, ETag: etag(x.UpdatedAt), Resource: x,
+				scope: reconciliation.Scope{Exchanges: []string{x.ExchangeName}}}, err
+		}
+
+	case kindBinding:
+		var in bindingInput
+		decode(&in)
+		if ch.Op == opCreate {
+			errs.reference("data.exchange_name", in.ExchangeName)
+			errs.reference("data.queue_name", in.QueueName)
+			if in.RoutingKey == nil {
+				errs.add("data.routing_key", "is required; use an empty string for none")
+			} else if len(*in.RoutingKey) > maxNameLength {
+				errs.add("data.routing_key", fmt.Sprintf("must be at most %d bytes", maxNameLength))
+			}
+		} else if ch.Op == opUpdate && (in.ExchangeName != "" || in.QueueName != "" || in.RoutingKey != nil) {
+			// The exchange, queue and routing key identify the binding
+			errs.add("data", "exchange_name, queue_name and routing_key cannot be changed; delete and create the binding instead")
+		}
+		b := models.Binding{
+			UUID: ch.Key, ExchangeName: in.ExchangeName, QueueName: in.QueueName,
+			Arguments: in.Arguments, Mandatory: in.Mandatory, Meta: in.Meta,
+		}
+		if in.RoutingKey != nil {
+			b.RoutingKey = *in.RoutingKey
+		}
+		p.apply = func(tx *repository.Tx, since time.Time) (changeResult, error) {
+			var err error
+			switch ch.Op {
+			case opCreate:
+				b, err = tx.CreateBinding(b)
+			case opUpdate:
+				b, err = tx.UpdateBinding(b, since)
+			case opDelete:
+				b, err = tx.DeleteBinding(p.Key, since)
+			}
+			return changeResult{Key: b.UUID, ETag: etag(b.UpdatedAt), Resource: b,
+				scope: reconciliation.Scope{Exchanges: []string{b.ExchangeName}, Queues: []string{b.QueueName}}}, err
+		}
+
+	case kindAssignment:
+		var in assignmentInput
+		decode(&in)
+		if ch.Op == opCreate {
+			if in.ServiceName == "" {
+				errs.add("data.service_name", "is required")
+			}
+			errs.reference("data.queue_name", in.QueueName)
+		} else if ch.Op == opUpdate && (in.ServiceName != "" || in.QueueName != "") {
+			errs.add("data", "service_name and queue_name cannot be changed; delete and create the assignment instead")
+		}
+		// Defaults of the service_assignments table
+		a := models.ServiceAssignment{
+			UUID: ch.Key, ServiceName: in.ServiceName, QueueName: in.QueueName,
+			PrefetchCount: 10, MaxInflight: 100, Notes: in.Notes, Meta: in.Meta,
+		}
+		if in.PrefetchCount != nil {
+			a.PrefetchCount = *in.PrefetchCount
+		}
+		if in.MaxInflight != nil {
+			a.MaxInflight = *in.MaxInflight
+		}
+		if a.PrefetchCount < 0 {
+			errs.add("data.prefetch_count", "must not be negative")
+		}
+		if a.MaxInflight < 0 {
+			errs.add("data.max_inflight", "must not be negative")
+		}
+		p.apply = func(tx *repository.Tx, since time.Time) (changeResult, error) {
+			var err error
+			switch ch.Op {
+			case opCreate:
+				a, err = tx.CreateServiceAssignment(a)
+			case opUpdate:
+				a, err = tx.UpdateServiceAssignment(a, since)
+			case opDelete:
+				a, err = tx.DeleteServiceAssignment(p.Key, since)
+			}
+			return changeResult{Key: a.UUID, ETag: etag(a.UpdatedAt), Resource: a,
+				scope: reconciliation.Scope{Queues: []string{a.QueueName}}}, err
+		}
+
+	default:
+		errs.add("kind", "must be queue, exchange, binding or assignment")
+	}
+
+	return p, errs
+}
+
+// applyChanges applies the changes in one transaction: either all of them are stored or none is.
+// The index of the change that failed is returned with the error.
+func applyChanges(repo *repository.Repository, changes []preparedChange) ([]changeResult, int, error) {
+	results := make([]changeResult, 0, len(changes))
+	failed := -1
+	err := repo.InTx(func(tx *repository.Tx) error {
+		for i, ch := range changes {
+			var since time.Time
+			if ch.UpdatedAt != nil && !ch.unconditional {
+				since = *ch.UpdatedAt
+			}
+			result, err := ch.apply(tx, since)
+			if err != nil {
+				failed = i
+				return err
+			}
+			result.Op, result.Kind = ch.Op, ch.Kind
+			results = append(results, result)
+		}
+		return nil
+	})
+	return results, failed, err
+}
+
+// changeError maps a repository error to a response. field prefixes the field of a reference
+// error, e.g. "changes[2].data.".
+func changeError(err error, field string) *response.Error {
+	var ref *repository.ReferenceError
+	switch {
+	case errors.As(err, &ref):
+		return response.Invalid(response.FieldError{Field: field + ref.Kind + "_name", Issue: ref.Error()})
+	case errors.Is(err, repository.ErrNotFound):
+		return response.NewError(http.StatusNotFound, response.CodeResourceNotFound, err.Error())
+	case errors.Is(err, repository.ErrAlreadyExists):
+		return response.NewError(http.StatusConflict, response.CodeAlreadyExists, err.Error())
+	case errors.Is(err, repository.ErrStale):
+		return response.NewError(http.StatusPreconditionFailed, response.CodePreconditionFailed,
+			err.Error()+"; read it again and retry")
+	case errors.Is(err, repository.ErrInUse):
+		return response.NewError(http.StatusConflict, response.CodeResourceInUse, err.Error())
+	default:
+		return response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to write topology changes")
+	}
+}
+
+// registerTopologyRoutes registers the write API and the import. Reads are public like the rest
+// of the API; writes require one of the API tokens.
+func registerTopologyRoutes(r *gin.Engine, deps Dependencies) {
+	h := writeHandler{repo: deps.Repo, rec: deps.Reconciler, leader: deps.Leader}
+	auth := middleware.RequireToken(deps.APITokens)
+	for _, res := range []struct{ path, kind, keyField string }{
+		{"queues", kindQueue, "name"},
+		{"exchanges", kindExchange, "name"},
+		{"bindings", kindBinding, "id"},
+		{"assignments", kindAssignment, "id"},
+	} {
+		r.POST("/topology/"+res.path, auth, h.create(res.kind))
+		r.GET("/topology/"+res.path+"/:key", h.get(res.kind))
+		r.PUT("/topology/"+res.path+"/:key", auth, h.update(res.kind, res.keyField))
+		r.DELETE("/topology/"+res.path+"/:key", auth, h.remove(res.kind, res.keyField))
+	}
+	r.POST("/topology/changes", auth, h.changes)
+	r.POST("/import", auth, importTopology(deps.Repo, deps.Provider))
+}
+
+// writeHandler serves the write API
+type writeHandler struct {
+	repo   *repository.Repository
+	rec    *reconciliation.Reconciler
+	leader *leader.Elector
+}
+
+// available fails the request when there is no database
+func (h writeHandler) available(c *gin.Context) bool {
+	if h.repo == nil {
+		response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
+		return false
+	}
+	return true
+}
+
+// reconcileRequested reads the reconcile query parameter
+func reconcileRequested(c *gin.Context) (bool, bool) {
+	v := c.Query("reconcile")
+	if v == "" {
+		return false, true
+	}
+	reconcile, err := strconv.ParseBool(v)
+	if err != nil {
+		response.Fail(c, response.InvalidParameter("reconcile", "must be a boolean value"))
+		return false, false
+	}
+	return reconcile, true
+}
+
+// reconcile runs a reconciliation limited to the changed resources and describes its outcome.
+// The changes are already committed, so a run that cannot start or fails is only reported.
+func (h writeHandler) reconcile(c *gin.Context, results []changeResult) map[string]interface{} {
+	if h.rec == nil {
+		return map[string]interface{}{"skipped": "queue provider not available"}
+	}
+	if !h.leader.IsLeader() {
+		return map[string]interface{}{"skipped": "this instance is not the leader; the leader reconciles the change on its next run"}
+	}
+
+	scope := &reconciliation.Scope{}
+	for _, r := range results {
+		scope.Merge(r.scope)
+	}
+	result, err := h.rec.TryReconcile(runContext(c), reconciliation.Request{
+		Scope:   scope,
+		Trigger: reconciliation.Trigger{Source: reconciliation.TriggerWrite, RequestID: c.GetString(response.RequestIDKey)},
+	})
+	if errors.Is(err, reconciliation.ErrAlreadyRunning) {
+		return map[string]interface{}{"skipped": err.Error()}
+	}
+	if err != nil && !errors.Is(err, reconciliation.ErrPruningAborted) {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	data := reconciliationResponse(result)
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	return data
+}
+
+// write validates and applies changes sent to a single-resource endpoint and responds with the
+// resource. Field errors are reported without the "data." prefix, and key errors as keyField.
+func (h writeHandler) write(c *gin.Context, ch topologyChange, keyField string) {
+	reconcile, ok := reconcileRequested(c)
+	if !ok {
+		return
+	}
+
+	p, errs := prepareChange(ch)
+	if len(errs) > 0 {
+		for i := range errs {
+			errs[i].Field = strings.TrimPrefix(errs[i].Field, "data.")
+			if errs[i].Field == "key" {
+				errs[i].Field = keyField
+			}
+		}
+		response.Fail(c, response.Invalid(errs...))
+		return
+	}
+
+	results, _, err := applyChanges(h.repo.WithContext(c.Request.Context()), []preparedChange{p})
+	if err != nil {
+		response.Fail(c, changeError(err, ""))
+		return
+	}
+
+	var metadata map[string]interface{}
+	if reconcile {
+		metadata = map[string]interface{}{"reconciliation": h.reconcile(c, results)}
+	}
+	status := http.StatusOK
+	if ch.Op == opCreate {
+		status = http.StatusCreated
+	}
+	c.Header("ETag", results[0].ETag)
+	response.JSON(c, status, ch.Op+"d", results[0].Resource, metadata)
+}
+
+// create handles POST /topology/{queues,exchanges,bindings,assignments}
+func (h writeHandler) create(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.available(c) {
+			return
+		}
+		body, ok := readBody(c)
+		if !ok {
+			return
+		}
+		h.write(c, topologyChange{Op: opCreate, Kind: kind, Data: body}, "")
+	}
+}
+
+// update handles PUT /topology/<kind>/:key. The client passes the ETag it read in If-Match, or
+// the updated_at it read in the body; If-Match: * updates unconditionally.
+func (h writeHandler) update(kind, keyField string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.available(c) {
+			return
+		}
+		body, ok := readBody(c)
+		if !ok {
+			return
+		}
+		ch := topologyChange{Op: opUpdate, Kind: kind, Key: c.Param("key"), Data: body}
+		var read struct {
+			UpdatedAt *time.Time `json:"updated_at"`
+		}
+		_ = json.Unmarshal(body, &read)
+		ch.UpdatedAt = read.UpdatedAt
+		if !precondition(c, &ch) {
+			return
+		}
+		h.write(c, ch, keyField)
+	}
+}
+
+// remove handles DELETE /topology/<kind>/:key; the resource is soft-deleted. The client passes
+// the ETag it read in If-Match; If-Match: * deletes unconditionally.
+func (h writeHandler) remove(kind, keyField string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.available(c) {
+			return
+		}
+		ch := topologyChange{Op: opDelete, Kind: kind, Key: c.Param("key")}
+		if !precondition(c, &ch) {
+			return
+		}
+		h.write(c, ch, keyField)
+	}
+}
+
+// get handles GET /topology/<kind>/:key and returns the resource with its ETag
+func (h writeHandler) get(kind string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.available(c) {
+			return
+		}
+		repo := h.repo.WithContext(c.Request.Context())
+		key := c.Param("key")
+
+		var resource interface{}
+		var updatedAt time.Time
+		var err error
+		switch kind {
+		case kindQueue:
+			var q *models.Queue
+			if q, err = repo.GetQueueByName(key); q != nil {
+				resource, updatedAt = q, q.UpdatedAt
+			}
+		case kindExchange:
+			var x *models.Exchange
+			if x, err = repo.GetExchangeByName(key); x != nil {
+				resource, updatedAt = x, x.UpdatedAt
+			}
+		case kindBinding:
+			var b *models.Binding
+			if _, perr := uuid.Parse(key); perr == nil {
+				if b, err = repo.GetBinding(key); b != nil {
+					resource, updatedAt = b, b.UpdatedAt
+				}
+			}
+		case kindAssignment:
+			var a *models.ServiceAssignment
+			if _, perr := uuid.Parse(key); perr == nil {
+				if a, err = repo.GetServiceAssignment(key); a != nil {
+					resource, updatedAt = a, a.UpdatedAt
+				}
+			}
+		}
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to retrieve "+kind))
+			return
+		}
+		if resource == nil {
+			response.Fail(c, response.NewError(http.StatusNotFound, response.CodeResourceNotFound, fmt.Sprintf("%s %q not found", kind, key)))
+			return
+		}
+		c.Header("ETag", etag(updatedAt))
+		response.OK(c, resource)
+	}
+}
+
+// changes handles POST /topology/changes: up to MaxChanges changes applied in one transaction
+func (h writeHandler) changes(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	reconcile, ok := reconcileRequested(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Changes []topologyChange `json:"changes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.Invalid(response.FieldError{Field: "body", Issue: "must be a JSON object with a changes array"}))
+		return
+	}
+	if len(req.Changes) == 0 || len(req.Changes) > MaxChanges {
+		response.Fail(c, response.Invalid(response.FieldError{Field: "changes", Issue: fmt.Sprintf("must contain between 1 and %d changes", MaxChanges)}))
+		return
+	}
+
+	prepared := make([]preparedChange, 0, len(req.Changes))
+	var errs fieldErrors
+	for i, ch := range req.Changes {
+		p, chErrs := prepareChange(ch)
+		for _, e := range chErrs {
+			errs.add(fmt.Sprintf("changes[%d].%s", i, e.Field), e.Issue)
+		}
+		prepared = append(prepared, p)
+	}
+	if len(errs) > 0 {
+		response.Fail(c, response.Invalid(errs...))
+		return
+	}
+
+	results, failed, err := applyChanges(h.repo.WithContext(c.Request.Context()), prepared)
+	if err != nil {
+		e := changeError(err, fmt.Sprintf("changes[%d].data.", failed))
+		if failed >= 0 {
+			e.WithMetadata("change", failed)
+		}
+		response.Fail(c, e)
+		return
+	}
+
+	var metadata map[string]interface{}
+	if reconcile {
+		metadata = map[string]interface{}{"reconciliation": h.reconcile(c, results)}
+	}
+	response.JSON(c, http.StatusOK, "applied", map[string]interface{}{"results": results}, metadata)
+}
+
+// readBody reads the request body of a single-resource write
+func readBody(c *gin.Context) (json.RawMessage, bool) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		response.Fail(c, response.Invalid(response.FieldError{Field: "body", Issue: "could not be read"}))
+		return nil, false
+	}
+	return body, true
+}
+
+// precondition reads If-Match into the change and fails the request with 428 when neither
+// If-Match nor updated_at is given
+func precondition(c *gin.Context, ch *topologyChange) bool {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	switch {
+	case ifMatch == "*":
+		ch.unconditional = true
+	case ifMatch != "":
+		t, ok := parseETag(ifMatch)
+		if !ok {
+			response.Fail(c, response.InvalidParameter("If-Match", "must be an ETag returned by this API"))
+			return false
+		}
+		ch.UpdatedAt = &t
+	case ch.UpdatedAt == nil:
+		response.Fail(c, response.NewError(http.StatusPreconditionRequired, response.CodePreconditionRequired,
+			"send the ETag you read in If-Match (or updated_at in the body) to avoid overwriting concurrent changes"))
+		return false
+	}
+	return true
+}
+
+// etag derives a resource's ETag from its updated_at, which changes with every write
+func etag(updatedAt time.Time) string {
+	return `"` + strconv.FormatInt(updatedAt.UnixMicro(), 10) + `"`
+}
+
+func parseETag(s string) (time.Time, bool) {
+	s = strings.Trim(strings.TrimPrefix(s, "W/"), `"`)
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMicro(n), true
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"queue-manager/internal/bootstrap"
+	"queue-manager/internal/reconciliation"
+	"queue-manager/internal/repository"
+	"queue-manager/internal/response"
+	"queue-manager/internal/validation"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validateTopology handles POST /validate. Without a body it validates the expected topology the
+// reconciler works with. A body is a manifest in the format of the topology files; it is merged
+// over the expected topology, or validated on its own with standalone=true, so a change can be
+// checked before it is written.
+func validateTopology(repo *repository.Repository, rec *reconciliation.Reconciler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		standalone := false
+		if v := c.Query("standalone"); v != "" {
+			var err error
+			if standalone, err = strconv.ParseBool(v); err != nil {
+				response.Fail(c, response.InvalidParameter("standalone", "must be a boolean value"))
+				return
+			}
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			response.Fail(c, response.Invalid(response.FieldError{Field: "body", Issue: "could not be read"}))
+			return
+		}
+		var overlay *bootstrap.Definitions
+		if len(bytes.TrimSpace(body)) > 0 {
+			defs, err := bootstrap.ParseManifest(bytes.NewReader(body))
+			if err != nil {
+				response.Fail(c, response.Invalid(manifestErrors(err)...))
+				return
+			}
+			overlay = &defs
+		} else if standalone {
+			response.Fail(c, response.Invalid(response.FieldError{Field: "body", Issue: "is required with standalone=true"}))
+			return
+		}
+
+		var defs bootstrap.Definitions
+		source := "request"
+		if !standalone {
+			src := expectedSource(repo, rec)
+			if src == nil {
+				response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
+				return
+			}
+			source = src.Name()
+			if defs, err = src.Load(c.Request.Context()); err != nil {
+				response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to load expected topology"))
+				return
+			}
+		}
+		if overlay != nil {
+			defs = bootstrap.Merge(defs, *overlay)
+		}
+
+		findings := validation.Validate(defs)
+		if findings == nil {
+			findings = validation.Findings{}
+		}
+		valid := findings.Err() == nil
+		message := "topology is valid"
+		if !valid {
+			message = "topology is invalid"
+		}
+		response.JSON(c, http.StatusOK, message, map[string]interface{}{
+			"valid":    valid,
+			"source":   source,
+			"errors":   findings.Count(validation.SeverityError),
+			"warnings": findings.Count(validation.SeverityWarning),
+			"findings": findings,
+		}, nil)
+	}
+}
+
+// expectedSource returns the source the reconciler reads the expected topology from, or the
+// database when no reconciler is configured; nil when neither is available
+func expectedSource(repo *repository.Repository, rec *reconciliation.Reconciler) bootstrap.TopologySource {
+	if rec != nil {
+		if src := rec.Source(); src != nil {
+			return src
+		}
+	}
+	if repo == nil {
+		return nil
+	}
+	return bootstrap.NewDBSource(repo)
+}
+
+// manifestErrors turns the problems reported by bootstrap.ParseManifest, formatted as
+// "field: issue", into field errors
+func manifestErrors(err error) []response.FieldError {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	fields := make([]response.FieldError, 0, len(errs))
+	for _, e := range errs {
+		field, issue, ok := strings.Cut(e.Error(), ": ")
+		if !ok || strings.Contains(field, " ") {
+			field, issue = "body", e.Error()
+		}
+		fields = append(fields, response.FieldError{Field: field, Issue: issue})
+	}
+	return fields
+}
+
+// invalidTopology responds to a run refused because the expected topology has error findings
+func invalidTopology(c *gin.Context, err error) bool {
+	var invalid *validation.Error
+	if !errors.As(err, &invalid) {
+		return false
+	}
+	response.Fail(c, response.NewError(http.StatusUnprocessableEntity, response.CodeInvalidTopology,
+		"the expected topology has errors; fix them before applying it (see POST /validate)").
+		WithData(map[string]interface{}{"findings": invalid.Findings}))
+	return true
+}
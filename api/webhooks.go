@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"queue-manager/internal/repository"
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listWebhookDeliveries handles GET /webhooks/deliveries. Supported filters: sink, event (event
+// type), failed=true (only unsuccessful attempts) and limit.
+func listWebhookDeliveries(repo *repository.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if repo == nil {
+			response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeServiceUnavailable, "database connection not available"))
+			return
+		}
+
+		filter := repository.DeliveryFilter{
+			Sink:      c.Query("sink"),
+			EventType: c.Query("event"),
+		}
+		if v := c.Query("failed"); v != "" {
+			failed, err := strconv.ParseBool(v)
+			if err != nil {
+				response.Fail(c, response.InvalidParameter("failed", "must be true or false"))
+				return
+			}
+			filter.Failed = failed
+		}
+		if v := c.Query("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > 500 {
+				response.Fail(c, response.InvalidParameter("limit", "must be between 1 and 500"))
+				return
+			}
+			filter.Limit = limit
+		}
+
+		deliveries, err := repo.WithContext(c.Request.Context()).ListWebhookDeliveries(filter)
+		if err != nil {
+			response.Fail(c, response.NewError(http.StatusInternalServerError, response.CodeDatabaseError, "failed to retrieve webhook deliveries"))
+			return
+		}
+
+		response.OK(c, deliveries)
+	}
+}
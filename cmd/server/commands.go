@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"queue-manager/internal/adoption"
+	"queue-manager/internal/bootstrap"
+	"queue-manager/internal/config"
+	"queue-manager/internal/db"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/queue/rabbitmq"
+	"queue-manager/internal/repository"
+)
+
+// runCommand runs the subcommand in args[0] and returns the exit code
+func runCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	switch args[0] {
+	case "import":
+		return runImport(args[1:], stdin, stdout, stderr)
+	case "export":
+		return runExport(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q; available commands: import, export\n", args[0])
+		return 2
+	}
+}
+
+// commandConfig loads the configuration for a subcommand. Subcommands do not serve HTTP, so
+// APP_HOST and APP_PORT may be left unset.
+func commandConfig() (config.Config, error) {
+	return config.LoadFromEnv(func(key string) (string, bool) {
+		if v, ok := os.LookupEnv(key); ok {
+			return v, true
+		}
+		switch key {
+		case "APP_HOST":
+			return "127.0.0.1", true
+		case "APP_PORT":
+			return "0", true
+		}
+		return "", false
+	})
+}
+
+// runImport imports the live broker or a definitions file into the database: it prints the
+// preview and writes the rows once confirmed
+func runImport(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	file := fs.String("definitions", "", "import this RabbitMQ definitions file instead of the live broker")
+	vhost := fs.String("vhost", rabbitmq.DefaultVhost, "virtual host to import from the definitions file")
+	yes := fs.Bool("yes", false, "write without asking for confirmation")
+	dryRun := fs.Bool("dry-run", false, "only print the preview")
+	asJSON := fs.Bool("json", false, "print the preview as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: server import [-definitions FILE [-vhost VHOST]] [-dry-run | -yes] [-json]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "import failed: %v\n", err)
+		return 1
+	}
+
+	cfg, err := commandConfig()
+	if err != nil {
+		return fail(err)
+	}
+	database, err := db.Connect(cfg.PostgresURI)
+	if err != nil {
+		return fail(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer database.Close()
+	repo := repository.NewRepository(database.DB)
+
+	source := adoption.SourceBroker
+	var top queue.Topology
+	if *file != "" {
+		source = adoption.SourceDefinitions
+		f, err := os.Open(*file)
+		if err != nil {
+			return fail(err)
+		}
+		defs, err := rabbitmq.ParseDefinitions(f)
+		f.Close()
+		if err != nil {
+			return fail(err)
+		}
+		top = defs.Topology(*vhost)
+	} else {
+		qp, err := bootstrap.NewProvider(cfg)
+		if err != nil {
+			return fail(err)
+		}
+		if qp == nil {
+			return fail(errors.New("QUEUE_PROVIDER is not set; configure the broker or pass -definitions"))
+		}
+		if top, err = queue.ReadTopology(qp); err != nil {
+			return fail(fmt.Errorf("failed to read the broker: %w", err))
+		}
+	}
+
+	preview, err := adoption.NewPreview(repo, source, top)
+	if err != nil {
+		return fail(err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(preview)
+	} else {
+		printPreview(stdout, preview)
+	}
+	if preview.Empty() || *dryRun {
+		return 0
+	}
+	if !*yes && !confirm(stdin, stdout, "Write these rows to the database? [y/N] ") {
+		fmt.Fprintln(stdout, "Nothing was written.")
+		return 0
+	}
+
+	imported, err := adoption.Apply(repo, preview)
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Fprintf(stdout, "Imported %d exchanges, %d queues and %d bindings.\n", imported.Exchanges, imported.Queues, imported.Bindings)
+	return 0
+}
+
+// runExport writes the topology stored in the database as a RabbitMQ definitions file, to stdout
+// or to the file given with -o
+func runExport(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	vhost := fs.String("vhost", rabbitmq.DefaultVhost, "virtual host to declare the resources in")
+	out := fs.String("o", "", "write the definitions to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: server export [-vhost VHOST] [-o FILE]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	fail := func(err error) int {
+		fmt.Fprintf(stderr, "export failed: %v\n", err)
+		return 1
+	}
+
+	cfg, err := commandConfig()
+	if err != nil {
+		return fail(err)
+	}
+	database, err := db.Connect(cfg.PostgresURI)
+	if err != nil {
+		return fail(fmt.Errorf("failed to connect to database: %w", err))
+	}
+	defer database.Close()
+
+	defs, err := bootstrap.ExportDefinitions(context.Background(), repository.NewRepository(database.DB), *vhost)
+	if err != nil {
+		return fail(err)
+	}
+	if err := writeDefinitions(stdout, *out, defs); err != nil {
+		return fail(err)
+	}
+	if *out != "" {
+		fmt.Fprintf(stderr, "Exported %d exchanges, %d queues and %d bindings to %s.\n",
+			len(defs.Exchanges), len(defs.Queues), len(defs.Bindings), *out)
+	}
+	return 0
+}
+
+// writeDefinitions writes defs as indented JSON to path, or to stdout when path is empty
+func writeDefinitions(stdout io.Writer, path string, defs rabbitmq.Definitions) error {
+	w := stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(defs)
+}
+
+// printPreview lists the rows to insert and the resources that are skipped
+func printPreview(w io.Writer, p *adoption.Preview) {
+	fmt.Fprintf(w, "Import from %s: %d exchanges, %d queues and %d bindings to insert "+
+		"(already in the database: %d exchanges, %d queues, %d bindings)\n",
+		p.Source, len(p.Exchanges), len(p.Queues), len(p.Bindings),
+		p.Existing.Exchanges, p.Existing.Queues, p.Existing.Bindings)
+	for _, x := range p.Exchanges {
+		fmt.Fprintf(w, "  + exchange %s (%s)\n", x.ExchangeName, properties(x.ExchangeType, x.Durable, x.AutoDelete, x.Internal, x.Arguments))
+	}
+	for _, q := range p.Queues {
+		fmt.Fprintf(w, "  + queue %s (%s)\n", q.QueueName, properties("", q.Durable, q.AutoDelete, false, q.Arguments))
+	}
+	for _, b := range p.Bindings {
+		fmt.Fprintf(w, "  + binding %s -> %s (%q)\n", b.ExchangeName, b.QueueName, b.RoutingKey)
+	}
+	for _, s := range p.Skipped {
+		fmt.Fprintf(w, "  ~ skipped %s %s: %s\n", s.Kind, s.Name, s.Reason)
+	}
+	if p.Empty() {
+		fmt.Fprintln(w, "Nothing to import.")
+	}
+}
+
+// properties describes the flags and arguments of a resource, e.g. "topic, durable, x-max-length=10"
+func properties(kind string, durable, autoDelete, internal bool, args map[string]interface{}) string {
+	var parts []string
+	if kind != "" {
+		parts = append(parts, kind)
+	}
+	if durable {
+		parts = append(parts, "durable")
+	} else {
+		parts = append(parts, "transient")
+	}
+	if autoDelete {
+		parts = append(parts, "auto-delete")
+	}
+	if internal {
+		parts = append(parts, "internal")
+	}
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, args[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// confirm asks question and reports whether the answer is yes
+func confirm(stdin io.Reader, stdout io.Writer, question string) bool {
+	fmt.Fprint(stdout, question)
+	answer, _ := bufio.NewReader(stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"queue-manager/internal/adoption"
+	"queue-manager/internal/models"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/queue/rabbitmq"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCommand_Unknown(t *testing.T) {
+	var stderr bytes.Buffer
+	assert.Equal(t, 2, runCommand([]string{"serve"}, strings.NewReader(""), &bytes.Buffer{}, &stderr))
+	assert.Contains(t, stderr.String(), `unknown command "serve"`)
+}
+
+func TestPrintPreview(t *testing.T) {
+	var out bytes.Buffer
+	printPreview(&out, &adoption.Preview{
+		Source:    adoption.SourceBroker,
+		Exchanges: []adoption.ExchangeRow{{ExchangeName: "orders", ExchangeType: "topic", Durable: true}},
+		Queues: []adoption.QueueRow{{QueueName: "orders.created", Durable: true,
+			Arguments: models.JSONB{"x-queue-type": "quorum", "x-max-length": float64(1000)}}},
+		Bindings: []adoption.BindingRow{{ExchangeName: "orders", QueueName: "orders.created", RoutingKey: "order.created"}},
+		Existing: adoption.Counts{Queues: 2},
+		Skipped:  []adoption.Skipped{{Kind: "queue", Name: "amq.gen-1", Reason: "generated"}},
+	})
+	assert.Equal(t, `Import from broker: 1 exchanges, 1 queues and 1 bindings to insert (already in the database: 0 exchanges, 2 queues, 0 bindings)
+  + exchange orders (topic, durable)
+  + queue orders.created (durable, x-max-length=1000, x-queue-type=quorum)
+  + binding orders -> orders.created ("order.created")
+  ~ skipped queue amq.gen-1: generated
+`, out.String())
+}
+
+func TestConfirm(t *testing.T) {
+	for answer, want := range map[string]bool{"y\n": true, "YES\n": true, "\n": false, "no\n": false, "": false} {
+		assert.Equal(t, want, confirm(strings.NewReader(answer), &bytes.Buffer{}, "?"), answer)
+	}
+}
+
+func TestWriteDefinitions(t *testing.T) {
+	defs := rabbitmq.NewDefinitions(rabbitmq.DefaultVhost, queue.Topology{
+		Queues: []queue.QueueInfo{{Name: "orders.created", Durable: true}},
+	})
+
+	var out bytes.Buffer
+	require.NoError(t, writeDefinitions(&out, "", defs))
+	assert.Contains(t, out.String(), `"name": "orders.created"`)
+
+	path := filepath.Join(t.TempDir(), "definitions.json")
+	require.NoError(t, writeDefinitions(&bytes.Buffer{}, path, defs))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	parsed, err := rabbitmq.ParseDefinitions(f)
+	require.NoError(t, err)
+	assert.Len(t, parsed.Queues, 1)
+}
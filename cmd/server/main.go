@@ -1,35 +1,88 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"time"
 
+	"queue-manager/api"
 	"queue-manager/internal/bootstrap"
 	"queue-manager/internal/config"
 	appcron "queue-manager/internal/cron"
 	"queue-manager/internal/db"
+	"queue-manager/internal/leader"
+	"queue-manager/internal/logging"
+	"queue-manager/internal/metrics"
+	"queue-manager/internal/notify"
 	"queue-manager/internal/queue"
+	"queue-manager/internal/readiness"
+	"queue-manager/internal/reconciliation"
 	"queue-manager/internal/repository"
 	"queue-manager/internal/server"
+	"queue-manager/internal/tracing"
+	"queue-manager/internal/webhook"
 )
 
 func main() {
+	// Subcommands such as "import" run once and exit instead of serving
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	cfg, err := config.LoadFromEnv(os.LookupEnv)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
 
+	logger, err := logging.Setup(cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		log.Fatalf("failed to set up logging: %v", err)
+	}
+	startupLog := logging.Component(logger, "main")
+	// fatal logs err and exits, like log.Fatalf
+	fatal := func(msg string, err error) {
+		startupLog.Error(msg, logging.Err(err))
+		os.Exit(1)
+	}
+
+	// Tracing is set up first so startup work is traced as well
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			startupLog.Warn("failed to flush traces", logging.Err(err))
+		}
+	}()
+
 	// Optional DB connect at startup if POSTGRES_URI is provided
 	var database *db.Database
 	var repo *repository.Repository
 	if cfg.PostgresURI != "" {
 		database, err = db.Connect(cfg.PostgresURI)
 		if err != nil {
-			log.Fatalf("failed to connect to database: %v", err)
+			fatal("failed to connect to database", err)
 		}
 		repo = repository.NewRepository(database.DB)
-		log.Printf("successfully connected to database")
+		repo.SetLogger(logger)
+		startupLog.Info("successfully connected to database")
+	}
+
+	// Leader election: with several replicas only the leader declares topology and reconciles
+	var elector *leader.Elector
+	if cfg.LeaderElectionEnabled {
+		elector = leader.NewElector(database.DB, cfg.LeaderElectionLockKey, cfg.LeaderElectionInterval)
+		if elector.Campaign() {
+			startupLog.Info("leader election enabled: this instance is the leader")
+		} else {
+			startupLog.Info("leader election enabled: this instance is a follower, reconciliation is left to the leader")
+		}
+		elector.Start()
+		defer elector.Stop()
 	}
 
 	// Optional Queue connect at startup based on provider
@@ -37,87 +90,186 @@ func main() {
 	if cfg.QueueProvider != "" {
 		qp, err = bootstrap.NewProvider(cfg)
 		if err != nil {
-			log.Fatalf("failed to init queue provider: %v", err)
+			fatal("failed to init queue provider", err)
+		}
+		if ls, ok := qp.(queue.LoggerSetter); ok {
+			ls.SetLogger(logger)
 		}
 		if qp != nil {
 			// Retry connection with exponential backoff (RabbitMQ may take time to start)
 			maxRetries := 10
 			retryDelay := 2 // seconds
 			for i := 0; i < maxRetries; i++ {
-				if err := qp.Connect(); err == nil {
-					log.Printf("successfully connected to queue provider")
+				err := qp.Connect()
+				if err == nil {
+					startupLog.Info("successfully connected to queue provider")
 					break
 				}
 				if i < maxRetries-1 {
-					log.Printf("failed to connect to queue (attempt %d/%d): %v, retrying in %ds...", i+1, maxRetries, err, retryDelay)
+					startupLog.Warn("failed to connect to queue, retrying", "attempt", i+1, "max_attempts", maxRetries,
+						"retry_in", (time.Duration(retryDelay) * time.Second).String(), logging.Err(err))
 					time.Sleep(time.Duration(retryDelay) * time.Second)
 					retryDelay *= 2 // exponential backoff, max 64s
 					if retryDelay > 64 {
 						retryDelay = 64
 					}
 				} else {
-					log.Printf("failed to connect to queue after %d attempts: %v, continuing anyway (will retry via cron)", maxRetries, err)
+					startupLog.Error("failed to connect to queue, continuing anyway (will retry via cron)", "attempts", maxRetries, logging.Err(err))
 				}
 			}
 		}
 	}
 
+	// Outbound webhooks notify about drift, changes, persisting errors and provider health
+	var notifier *webhook.Notifier
+	if cfg.WebhooksFile != "" {
+		sinks, err := webhook.LoadSinks(cfg.WebhooksFile)
+		if err != nil {
+			fatal("failed to load webhooks", err)
+		}
+		notifier, err = webhook.NewNotifier(sinks, webhook.Options{
+			MaxAttempts: cfg.WebhookMaxAttempts,
+			Backoff:     cfg.WebhookBackoff,
+			Timeout:     cfg.WebhookTimeout,
+			ErrorRuns:   cfg.WebhookErrorRuns,
+		})
+		if err != nil {
+			fatal("failed to set up webhooks", err)
+		}
+		notifier.SetLogger(logger)
+		if repo != nil {
+			notifier.SetDeliveryLog(repo)
+		}
+		notifier.Start()
+		defer notifier.Stop()
+	}
+
+	// Expected topology: the database unless manifest files are configured, alone or over the database
+	var files *bootstrap.FileSource
+	var source bootstrap.TopologySource
+	switch cfg.TopologySource {
+	case "file":
+		files = bootstrap.NewFileSource(cfg.TopologyDir)
+		source = files
+	case "merged":
+		files = bootstrap.NewFileSource(cfg.TopologyDir)
+		source = bootstrap.NewMergedSource(bootstrap.NewDBSource(repo), files)
+	}
+	if source != nil {
+		// Refuse to start on invalid files rather than reconcile against them later
+		if _, err := source.Load(context.Background()); err != nil {
+			fatal("failed to load topology", err)
+		}
+		startupLog.Info("reading topology from files", "source", source.Name(), "dir", cfg.TopologyDir)
+	}
+
+	// Reconciler shared by the cron scheduler and the /sync endpoint so the pruning guards
+	// compare against the same last successful run
+	var rec *reconciliation.Reconciler
+	if qp != nil {
+		rec = reconciliation.NewReconciler(qp, repo, reconciliation.Guards{
+			AllowEmptyExpectation: cfg.ReconcileAllowEmptyExpectation,
+			MaxShrinkPercent:      cfg.ReconcileMaxShrinkPercent,
+			MaxDeletionsPerRun:    cfg.ReconcileMaxDeletions,
+		}, reconciliation.GracePolicy{
+			Period: cfg.ReconcileDeletionGracePeriod,
+			Runs:   cfg.ReconcileDeletionGraceRuns,
+		})
+		if repo != nil {
+			rec.SetHistory(repo)
+		}
+		rec.SetLogger(logger)
+		if source != nil {
+			rec.SetSource(source)
+		}
+		if notifier != nil {
+			rec.AddObserver(notifier)
+		}
+	}
+
+	// Readiness: database ping, provider health and the outcome of the startup declaration
+	var pinger readiness.Pinger
+	if database != nil {
+		pinger = database.DB
+	}
+	ready := readiness.NewTracker(pinger, qp)
+	if rec != nil && repo != nil && elector.IsLeader() {
+		rec.AddObserver(ready)
+	} else {
+		// Followers leave the declaration to the leader; without a provider or database it never happens
+		ready.Skip()
+	}
+
 	// Declare topology on startup if configured and connected
+	var sched *appcron.Scheduler
 	if qp != nil {
 		// Check if we're actually connected before declaring topology
 		hs := qp.Health()
+		metrics.SetProviderUp(hs.OK)
 		if hs.OK {
 			if repo == nil {
-				log.Printf("warning: database not connected, cannot load topology from database (will retry via cron)")
+				startupLog.Warn("database not connected, cannot load topology from database (will retry via cron)")
+			} else if !elector.IsLeader() {
+				startupLog.Info("not the leader, skipping topology declaration")
 			} else {
-				top, err := bootstrap.LoadTopologyFromDB(repo)
+				// Declare missing resources only; pruning is left to the cron reconciliation
+				result, err := rec.Reconcile(context.Background(), reconciliation.Request{
+					CreateOnly: true,
+					Trigger:    reconciliation.Trigger{Source: reconciliation.TriggerStartup},
+				})
 				if err != nil {
-					log.Printf("warning: failed to load topology from database: %v (will retry via cron)", err)
+					startupLog.Warn("failed to declare topology from database (will retry via cron)", logging.Err(err))
 				} else {
-					log.Printf("loaded topology from database: %d exchanges, %d queues, %d bindings", len(top.Exchanges), len(top.Queues), len(top.Bindings))
-
-					if len(top.Exchanges) == 0 && len(top.Queues) == 0 && len(top.Bindings) == 0 {
-						log.Printf("warning: topology is empty - database tables may not have data. Run migrations to seed data.")
-					}
-
-					// exchanges
-					exchangeCount := 0
-					for name, kind := range top.Exchanges {
-						if err := qp.DeclareExchange(name, kind, true); err != nil {
-							log.Printf("warning: declare exchange %s failed: %v (will retry via cron)", name, err)
-						} else {
-							exchangeCount++
-							log.Printf("declared exchange: %s (type: %s)", name, kind)
-						}
-					}
-					// queues
-					queueCount := 0
-					for _, q := range top.Queues {
-						if err := qp.DeclareQueue(q, true); err != nil {
-							log.Printf("warning: declare queue %s failed: %v (will retry via cron)", q, err)
-						} else {
-							queueCount++
-							log.Printf("declared queue: %s", q)
-						}
+					for _, msg := range result.Errors {
+						startupLog.Warn(msg+" (will retry via cron)", logging.KeyRunID, result.RunID)
 					}
-					// bindings
-					bindingCount := 0
-					for _, b := range top.Bindings {
-						if err := qp.BindQueue(b[0], b[1], b[2]); err != nil {
-							log.Printf("warning: bind queue %s to exchange %s (routing key: %s) failed: %v (will retry via cron)", b[0], b[1], b[2], err)
-						} else {
-							bindingCount++
-							log.Printf("bound queue %s to exchange %s (routing key: %s)", b[0], b[1], b[2])
-						}
-					}
-					log.Printf("topology declaration completed: %d exchanges, %d queues, %d bindings created", exchangeCount, queueCount, bindingCount)
+					startupLog.Info("topology declaration completed", logging.KeyRunID, result.RunID,
+						"exchanges", len(result.CreatedExchanges), "queues", len(result.CreatedQueues), "bindings", len(result.CreatedBindings))
 				}
 			}
 		} else {
-			log.Printf("queue provider not connected, skipping topology declaration (will retry via cron)")
+			startupLog.Warn("queue provider not connected, skipping topology declaration (will retry via cron)")
 		}
+		// Per-queue gauges are opt-in: they add one series per queue on every scrape
+		if cfg.MetricsQueueStatsEnabled {
+			if lister, ok := qp.(queue.QueueStatsLister); ok {
+				if err := metrics.RegisterQueueCollector(lister); err != nil {
+					startupLog.Warn("failed to register queue metrics", logging.Err(err))
+				}
+			} else {
+				startupLog.Warn("queue provider does not report queue stats, per-queue metrics disabled")
+			}
+		}
+
 		// start cron health checks/recovery (always start, even if not connected)
-		sched := appcron.NewScheduler(qp, repo)
+		sched = appcron.NewScheduler(qp, repo, rec)
+		sched.SetLogger(logger)
+		if err := sched.Configure(cfg); err != nil {
+			fatal("failed to configure scheduler", err)
+		}
+		sched.SetLeader(elector)
+		if notifier != nil {
+			sched.SetHealthObserver(notifier)
+		}
+
+		// Reconcile changed resources as soon as the database reports them; the reconcile job
+		// then defaults to a slower safety-net schedule (see RECONCILE_SAFETY_NET_INTERVAL)
+		if cfg.ReconcileEventsEnabled && repo != nil {
+			listener := notify.NewListener(cfg.PostgresURI, cfg.ReconcileEventsDebounce, notify.Reconcile(rec, qp, elector))
+			listener.SetLogger(logger)
+			listener.Start()
+			defer listener.Stop()
+		}
+
+		// Reconcile as soon as the topology files change
+		if files != nil && cfg.TopologyWatchInterval > 0 {
+			reconcile := notify.ReconcileAs(reconciliation.TriggerFile, rec, qp, elector)
+			watcher := bootstrap.NewWatcher(files, cfg.TopologyWatchInterval, func() { reconcile(nil) })
+			watcher.SetLogger(logger)
+			watcher.Start()
+			defer watcher.Stop()
+		}
+
 		sched.Start()
 		defer func() {
 			sched.Stop()
@@ -128,8 +280,17 @@ func main() {
 		}()
 	}
 
-	s := server.New(cfg, repo, qp)
+	var live *queue.TopologyCache
+	if qp != nil {
+		live = queue.NewTopologyCache(qp, cfg.RealityCacheTTL)
+	}
+
+	s := server.New(cfg, api.Dependencies{
+		Repo: repo, Provider: qp, Reconciler: rec, Leader: elector, Scheduler: sched,
+		LiveTopology: live, Readiness: ready, Logger: logger, APITokens: cfg.APITokens,
+	})
+	startupLog.Info("HTTP server starting", "addr", cfg.Addr())
 	if err := s.Start(); err != nil {
-		log.Fatalf("server error: %v", err)
+		fatal("server error", err)
 	}
 }
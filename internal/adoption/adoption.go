@@ -0,0 +1,248 @@
+// Package adoption imports the topology of an existing broker into the database, so the
+// reconciler adopts its exchanges, queues and bindings instead of deleting them. An import is
+// previewed first; the preview's token confirms that exactly the previewed rows are written.
+package adoption
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"queue-manager/internal/models"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/repository"
+)
+
+// Sources an import reads from, recorded in the meta.imported_from of the imported rows
+const (
+	SourceBroker      = "broker"
+	SourceDefinitions = "definitions"
+)
+
+// ErrNotDetailed is returned for providers that do not report exchange types and resource flags
+var ErrNotDetailed = errors.New("the queue provider does not report resource properties; import a definitions file instead")
+
+// ExchangeRow is an exchange to insert
+type ExchangeRow struct {
+	ExchangeName string       `json:"exchange_name"`
+	ExchangeType string       `json:"exchange_type"`
+	Durable      bool         `json:"durable"`
+	AutoDelete   bool         `json:"auto_delete"`
+	Internal     bool         `json:"internal"`
+	Arguments    models.JSONB `json:"arguments"`
+}
+
+// QueueRow is a queue to insert
+type QueueRow struct {
+	QueueName  string       `json:"queue_name"`
+	Durable    bool         `json:"durable"`
+	AutoDelete bool         `json:"auto_delete"`
+	Arguments  models.JSONB `json:"arguments"`
+}
+
+// BindingRow is a binding to insert
+type BindingRow struct {
+	ExchangeName string       `json:"exchange_name"`
+	QueueName    string       `json:"queue_name"`
+	RoutingKey   string       `json:"routing_key"`
+	Arguments    models.JSONB `json:"arguments"`
+}
+
+// Skipped is a resource of the source that is not imported
+type Skipped struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Counts is a number of resources per kind
+type Counts struct {
+	Exchanges int `json:"exchanges"`
+	Queues    int `json:"queues"`
+	Bindings  int `json:"bindings"`
+}
+
+// Preview lists the rows an import would insert. Resources that are already in the database
+// are counted in Existing and left unchanged.
+type Preview struct {
+	Source    string        `json:"source"`
+	Exchanges []ExchangeRow `json:"exchanges"`
+	Queues    []QueueRow    `json:"queues"`
+	Bindings  []BindingRow  `json:"bindings"`
+	Existing  Counts        `json:"existing"`
+	Skipped   []Skipped     `json:"skipped"`
+	// Token identifies the rows; pass it back to confirm the import
+	Token string `json:"token"`
+}
+
+// Empty reports whether there is nothing to insert
+func (p *Preview) Empty() bool {
+	return len(p.Exchanges)+len(p.Queues)+len(p.Bindings) == 0
+}
+
+// NewPreview compares the topology read from source with the database and returns the rows
+// missing from it. Arguments and flags are kept as the broker reports them.
+func NewPreview(repo *repository.Repository, source string, top queue.Topology) (*Preview, error) {
+	if !top.Detailed {
+		return nil, ErrNotDetailed
+	}
+	exchanges, err := repo.ListExchanges()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exchanges: %w", err)
+	}
+	queues, err := repo.ListQueues()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load queues: %w", err)
+	}
+	bindings, err := repo.ListBindings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bindings: %w", err)
+	}
+
+	p := &Preview{
+		Source:    source,
+		Exchanges: []ExchangeRow{},
+		Queues:    []QueueRow{},
+		Bindings:  []BindingRow{},
+		Skipped:   []Skipped{},
+	}
+	skip := func(kind, name, reason string) {
+		p.Skipped = append(p.Skipped, Skipped{Kind: kind, Name: name, Reason: reason})
+	}
+
+	// known holds the exchanges and queues bindings may refer to: existing or imported
+	knownExchanges, knownQueues := map[string]bool{}, map[string]bool{}
+	for _, e := range exchanges {
+		knownExchanges[e.ExchangeName] = true
+	}
+	for _, q := range queues {
+		knownQueues[q.QueueName] = true
+	}
+	existingBindings := map[[3]string]bool{}
+	for _, b := range bindings {
+		existingBindings[[3]string{b.ExchangeName, b.QueueName, b.RoutingKey}] = true
+	}
+
+	for _, x := range top.Exchanges {
+		switch {
+		case knownExchanges[x.Name]:
+			p.Existing.Exchanges++
+		case !supportedExchangeType(x.Type):
+			skip("exchange", x.Name, fmt.Sprintf("exchange type %q is not supported", x.Type))
+		default:
+			knownExchanges[x.Name] = true
+			p.Exchanges = append(p.Exchanges, ExchangeRow{
+				ExchangeName: x.Name, ExchangeType: x.Type, Durable: x.Durable, AutoDelete: x.AutoDelete,
+				Internal: x.Internal, Arguments: orEmpty(x.Arguments),
+			})
+		}
+	}
+	for _, q := range top.Queues {
+		switch {
+		case knownQueues[q.Name]:
+			p.Existing.Queues++
+		case q.Exclusive:
+			skip("queue", q.Name, "exclusive queues belong to the connection that declared them")
+		case strings.HasPrefix(q.Name, "amq."):
+			skip("queue", q.Name, "names starting with amq. are generated by the broker")
+		default:
+			knownQueues[q.Name] = true
+			p.Queues = append(p.Queues, QueueRow{
+				QueueName: q.Name, Durable: q.Durable, AutoDelete: q.AutoDelete, Arguments: orEmpty(q.Arguments),
+			})
+		}
+	}
+	for _, b := range top.Bindings {
+		name := fmt.Sprintf("%s -> %s (%q)", b.Exchange, b.Queue, b.RoutingKey)
+		switch {
+		case existingBindings[[3]string{b.Exchange, b.Queue, b.RoutingKey}]:
+			p.Existing.Bindings++
+		case !knownExchanges[b.Exchange]:
+			skip("binding", name, fmt.Sprintf("exchange %q is not imported", b.Exchange))
+		case !knownQueues[b.Queue]:
+			skip("binding", name, fmt.Sprintf("queue %q is not imported", b.Queue))
+		default:
+			p.Bindings = append(p.Bindings, BindingRow{
+				ExchangeName: b.Exchange, QueueName: b.Queue, RoutingKey: b.RoutingKey, Arguments: orEmpty(b.Arguments),
+			})
+		}
+	}
+
+	sort.Slice(p.Exchanges, func(i, j int) bool { return p.Exchanges[i].ExchangeName < p.Exchanges[j].ExchangeName })
+	sort.Slice(p.Queues, func(i, j int) bool { return p.Queues[i].QueueName < p.Queues[j].QueueName })
+	sort.Slice(p.Bindings, func(i, j int) bool {
+		a, b := p.Bindings[i], p.Bindings[j]
+		if a.ExchangeName != b.ExchangeName {
+			return a.ExchangeName < b.ExchangeName
+		}
+		if a.QueueName != b.QueueName {
+			return a.QueueName < b.QueueName
+		}
+		return a.RoutingKey < b.RoutingKey
+	})
+	p.Token = p.hash()
+	return p, nil
+}
+
+// hash fingerprints the rows to insert
+func (p *Preview) hash() string {
+	raw, _ := json.Marshal([]interface{}{p.Exchanges, p.Queues, p.Bindings})
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Apply inserts the rows of p in one transaction: either all of them are written or none.
+// Soft-deleted rows with the same names are restored with the imported properties.
+func Apply(repo *repository.Repository, p *Preview) (Counts, error) {
+	meta := func() models.JSONB { return models.JSONB{"imported_from": p.Source} }
+	err := repo.InTx(func(tx *repository.Tx) error {
+		for _, x := range p.Exchanges {
+			if _, err := tx.CreateExchange(models.Exchange{
+				ExchangeName: x.ExchangeName, ExchangeType: x.ExchangeType, Durable: x.Durable,
+				AutoDelete: x.AutoDelete, Internal: x.Internal, Arguments: x.Arguments, Meta: meta(),
+			}); err != nil {
+				return err
+			}
+		}
+		for _, q := range p.Queues {
+			if _, err := tx.CreateQueue(models.Queue{
+				QueueName: q.QueueName, Durable: q.Durable, AutoDelete: q.AutoDelete,
+				Arguments: q.Arguments, Meta: meta(),
+			}); err != nil {
+				return err
+			}
+		}
+		for _, b := range p.Bindings {
+			if _, err := tx.CreateBinding(models.Binding{
+				ExchangeName: b.ExchangeName, QueueName: b.QueueName, RoutingKey: b.RoutingKey,
+				Arguments: b.Arguments, Meta: meta(),
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Counts{}, err
+	}
+	return Counts{Exchanges: len(p.Exchanges), Queues: len(p.Queues), Bindings: len(p.Bindings)}, nil
+}
+
+func supportedExchangeType(kind string) bool {
+	switch kind {
+	case "direct", "topic", "fanout", "headers":
+		return true
+	}
+	return false
+}
+
+func orEmpty(m map[string]interface{}) models.JSONB {
+	if m == nil {
+		return models.JSONB{}
+	}
+	return models.JSONB(m)
+}
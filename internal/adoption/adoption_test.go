@@ -0,0 +1,154 @@
+package adoption
+
+import (
+	"testing"
+	"time"
+
+	"queue-manager/internal/models"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/repository"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	exchangeColumns = []string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"exchange_name", "exchange_type", "durable", "auto_delete", "internal",
+		"arguments", "description",
+	}
+	queueColumns = []string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"queue_name", "durable", "auto_delete", "arguments", "description",
+	}
+	bindingColumns = []string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"exchange_name", "queue_name", "routing_key", "arguments", "mandatory",
+	}
+)
+
+// expectDatabase sets up the mock to hold the orders exchange and queue, bound with order.created
+func expectDatabase(mock sqlmock.Sqlmock) {
+	now := time.Now()
+	mock.ExpectQuery(`SELECT.*FROM queue_manager.exchanges`).WillReturnRows(sqlmock.NewRows(exchangeColumns).
+		AddRow(1, "x1", now, now, nil, []byte(`{}`), "orders", "topic", true, false, false, []byte(`{}`), ""))
+	mock.ExpectQuery(`SELECT.*FROM queue_manager.queues`).WillReturnRows(sqlmock.NewRows(queueColumns).
+		AddRow(1, "q1", now, now, nil, []byte(`{}`), "orders.created", true, false, []byte(`{}`), ""))
+	mock.ExpectQuery(`SELECT.*FROM queue_manager.bindings`).WillReturnRows(sqlmock.NewRows(bindingColumns).
+		AddRow(1, "b1", now, now, nil, []byte(`{}`), "orders", "orders.created", "order.created", []byte(`{}`), false))
+}
+
+// live is a broker holding the database's resources plus new and unsupported ones
+var live = queue.Topology{
+	Detailed: true,
+	Exchanges: []queue.ExchangeInfo{
+		{Name: "orders", Type: "topic", Durable: true},
+		{Name: "billing", Type: "direct", Durable: true, Arguments: map[string]interface{}{"alternate-exchange": "unrouted"}},
+		{Name: "delayed", Type: "x-delayed-message", Durable: true},
+	},
+	Queues: []queue.QueueInfo{
+		{Name: "orders.created", Durable: true},
+		{Name: "billing.invoices", Durable: true, Arguments: map[string]interface{}{"x-queue-type": "quorum", "x-max-length": float64(1000)}},
+		{Name: "amq.gen-1234", AutoDelete: true, Exclusive: true},
+	},
+	Bindings: []queue.BindingInfo{
+		{Exchange: "orders", Queue: "orders.created", RoutingKey: "order.created"},
+		{Exchange: "orders", Queue: "billing.invoices", RoutingKey: "order.paid"},
+		{Exchange: "delayed", Queue: "billing.invoices", RoutingKey: "retry"},
+	},
+}
+
+func TestNewPreview(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	expectDatabase(mock)
+
+	p, err := NewPreview(repository.NewRepository(db), SourceBroker, live)
+	require.NoError(t, err)
+	assert.Equal(t, []ExchangeRow{{
+		ExchangeName: "billing", ExchangeType: "direct", Durable: true,
+		Arguments: models.JSONB{"alternate-exchange": "unrouted"},
+	}}, p.Exchanges)
+	assert.Equal(t, []QueueRow{{
+		QueueName: "billing.invoices", Durable: true,
+		Arguments: models.JSONB{"x-queue-type": "quorum", "x-max-length": float64(1000)},
+	}}, p.Queues)
+	assert.Equal(t, []BindingRow{{
+		ExchangeName: "orders", QueueName: "billing.invoices", RoutingKey: "order.paid", Arguments: models.JSONB{},
+	}}, p.Bindings)
+	assert.Equal(t, Counts{Exchanges: 1, Queues: 1, Bindings: 1}, p.Existing)
+	assert.Equal(t, []Skipped{
+		{Kind: "exchange", Name: "delayed", Reason: `exchange type "x-delayed-message" is not supported`},
+		{Kind: "queue", Name: "amq.gen-1234", Reason: "exclusive queues belong to the connection that declared them"},
+		{Kind: "binding", Name: `delayed -> billing.invoices ("retry")`, Reason: `exchange "delayed" is not imported`},
+	}, p.Skipped)
+	assert.NotEmpty(t, p.Token)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	t.Run("the token identifies the rows", func(t *testing.T) {
+		expectDatabase(mock)
+		again, err := NewPreview(repository.NewRepository(db), SourceBroker, live)
+		require.NoError(t, err)
+		assert.Equal(t, p.Token, again.Token)
+
+		again.Queues[0].Durable = false
+		assert.NotEqual(t, p.Token, again.hash())
+	})
+
+	t.Run("refuses topologies without properties", func(t *testing.T) {
+		_, err := NewPreview(repository.NewRepository(db), SourceBroker, queue.Topology{})
+		assert.ErrorIs(t, err, ErrNotDetailed)
+	})
+}
+
+func TestApply(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	repo := repository.NewRepository(db)
+	now := time.Now()
+	meta := models.JSONB{"imported_from": SourceDefinitions}
+	p := &Preview{
+		Source:    SourceDefinitions,
+		Exchanges: []ExchangeRow{{ExchangeName: "billing", ExchangeType: "direct", Durable: true, Arguments: models.JSONB{}}},
+		Queues:    []QueueRow{{QueueName: "billing.invoices", Durable: true, Arguments: models.JSONB{"x-queue-type": "quorum"}}},
+		Bindings:  []BindingRow{{ExchangeName: "billing", QueueName: "billing.invoices", RoutingKey: "invoice", Arguments: models.JSONB{}}},
+	}
+
+	t.Run("writes all rows in one transaction", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO queue_manager.exchanges`).
+			WithArgs(meta, "billing", "direct", true, false, false, models.JSONB{}, "").
+			WillReturnRows(sqlmock.NewRows(exchangeColumns).
+				AddRow(2, "x2", now, now, nil, []byte(`{}`), "billing", "direct", true, false, false, []byte(`{}`), ""))
+		mock.ExpectQuery(`INSERT INTO queue_manager.queues`).
+			WithArgs(meta, "billing.invoices", true, false, models.JSONB{"x-queue-type": "quorum"}, "").
+			WillReturnRows(sqlmock.NewRows(queueColumns).
+				AddRow(2, "q2", now, now, nil, []byte(`{}`), "billing.invoices", true, false, []byte(`{}`), ""))
+		mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(`SELECT EXISTS`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(`INSERT INTO queue_manager.bindings`).
+			WithArgs(meta, "billing", "billing.invoices", "invoice", models.JSONB{}, false).
+			WillReturnRows(sqlmock.NewRows(bindingColumns).
+				AddRow(2, "b2", now, now, nil, []byte(`{}`), "billing", "billing.invoices", "invoice", []byte(`{}`), false))
+		mock.ExpectCommit()
+
+		counts, err := Apply(repo, p)
+		require.NoError(t, err)
+		assert.Equal(t, Counts{Exchanges: 1, Queues: 1, Bindings: 1}, counts)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rolls back when a row was created meanwhile", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO queue_manager.exchanges`).WillReturnRows(sqlmock.NewRows(exchangeColumns))
+		mock.ExpectRollback()
+
+		_, err := Apply(repo, p)
+		assert.ErrorIs(t, err, repository.ErrAlreadyExists)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
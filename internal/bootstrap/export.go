@@ -0,0 +1,49 @@
+package bootstrap
+
+import (
+	"context"
+
+	"queue-manager/internal/queue"
+	"queue-manager/internal/queue/rabbitmq"
+	"queue-manager/internal/repository"
+)
+
+// Detailed returns the exchanges, queues and bindings with their properties, in the form the
+// provider reports them
+func (d Definitions) Detailed() queue.Topology {
+	t := queue.Topology{
+		Exchanges: make([]queue.ExchangeInfo, 0, len(d.Exchanges)),
+		Queues:    make([]queue.QueueInfo, 0, len(d.Queues)),
+		Bindings:  make([]queue.BindingInfo, 0, len(d.Bindings)),
+		Detailed:  true,
+	}
+	for _, e := range d.Exchanges {
+		t.Exchanges = append(t.Exchanges, queue.ExchangeInfo{
+			Name: e.ExchangeName, Type: e.ExchangeType, Durable: e.Durable, AutoDelete: e.AutoDelete,
+			Internal: e.Internal, Arguments: e.Arguments,
+		})
+	}
+	for _, q := range d.Queues {
+		t.Queues = append(t.Queues, queue.QueueInfo{
+			Name: q.QueueName, Durable: q.Durable, AutoDelete: q.AutoDelete, Arguments: q.Arguments,
+		})
+	}
+	for _, b := range d.Bindings {
+		t.Bindings = append(t.Bindings, queue.BindingInfo{
+			Exchange: b.ExchangeName, Queue: b.QueueName, RoutingKey: b.RoutingKey, Arguments: b.Arguments,
+		})
+	}
+	return t
+}
+
+// ExportDefinitions returns the topology stored in the database as a RabbitMQ definitions file
+// for vhost. It carries the same resources as LoadTopologyFromDB, with their properties.
+// Service assignments have no counterpart in RabbitMQ and are left out, as are users and
+// policies, which the database does not describe.
+func ExportDefinitions(ctx context.Context, repo *repository.Repository, vhost string) (rabbitmq.Definitions, error) {
+	defs, err := NewDBSource(repo).Load(ctx)
+	if err != nil {
+		return rabbitmq.Definitions{}, err
+	}
+	return rabbitmq.NewDefinitions(vhost, defs.Detailed()), nil
+}
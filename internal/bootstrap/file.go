@@ -0,0 +1,502 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"queue-manager/internal/logging"
+	"queue-manager/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxNameLength is the longest exchange or queue name the broker accepts
+const maxNameLength = 255
+
+// Defaults of the service_assignments table, applied to assignments that leave them out
+const (
+	defaultPrefetchCount = 10
+	defaultMaxInflight   = 100
+)
+
+// manifest is the content of one topology file. Field names follow the write API.
+type manifest struct {
+	Exchanges   []exchangeManifest   `json:"exchanges" yaml:"exchanges"`
+	Queues      []queueManifest      `json:"queues" yaml:"queues"`
+	Bindings    []bindingManifest    `json:"bindings" yaml:"bindings"`
+	Assignments []assignmentManifest `json:"assignments" yaml:"assignments"`
+}
+
+type exchangeManifest struct {
+	ExchangeName string       `json:"exchange_name" yaml:"exchange_name"`
+	ExchangeType string       `json:"exchange_type" yaml:"exchange_type"`
+	Durable      *bool        `json:"durable" yaml:"durable"`
+	AutoDelete   bool         `json:"auto_delete" yaml:"auto_delete"`
+	Internal     bool         `json:"internal" yaml:"internal"`
+	Arguments    models.JSONB `json:"arguments" yaml:"arguments"`
+	Description  string       `json:"description" yaml:"description"`
+	Meta         models.JSONB `json:"meta" yaml:"meta"`
+}
+
+type queueManifest struct {
+	QueueName   string       `json:"queue_name" yaml:"queue_name"`
+	Durable     *bool        `json:"durable" yaml:"durable"`
+	AutoDelete  bool         `json:"auto_delete" yaml:"auto_delete"`
+	Arguments   models.JSONB `json:"arguments" yaml:"arguments"`
+	Description string       `json:"description" yaml:"description"`
+	Meta        models.JSONB `json:"meta" yaml:"meta"`
+}
+
+type bindingManifest struct {
+	ExchangeName string       `json:"exchange_name" yaml:"exchange_name"`
+	QueueName    string       `json:"queue_name" yaml:"queue_name"`
+	RoutingKey   string       `json:"routing_key" yaml:"routing_key"`
+	Arguments    models.JSONB `json:"arguments" yaml:"arguments"`
+	Mandatory    bool         `json:"mandatory" yaml:"mandatory"`
+	Meta         models.JSONB `json:"meta" yaml:"meta"`
+}
+
+type assignmentManifest struct {
+	ServiceName   string       `json:"service_name" yaml:"service_name"`
+	QueueName     string       `json:"queue_name" yaml:"queue_name"`
+	PrefetchCount *int         `json:"prefetch_count" yaml:"prefetch_count"`
+	MaxInflight   *int         `json:"max_inflight" yaml:"max_inflight"`
+	Notes         string       `json:"notes" yaml:"notes"`
+	Meta          models.JSONB `json:"meta" yaml:"meta"`
+}
+
+// FileSource reads the topology from a directory of manifest files (*.yaml, *.yml and *.json,
+// including subdirectories; hidden files and directories are skipped). Each file may declare
+// exchanges, queues, bindings and assignments; together the files make up the topology, so a
+// resource must be declared in only one of them.
+type FileSource struct {
+	dir string
+}
+
+// NewFileSource creates a source reading the manifests in dir
+func NewFileSource(dir string) *FileSource {
+	return &FileSource{dir: dir}
+}
+
+// Name implements TopologySource
+func (s *FileSource) Name() string { return "file" }
+
+// Dir returns the directory the manifests are read from
+func (s *FileSource) Dir() string { return s.dir }
+
+// Load implements TopologySource. All problems found in the files are reported together.
+func (s *FileSource) Load(ctx context.Context) (Definitions, error) {
+	defs, err := s.parse()
+	if err != nil {
+		return Definitions{}, err
+	}
+	if err := checkReferences(defs); err != nil {
+		return Definitions{}, fmt.Errorf("invalid topology files in %s: %w", s.dir, err)
+	}
+	return defs, nil
+}
+
+// parse reads and validates the files without checking that bindings and assignments refer to
+// declared exchanges and queues, so the result can still be merged with another source
+func (s *FileSource) parse() (Definitions, error) {
+	paths, err := s.files()
+	if err != nil {
+		return Definitions{}, err
+	}
+
+	var defs Definitions
+	var problems []error
+	// declared maps a resource key to the file declaring it, to report duplicates across files
+	declared := map[string]string{}
+	declare := func(path, field, key string) bool {
+		if other, ok := declared[key]; ok {
+			problems = append(problems, fmt.Errorf("%s: %s: already declared in %s", path, field, other))
+			return false
+		}
+		declared[key] = path
+		return true
+	}
+
+	for _, path := range paths {
+		m, err := readManifest(path)
+		rel, _ := filepath.Rel(s.dir, path)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", rel, err))
+			continue
+		}
+		d, errs := m.definitions(func(field, key string) bool { return declare(rel, field, key) })
+		problems = append(problems, prefixed(rel, errs)...)
+		defs.Exchanges = append(defs.Exchanges, d.Exchanges...)
+		defs.Queues = append(defs.Queues, d.Queues...)
+		defs.Bindings = append(defs.Bindings, d.Bindings...)
+		defs.Assignments = append(defs.Assignments, d.Assignments...)
+	}
+
+	if len(problems) > 0 {
+		return Definitions{}, fmt.Errorf("invalid topology files in %s: %w", s.dir, errors.Join(problems...))
+	}
+	return defs, nil
+}
+
+// definitions converts and validates the resources of a manifest. declare is called with the
+// field and key of each valid resource and reports whether it was declared for the first time.
+func (m manifest) definitions(declare func(field, key string) bool) (Definitions, []error) {
+	var defs Definitions
+	var problems []error
+	for i, in := range m.Exchanges {
+		field := fmt.Sprintf("exchanges[%d]", i)
+		errs := validateName(field+".exchange_name", in.ExchangeName)
+		switch in.ExchangeType {
+		case "direct", "topic", "fanout", "headers":
+		default:
+			errs = append(errs, fmt.Errorf("%s.exchange_type: must be direct, topic, fanout or headers", field))
+		}
+		if len(errs) > 0 {
+			problems = append(problems, errs...)
+			continue
+		}
+		if declare(field, "exchange\x00"+in.ExchangeName) {
+			defs.Exchanges = append(defs.Exchanges, models.Exchange{
+				ExchangeName: in.ExchangeName, ExchangeType: in.ExchangeType, Durable: in.Durable == nil || *in.Durable,
+				AutoDelete: in.AutoDelete, Internal: in.Internal, Arguments: orEmpty(in.Arguments),
+				Description: in.Description, Meta: orEmpty(in.Meta),
+			})
+		}
+	}
+	for i, in := range m.Queues {
+		field := fmt.Sprintf("queues[%d]", i)
+		if errs := validateName(field+".queue_name", in.QueueName); len(errs) > 0 {
+			problems = append(problems, errs...)
+			continue
+		}
+		if declare(field, "queue\x00"+in.QueueName) {
+			defs.Queues = append(defs.Queues, models.Queue{
+				QueueName: in.QueueName, Durable: in.Durable == nil || *in.Durable, AutoDelete: in.AutoDelete,
+				Arguments: orEmpty(in.Arguments), Description: in.Description, Meta: orEmpty(in.Meta),
+			})
+		}
+	}
+	for i, in := range m.Bindings {
+		field := fmt.Sprintf("bindings[%d]", i)
+		errs := append(validateReference(field+".exchange_name", in.ExchangeName),
+			validateReference(field+".queue_name", in.QueueName)...)
+		if len(in.RoutingKey) > maxNameLength {
+			errs = append(errs, fmt.Errorf("%s.routing_key: must be at most %d bytes", field, maxNameLength))
+		}
+		if len(errs) > 0 {
+			problems = append(problems, errs...)
+			continue
+		}
+		b := models.Binding{
+			ExchangeName: in.ExchangeName, QueueName: in.QueueName, RoutingKey: in.RoutingKey,
+			Arguments: orEmpty(in.Arguments), Mandatory: in.Mandatory, Meta: orEmpty(in.Meta),
+		}
+		if declare(field, "binding\x00"+bindingKey(b)) {
+			defs.Bindings = append(defs.Bindings, b)
+		}
+	}
+	for i, in := range m.Assignments {
+		field := fmt.Sprintf("assignments[%d]", i)
+		var errs []error
+		if in.ServiceName == "" {
+			errs = append(errs, fmt.Errorf("%s.service_name: is required", field))
+		}
+		errs = append(errs, validateReference(field+".queue_name", in.QueueName)...)
+		a := models.ServiceAssignment{
+			ServiceName: in.ServiceName, QueueName: in.QueueName, PrefetchCount: defaultPrefetchCount,
+			MaxInflight: defaultMaxInflight, Notes: in.Notes, Meta: orEmpty(in.Meta),
+		}
+		if in.PrefetchCount != nil {
+			a.PrefetchCount = *in.PrefetchCount
+		}
+		if in.MaxInflight != nil {
+			a.MaxInflight = *in.MaxInflight
+		}
+		if a.PrefetchCount < 0 {
+			errs = append(errs, fmt.Errorf("%s.prefetch_count: must not be negative", field))
+		}
+		if a.MaxInflight < 0 {
+			errs = append(errs, fmt.Errorf("%s.max_inflight: must not be negative", field))
+		}
+		if len(errs) > 0 {
+			problems = append(problems, errs...)
+			continue
+		}
+		if declare(field, "assignment\x00"+assignmentKey(a)) {
+			defs.Assignments = append(defs.Assignments, a)
+		}
+	}
+	return defs, problems
+}
+
+// ParseManifest reads a single JSON manifest in the format of the topology files, e.g. a change
+// to validate before it is written. All problems are reported together.
+func ParseManifest(r io.Reader) (Definitions, error) {
+	var m manifest
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return Definitions{}, fmt.Errorf("failed to parse: %w", err)
+	}
+	declared := map[string]string{}
+	var duplicates []error
+	defs, problems := m.definitions(func(field, key string) bool {
+		if other, ok := declared[key]; ok {
+			duplicates = append(duplicates, fmt.Errorf("%s: already declared in %s", field, other))
+			return false
+		}
+		declared[key] = field
+		return true
+	})
+	if problems = append(problems, duplicates...); len(problems) > 0 {
+		return Definitions{}, errors.Join(problems...)
+	}
+	return defs, nil
+}
+
+// files returns the manifest paths in lexical order
+func (s *FileSource) files() ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != s.dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && isManifest(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topology directory: %w", err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// fingerprint identifies the current set of files by path, size and modification time
+func (s *FileSource) fingerprint() (string, error) {
+	paths, err := s.files()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\t%d\t%d\n", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func isManifest(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// readManifest decodes a file, rejecting unknown fields so that typos do not go unnoticed
+func readManifest(path string) (manifest, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return manifest{}, err
+	}
+	var m manifest
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&m)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		err = dec.Decode(&m)
+	}
+	// An empty file declares nothing
+	if err != nil && !errors.Is(err, io.EOF) {
+		return manifest{}, fmt.Errorf("failed to parse: %w", err)
+	}
+	return m, nil
+}
+
+// validateName checks an exchange or queue name. Names starting with "amq." are reserved by RabbitMQ.
+func validateName(field, name string) []error {
+	if errs := validateReference(field, name); len(errs) > 0 {
+		return errs
+	}
+	if strings.HasPrefix(name, "amq.") {
+		return []error{fmt.Errorf(`%s: must not start with "amq.", which is reserved by the broker`, field)}
+	}
+	return nil
+}
+
+// validateReference checks the name of an exchange or queue a binding or assignment refers to
+func validateReference(field, name string) []error {
+	switch {
+	case name == "":
+		return []error{fmt.Errorf("%s: is required", field)}
+	case len(name) > maxNameLength:
+		return []error{fmt.Errorf("%s: must be at most %d bytes", field, maxNameLength)}
+	}
+	return nil
+}
+
+// checkReferences checks that bindings and assignments refer to declared exchanges and queues.
+// The default and amq.* exchanges exist on every broker and need no declaration.
+func checkReferences(defs Definitions) error {
+	exchanges := make(map[string]bool, len(defs.Exchanges))
+	for _, e := range defs.Exchanges {
+		exchanges[e.ExchangeName] = true
+	}
+	queues := make(map[string]bool, len(defs.Queues))
+	for _, q := range defs.Queues {
+		queues[q.QueueName] = true
+	}
+
+	var problems []error
+	for _, b := range defs.Bindings {
+		if !exchanges[b.ExchangeName] && !systemExchange(b.ExchangeName) {
+			problems = append(problems, fmt.Errorf("binding %s -> %s (%q): exchange %q is not declared", b.ExchangeName, b.QueueName, b.RoutingKey, b.ExchangeName))
+		}
+		if !queues[b.QueueName] {
+			problems = append(problems, fmt.Errorf("binding %s -> %s (%q): queue %q is not declared", b.ExchangeName, b.QueueName, b.RoutingKey, b.QueueName))
+		}
+	}
+	for _, a := range defs.Assignments {
+		if !queues[a.QueueName] {
+			problems = append(problems, fmt.Errorf("assignment of %s to %s: queue %q is not declared", a.ServiceName, a.QueueName, a.QueueName))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// systemExchange reports whether the exchange is one the broker declares itself
+func systemExchange(name string) bool {
+	return name == "" || strings.HasPrefix(name, "amq.")
+}
+
+func prefixed(path string, errs []error) []error {
+	out := make([]error, len(errs))
+	for i, err := range errs {
+		out[i] = fmt.Errorf("%s: %w", path, err)
+	}
+	return out
+}
+
+func orEmpty(j models.JSONB) models.JSONB {
+	if j == nil {
+		return models.JSONB{}
+	}
+	return j
+}
+
+// Watcher polls a FileSource and calls onChange when the files changed and can be parsed.
+// Invalid changes are only logged: reconciliations fail on them rather than acting on a partial
+// topology, until the files are fixed. References are left to the reconciliation, since with a
+// merged source they may point to the database.
+type Watcher struct {
+	source   *FileSource
+	interval time.Duration
+	onChange func()
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	logger *slog.Logger
+}
+
+// NewWatcher creates a watcher checking source for changes every interval
+func NewWatcher(source *FileSource, interval time.Duration, onChange func()) *Watcher {
+	return &Watcher{
+		source:   source,
+		interval: interval,
+		onChange: onChange,
+		logger:   logging.Component(nil, "topology"),
+	}
+}
+
+// SetLogger replaces the watcher's logger
+func (w *Watcher) SetLogger(logger *slog.Logger) {
+	w.logger = logging.Component(logger, "topology")
+}
+
+// Start watches in the background until Stop is called
+func (w *Watcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+
+	last, err := w.source.fingerprint()
+	if err != nil {
+		w.logger.Warn("failed to read topology files", "dir", w.source.dir, logging.Err(err))
+	}
+	go func() {
+		defer close(w.done)
+		w.watch(ctx, last)
+	}()
+	w.logger.Info("watching topology files", "dir", w.source.dir, "interval", w.interval)
+}
+
+// Stop stops watching and waits for a running onChange to return
+func (w *Watcher) Stop() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+	w.cancel = nil
+}
+
+func (w *Watcher) watch(ctx context.Context, last string) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		last = w.check(last)
+	}
+}
+
+// check calls onChange if the files changed since last and are valid, and returns the new fingerprint
+func (w *Watcher) check(last string) string {
+	current, err := w.source.fingerprint()
+	if err != nil {
+		w.logger.Warn("failed to read topology files", "dir", w.source.dir, logging.Err(err))
+		return last
+	}
+	if current == last {
+		return last
+	}
+	defs, err := w.source.parse()
+	if err != nil {
+		w.logger.Error("topology files changed but are invalid", logging.Err(err))
+		return current
+	}
+	w.logger.Info("topology files changed", "exchanges", len(defs.Exchanges), "queues", len(defs.Queues),
+		"bindings", len(defs.Bindings), "assignments", len(defs.Assignments))
+	w.onChange()
+	return current
+}
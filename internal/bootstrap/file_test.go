@@ -0,0 +1,266 @@
+package bootstrap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-manager/internal/models"
+)
+
+// writeFiles creates the files in a temporary directory and returns it
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestFileSource_Load(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"shared.yaml": `
+exchanges:
+  - exchange_name: ex.orders
+    exchange_type: topic
+`,
+		"orders/topology.yml": `
+queues:
+  - queue_name: q.orders
+    arguments:
+      x-queue-type: quorum
+  - queue_name: q.orders.tmp
+    durable: false
+    auto_delete: true
+bindings:
+  - exchange_name: ex.orders
+    queue_name: q.orders
+    routing_key: order.*
+assignments:
+  - service_name: orders-api
+    queue_name: q.orders
+    prefetch_count: 20
+`,
+		"billing.json": `{"queues": [{"queue_name": "q.billing"}],
+			"bindings": [{"exchange_name": "ex.orders", "queue_name": "q.billing", "routing_key": "order.paid"}]}`,
+		"README.md":        "not a manifest",
+		".drafts/wip.yaml": "queues: [{queue_name: q.draft}]",
+		"empty.yaml":       "",
+	})
+
+	defs, err := NewFileSource(dir).Load(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(defs.Exchanges) != 1 || len(defs.Queues) != 3 || len(defs.Bindings) != 2 || len(defs.Assignments) != 1 {
+		t.Fatalf("unexpected definitions: %+v", defs)
+	}
+	// Files are read in lexical order: billing.json, orders/topology.yml, shared.yaml
+	if q := defs.Queues[1]; q.QueueName != "q.orders" || !q.Durable || q.Arguments["x-queue-type"] != "quorum" {
+		t.Fatalf("unexpected queue: %+v", q)
+	}
+	if q := defs.Queues[2]; q.Durable || !q.AutoDelete {
+		t.Fatalf("expected a transient auto-delete queue, got %+v", q)
+	}
+	if a := defs.Assignments[0]; a.PrefetchCount != 20 || a.MaxInflight != defaultMaxInflight {
+		t.Fatalf("expected prefetch 20 and the default max inflight, got %+v", a)
+	}
+
+	top := defs.Topology()
+	if top.Exchanges["ex.orders"] != "topic" || len(top.Queues) != 3 || top.Bindings[1] != [3]string{"q.orders", "ex.orders", "order.*"} {
+		t.Fatalf("unexpected topology: %+v", top)
+	}
+}
+
+func TestFileSource_SystemExchanges(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"audit.yaml": `
+queues:
+  - queue_name: q.audit
+bindings:
+  - exchange_name: amq.topic
+    queue_name: q.audit
+    routing_key: "#"
+`})
+
+	defs, err := NewFileSource(dir).Load(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(defs.Bindings) != 1 || defs.Bindings[0].ExchangeName != "amq.topic" {
+		t.Fatalf("expected the binding to amq.topic, got %+v", defs.Bindings)
+	}
+}
+
+func TestFileSource_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "invalid resources",
+			files: map[string]string{"a.yaml": `
+exchanges:
+  - exchange_name: amq.orders
+    exchange_type: topic
+  - exchange_name: ex.orders
+    exchange_type: queue
+queues:
+  - durable: true
+assignments:
+  - queue_name: q.orders
+    max_inflight: -1
+`},
+			want: []string{
+				`a.yaml: exchanges[0].exchange_name: must not start with "amq."`,
+				"a.yaml: exchanges[1].exchange_type: must be direct, topic, fanout or headers",
+				"a.yaml: queues[0].queue_name: is required",
+				"a.yaml: assignments[0].service_name: is required",
+				"a.yaml: assignments[0].max_inflight: must not be negative",
+			},
+		},
+		{
+			name:  "unknown fields",
+			files: map[string]string{"a.yaml": "queues:\n  - queue_name: q.orders\n    durabel: true\n", "b.json": `{"queue": []}`},
+			want:  []string{"a.yaml: failed to parse", "field durabel not found", `b.json: failed to parse: json: unknown field "queue"`},
+		},
+		{
+			name: "duplicates across files",
+			files: map[string]string{
+				"a.yaml": "queues: [{queue_name: q.orders}]",
+				"b.yaml": "queues: [{queue_name: q.orders}]",
+			},
+			want: []string{"b.yaml: queues[0]: already declared in a.yaml"},
+		},
+		{
+			name: "undeclared references",
+			files: map[string]string{"a.yaml": `
+bindings:
+  - exchange_name: ex.orders
+    queue_name: q.orders
+assignments:
+  - service_name: orders-api
+    queue_name: q.missing
+`},
+			want: []string{
+				`exchange "ex.orders" is not declared`,
+				`queue "q.orders" is not declared`,
+				`assignment of orders-api to q.missing: queue "q.missing" is not declared`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defs, err := NewFileSource(writeFiles(t, tt.files)).Load(context.Background())
+			if err == nil {
+				t.Fatalf("expected error, got %+v", defs)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got:\n%v", want, err)
+				}
+			}
+		})
+	}
+
+	t.Run("missing directory", func(t *testing.T) {
+		if _, err := NewFileSource(filepath.Join(t.TempDir(), "missing")).Load(context.Background()); err == nil {
+			t.Fatalf("expected error for a missing directory")
+		}
+	})
+}
+
+func TestParseManifest(t *testing.T) {
+	defs, err := ParseManifest(strings.NewReader(`{
+		"queues": [{"queue_name": "q.orders", "arguments": {"x-message-ttl": 60000}}],
+		"assignments": [{"service_name": "orders-api", "queue_name": "q.orders"}]
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(defs.Queues) != 1 || !defs.Queues[0].Durable || defs.Assignments[0].MaxInflight != defaultMaxInflight {
+		t.Fatalf("expected the defaults of the topology files, got %+v", defs)
+	}
+
+	_, err = ParseManifest(strings.NewReader(`{"queues": [{"queue_name": "q.orders"}, {"queue_name": "q.orders"}, {}]}`))
+	for _, want := range []string{"queues[1]: already declared in queues[0]", "queues[2].queue_name: is required"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := Definitions{
+		Exchanges: []models.Exchange{{ExchangeName: "ex.orders", ExchangeType: "direct"}},
+		Queues:    []models.Queue{{QueueName: "q.orders", Durable: true}, {QueueName: "q.audit", Durable: true}},
+		Bindings:  []models.Binding{{ExchangeName: "ex.orders", QueueName: "q.orders", RoutingKey: "created"}},
+	}
+	overlay := Definitions{
+		Exchanges: []models.Exchange{{ExchangeName: "ex.orders", ExchangeType: "topic"}},
+		Queues:    []models.Queue{{QueueName: "q.billing", Durable: true}},
+		Bindings: []models.Binding{
+			{ExchangeName: "ex.orders", QueueName: "q.orders", RoutingKey: "created", Mandatory: true},
+			{ExchangeName: "ex.orders", QueueName: "q.billing", RoutingKey: "paid"},
+		},
+		Assignments: []models.ServiceAssignment{{ServiceName: "billing", QueueName: "q.billing"}},
+	}
+
+	merged := Merge(base, overlay)
+	if len(merged.Exchanges) != 1 || merged.Exchanges[0].ExchangeType != "topic" {
+		t.Fatalf("expected the file exchange to override the database, got %+v", merged.Exchanges)
+	}
+	if names := merged.Topology().Queues; strings.Join(names, ",") != "q.orders,q.audit,q.billing" {
+		t.Fatalf("unexpected queues: %v", names)
+	}
+	if len(merged.Bindings) != 2 || !merged.Bindings[0].Mandatory {
+		t.Fatalf("expected the file binding to replace the database binding, got %+v", merged.Bindings)
+	}
+	if err := checkReferences(merged); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"a.yaml": "queues: [{queue_name: q.orders}]"})
+	changes := 0
+	w := NewWatcher(NewFileSource(dir), time.Second, func() { changes++ })
+
+	last, err := w.source.fingerprint()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.check(last) != last || changes != 0 {
+		t.Fatalf("expected no change")
+	}
+
+	write := func(content string) {
+		if err := os.WriteFile(filepath.Join(dir, "b.yaml"), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+	write("queues: [{queue_name: q.orders}]")
+	last = w.check(last)
+	if changes != 0 {
+		t.Fatalf("expected an invalid change to be ignored")
+	}
+	write("queues: [{queue_name: q.billing}]")
+	// Make sure the modification is visible even on coarse file system timestamps
+	if err := os.Chtimes(filepath.Join(dir, "b.yaml"), time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("failed to touch: %v", err)
+	}
+	w.check(last)
+	if changes != 1 {
+		t.Fatalf("expected one change, got %d", changes)
+	}
+}
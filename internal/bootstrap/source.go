@@ -0,0 +1,150 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"queue-manager/internal/models"
+	"queue-manager/internal/repository"
+)
+
+// Definitions is the expected topology as declared by a TopologySource, with the properties of
+// each resource and the service assignments the reconciler does not act on
+type Definitions struct {
+	Exchanges   []models.Exchange
+	Queues      []models.Queue
+	Bindings    []models.Binding
+	Assignments []models.ServiceAssignment
+}
+
+// Topology returns the names, exchange types and bindings the reconciler works with
+func (d Definitions) Topology() Topology {
+	top := Topology{
+		Exchanges: map[string]string{},
+		Queues:    []string{},
+		Bindings:  [][3]string{},
+	}
+	for _, e := range d.Exchanges {
+		top.Exchanges[e.ExchangeName] = e.ExchangeType
+	}
+	for _, q := range d.Queues {
+		top.Queues = append(top.Queues, q.QueueName)
+	}
+	for _, b := range d.Bindings {
+		top.Bindings = append(top.Bindings, [3]string{b.QueueName, b.ExchangeName, b.RoutingKey})
+	}
+	return top
+}
+
+// TopologySource provides the expected topology
+type TopologySource interface {
+	// Name identifies the source in logs: db, file or merged
+	Name() string
+	// Load returns the current definitions, or an error if they cannot be read or are invalid.
+	// An error must never be reported as an empty topology, which would prune everything.
+	Load(ctx context.Context) (Definitions, error)
+}
+
+// DBSource reads the topology from PostgreSQL, the default source of truth
+type DBSource struct {
+	repo *repository.Repository
+}
+
+// NewDBSource creates a source reading from the repository
+func NewDBSource(repo *repository.Repository) *DBSource {
+	return &DBSource{repo: repo}
+}
+
+// Name implements TopologySource
+func (s *DBSource) Name() string { return "db" }
+
+// Load implements TopologySource
+func (s *DBSource) Load(ctx context.Context) (Definitions, error) {
+	repo := s.repo.WithContext(ctx)
+	var defs Definitions
+	var err error
+	if defs.Exchanges, err = repo.ListExchanges(); err != nil {
+		return Definitions{}, fmt.Errorf("failed to load exchanges: %w", err)
+	}
+	if defs.Queues, err = repo.ListQueues(); err != nil {
+		return Definitions{}, fmt.Errorf("failed to load queues: %w", err)
+	}
+	if defs.Bindings, err = repo.ListBindings(); err != nil {
+		return Definitions{}, fmt.Errorf("failed to load bindings: %w", err)
+	}
+	if defs.Assignments, err = repo.ListServiceAssignments(); err != nil {
+		return Definitions{}, fmt.Errorf("failed to load service assignments: %w", err)
+	}
+	return defs, nil
+}
+
+// MergedSource combines the database with manifest files. Files add resources and override
+// database resources with the same name (exchanges, queues) or key (bindings: exchange, queue
+// and routing key; assignments: service and queue). Bindings and assignments in the files may
+// refer to exchanges and queues that are only in the database.
+type MergedSource struct {
+	db    *DBSource
+	files *FileSource
+}
+
+// NewMergedSource creates a source overlaying files on the database
+func NewMergedSource(db *DBSource, files *FileSource) *MergedSource {
+	return &MergedSource{db: db, files: files}
+}
+
+// Name implements TopologySource
+func (s *MergedSource) Name() string { return "merged" }
+
+// Load implements TopologySource
+func (s *MergedSource) Load(ctx context.Context) (Definitions, error) {
+	base, err := s.db.Load(ctx)
+	if err != nil {
+		return Definitions{}, err
+	}
+	overlay, err := s.files.parse()
+	if err != nil {
+		return Definitions{}, err
+	}
+	defs := Merge(base, overlay)
+	if err := checkReferences(defs); err != nil {
+		return Definitions{}, fmt.Errorf("invalid topology files in %s: %w", s.files.dir, err)
+	}
+	return defs, nil
+}
+
+// Merge returns base with the resources of overlay added, replacing base resources with the same key
+func Merge(base, overlay Definitions) Definitions {
+	return Definitions{
+		Exchanges:   mergeByKey(base.Exchanges, overlay.Exchanges, func(e models.Exchange) string { return e.ExchangeName }),
+		Queues:      mergeByKey(base.Queues, overlay.Queues, func(q models.Queue) string { return q.QueueName }),
+		Bindings:    mergeByKey(base.Bindings, overlay.Bindings, bindingKey),
+		Assignments: mergeByKey(base.Assignments, overlay.Assignments, assignmentKey),
+	}
+}
+
+// mergeByKey keeps the order of base, with overridden items in place and new items appended
+func mergeByKey[T any](base, overlay []T, key func(T) string) []T {
+	index := make(map[string]int, len(base))
+	merged := make([]T, 0, len(base)+len(overlay))
+	for _, item := range base {
+		index[key(item)] = len(merged)
+		merged = append(merged, item)
+	}
+	for _, item := range overlay {
+		if i, ok := index[key(item)]; ok {
+			merged[i] = item
+			continue
+		}
+		index[key(item)] = len(merged)
+		merged = append(merged, item)
+	}
+	return merged
+}
+
+func bindingKey(b models.Binding) string {
+	return b.ExchangeName + "\x00" + b.QueueName + "\x00" + b.RoutingKey
+}
+
+func assignmentKey(a models.ServiceAssignment) string {
+	return a.ServiceName + "\x00" + a.QueueName
+}
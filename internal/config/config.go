@@ -3,10 +3,25 @@ package config
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type LookupFunc func(key string) (string, bool)
 
+// DefaultLeaderElectionLockKey is the advisory lock key replicas compete for unless overridden
+const DefaultLeaderElectionLockKey int64 = 7265001
+
+// JobSchedule configures one scheduled job
+type JobSchedule struct {
+	Enabled bool
+	// Schedule is a standard cron expression or a descriptor such as "@every 30s"
+	Schedule string
+	// Jitter delays each run by a random duration up to this value, spreading load across replicas
+	Jitter time.Duration
+}
+
 type Config struct {
 	AppHost       string
 	AppPort       string
@@ -14,6 +29,59 @@ type Config struct {
 	RabbitAMQPURI string
 	RabbitHTTPURI string
 	QueueProvider string
+
+	// TopologySource is where the expected topology is read from: db, file or merged (files over
+	// the database). Files are read from TopologyDir and polled every TopologyWatchInterval (0 disables watching).
+	TopologySource        string
+	TopologyDir           string
+	TopologyWatchInterval time.Duration
+
+	// Reconciliation pruning guards
+	ReconcileAllowEmptyExpectation bool
+	ReconcileMaxShrinkPercent      int
+	ReconcileMaxDeletions          int
+	ReconcileDeletionGracePeriod   time.Duration
+	ReconcileDeletionGraceRuns     int
+
+	// Leader election between replicas (Postgres advisory lock)
+	LeaderElectionEnabled  bool
+	LeaderElectionLockKey  int64
+	LeaderElectionInterval time.Duration
+
+	// Event-driven reconciliation (Postgres LISTEN/NOTIFY)
+	ReconcileEventsEnabled     bool
+	ReconcileEventsDebounce    time.Duration
+	ReconcileSafetyNetInterval time.Duration
+
+	// Scheduled jobs
+	SchedulerHealth    JobSchedule
+	SchedulerReconcile JobSchedule
+	SchedulerReport    JobSchedule
+
+	// MetricsQueueStatsEnabled exposes per-queue depth and consumer gauges on /metrics
+	MetricsQueueStatsEnabled bool
+
+	// RealityCacheTTL is how long GET /reality serves the same provider snapshot (0 disables caching)
+	RealityCacheTTL time.Duration
+
+	// APITokens are the bearer tokens accepted by the write API; it is disabled when empty
+	APITokens []string
+
+	// OpenTelemetry tracing; the exporter reads its endpoint from the standard OTEL_EXPORTER_OTLP_* variables
+	TracingEnabled     bool
+	TracingSampleRatio float64
+
+	// Logging: level is trace, debug, info, warn or error; format is json or text
+	LogLevel  string
+	LogFormat string
+
+	// Outbound webhooks; sinks are defined in the JSON file at WebhooksFile (disabled when empty)
+	WebhooksFile       string
+	WebhookMaxAttempts int
+	WebhookBackoff     time.Duration
+	WebhookTimeout     time.Duration
+	// WebhookErrorRuns is the number of consecutive runs with errors that triggers a notification
+	WebhookErrorRuns int
 }
 
 func (c Config) Addr() string {
@@ -44,7 +112,215 @@ func LoadFromEnv(lookup LookupFunc) (Config, error) {
 	if cfg.QueueProvider, ok = lookup("QUEUE_PROVIDER"); !ok {
 		cfg.QueueProvider = ""
 	}
+
+	var err error
+	if cfg.TopologySource, err = lookupOneOf(lookup, "TOPOLOGY_SOURCE", "db", "db", "file", "merged"); err != nil {
+		return Config{}, err
+	}
+	cfg.TopologyDir, _ = lookup("TOPOLOGY_DIR")
+	if cfg.TopologySource != "db" && cfg.TopologyDir == "" {
+		return Config{}, fmt.Errorf("TOPOLOGY_SOURCE=%s requires TOPOLOGY_DIR", cfg.TopologySource)
+	}
+	// Run history, grace periods and leader election still live in the database
+	if cfg.TopologySource != "db" && cfg.PostgresURI == "" {
+		return Config{}, fmt.Errorf("TOPOLOGY_SOURCE=%s requires POSTGRES_URI", cfg.TopologySource)
+	}
+	if cfg.TopologyWatchInterval, err = lookupDuration(lookup, "TOPOLOGY_WATCH_INTERVAL", 10*time.Second); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.ReconcileAllowEmptyExpectation, err = lookupBool(lookup, "RECONCILE_ALLOW_EMPTY_EXPECTATION", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReconcileMaxShrinkPercent, err = lookupNonNegativeInt(lookup, "RECONCILE_MAX_SHRINK_PERCENT", 50); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReconcileMaxDeletions, err = lookupNonNegativeInt(lookup, "RECONCILE_MAX_DELETIONS", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReconcileDeletionGracePeriod, err = lookupDuration(lookup, "RECONCILE_DELETION_GRACE_PERIOD", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReconcileDeletionGraceRuns, err = lookupNonNegativeInt(lookup, "RECONCILE_DELETION_GRACE_RUNS", 0); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.LeaderElectionEnabled, err = lookupBool(lookup, "LEADER_ELECTION_ENABLED", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.LeaderElectionEnabled && cfg.PostgresURI == "" {
+		return Config{}, errors.New("LEADER_ELECTION_ENABLED requires POSTGRES_URI")
+	}
+	cfg.LeaderElectionLockKey = DefaultLeaderElectionLockKey
+	if v, ok := lookup("LEADER_ELECTION_LOCK_KEY"); ok && v != "" {
+		if cfg.LeaderElectionLockKey, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return Config{}, errors.New("LEADER_ELECTION_LOCK_KEY must be an integer")
+		}
+	}
+	if cfg.LeaderElectionInterval, err = lookupDuration(lookup, "LEADER_ELECTION_INTERVAL", 10*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.LeaderElectionInterval == 0 {
+		return Config{}, errors.New("LEADER_ELECTION_INTERVAL must be greater than zero")
+	}
+
+	if cfg.ReconcileEventsEnabled, err = lookupBool(lookup, "RECONCILE_EVENTS_ENABLED", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReconcileEventsEnabled && cfg.PostgresURI == "" {
+		return Config{}, errors.New("RECONCILE_EVENTS_ENABLED requires POSTGRES_URI")
+	}
+	if cfg.ReconcileEventsDebounce, err = lookupDuration(lookup, "RECONCILE_EVENTS_DEBOUNCE", 2*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReconcileEventsDebounce == 0 {
+		return Config{}, errors.New("RECONCILE_EVENTS_DEBOUNCE must be greater than zero")
+	}
+	if cfg.ReconcileSafetyNetInterval, err = lookupDuration(lookup, "RECONCILE_SAFETY_NET_INTERVAL", 5*time.Minute); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.SchedulerHealth, err = lookupJobSchedule(lookup, "SCHEDULER_HEALTH", true, "@every 30s"); err != nil {
+		return Config{}, err
+	}
+	// With event-driven reconciliation the full reconciliation only runs as a slower safety net
+	reconcileSchedule := "@every 30s"
+	if cfg.ReconcileEventsEnabled {
+		reconcileSchedule = "@every " + cfg.ReconcileSafetyNetInterval.String()
+	}
+	if cfg.SchedulerReconcile, err = lookupJobSchedule(lookup, "SCHEDULER_RECONCILE", true, reconcileSchedule); err != nil {
+		return Config{}, err
+	}
+	if cfg.SchedulerReport, err = lookupJobSchedule(lookup, "SCHEDULER_REPORT", false, "@every 5m"); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.MetricsQueueStatsEnabled, err = lookupBool(lookup, "METRICS_QUEUE_STATS_ENABLED", false); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.RealityCacheTTL, err = lookupDuration(lookup, "REALITY_CACHE_TTL", 5*time.Second); err != nil {
+		return Config{}, err
+	}
+
+	if v, ok := lookup("API_TOKENS"); ok {
+		for _, token := range strings.Split(v, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				cfg.APITokens = append(cfg.APITokens, token)
+			}
+		}
+	}
+
+	if cfg.TracingEnabled, err = lookupBool(lookup, "TRACING_ENABLED", false); err != nil {
+		return Config{}, err
+	}
+	cfg.TracingSampleRatio = 1
+	if v, ok := lookup("TRACING_SAMPLE_RATIO"); ok && v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return Config{}, errors.New("TRACING_SAMPLE_RATIO must be a number between 0 and 1")
+		}
+		cfg.TracingSampleRatio = ratio
+	}
+
+	if cfg.LogLevel, err = lookupOneOf(lookup, "LOG_LEVEL", "info", "trace", "debug", "info", "warn", "error"); err != nil {
+		return Config{}, err
+	}
+	if cfg.LogFormat, err = lookupOneOf(lookup, "LOG_FORMAT", "json", "json", "text"); err != nil {
+		return Config{}, err
+	}
+
+	cfg.WebhooksFile, _ = lookup("WEBHOOKS_FILE")
+	if cfg.WebhookMaxAttempts, err = lookupNonNegativeInt(lookup, "WEBHOOK_MAX_ATTEMPTS", 5); err != nil {
+		return Config{}, err
+	}
+	if cfg.WebhookMaxAttempts == 0 {
+		return Config{}, errors.New("WEBHOOK_MAX_ATTEMPTS must be greater than zero")
+	}
+	if cfg.WebhookBackoff, err = lookupDuration(lookup, "WEBHOOK_BACKOFF", time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.WebhookTimeout, err = lookupDuration(lookup, "WEBHOOK_TIMEOUT", 10*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.WebhookTimeout == 0 {
+		return Config{}, errors.New("WEBHOOK_TIMEOUT must be greater than zero")
+	}
+	if cfg.WebhookErrorRuns, err = lookupNonNegativeInt(lookup, "WEBHOOK_ERROR_RUNS", 3); err != nil {
+		return Config{}, err
+	}
+	if cfg.WebhookErrorRuns == 0 {
+		return Config{}, errors.New("WEBHOOK_ERROR_RUNS must be greater than zero")
+	}
 	return cfg, nil
 }
 
+// lookupBool reads an optional boolean variable, falling back to def when unset or empty
+func lookupBool(lookup LookupFunc, key string, def bool) (bool, error) {
+	v, ok := lookup(key)
+	if !ok || v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean value", key)
+	}
+	return b, nil
+}
+
+// lookupNonNegativeInt reads an optional integer variable, falling back to def when unset or empty
+func lookupNonNegativeInt(lookup LookupFunc, key string, def int) (int, error) {
+	v, ok := lookup(key)
+	if !ok || v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return n, nil
+}
+
+// lookupDuration reads an optional non-negative duration such as "24h", falling back to def when unset or empty
+func lookupDuration(lookup LookupFunc, key string, def time.Duration) (time.Duration, error) {
+	v, ok := lookup(key)
+	if !ok || v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative duration such as 24h", key)
+	}
+	return d, nil
+}
+
+// lookupOneOf reads an optional case-insensitive choice, falling back to def when unset or empty
+func lookupOneOf(lookup LookupFunc, key, def string, allowed ...string) (string, error) {
+	v, ok := lookup(key)
+	if !ok || v == "" {
+		return def, nil
+	}
+	v = strings.ToLower(v)
+	for _, a := range allowed {
+		if v == a {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("%s must be one of %s", key, strings.Join(allowed, ", "))
+}
 
+// lookupJobSchedule reads <prefix>_ENABLED, <prefix>_SCHEDULE and <prefix>_JITTER
+func lookupJobSchedule(lookup LookupFunc, prefix string, enabled bool, schedule string) (JobSchedule, error) {
+	job := JobSchedule{Schedule: schedule}
+	var err error
+	if job.Enabled, err = lookupBool(lookup, prefix+"_ENABLED", enabled); err != nil {
+		return JobSchedule{}, err
+	}
+	if v, ok := lookup(prefix + "_SCHEDULE"); ok && v != "" {
+		job.Schedule = v
+	}
+	if job.Jitter, err = lookupDuration(lookup, prefix+"_JITTER", 0); err != nil {
+		return JobSchedule{}, err
+	}
+	return job, nil
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestLoadFromEnv_Success(t *testing.T) {
@@ -40,4 +42,374 @@ func TestLoadFromEnv_MissingPort(t *testing.T) {
 	}
 }
 
+func TestLoadFromEnv_ReconcileGuards(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	t.Run("defaults", func(t *testing.T) {
+		got, err := LoadFromEnv(os.LookupEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.ReconcileAllowEmptyExpectation || got.ReconcileMaxShrinkPercent != 50 || got.ReconcileMaxDeletions != 0 {
+			t.Fatalf("unexpected guard defaults: %+v", got)
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("RECONCILE_ALLOW_EMPTY_EXPECTATION", "true")
+		t.Setenv("RECONCILE_MAX_SHRINK_PERCENT", "20")
+		t.Setenv("RECONCILE_MAX_DELETIONS", "5")
+		got, err := LoadFromEnv(os.LookupEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !got.ReconcileAllowEmptyExpectation || got.ReconcileMaxShrinkPercent != 20 || got.ReconcileMaxDeletions != 5 {
+			t.Fatalf("unexpected guard values: %+v", got)
+		}
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		t.Setenv("RECONCILE_MAX_DELETIONS", "-1")
+		if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+			t.Fatalf("expected error for negative RECONCILE_MAX_DELETIONS")
+		}
+	})
+}
+
+func TestLoadFromEnv_DeletionGrace(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	t.Run("defaults", func(t *testing.T) {
+		got, err := LoadFromEnv(os.LookupEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.ReconcileDeletionGracePeriod != 0 || got.ReconcileDeletionGraceRuns != 0 {
+			t.Fatalf("unexpected grace defaults: %+v", got)
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("RECONCILE_DELETION_GRACE_PERIOD", "24h")
+		t.Setenv("RECONCILE_DELETION_GRACE_RUNS", "3")
+		got, err := LoadFromEnv(os.LookupEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.ReconcileDeletionGracePeriod != 24*time.Hour || got.ReconcileDeletionGraceRuns != 3 {
+			t.Fatalf("unexpected grace values: %+v", got)
+		}
+	})
+
+	t.Run("invalid duration", func(t *testing.T) {
+		t.Setenv("RECONCILE_DELETION_GRACE_PERIOD", "tomorrow")
+		if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+			t.Fatalf("expected error for invalid RECONCILE_DELETION_GRACE_PERIOD")
+		}
+	})
+}
+
+func TestLoadFromEnv_LeaderElection(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	t.Run("disabled by default", func(t *testing.T) {
+		got, err := LoadFromEnv(os.LookupEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.LeaderElectionEnabled || got.LeaderElectionLockKey != DefaultLeaderElectionLockKey || got.LeaderElectionInterval != 10*time.Second {
+			t.Fatalf("unexpected leader election defaults: %+v", got)
+		}
+	})
+
+	t.Run("requires database", func(t *testing.T) {
+		t.Setenv("LEADER_ELECTION_ENABLED", "true")
+		if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+			t.Fatalf("expected error when leader election is enabled without POSTGRES_URI")
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("LEADER_ELECTION_ENABLED", "true")
+		t.Setenv("POSTGRES_URI", "postgres://localhost/db")
+		t.Setenv("LEADER_ELECTION_LOCK_KEY", "42")
+		t.Setenv("LEADER_ELECTION_INTERVAL", "3s")
+		got, err := LoadFromEnv(os.LookupEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !got.LeaderElectionEnabled || got.LeaderElectionLockKey != 42 || got.LeaderElectionInterval != 3*time.Second {
+			t.Fatalf("unexpected leader election values: %+v", got)
+		}
+	})
+}
+
+func TestLoadFromEnv_ReconcileEvents(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	t.Run("disabled by default", func(t *testing.T) {
+		got, err := LoadFromEnv(os.LookupEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.ReconcileEventsEnabled || got.ReconcileEventsDebounce != 2*time.Second || got.ReconcileSafetyNetInterval != 5*time.Minute {
+			t.Fatalf("unexpected event defaults: %+v", got)
+		}
+	})
+
+	t.Run("requires database", func(t *testing.T) {
+		t.Setenv("RECONCILE_EVENTS_ENABLED", "true")
+		if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+			t.Fatalf("expected error when events are enabled without POSTGRES_URI")
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("RECONCILE_EVENTS_ENABLED", "true")
+		t.Setenv("POSTGRES_URI", "postgres://localhost/db")
+		t.Setenv("RECONCILE_EVENTS_DEBOUNCE", "500ms")
+		t.Setenv("RECONCILE_SAFETY_NET_INTERVAL", "10m")
+		got, err := LoadFromEnv(os.LookupEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !got.ReconcileEventsEnabled || got.ReconcileEventsDebounce != 500*time.Millisecond || got.ReconcileSafetyNetInterval != 10*time.Minute {
+			t.Fatalf("unexpected event values: %+v", got)
+		}
+	})
+
+	t.Run("zero debounce", func(t *testing.T) {
+		t.Setenv("RECONCILE_EVENTS_DEBOUNCE", "0s")
+		if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+			t.Fatalf("expected error for zero RECONCILE_EVENTS_DEBOUNCE")
+		}
+	})
+}
+
+func TestLoadFromEnv_Scheduler(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	t.Run("defaults", func(t *testing.T) {
+		got, err := LoadFromEnv(os.LookupEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.SchedulerHealth != (JobSchedule{Enabled: true, Schedule: "@every 30s"}) ||
+			got.SchedulerReconcile != (JobSchedule{Enabled: true, Schedule: "@every 30s"}) ||
+			got.SchedulerReport != (JobSchedule{Enabled: false, Schedule: "@every 5m"}) {
+			t.Fatalf("unexpected scheduler defaults: %+v", got)
+		}
+	})
 
+	t.Run("safety net with events", func(t *testing.T) {
+		t.Setenv("RECONCILE_EVENTS_ENABLED", "true")
+		t.Setenv("POSTGRES_URI", "postgres://localhost/db")
+		got, err := LoadFromEnv(os.LookupEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.SchedulerReconcile.Schedule != "@every 5m0s" {
+			t.Fatalf("unexpected reconcile schedule: %q", got.SchedulerReconcile.Schedule)
+		}
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		t.Setenv("SCHEDULER_RECONCILE_SCHEDULE", "*/2 * * * *")
+		t.Setenv("SCHEDULER_RECONCILE_JITTER", "15s")
+		t.Setenv("SCHEDULER_REPORT_ENABLED", "true")
+		t.Setenv("SCHEDULER_HEALTH_ENABLED", "false")
+		got, err := LoadFromEnv(os.LookupEnv)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.SchedulerReconcile != (JobSchedule{Enabled: true, Schedule: "*/2 * * * *", Jitter: 15 * time.Second}) ||
+			!got.SchedulerReport.Enabled || got.SchedulerHealth.Enabled {
+			t.Fatalf("unexpected scheduler values: %+v", got)
+		}
+	})
+
+	t.Run("invalid jitter", func(t *testing.T) {
+		t.Setenv("SCHEDULER_HEALTH_JITTER", "soon")
+		if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+			t.Fatalf("expected error for invalid SCHEDULER_HEALTH_JITTER")
+		}
+	})
+}
+
+func TestLoadFromEnv_Metrics(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	got, err := LoadFromEnv(os.LookupEnv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.MetricsQueueStatsEnabled {
+		t.Fatalf("per-queue metrics must be opt-in")
+	}
+
+	t.Setenv("METRICS_QUEUE_STATS_ENABLED", "true")
+	if got, err = LoadFromEnv(os.LookupEnv); err != nil || !got.MetricsQueueStatsEnabled {
+		t.Fatalf("expected per-queue metrics enabled, got %+v (err %v)", got, err)
+	}
+}
+
+func TestLoadFromEnv_RealityCacheTTL(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	got, err := LoadFromEnv(os.LookupEnv)
+	if err != nil || got.RealityCacheTTL != 5*time.Second {
+		t.Fatalf("expected 5s reality cache TTL by default, got %v (err %v)", got.RealityCacheTTL, err)
+	}
+
+	t.Setenv("REALITY_CACHE_TTL", "0")
+	if got, err = LoadFromEnv(os.LookupEnv); err != nil || got.RealityCacheTTL != 0 {
+		t.Fatalf("expected caching disabled, got %v (err %v)", got.RealityCacheTTL, err)
+	}
+
+	t.Setenv("REALITY_CACHE_TTL", "soon")
+	if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+		t.Fatalf("expected error for invalid REALITY_CACHE_TTL")
+	}
+}
+
+func TestLoadFromEnv_APITokens(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	got, err := LoadFromEnv(os.LookupEnv)
+	if err != nil || len(got.APITokens) != 0 {
+		t.Fatalf("expected no API tokens by default, got %v (err %v)", got.APITokens, err)
+	}
+
+	t.Setenv("API_TOKENS", " ci-token, ,ops-token ")
+	got, err = LoadFromEnv(os.LookupEnv)
+	if err != nil || !reflect.DeepEqual(got.APITokens, []string{"ci-token", "ops-token"}) {
+		t.Fatalf("expected two API tokens, got %v (err %v)", got.APITokens, err)
+	}
+}
+
+func TestLoadFromEnv_TopologySource(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	got, err := LoadFromEnv(os.LookupEnv)
+	if err != nil || got.TopologySource != "db" || got.TopologyWatchInterval != 10*time.Second {
+		t.Fatalf("expected the db source by default, got %q/%v (err %v)", got.TopologySource, got.TopologyWatchInterval, err)
+	}
+
+	t.Setenv("TOPOLOGY_SOURCE", "file")
+	if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+		t.Fatalf("expected error for the file source without TOPOLOGY_DIR")
+	}
+	t.Setenv("TOPOLOGY_DIR", "/etc/queue-manager/topology")
+	if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+		t.Fatalf("expected error for the file source without POSTGRES_URI")
+	}
+	t.Setenv("POSTGRES_URI", "postgres://localhost/queue_manager")
+	t.Setenv("TOPOLOGY_WATCH_INTERVAL", "0")
+	got, err = LoadFromEnv(os.LookupEnv)
+	if err != nil || got.TopologySource != "file" || got.TopologyDir != "/etc/queue-manager/topology" || got.TopologyWatchInterval != 0 {
+		t.Fatalf("unexpected topology source config: %+v (err %v)", got, err)
+	}
+
+	t.Setenv("TOPOLOGY_SOURCE", "merged")
+	if got, err = LoadFromEnv(os.LookupEnv); err != nil || got.TopologySource != "merged" {
+		t.Fatalf("expected the merged source, got %q (err %v)", got.TopologySource, err)
+	}
+	t.Setenv("TOPOLOGY_SOURCE", "git")
+	if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+		t.Fatalf("expected error for an unknown source")
+	}
+}
+
+func TestLoadFromEnv_Tracing(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	got, err := LoadFromEnv(os.LookupEnv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.TracingEnabled || got.TracingSampleRatio != 1 {
+		t.Fatalf("expected tracing disabled with sample ratio 1, got %v/%v", got.TracingEnabled, got.TracingSampleRatio)
+	}
+
+	t.Setenv("TRACING_ENABLED", "true")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+	if got, err = LoadFromEnv(os.LookupEnv); err != nil || !got.TracingEnabled || got.TracingSampleRatio != 0.25 {
+		t.Fatalf("expected tracing enabled with ratio 0.25, got %+v (err %v)", got, err)
+	}
+
+	t.Setenv("TRACING_SAMPLE_RATIO", "1.5")
+	if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+		t.Fatalf("expected error for a sample ratio above 1")
+	}
+}
+
+func TestLoadFromEnv_Logging(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	got, err := LoadFromEnv(os.LookupEnv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.LogLevel != "info" || got.LogFormat != "json" {
+		t.Fatalf("expected info/json defaults, got %q/%q", got.LogLevel, got.LogFormat)
+	}
+
+	t.Setenv("LOG_LEVEL", "DEBUG")
+	t.Setenv("LOG_FORMAT", "text")
+	if got, err = LoadFromEnv(os.LookupEnv); err != nil || got.LogLevel != "debug" || got.LogFormat != "text" {
+		t.Fatalf("expected debug/text, got %+v (err %v)", got, err)
+	}
+
+	t.Setenv("LOG_LEVEL", "verbose")
+	if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+		t.Fatalf("expected error for an unknown log level")
+	}
+	t.Setenv("LOG_LEVEL", "info")
+	t.Setenv("LOG_FORMAT", "xml")
+	if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+		t.Fatalf("expected error for an unknown log format")
+	}
+}
+
+func TestLoadFromEnv_Webhooks(t *testing.T) {
+	t.Setenv("APP_HOST", "0.0.0.0")
+	t.Setenv("APP_PORT", "8080")
+
+	got, err := LoadFromEnv(os.LookupEnv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.WebhooksFile != "" || got.WebhookMaxAttempts != 5 || got.WebhookBackoff != time.Second ||
+		got.WebhookTimeout != 10*time.Second || got.WebhookErrorRuns != 3 {
+		t.Fatalf("unexpected webhook defaults: %+v", got)
+	}
+
+	t.Setenv("WEBHOOKS_FILE", "/etc/queue-manager/webhooks.json")
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "2")
+	t.Setenv("WEBHOOK_BACKOFF", "500ms")
+	t.Setenv("WEBHOOK_ERROR_RUNS", "5")
+	got, err = LoadFromEnv(os.LookupEnv)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.WebhooksFile != "/etc/queue-manager/webhooks.json" || got.WebhookMaxAttempts != 2 ||
+		got.WebhookBackoff != 500*time.Millisecond || got.WebhookErrorRuns != 5 {
+		t.Fatalf("unexpected webhook config: %+v", got)
+	}
+
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "0")
+	if _, err := LoadFromEnv(os.LookupEnv); err == nil {
+		t.Fatalf("expected error for zero WEBHOOK_MAX_ATTEMPTS")
+	}
+}
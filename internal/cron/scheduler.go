@@ -1,9 +1,18 @@
 package cron
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
 	"time"
 
+	"queue-manager/internal/config"
+	"queue-manager/internal/leader"
+	"queue-manager/internal/logging"
+	"queue-manager/internal/metrics"
 	"queue-manager/internal/queue"
 	"queue-manager/internal/reconciliation"
 	"queue-manager/internal/repository"
@@ -11,67 +20,147 @@ import (
 	"github.com/robfig/cron/v3"
 )
 
+// Scheduled job names
+const (
+	JobHealth    = "health"    // checks provider health and reconnects
+	JobReconcile = "reconcile" // full reconciliation (leader only)
+	JobReport    = "report"    // logs drift without changing the provider
+)
+
+// ErrJobNotFound is returned when pausing or resuming an unknown job
+var ErrJobNotFound = errors.New("job not found")
+
 type Scheduler struct {
 	c    *cron.Cron
 	qp   queue.Provider
 	repo *repository.Repository
+	rec  *reconciliation.Reconciler
+	// leader is nil when leader election is disabled, in which case this instance always reconciles
+	leader *leader.Elector
+	health HealthObserver
+
+	mu     sync.Mutex
+	jobs   []*job
+	stop   chan struct{}
+	logger *slog.Logger
+}
+
+// HealthObserver is told the outcome of every provider health check, e.g. to notify on changes
+type HealthObserver interface {
+	ProviderHealth(ctx context.Context, healthy bool, details string)
+}
+
+// job is a scheduled job and its run state
+type job struct {
+	name     string
+	schedule config.JobSchedule
+	run      func(ctx context.Context) error
+
+	entryID      cron.EntryID
+	paused       bool
+	running      bool
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    string
+}
+
+// JobStatus describes a scheduled job
+type JobStatus struct {
+	Name           string     `json:"name"`
+	Schedule       string     `json:"schedule"`
+	Enabled        bool       `json:"enabled"`
+	Paused         bool       `json:"paused"`
+	Running        bool       `json:"running"`
+	Jitter         string     `json:"jitter,omitempty"`
+	LastRun        *time.Time `json:"lastRun,omitempty"`
+	LastDurationMs int64      `json:"lastDurationMs,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	NextRun        *time.Time `json:"nextRun,omitempty"`
+}
+
+// NewScheduler creates a scheduler with the default jobs: health checks and reconciliation
+// every 30s, drift reporting disabled. Use Configure to change them before Start.
+func NewScheduler(qp queue.Provider, repo *repository.Repository, rec *reconciliation.Reconciler) *Scheduler {
+	if rec == nil {
+		rec = reconciliation.NewReconciler(qp, repo, reconciliation.Guards{}, reconciliation.GracePolicy{})
+	}
+	s := &Scheduler{
+		// A slow run must not overlap the next tick
+		c:      cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger))),
+		qp:     qp,
+		repo:   repo,
+		rec:    rec,
+		stop:   make(chan struct{}),
+		logger: logging.Component(nil, "cron"),
+	}
+	s.jobs = []*job{
+		{name: JobHealth, schedule: config.JobSchedule{Enabled: true, Schedule: "@every 30s"}, run: s.healthCheck},
+		{name: JobReconcile, schedule: config.JobSchedule{Enabled: true, Schedule: "@every 30s"}, run: s.reconcile},
+		{name: JobReport, schedule: config.JobSchedule{Enabled: false, Schedule: "@every 5m"}, run: s.report},
+	}
+	return s
 }
 
-func NewScheduler(qp queue.Provider, repo *repository.Repository) *Scheduler {
-	return &Scheduler{
-		c:    cron.New(),
-		qp:   qp,
-		repo: repo,
+// Configure sets the schedule of every job from the configuration
+func (s *Scheduler) Configure(cfg config.Config) error {
+	schedules := map[string]config.JobSchedule{
+		JobHealth:    cfg.SchedulerHealth,
+		JobReconcile: cfg.SchedulerReconcile,
+		JobReport:    cfg.SchedulerReport,
+	}
+	for name, schedule := range schedules {
+		if _, err := cron.ParseStandard(schedule.Schedule); err != nil {
+			return fmt.Errorf("invalid schedule %q for %s job: %w", schedule.Schedule, name, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		j.schedule = schedules[j.name]
 	}
+	return nil
+}
+
+// SetLogger replaces the scheduler's logger
+func (s *Scheduler) SetLogger(l *slog.Logger) {
+	s.logger = logging.Component(l, "cron")
+}
+
+// SetLeader restricts reconciliation to the instance holding leadership
+func (s *Scheduler) SetLeader(e *leader.Elector) {
+	s.leader = e
+}
+
+// SetHealthObserver reports the outcome of every health check to o
+func (s *Scheduler) SetHealthObserver(o HealthObserver) {
+	s.health = o
 }
 
 func (s *Scheduler) Start() {
 	if s.qp == nil {
-		log.Printf("[cron] scheduler not started: queue provider is nil")
+		s.logger.Warn("scheduler not started: queue provider is nil")
 		return
 	}
-	log.Printf("[cron] scheduler started: periodic health checks every 30s")
-	// Every 30s health check and reconciliation
-	_, _ = s.c.AddFunc("@every 30s", func() {
-		log.Printf("[cron] running periodic health check at %s", time.Now().Format(time.RFC3339))
-		hs := s.qp.Health()
-		if !hs.OK {
-			log.Printf("[cron] queue unhealthy: %s - attempting reconnect", hs.Details)
-			if err := s.qp.Connect(); err != nil {
-				log.Printf("[cron] reconnect failed: %v", err)
-				return
-			}
-			log.Printf("[cron] reconnected successfully")
-		}
 
-		// Perform reconciliation if provider is healthy and repository is available
-		if hs.OK && s.repo != nil {
-			result, err := reconciliation.ReconcileTopology(s.qp, s.repo, false)
-			if err != nil {
-				log.Printf("[cron] reconciliation failed: %v", err)
-			} else {
-				summary := result.Summary()
-				if summary["exchangesCreated"] > 0 || summary["queuesCreated"] > 0 || summary["bindingsCreated"] > 0 ||
-					summary["exchangesDeleted"] > 0 || summary["queuesDeleted"] > 0 || summary["bindingsDeleted"] > 0 {
-					log.Printf("[cron] reconciliation completed: created %d exchanges, %d queues, %d bindings; deleted %d exchanges, %d queues, %d bindings",
-						summary["exchangesCreated"], summary["queuesCreated"], summary["bindingsCreated"],
-						summary["exchangesDeleted"], summary["queuesDeleted"], summary["bindingsDeleted"])
-				} else {
-					log.Printf("[cron] health check passed: queue provider is healthy, topology is in sync")
-				}
-				if len(result.Errors) > 0 {
-					log.Printf("[cron] reconciliation had %d errors", len(result.Errors))
-					for _, errMsg := range result.Errors {
-						log.Printf("[cron] reconciliation error: %s", errMsg)
-					}
-				}
-			}
-		} else if !hs.OK {
-			log.Printf("[cron] health check failed: queue provider is unhealthy, skipping reconciliation")
-		} else if s.repo == nil {
-			log.Printf("[cron] health check passed: queue provider is healthy, but repository not available, skipping reconciliation")
+	s.mu.Lock()
+	for _, j := range s.jobs {
+		if !j.schedule.Enabled {
+			s.logger.Info("job disabled", "job", j.name)
+			continue
+		}
+		j := j
+		id, err := s.c.AddFunc(j.schedule.Schedule, func() { s.runJob(j) })
+		if err != nil {
+			s.logger.Error("failed to schedule job", "job", j.name, logging.Err(err))
+			continue
 		}
-	})
+		j.entryID = id
+		s.logger.Info("job scheduled", "job", j.name, "schedule", j.schedule.Schedule, "jitter", j.schedule.Jitter)
+	}
+	s.mu.Unlock()
+
+	s.logger.Info("scheduler started")
 	s.c.Start()
 }
 
@@ -79,4 +168,222 @@ func (s *Scheduler) Stop() {
 	if s.c != nil {
 		s.c.Stop()
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+// Jobs returns the state of every job, including disabled ones
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status := JobStatus{
+			Name:      j.name,
+			Schedule:  j.schedule.Schedule,
+			Enabled:   j.schedule.Enabled,
+			Paused:    j.paused,
+			Running:   j.running,
+			LastError: j.lastError,
+		}
+		if j.schedule.Jitter > 0 {
+			status.Jitter = j.schedule.Jitter.String()
+		}
+		if !j.lastRun.IsZero() {
+			lastRun := j.lastRun
+			status.LastRun = &lastRun
+			status.LastDurationMs = j.lastDuration.Milliseconds()
+		}
+		if j.entryID != 0 {
+			if next := s.c.Entry(j.entryID).Next; !next.IsZero() {
+				status.NextRun = &next
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Pause skips the job's runs until it is resumed. Pausing is local to this instance.
+func (s *Scheduler) Pause(name string) (JobStatus, error) {
+	return s.setPaused(name, true)
+}
+
+// Resume lets a paused job run again on its schedule
+func (s *Scheduler) Resume(name string) (JobStatus, error) {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) (JobStatus, error) {
+	s.mu.Lock()
+	found := false
+	for _, j := range s.jobs {
+		if j.name == name {
+			j.paused = paused
+			found = true
+		}
+	}
+	s.mu.Unlock()
+	if !found {
+		return JobStatus{}, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+
+	if paused {
+		s.logger.Info("job paused", "job", name)
+	} else {
+		s.logger.Info("job resumed", "job", name)
+	}
+	for _, status := range s.Jobs() {
+		if status.Name == name {
+			return status, nil
+		}
+	}
+	return JobStatus{}, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+}
+
+// runJob applies pausing and jitter and records the outcome of a run
+func (s *Scheduler) runJob(j *job) {
+	s.mu.Lock()
+	paused, jitter := j.paused, j.schedule.Jitter
+	s.mu.Unlock()
+	if paused {
+		s.logger.Info("job is paused, skipping", "job", j.name)
+		return
+	}
+	if jitter > 0 {
+		select {
+		case <-time.After(rand.N(jitter)):
+		case <-s.stop:
+			return
+		}
+	}
+
+	s.mu.Lock()
+	j.running = true
+	s.mu.Unlock()
+
+	// Everything logged by the run, including the reconciliation it starts, names the job
+	ctx := logging.With(context.Background(), "job", j.name)
+	started := time.Now()
+	err := j.run(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.running = false
+	j.lastRun = started.UTC()
+	j.lastDuration = time.Since(started)
+	j.lastError = ""
+	if err != nil {
+		j.lastError = err.Error()
+	}
+}
+
+// healthCheck checks the provider and reconnects when it is unhealthy
+func (s *Scheduler) healthCheck(ctx context.Context) error {
+	s.logger.DebugContext(ctx, "running periodic health check")
+	hs := s.qp.Health()
+	if hs.OK {
+		s.providerHealth(ctx, true, hs.Details)
+		s.logger.DebugContext(ctx, "health check passed: queue provider is healthy")
+		return nil
+	}
+	s.logger.WarnContext(ctx, "queue provider unhealthy, attempting reconnect", "details", hs.Details)
+	if err := s.qp.Connect(); err != nil {
+		s.providerHealth(ctx, false, fmt.Sprintf("%s; reconnect failed: %v", hs.Details, err))
+		s.logger.ErrorContext(ctx, "reconnect failed", logging.Err(err))
+		return fmt.Errorf("reconnect failed: %w", err)
+	}
+	s.providerHealth(ctx, true, "reconnected")
+	s.logger.InfoContext(ctx, "reconnected to queue provider")
+	return nil
+}
+
+// providerHealth exports the outcome of a health check to the metrics and the observer
+func (s *Scheduler) providerHealth(ctx context.Context, healthy bool, details string) {
+	metrics.SetProviderUp(healthy)
+	if s.health != nil {
+		s.health.ProviderHealth(ctx, healthy, details)
+	}
+}
+
+// reconcile runs a full reconciliation on the leader while the provider is healthy
+func (s *Scheduler) reconcile(ctx context.Context) error {
+	// Only the leader reconciles; followers keep checking provider health
+	if !s.leader.IsLeader() {
+		s.logger.DebugContext(ctx, "this instance is not the leader, skipping reconciliation")
+		return nil
+	}
+	if s.repo == nil {
+		s.logger.WarnContext(ctx, "repository not available, skipping reconciliation")
+		return nil
+	}
+	if hs := s.qp.Health(); !hs.OK {
+		s.logger.WarnContext(ctx, "queue provider is unhealthy, skipping reconciliation")
+		return errors.New("queue provider is unhealthy")
+	}
+
+	result, err := s.rec.TryReconcile(ctx, reconciliation.Request{Trigger: reconciliation.Trigger{Source: reconciliation.TriggerCron}})
+	// Another run (e.g. a manual /sync) is already bringing the topology in sync
+	if errors.Is(err, reconciliation.ErrAlreadyRunning) {
+		s.logger.InfoContext(ctx, "reconciliation already running, skipping this tick", logging.Err(err))
+		return nil
+	}
+	if errors.Is(err, reconciliation.ErrPruningAborted) {
+		s.logger.ErrorContext(ctx, "reconciliation aborted pruning; resolve the expected topology or run /sync?force=true",
+			logging.KeyRunID, result.RunID, "reason", result.AbortReason, "pending_deletions", len(result.PendingDeletions))
+	}
+	if err != nil && !errors.Is(err, reconciliation.ErrPruningAborted) {
+		s.logger.ErrorContext(ctx, "reconciliation failed", logging.Err(err))
+		return err
+	}
+
+	summary := result.Summary()
+	if summary["exchangesCreated"] > 0 || summary["queuesCreated"] > 0 || summary["bindingsCreated"] > 0 ||
+		summary["exchangesDeleted"] > 0 || summary["queuesDeleted"] > 0 || summary["bindingsDeleted"] > 0 {
+		s.logger.InfoContext(ctx, "reconciliation completed", logging.KeyRunID, result.RunID, "summary", summary)
+	} else {
+		s.logger.DebugContext(ctx, "reconciliation completed: topology is in sync", logging.KeyRunID, result.RunID)
+	}
+	if len(result.ScheduledDeletions) > 0 {
+		s.logger.InfoContext(ctx, "unexpected resources scheduled for deletion after their grace period",
+			logging.KeyRunID, result.RunID, "count", len(result.ScheduledDeletions))
+	}
+	if len(result.Errors) > 0 {
+		s.logger.ErrorContext(ctx, "reconciliation had errors", logging.KeyRunID, result.RunID, "errors", result.Errors)
+		return fmt.Errorf("reconciliation had %d errors", len(result.Errors))
+	}
+	return err
+}
+
+// report logs the drift between expected and actual state without changing the provider
+func (s *Scheduler) report(ctx context.Context) error {
+	if s.repo == nil {
+		s.logger.WarnContext(ctx, "repository not available, skipping drift report")
+		return nil
+	}
+	if hs := s.qp.Health(); !hs.OK {
+		s.logger.WarnContext(ctx, "queue provider is unhealthy, skipping drift report")
+		return errors.New("queue provider is unhealthy")
+	}
+
+	plan, err := s.rec.Drift(ctx)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "drift report failed", logging.Err(err))
+		return err
+	}
+	if len(plan.Actions) == 0 && len(plan.PendingDeletions) == 0 && len(plan.ScheduledDeletions) == 0 {
+		s.logger.InfoContext(ctx, "drift report: topology is in sync")
+		return nil
+	}
+	s.logger.WarnContext(ctx, "drift report: topology is out of sync", "summary", plan.Summary())
+	for _, a := range plan.Actions {
+		s.logger.InfoContext(ctx, "drift: would "+string(a.Type)+" "+a.Kind, logging.Resource(a.Kind, a.Name))
+	}
+	return nil
 }
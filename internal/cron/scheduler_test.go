@@ -1,14 +1,18 @@
 package cron
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"queue-manager/internal/config"
 	"queue-manager/internal/queue"
 	"queue-manager/internal/repository"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockProvider is a mock implementation of queue.Provider
@@ -84,11 +88,21 @@ func (m *MockProvider) ListBindings(queueName string) ([][3]string, error) {
 	return args.Get(0).([][3]string), args.Error(1)
 }
 
+func (m *MockProvider) InspectQueue(name string) (queue.QueueStatus, error) {
+	args := m.Called(name)
+	return args.Get(0).(queue.QueueStatus), args.Error(1)
+}
+
 func (m *MockProvider) DeleteQueue(name string) error {
 	args := m.Called(name)
 	return args.Error(0)
 }
 
+func (m *MockProvider) DeleteQueueIf(name string, ifEmpty, ifUnused bool) error {
+	args := m.Called(name, ifEmpty, ifUnused)
+	return args.Error(0)
+}
+
 func (m *MockProvider) DeleteExchange(name string) error {
 	args := m.Called(name)
 	return args.Error(0)
@@ -98,16 +112,17 @@ func TestNewScheduler(t *testing.T) {
 	mockProvider := new(MockProvider)
 	mockRepo := &repository.Repository{}
 
-	scheduler := NewScheduler(mockProvider, mockRepo)
+	scheduler := NewScheduler(mockProvider, mockRepo, nil)
 	assert.NotNil(t, scheduler)
 	assert.Equal(t, mockProvider, scheduler.qp)
 	assert.Equal(t, mockRepo, scheduler.repo)
+	assert.NotNil(t, scheduler.rec)
 	assert.NotNil(t, scheduler.c)
 }
 
 func TestScheduler_Start(t *testing.T) {
 	t.Run("nil provider", func(t *testing.T) {
-		scheduler := NewScheduler(nil, nil)
+		scheduler := NewScheduler(nil, nil, nil)
 		scheduler.Start()
 		// Should not panic, just log and return
 		time.Sleep(100 * time.Millisecond) // Give it a moment
@@ -117,7 +132,7 @@ func TestScheduler_Start(t *testing.T) {
 	t.Run("with provider and repo", func(t *testing.T) {
 		mockProvider := new(MockProvider)
 		repo := &repository.Repository{} // Empty repo - reconciliation will be skipped
-		scheduler := NewScheduler(mockProvider, repo)
+		scheduler := NewScheduler(mockProvider, repo, nil)
 
 		// Just test that scheduler can start and stop without panicking
 		// The actual cron job runs every 30s, which is hard to test in unit tests
@@ -133,7 +148,7 @@ func TestScheduler_Start(t *testing.T) {
 func TestScheduler_Stop(t *testing.T) {
 	mockProvider := new(MockProvider)
 	mockRepo := &repository.Repository{}
-	scheduler := NewScheduler(mockProvider, mockRepo)
+	scheduler := NewScheduler(mockProvider, mockRepo, nil)
 
 	scheduler.Start()
 	time.Sleep(50 * time.Millisecond)
@@ -146,7 +161,7 @@ func TestScheduler_Stop(t *testing.T) {
 func TestScheduler_HealthCheck_Unhealthy(t *testing.T) {
 	mockProvider := new(MockProvider)
 	mockRepo := &repository.Repository{}
-	scheduler := NewScheduler(mockProvider, mockRepo)
+	scheduler := NewScheduler(mockProvider, mockRepo, nil)
 
 	// Just test that scheduler can start and stop
 	// The actual health check runs every 30s, which is hard to test in unit tests
@@ -160,7 +175,7 @@ func TestScheduler_HealthCheck_Unhealthy(t *testing.T) {
 func TestScheduler_HealthCheck_ReconnectFailure(t *testing.T) {
 	mockProvider := new(MockProvider)
 	mockRepo := &repository.Repository{}
-	scheduler := NewScheduler(mockProvider, mockRepo)
+	scheduler := NewScheduler(mockProvider, mockRepo, nil)
 
 	// Just test that scheduler can start and stop
 	scheduler.Start()
@@ -170,10 +185,43 @@ func TestScheduler_HealthCheck_ReconnectFailure(t *testing.T) {
 	assert.NotNil(t, scheduler.c)
 }
 
+// healthRecorder captures the health reported to the observer
+type healthRecorder struct {
+	healthy []bool
+	details []string
+}
+
+func (h *healthRecorder) ProviderHealth(_ context.Context, healthy bool, details string) {
+	h.healthy = append(h.healthy, healthy)
+	h.details = append(h.details, details)
+}
+
+func TestScheduler_HealthObserver(t *testing.T) {
+	mockProvider := new(MockProvider)
+	scheduler := NewScheduler(mockProvider, nil, nil)
+	observer := &healthRecorder{}
+	scheduler.SetHealthObserver(observer)
+
+	mockProvider.On("Health").Return(queue.HealthStatus{OK: true, Details: "connected"}).Once()
+	require.NoError(t, scheduler.healthCheck(context.Background()))
+
+	mockProvider.On("Health").Return(queue.HealthStatus{OK: false, Details: "connection closed"}).Once()
+	mockProvider.On("Connect").Return(errors.New("connection refused")).Once()
+	require.Error(t, scheduler.healthCheck(context.Background()))
+
+	mockProvider.On("Health").Return(queue.HealthStatus{OK: false, Details: "connection closed"}).Once()
+	mockProvider.On("Connect").Return(nil).Once()
+	require.NoError(t, scheduler.healthCheck(context.Background()))
+
+	assert.Equal(t, []bool{true, false, true}, observer.healthy)
+	assert.Equal(t, "connection closed; reconnect failed: connection refused", observer.details[1])
+	mockProvider.AssertExpectations(t)
+}
+
 func TestScheduler_Reconciliation(t *testing.T) {
 	mockProvider := new(MockProvider)
 	repo := &repository.Repository{} // Empty repo - reconciliation will be skipped
-	scheduler := NewScheduler(mockProvider, repo)
+	scheduler := NewScheduler(mockProvider, repo, nil)
 
 	// Just test that scheduler can start and stop
 	scheduler.Start()
@@ -186,7 +234,7 @@ func TestScheduler_Reconciliation(t *testing.T) {
 func TestScheduler_ReconciliationError(t *testing.T) {
 	mockProvider := new(MockProvider)
 	repo := &repository.Repository{} // Empty repo - reconciliation will be skipped
-	scheduler := NewScheduler(mockProvider, repo)
+	scheduler := NewScheduler(mockProvider, repo, nil)
 
 	// Just test that scheduler can start and stop
 	scheduler.Start()
@@ -198,7 +246,7 @@ func TestScheduler_ReconciliationError(t *testing.T) {
 
 func TestScheduler_NilRepository(t *testing.T) {
 	mockProvider := new(MockProvider)
-	scheduler := NewScheduler(mockProvider, nil)
+	scheduler := NewScheduler(mockProvider, nil, nil)
 
 	// Just test that scheduler can start and stop with nil repository
 	scheduler.Start()
@@ -210,3 +258,73 @@ func TestScheduler_NilRepository(t *testing.T) {
 }
 
 
+
+func TestScheduler_Configure(t *testing.T) {
+	scheduler := NewScheduler(new(MockProvider), nil, nil)
+
+	err := scheduler.Configure(config.Config{
+		SchedulerHealth:    config.JobSchedule{Enabled: true, Schedule: "@every 10s"},
+		SchedulerReconcile: config.JobSchedule{Enabled: true, Schedule: "*/5 * * * *", Jitter: time.Second},
+		SchedulerReport:    config.JobSchedule{Enabled: false, Schedule: "@hourly"},
+	})
+	require.NoError(t, err)
+
+	jobs := scheduler.Jobs()
+	require.Len(t, jobs, 3)
+	assert.Equal(t, JobHealth, jobs[0].Name)
+	assert.Equal(t, "@every 10s", jobs[0].Schedule)
+	assert.Equal(t, "*/5 * * * *", jobs[1].Schedule)
+	assert.Equal(t, "1s", jobs[1].Jitter)
+	assert.False(t, jobs[2].Enabled)
+
+	err = scheduler.Configure(config.Config{
+		SchedulerHealth:    config.JobSchedule{Enabled: true, Schedule: "every now and then"},
+		SchedulerReconcile: config.JobSchedule{Enabled: true, Schedule: "@every 30s"},
+		SchedulerReport:    config.JobSchedule{Enabled: true, Schedule: "@every 5m"},
+	})
+	assert.Error(t, err)
+}
+
+func TestScheduler_JobsNextRun(t *testing.T) {
+	mockProvider := new(MockProvider)
+	scheduler := NewScheduler(mockProvider, nil, nil)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	for _, job := range scheduler.Jobs() {
+		if job.Enabled {
+			assert.NotNil(t, job.NextRun, job.Name)
+		} else {
+			assert.Nil(t, job.NextRun, job.Name)
+		}
+		assert.Nil(t, job.LastRun, job.Name)
+	}
+}
+
+func TestScheduler_PauseResume(t *testing.T) {
+	mockProvider := new(MockProvider)
+	scheduler := NewScheduler(mockProvider, nil, nil)
+
+	status, err := scheduler.Pause(JobHealth)
+	require.NoError(t, err)
+	assert.True(t, status.Paused)
+
+	// A paused job is skipped and never touches the provider
+	scheduler.runJob(scheduler.jobs[0])
+	mockProvider.AssertNotCalled(t, "Health")
+	assert.Nil(t, scheduler.Jobs()[0].LastRun)
+
+	status, err = scheduler.Resume(JobHealth)
+	require.NoError(t, err)
+	assert.False(t, status.Paused)
+
+	mockProvider.On("Health").Return(queue.HealthStatus{OK: false, Details: "down"})
+	mockProvider.On("Connect").Return(errors.New("connection refused"))
+	scheduler.runJob(scheduler.jobs[0])
+	status = scheduler.Jobs()[0]
+	assert.NotNil(t, status.LastRun)
+	assert.Contains(t, status.LastError, "connection refused")
+
+	_, err = scheduler.Pause("unknown")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
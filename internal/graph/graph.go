@@ -0,0 +1,240 @@
+// Package graph maps the expected topology as a graph of producers, exchanges, queues and
+// consuming services, optionally overlaid with the drift of the live topology, and renders it
+// for Graphviz and Mermaid.
+package graph
+
+import (
+	"sort"
+
+	"queue-manager/internal/bootstrap"
+	"queue-manager/internal/reconciliation"
+)
+
+// Kind is the kind of a node
+type Kind string
+
+const (
+	KindProducer Kind = "producer"
+	KindExchange Kind = "exchange"
+	KindQueue    Kind = "queue"
+	KindService  Kind = "service"
+)
+
+// Kinds of edges
+const (
+	EdgePublishes = "publishes" // producer -> exchange
+	EdgeBinding   = "binding"   // exchange -> queue
+	EdgeConsumes  = "consumes"  // queue -> service
+)
+
+// State is the drift state of an exchange, queue or binding. It is empty unless drift was
+// overlaid; producers, services and their edges are not on the broker and never have one.
+type State string
+
+const (
+	StateHealthy    State = "healthy"
+	StateMissing    State = "missing"
+	StateUnexpected State = "unexpected"
+	StateMismatched State = "mismatched"
+)
+
+// Node is a producer, exchange, queue or service. Type is the exchange type; Owner comes from the
+// owner key of the resource's meta.
+type Node struct {
+	ID    string `json:"id"`
+	Kind  Kind   `json:"kind"`
+	Name  string `json:"name"`
+	Type  string `json:"type,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	State State  `json:"state,omitempty"`
+}
+
+// Edge connects two nodes by ID
+type Edge struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Kind       string `json:"kind"`
+	RoutingKey string `json:"routing_key,omitempty"`
+	State      State  `json:"state,omitempty"`
+}
+
+// Graph is the topology graph. Nodes are ordered by kind, from producers to services, then by
+// name; edges by their ends and routing key.
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// ID returns the ID of the node of a kind with a name, e.g. "queue:orders.created"
+func ID(kind Kind, name string) string {
+	return string(kind) + ":" + name
+}
+
+// Build maps the definitions. Producers are read from the producers key of an exchange's meta,
+// a name or a list of names, since the schema has no table for them. Exchanges and queues that
+// bindings refer to but that are not declared, such as amq.topic, are added without a type.
+func Build(d bootstrap.Definitions) *Graph {
+	b := builder{nodes: map[string]int{}, edges: map[Edge]int{}}
+	for _, x := range d.Exchanges {
+		i := b.node(KindExchange, x.ExchangeName)
+		b.g.Nodes[i].Type = x.ExchangeType
+		b.g.Nodes[i].Owner = stringValue(x.Meta["owner"])
+		for _, p := range names(x.Meta["producers"]) {
+			b.node(KindProducer, p)
+			b.edge(Edge{From: ID(KindProducer, p), To: ID(KindExchange, x.ExchangeName), Kind: EdgePublishes})
+		}
+	}
+	for _, q := range d.Queues {
+		i := b.node(KindQueue, q.QueueName)
+		b.g.Nodes[i].Owner = stringValue(q.Meta["owner"])
+	}
+	for _, bd := range d.Bindings {
+		b.node(KindExchange, bd.ExchangeName)
+		b.node(KindQueue, bd.QueueName)
+		b.edge(Edge{From: ID(KindExchange, bd.ExchangeName), To: ID(KindQueue, bd.QueueName), Kind: EdgeBinding, RoutingKey: bd.RoutingKey})
+	}
+	for _, a := range d.Assignments {
+		b.node(KindQueue, a.QueueName)
+		b.node(KindService, a.ServiceName)
+		b.edge(Edge{From: ID(KindQueue, a.QueueName), To: ID(KindService, a.ServiceName), Kind: EdgeConsumes})
+	}
+	return b.sorted()
+}
+
+// Overlay marks the exchanges, queues and bindings of the graph with the state the diff reports
+// for them, and adds the unexpected ones. Resources the diff does not cover, such as the amq.*
+// exchanges, are left without a state. g is not modified.
+func Overlay(g *Graph, d *reconciliation.Diff) *Graph {
+	b := builder{
+		g:     Graph{Nodes: append([]Node(nil), g.Nodes...), Edges: append([]Edge(nil), g.Edges...)},
+		nodes: map[string]int{},
+		edges: map[Edge]int{},
+	}
+	for i, n := range b.g.Nodes {
+		b.nodes[n.ID] = i
+	}
+	for i, e := range b.g.Edges {
+		b.edges[edgeKey(e)] = i
+	}
+
+	b.mark(d.Healthy, StateHealthy)
+	b.mark(d.Missing, StateMissing)
+	b.mark(d.Unexpected, StateUnexpected)
+	for _, m := range d.Mismatched.Exchanges {
+		b.g.Nodes[b.node(KindExchange, m.Name)].State = StateMismatched
+	}
+	for _, m := range d.Mismatched.Queues {
+		b.g.Nodes[b.node(KindQueue, m.Name)].State = StateMismatched
+	}
+	for _, m := range d.Mismatched.Bindings {
+		if m.Expected != nil {
+			b.g.Edges[b.binding(*m.Expected)].State = StateMismatched
+		}
+	}
+	return b.sorted()
+}
+
+// builder adds nodes and edges once, keeping their index by ID and by edge
+type builder struct {
+	g     Graph
+	nodes map[string]int
+	edges map[Edge]int
+}
+
+func (b *builder) node(kind Kind, name string) int {
+	id := ID(kind, name)
+	if i, ok := b.nodes[id]; ok {
+		return i
+	}
+	b.g.Nodes = append(b.g.Nodes, Node{ID: id, Kind: kind, Name: name})
+	b.nodes[id] = len(b.g.Nodes) - 1
+	return b.nodes[id]
+}
+
+func (b *builder) edge(e Edge) int {
+	if i, ok := b.edges[edgeKey(e)]; ok {
+		return i
+	}
+	b.g.Edges = append(b.g.Edges, e)
+	b.edges[edgeKey(e)] = len(b.g.Edges) - 1
+	return b.edges[edgeKey(e)]
+}
+
+func (b *builder) binding(ref reconciliation.BindingRef) int {
+	b.node(KindExchange, ref.Exchange)
+	b.node(KindQueue, ref.Queue)
+	return b.edge(Edge{From: ID(KindExchange, ref.Exchange), To: ID(KindQueue, ref.Queue), Kind: EdgeBinding, RoutingKey: ref.RoutingKey})
+}
+
+// mark sets the state of the resources in set, adding the ones the graph lacks
+func (b *builder) mark(set reconciliation.ResourceSet, s State) {
+	for _, name := range set.Exchanges {
+		b.g.Nodes[b.node(KindExchange, name)].State = s
+	}
+	for _, name := range set.Queues {
+		b.g.Nodes[b.node(KindQueue, name)].State = s
+	}
+	for _, ref := range set.Bindings {
+		b.g.Edges[b.binding(ref)].State = s
+	}
+}
+
+// sorted returns the graph with nodes and edges in their documented order
+func (b *builder) sorted() *Graph {
+	g := b.g
+	if g.Nodes == nil {
+		g.Nodes = []Node{}
+	}
+	if g.Edges == nil {
+		g.Edges = []Edge{}
+	}
+	sort.SliceStable(g.Nodes, func(i, j int) bool {
+		if kindOrder[g.Nodes[i].Kind] != kindOrder[g.Nodes[j].Kind] {
+			return kindOrder[g.Nodes[i].Kind] < kindOrder[g.Nodes[j].Kind]
+		}
+		return g.Nodes[i].Name < g.Nodes[j].Name
+	})
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.RoutingKey < b.RoutingKey
+	})
+	return &g
+}
+
+var kindOrder = map[Kind]int{KindProducer: 0, KindExchange: 1, KindQueue: 2, KindService: 3}
+
+// edgeKey identifies an edge regardless of its state
+func edgeKey(e Edge) Edge {
+	e.State = ""
+	return e
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// names reads a meta value holding a name or a list of names
+func names(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
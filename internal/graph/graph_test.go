@@ -0,0 +1,136 @@
+package graph
+
+import (
+	"testing"
+
+	"queue-manager/internal/bootstrap"
+	"queue-manager/internal/models"
+	"queue-manager/internal/reconciliation"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var definitions = bootstrap.Definitions{
+	Exchanges: []models.Exchange{
+		{ExchangeName: "orders", ExchangeType: "topic", Meta: models.JSONB{"owner": "orders-team", "producers": []interface{}{"checkout", "admin"}}},
+	},
+	Queues: []models.Queue{
+		{QueueName: "orders.created", Meta: models.JSONB{"owner": "orders-team"}},
+		{QueueName: "orders.audit"},
+	},
+	Bindings: []models.Binding{
+		{ExchangeName: "orders", QueueName: "orders.created", RoutingKey: "order.created"},
+		{ExchangeName: "amq.topic", QueueName: "orders.audit", RoutingKey: "#"},
+	},
+	Assignments: []models.ServiceAssignment{
+		{ServiceName: "order-service", QueueName: "orders.created"},
+	},
+}
+
+func TestBuild(t *testing.T) {
+	g := Build(definitions)
+
+	ids := make([]string, len(g.Nodes))
+	for i, n := range g.Nodes {
+		ids[i] = n.ID
+	}
+	assert.Equal(t, []string{
+		"producer:admin", "producer:checkout",
+		"exchange:amq.topic", "exchange:orders",
+		"queue:orders.audit", "queue:orders.created",
+		"service:order-service",
+	}, ids)
+	assert.Equal(t, Node{ID: "exchange:orders", Kind: KindExchange, Name: "orders", Type: "topic", Owner: "orders-team"}, g.Nodes[3])
+	assert.Equal(t, Node{ID: "exchange:amq.topic", Kind: KindExchange, Name: "amq.topic"}, g.Nodes[2])
+
+	assert.Equal(t, []Edge{
+		{From: "exchange:amq.topic", To: "queue:orders.audit", Kind: EdgeBinding, RoutingKey: "#"},
+		{From: "exchange:orders", To: "queue:orders.created", Kind: EdgeBinding, RoutingKey: "order.created"},
+		{From: "producer:admin", To: "exchange:orders", Kind: EdgePublishes},
+		{From: "producer:checkout", To: "exchange:orders", Kind: EdgePublishes},
+		{From: "queue:orders.created", To: "service:order-service", Kind: EdgeConsumes},
+	}, g.Edges)
+}
+
+func TestOverlay(t *testing.T) {
+	g := Build(definitions)
+	diff := &reconciliation.Diff{
+		Missing: reconciliation.ResourceSet{
+			Queues:   []string{"orders.audit"},
+			Bindings: []reconciliation.BindingRef{{Exchange: "amq.topic", Queue: "orders.audit", RoutingKey: "#"}},
+		},
+		Unexpected: reconciliation.ResourceSet{
+			Queues:   []string{"orders.legacy"},
+			Bindings: []reconciliation.BindingRef{{Exchange: "orders", Queue: "orders.legacy", RoutingKey: "order.#"}},
+		},
+		Mismatched: reconciliation.Mismatches{Exchanges: []reconciliation.Mismatch{{Kind: "exchange", Name: "orders"}}},
+		Healthy: reconciliation.ResourceSet{
+			Queues:   []string{"orders.created"},
+			Bindings: []reconciliation.BindingRef{{Exchange: "orders", Queue: "orders.created", RoutingKey: "order.created"}},
+		},
+	}
+	overlaid := Overlay(g, diff)
+
+	states := map[string]State{}
+	for _, n := range overlaid.Nodes {
+		states[n.ID] = n.State
+	}
+	assert.Equal(t, map[string]State{
+		"producer:admin": "", "producer:checkout": "",
+		"exchange:amq.topic": "", "exchange:orders": StateMismatched,
+		"queue:orders.audit": StateMissing, "queue:orders.created": StateHealthy, "queue:orders.legacy": StateUnexpected,
+		"service:order-service": "",
+	}, states)
+
+	edges := map[string]State{}
+	for _, e := range overlaid.Edges {
+		edges[e.From+" -> "+e.To] = e.State
+	}
+	assert.Equal(t, StateMissing, edges["exchange:amq.topic -> queue:orders.audit"])
+	assert.Equal(t, StateHealthy, edges["exchange:orders -> queue:orders.created"])
+	assert.Equal(t, StateUnexpected, edges["exchange:orders -> queue:orders.legacy"])
+	assert.Equal(t, State(""), edges["queue:orders.created -> service:order-service"])
+
+	// The graph the drift is overlaid on is left as it was
+	for _, n := range g.Nodes {
+		require.Empty(t, n.State, n.ID)
+	}
+}
+
+func TestRender(t *testing.T) {
+	g := &Graph{
+		Nodes: []Node{
+			{ID: "exchange:orders", Kind: KindExchange, Name: "orders", Type: "topic", Owner: "orders-team"},
+			{ID: "queue:orders.created", Kind: KindQueue, Name: "orders.created", State: StateMissing},
+			{ID: "service:order-service", Kind: KindService, Name: "order-service"},
+		},
+		Edges: []Edge{
+			{From: "exchange:orders", To: "queue:orders.created", Kind: EdgeBinding, RoutingKey: `order."created"`, State: StateMissing},
+			{From: "queue:orders.created", To: "service:order-service", Kind: EdgeConsumes},
+		},
+	}
+
+	assert.Equal(t, `digraph topology {
+  rankdir=LR;
+  node [fontname="Helvetica"];
+  edge [fontname="Helvetica", fontsize=10];
+  "exchange:orders" [label="orders\ntopic\nowner: orders-team", shape=hexagon];
+  "queue:orders.created" [label="orders.created\nmissing", shape=cylinder, color="#d62728", fontcolor="#d62728", style=dashed];
+  "service:order-service" [label="order-service", shape=component];
+  "exchange:orders" -> "queue:orders.created" [label="order.\"created\"", color="#d62728", fontcolor="#d62728", style=dashed];
+  "queue:orders.created" -> "service:order-service" [arrowhead=empty];
+}
+`, g.DOT())
+
+	assert.Equal(t, `flowchart LR
+  n0{{"orders<br/>topic<br/>owner: orders-team"}}
+  n1[("orders.created<br/>missing")]
+  n2[["order-service"]]
+  n0 -->|"order.#quot;created#quot;"| n1
+  n1 -.-> n2
+  classDef missing stroke:#d62728,stroke-dasharray:5 5,stroke-width:2px
+  class n1 missing
+  linkStyle 0 stroke:#d62728,stroke-dasharray:5 5
+`, g.Mermaid())
+}
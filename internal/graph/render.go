@@ -0,0 +1,170 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format is an output format of the graph
+type Format string
+
+const (
+	FormatJSON    Format = "json"
+	FormatDOT     Format = "dot"
+	FormatMermaid Format = "mermaid"
+)
+
+// style is how a drift state is drawn
+type style struct {
+	color  string
+	dashed bool
+}
+
+// styles are the drift states drawn differently; healthy resources keep the default style
+var styles = map[State]style{
+	StateMissing:    {color: "#d62728", dashed: true},
+	StateUnexpected: {color: "#ff7f0e"},
+	StateMismatched: {color: "#bcbd22"},
+}
+
+// label is the text of a node: its name, exchange type, owner and drift state
+func (n Node) label() []string {
+	lines := []string{n.Name}
+	if n.Name == "" {
+		lines[0] = "(default)"
+	}
+	if n.Type != "" {
+		lines = append(lines, n.Type)
+	}
+	if n.Owner != "" {
+		lines = append(lines, "owner: "+n.Owner)
+	}
+	if _, ok := styles[n.State]; ok {
+		lines = append(lines, string(n.State))
+	}
+	return lines
+}
+
+var dotShapes = map[Kind]string{
+	KindProducer: "ellipse",
+	KindExchange: "hexagon",
+	KindQueue:    "cylinder",
+	KindService:  "component",
+}
+
+// DOT renders the graph for Graphviz, left to right from producers to services
+func (g *Graph) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph topology {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [fontname=\"Helvetica\"];\n")
+	sb.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, n := range g.Nodes {
+		lines := n.label()
+		for i, l := range lines {
+			lines[i] = dotEscape(l)
+		}
+		fmt.Fprintf(&sb, "  \"%s\" [label=\"%s\", shape=%s%s];\n",
+			dotEscape(n.ID), strings.Join(lines, `\n`), dotShapes[n.Kind], dotStyle(n.State))
+	}
+	for _, e := range g.Edges {
+		var attrs []string
+		if e.RoutingKey != "" {
+			attrs = append(attrs, fmt.Sprintf("label=\"%s\"", dotEscape(e.RoutingKey)))
+		}
+		if e.Kind == EdgeConsumes {
+			attrs = append(attrs, "arrowhead=empty")
+		}
+		fmt.Fprintf(&sb, "  \"%s\" -> \"%s\"", dotEscape(e.From), dotEscape(e.To))
+		if st := strings.TrimPrefix(strings.Join(attrs, ", ")+dotStyle(e.State), ", "); st != "" {
+			fmt.Fprintf(&sb, " [%s]", st)
+		}
+		sb.WriteString(";\n")
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+func dotStyle(s State) string {
+	st, ok := styles[s]
+	if !ok {
+		return ""
+	}
+	attrs := fmt.Sprintf(", color=\"%s\", fontcolor=\"%s\"", st.color, st.color)
+	if st.dashed {
+		attrs += ", style=dashed"
+	}
+	return attrs
+}
+
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// mermaidShapes are the opening and closing brackets of each kind of node
+var mermaidShapes = map[Kind][2]string{
+	KindProducer: {"([", "])"},
+	KindExchange: {"{{", "}}"},
+	KindQueue:    {"[(", ")]"},
+	KindService:  {"[[", "]]"},
+}
+
+// Mermaid renders the graph as a Mermaid flowchart. Node IDs are replaced with n0, n1, ... since
+// Mermaid does not accept the characters of resource names in IDs.
+func (g *Graph) Mermaid() string {
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+	ids := make(map[string]string, len(g.Nodes))
+	classes := map[State][]string{}
+	for i, n := range g.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[n.ID] = id
+		lines := n.label()
+		for j, l := range lines {
+			lines[j] = mermaidEscape(l)
+		}
+		shape := mermaidShapes[n.Kind]
+		fmt.Fprintf(&sb, "  %s%s\"%s\"%s\n", id, shape[0], strings.Join(lines, "<br/>"), shape[1])
+		if _, ok := styles[n.State]; ok {
+			classes[n.State] = append(classes[n.State], id)
+		}
+	}
+	var links []string
+	for i, e := range g.Edges {
+		arrow := "-->"
+		if e.Kind == EdgeConsumes {
+			arrow = "-.->"
+		}
+		if e.RoutingKey != "" {
+			arrow += fmt.Sprintf("|\"%s\"|", mermaidEscape(e.RoutingKey))
+		}
+		fmt.Fprintf(&sb, "  %s %s %s\n", ids[e.From], arrow, ids[e.To])
+		if st, ok := styles[e.State]; ok {
+			links = append(links, fmt.Sprintf("  linkStyle %d %s\n", i, mermaidStyle(st)))
+		}
+	}
+	for _, s := range []State{StateMissing, StateUnexpected, StateMismatched} {
+		if len(classes[s]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "  classDef %s %s,stroke-width:2px\n", s, mermaidStyle(styles[s]))
+		fmt.Fprintf(&sb, "  class %s %s\n", strings.Join(classes[s], ","), s)
+	}
+	for _, l := range links {
+		sb.WriteString(l)
+	}
+	return sb.String()
+}
+
+func mermaidStyle(st style) string {
+	s := "stroke:" + st.color
+	if st.dashed {
+		s += ",stroke-dasharray:5 5"
+	}
+	return s
+}
+
+// mermaidEscape replaces the characters that end a quoted Mermaid label with entity codes
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
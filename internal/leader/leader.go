@@ -0,0 +1,195 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"queue-manager/internal/logging"
+)
+
+// Elector elects a single leader among queue-manager replicas using a Postgres session-level
+// advisory lock. The replica whose session holds the lock is the leader; Postgres releases the
+// lock automatically when that session ends, so a crashed leader is replaced on the next attempt.
+//
+// A nil *Elector means leader election is disabled: the instance always considers itself leader.
+type Elector struct {
+	db         *sql.DB
+	key        int64
+	interval   time.Duration
+	instanceID string
+
+	mu      sync.Mutex
+	conn    *sql.Conn
+	leader  bool
+	since   time.Time
+	lastErr string
+
+	stop   chan struct{}
+	done   chan struct{}
+	logger *slog.Logger
+}
+
+// Status describes the leadership state for health output
+type Status struct {
+	Enabled    bool       `json:"enabled"`
+	Leader     bool       `json:"leader"`
+	InstanceID string     `json:"instanceId,omitempty"`
+	Since      *time.Time `json:"since,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+}
+
+// NewElector creates an elector competing for the advisory lock with the given key. Campaigns
+// are repeated every interval once Start is called.
+func NewElector(db *sql.DB, key int64, interval time.Duration) *Elector {
+	instanceID, _ := os.Hostname()
+	return &Elector{
+		db:         db,
+		key:        key,
+		interval:   interval,
+		instanceID: instanceID,
+		logger:     logging.Component(nil, "leader"),
+	}
+}
+
+// Campaign makes a single attempt to acquire the lock, or verifies that the session holding it
+// is still alive. It returns whether this instance is the leader afterwards.
+func (e *Elector) Campaign() bool {
+	if e == nil {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if e.conn != nil {
+		if _, err := e.conn.ExecContext(ctx, "SELECT 1"); err != nil {
+			e.logger.Warn("lost leadership: lock session failed", logging.Err(err))
+			e.lastErr = err.Error()
+			e.releaseLocked()
+			return false
+		}
+		return true
+	}
+
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		e.lastErr = err.Error()
+		return false
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", e.key).Scan(&acquired); err != nil {
+		e.lastErr = err.Error()
+		discard(conn)
+		return false
+	}
+	e.lastErr = ""
+	if !acquired {
+		_ = conn.Close()
+		return false
+	}
+
+	e.conn = conn
+	e.leader = true
+	e.since = time.Now().UTC()
+	e.logger.Info("acquired leadership", "instance", e.instanceID, "lock_key", e.key)
+	return true
+}
+
+// Start campaigns periodically in the background until Stop is called
+func (e *Elector) Start() {
+	if e == nil {
+		return
+	}
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.stop:
+				return
+			case <-ticker.C:
+				e.Campaign()
+			}
+		}
+	}()
+}
+
+// Stop ends campaigning and gives up leadership so another replica can take over immediately
+func (e *Elector) Stop() {
+	if e == nil {
+		return
+	}
+	if e.stop != nil {
+		close(e.stop)
+		<-e.done
+		e.stop = nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conn != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, _ = e.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", e.key)
+		e.logger.Info("released leadership", "instance", e.instanceID)
+	}
+	e.releaseLocked()
+}
+
+// IsLeader reports whether this instance currently holds leadership
+func (e *Elector) IsLeader() bool {
+	if e == nil {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Status returns the leadership state
+func (e *Elector) Status() Status {
+	if e == nil {
+		return Status{Enabled: false, Leader: true}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := Status{
+		Enabled:    true,
+		Leader:     e.leader,
+		InstanceID: e.instanceID,
+		LastError:  e.lastErr,
+	}
+	if e.leader {
+		since := e.since
+		status.Since = &since
+	}
+	return status
+}
+
+// releaseLocked drops the lock session. Must be called with e.mu held.
+func (e *Elector) releaseLocked() {
+	if e.conn != nil {
+		discard(e.conn)
+	}
+	e.conn = nil
+	e.leader = false
+	e.since = time.Time{}
+}
+
+// discard closes the underlying connection instead of returning it to the pool, so a
+// session-level advisory lock can never survive on a pooled connection
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	_ = conn.Close()
+}
@@ -0,0 +1,80 @@
+package leader
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestElector_NilIsAlwaysLeader(t *testing.T) {
+	var e *Elector
+	assert.True(t, e.IsLeader())
+	assert.True(t, e.Campaign())
+	assert.Equal(t, Status{Enabled: false, Leader: true}, e.Status())
+	e.Start()
+	e.Stop()
+}
+
+func TestElector_Campaign(t *testing.T) {
+	t.Run("acquires the lock", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT pg_try_advisory_lock\(\$1\)`).WithArgs(int64(42)).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+		mock.ExpectExec(`SELECT 1`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WithArgs(int64(42)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		e := NewElector(db, 42, time.Second)
+		require.True(t, e.Campaign())
+		assert.True(t, e.IsLeader())
+		status := e.Status()
+		assert.True(t, status.Enabled)
+		assert.True(t, status.Leader)
+		assert.NotNil(t, status.Since)
+
+		// Subsequent campaigns only verify the lock session
+		require.True(t, e.Campaign())
+
+		e.Stop()
+		assert.False(t, e.IsLeader())
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("another replica holds the lock", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT pg_try_advisory_lock\(\$1\)`).WithArgs(int64(42)).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+
+		e := NewElector(db, 42, time.Second)
+		assert.False(t, e.Campaign())
+		assert.False(t, e.IsLeader())
+		assert.Nil(t, e.Status().Since)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("loses leadership when the lock session fails", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT pg_try_advisory_lock\(\$1\)`).WithArgs(int64(42)).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+		mock.ExpectExec(`SELECT 1`).WillReturnError(errors.New("connection reset"))
+
+		e := NewElector(db, 42, time.Second)
+		require.True(t, e.Campaign())
+		assert.False(t, e.Campaign())
+		assert.False(t, e.IsLeader())
+		assert.Equal(t, "connection reset", e.Status().LastError)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
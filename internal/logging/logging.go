@@ -0,0 +1,194 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Field names shared by all components
+const (
+	KeyComponent = "component"
+	KeyRequestID = "request_id"
+	KeyRunID     = "run_id"
+	KeyResource  = "resource"
+	KeyTraceID   = "trace_id"
+	KeyError     = "error"
+)
+
+// LevelTrace is more verbose than debug, for step-by-step diagnostics
+const LevelTrace = slog.Level(-8)
+
+// ServiceName is added to every log line
+const ServiceName = "queue-manager"
+
+// Output formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// ParseLevel parses trace, debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "trace":
+		return LevelTrace, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// New creates a logger writing to w in the given format ("json" or "text"). Records logged with
+// a context also carry the fields stored in it with With, and the trace ID of its span.
+func New(w io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level, AddSource: true, ReplaceAttr: replaceAttr}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return slog.New(contextHandler{h}).With("service", ServiceName), nil
+}
+
+// Setup creates the process logger on stderr and makes it the default, so the standard library
+// log package and libraries using slog.Default write through it as well
+func Setup(level, format string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	logger, err := New(os.Stderr, lvl, format)
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// Component returns l, or the default logger when l is nil, tagged with the component name
+func Component(l *slog.Logger, name string) *slog.Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return l.With(KeyComponent, name)
+}
+
+// Resource identifies the queue, exchange or binding a log line is about
+func Resource(kind, name string) slog.Attr {
+	return slog.Group(KeyResource, "kind", kind, "name", name)
+}
+
+// Err records an error under the common key
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
+
+type fieldsKey struct{}
+
+// With returns a context whose log records carry the given fields, e.g. the request or run ID.
+// Fields added later take precedence over earlier ones with the same key.
+func With(ctx context.Context, args ...any) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	r := slog.Record{}
+	r.Add(args...)
+	fields := append([]slog.Attr{}, fieldsFrom(ctx)...)
+	r.Attrs(func(a slog.Attr) bool {
+		for i := range fields {
+			if fields[i].Key == a.Key {
+				fields = append(fields[:i], fields[i+1:]...)
+				break
+			}
+		}
+		fields = append(fields, a)
+		return true
+	})
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// WithRequestID tags the context's log records with the ID of the HTTP request
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return With(ctx, KeyRequestID, id)
+}
+
+// WithRunID tags the context's log records with the ID of a reconciliation run
+func WithRunID(ctx context.Context, id string) context.Context {
+	return With(ctx, KeyRunID, id)
+}
+
+func fieldsFrom(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]slog.Attr)
+	return fields
+}
+
+// contextHandler adds the fields stored in the record's context and the current trace ID
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if ctx != nil {
+		r.AddAttrs(fieldsFrom(ctx)...)
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			r.AddAttrs(slog.String(KeyTraceID, sc.TraceID().String()))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// replaceAttr renames the built-in fields to the schema in @architecture/logging.md: timestamp,
+// lowercase level (including trace), message, and file/line instead of a source object
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.TimeKey:
+		a.Key = "timestamp"
+	case slog.MessageKey:
+		a.Key = "message"
+	case slog.LevelKey:
+		level, _ := a.Value.Any().(slog.Level)
+		if level <= LevelTrace {
+			return slog.String(slog.LevelKey, "trace")
+		}
+		return slog.String(slog.LevelKey, strings.ToLower(level.String()))
+	case slog.SourceKey:
+		src, ok := a.Value.Any().(*slog.Source)
+		if !ok || src == nil {
+			return a
+		}
+		file := filepath.Join(filepath.Base(filepath.Dir(src.File)), filepath.Base(src.File))
+		return slog.Group("", slog.String("file", file), slog.Int("line", src.Line))
+	}
+	return a
+}
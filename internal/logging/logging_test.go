@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func decodeLine(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line), buf.String())
+	buf.Reset()
+	return line
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"trace": LevelTrace,
+		"DEBUG": slog.LevelDebug,
+		"":      slog.LevelInfo,
+		"info":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	}
+	for in, want := range tests {
+		got, err := ParseLevel(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestNew_JSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, slog.LevelInfo, FormatJSON)
+	require.NoError(t, err)
+
+	ctx := WithRunID(WithRequestID(context.Background(), "req-1"), "run-1")
+	Component(logger, "reconciliation").InfoContext(ctx, "created queue", Resource("queue", "orders"), Err(errors.New("boom")))
+
+	line := decodeLine(t, &buf)
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, "created queue", line["message"])
+	assert.Equal(t, ServiceName, line["service"])
+	assert.Equal(t, "reconciliation", line[KeyComponent])
+	assert.Equal(t, "req-1", line[KeyRequestID])
+	assert.Equal(t, "run-1", line[KeyRunID])
+	assert.Equal(t, map[string]interface{}{"kind": "queue", "name": "orders"}, line[KeyResource])
+	assert.Equal(t, "boom", line[KeyError])
+	assert.Equal(t, "logging/logging_test.go", line["file"])
+	assert.NotZero(t, line["line"])
+	assert.NotEmpty(t, line["timestamp"])
+}
+
+func TestNew_Level(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, slog.LevelInfo, FormatJSON)
+	require.NoError(t, err)
+	logger.Debug("hidden")
+	assert.Empty(t, buf.String())
+
+	logger, err = New(&buf, LevelTrace, FormatJSON)
+	require.NoError(t, err)
+	logger.Log(context.Background(), LevelTrace, "step")
+	assert.Equal(t, "trace", decodeLine(t, &buf)["level"])
+}
+
+func TestNew_Text(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, slog.LevelInfo, FormatText)
+	require.NoError(t, err)
+	logger.InfoContext(WithRequestID(context.Background(), "req-1"), "hello")
+	assert.True(t, strings.Contains(buf.String(), "request_id=req-1"), buf.String())
+	assert.True(t, strings.Contains(buf.String(), "message=hello"), buf.String())
+
+	_, err = New(&buf, slog.LevelInfo, "xml")
+	assert.Error(t, err)
+}
+
+func TestWith_OverridesFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, slog.LevelInfo, FormatJSON)
+	require.NoError(t, err)
+
+	ctx := WithRunID(context.Background(), "run-1")
+	ctx = WithRunID(ctx, "run-2")
+	logger.InfoContext(ctx, "hello")
+	assert.Equal(t, "run-2", decodeLine(t, &buf)[KeyRunID])
+}
+
+func TestNew_TraceID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, slog.LevelInfo, FormatJSON)
+	require.NoError(t, err)
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "op")
+	defer span.End()
+	logger.InfoContext(ctx, "traced")
+	assert.Equal(t, span.SpanContext().TraceID().String(), decodeLine(t, &buf)[KeyTraceID])
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "queue_manager"
+
+var (
+	reconciliationRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "reconciliation",
+		Name:      "runs_total",
+		Help:      "Reconciliation runs by trigger, status and dry-run flag.",
+	}, []string{"trigger", "status", "dry_run"})
+
+	reconciliationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "reconciliation",
+		Name:      "duration_seconds",
+		Help:      "Duration of reconciliation runs.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"trigger", "dry_run"})
+
+	reconciliationResources = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "reconciliation",
+		Name:      "resources_total",
+		Help:      "Resources created, deleted or failed on the provider by reconciliation, by resource kind.",
+	}, []string{"action", "kind"})
+
+	driftResources = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "drift",
+		Name:      "resources",
+		Help:      "Resources missing on the provider or unexpected on it, as seen by the last full reconciliation or drift report.",
+	}, []string{"state", "kind"})
+
+	providerUp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "provider",
+		Name:      "up",
+		Help:      "Whether the queue provider was healthy at the last health check (1) or not (0).",
+	})
+
+	managementAPIDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "management_api",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests to the broker management API.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "endpoint"})
+
+	managementAPIErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "management_api",
+		Name:      "errors_total",
+		Help:      "Failed requests to the broker management API, by HTTP status code or \"transport\".",
+	}, []string{"method", "endpoint", "code"})
+
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests served, by route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests served, by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// Resource kinds and drift states used as label values
+var (
+	kinds       = []string{"exchange", "queue", "binding"}
+	driftStates = []string{"missing", "unexpected"}
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRun records a finished reconciliation run
+func ObserveRun(trigger, status string, dryRun bool, duration time.Duration) {
+	dry := strconv.FormatBool(dryRun)
+	reconciliationRuns.WithLabelValues(trigger, status, dry).Inc()
+	reconciliationDuration.WithLabelValues(trigger, dry).Observe(duration.Seconds())
+}
+
+// AddResources counts resources created, deleted or errored ("created", "deleted", "errored")
+func AddResources(action, kind string, n int) {
+	if n > 0 {
+		reconciliationResources.WithLabelValues(action, kind).Add(float64(n))
+	}
+}
+
+// Drift counts resources per kind in one drift state
+type Drift map[string]int
+
+// SetDrift replaces the drift gauges. Kinds without drift are reported as 0.
+func SetDrift(missing, unexpected Drift) {
+	for _, state := range driftStates {
+		counts := missing
+		if state == "unexpected" {
+			counts = unexpected
+		}
+		for _, kind := range kinds {
+			driftResources.WithLabelValues(state, kind).Set(float64(counts[kind]))
+		}
+	}
+}
+
+// SetProviderUp records the outcome of a provider health check
+func SetProviderUp(up bool) {
+	if up {
+		providerUp.Set(1)
+	} else {
+		providerUp.Set(0)
+	}
+}
+
+// ObserveManagementAPI records a request to the broker management API. code is the HTTP
+// status code, or 0 when the request failed before a response was received.
+func ObserveManagementAPI(method, endpoint string, code int, duration time.Duration) {
+	managementAPIDuration.WithLabelValues(method, endpoint).Observe(duration.Seconds())
+	switch {
+	case code == 0:
+		managementAPIErrors.WithLabelValues(method, endpoint, "transport").Inc()
+	case code >= 400:
+		managementAPIErrors.WithLabelValues(method, endpoint, strconv.Itoa(code)).Inc()
+	}
+}
+
+// ObserveHTTP records a served HTTP request
+func ObserveHTTP(method, route string, status int, duration time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
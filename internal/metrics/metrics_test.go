@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"queue-manager/internal/queue"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDrift(t *testing.T) {
+	SetDrift(Drift{"queue": 2}, Drift{"binding": 1})
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(driftResources.WithLabelValues("missing", "queue")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(driftResources.WithLabelValues("missing", "exchange")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(driftResources.WithLabelValues("unexpected", "binding")))
+
+	// Resolved drift goes back to zero
+	SetDrift(Drift{}, Drift{})
+	assert.Equal(t, 0.0, testutil.ToFloat64(driftResources.WithLabelValues("missing", "queue")))
+}
+
+func TestObserveManagementAPI(t *testing.T) {
+	ObserveManagementAPI("GET", "/test", 200, time.Millisecond)
+	ObserveManagementAPI("GET", "/test", 503, time.Millisecond)
+	ObserveManagementAPI("GET", "/test", 0, time.Millisecond)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(managementAPIErrors.WithLabelValues("GET", "/test", "503")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(managementAPIErrors.WithLabelValues("GET", "/test", "transport")))
+	assert.Equal(t, 1, testutil.CollectAndCount(managementAPIDuration))
+}
+
+type fakeLister struct {
+	statuses []queue.QueueStatus
+	err      error
+}
+
+func (f fakeLister) ListQueueStatuses() ([]queue.QueueStatus, error) {
+	return f.statuses, f.err
+}
+
+func TestQueueCollector(t *testing.T) {
+	c := &queueCollector{lister: fakeLister{statuses: []queue.QueueStatus{{Name: "q1", Messages: 4, Consumers: 2}}}}
+
+	expected := `
+# HELP queue_manager_queue_consumers Consumers attached to the queue as reported by the management API.
+# TYPE queue_manager_queue_consumers gauge
+queue_manager_queue_consumers{queue="q1"} 2
+# HELP queue_manager_queue_messages Messages in the queue (ready and unacknowledged) as reported by the management API.
+# TYPE queue_manager_queue_messages gauge
+queue_manager_queue_messages{queue="q1"} 4
+`
+	require.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+
+	failing := &queueCollector{lister: fakeLister{err: errors.New("management API down")}}
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(failing))
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	assert.Empty(t, families)
+}
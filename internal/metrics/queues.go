@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"queue-manager/internal/logging"
+	"queue-manager/internal/queue"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queueMessagesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "queue", "messages"),
+		"Messages in the queue (ready and unacknowledged) as reported by the management API.",
+		[]string{"queue"}, nil,
+	)
+	queueConsumersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "queue", "consumers"),
+		"Consumers attached to the queue as reported by the management API.",
+		[]string{"queue"}, nil,
+	)
+)
+
+// queueCollector reads per-queue depth and consumers from the provider on every scrape. It is
+// opt-in: one gauge per queue can add many series on brokers with lots of queues.
+type queueCollector struct {
+	lister queue.QueueStatsLister
+}
+
+// RegisterQueueCollector exposes per-queue depth and consumer gauges
+func RegisterQueueCollector(lister queue.QueueStatsLister) error {
+	return prometheus.Register(&queueCollector{lister: lister})
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueMessagesDesc
+	ch <- queueConsumersDesc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	statuses, err := c.lister.ListQueueStatuses()
+	if err != nil {
+		logging.Component(nil, "metrics").Warn("failed to collect queue stats", logging.Err(err))
+		return
+	}
+	for _, s := range statuses {
+		ch <- prometheus.MustNewConstMetric(queueMessagesDesc, prometheus.GaugeValue, float64(s.Messages), s.Name)
+		ch <- prometheus.MustNewConstMetric(queueConsumersDesc, prometheus.GaugeValue, float64(s.Consumers), s.Name)
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"queue-manager/internal/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireToken only lets requests through that send one of the tokens as
+// "Authorization: Bearer <token>". Without tokens every request is rejected, so the routes it
+// guards stay disabled until tokens are configured.
+func RequireToken(tokens []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(tokens) == 0 {
+			response.Abort(c, response.NewError(http.StatusForbidden, response.CodeForbidden,
+				"write API is disabled; set API_TOKENS to enable it"))
+			return
+		}
+
+		scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+		if ok && strings.EqualFold(scheme, "Bearer") && validToken(tokens, strings.TrimSpace(token)) {
+			c.Next()
+			return
+		}
+		c.Header("WWW-Authenticate", `Bearer realm="queue-manager"`)
+		response.Abort(c, response.NewError(http.StatusUnauthorized, response.CodeUnauthorized,
+			"missing or invalid bearer token"))
+	}
+}
+
+// validToken compares in constant time, so response times do not leak how much of a token matched
+func validToken(tokens []string, token string) bool {
+	valid := 0
+	for _, t := range tokens {
+		valid |= subtle.ConstantTimeCompare([]byte(t), []byte(token))
+	}
+	return valid == 1
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(tokens []string, authorization string) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.POST("/test", RequireToken(tokens), func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+		req := httptest.NewRequest(http.MethodPost, "/test", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tokens := []string{"ci-token", "ops-token"}
+
+	t.Run("accepts a configured token", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, serve(tokens, "Bearer ops-token").Code)
+		assert.Equal(t, http.StatusNoContent, serve(tokens, "bearer ci-token").Code)
+	})
+
+	t.Run("rejects missing and unknown tokens", func(t *testing.T) {
+		for _, authorization := range []string{"", "Bearer", "Bearer ops", "Basic ops-token", "ops-token"} {
+			w := serve(tokens, authorization)
+			assert.Equal(t, http.StatusUnauthorized, w.Code, authorization)
+			assert.Contains(t, w.Body.String(), `"code":"UNAUTHORIZED"`)
+			assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+		}
+	})
+
+	t.Run("rejects everything without tokens", func(t *testing.T) {
+		w := serve(nil, "Bearer anything")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"FORBIDDEN"`)
+	})
+}
@@ -1,30 +1,75 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"queue-manager/internal/logging"
+	"queue-manager/internal/metrics"
+	"queue-manager/internal/response"
+	"queue-manager/internal/tracing"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// RequestID assigns every request an ID. The ID is added to the fields of everything logged with
+// the request's context. When the request is traced, the ID is recorded on the server span and
+// the trace ID is returned in X-Trace-ID, so either one leads to the other.
 func RequestID() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := uuid.New().String()
 		c.Writer.Header().Set("X-Request-ID", id)
-		c.Set("request_id", id)
+		c.Set(response.RequestIDKey, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		span := trace.SpanFromContext(c.Request.Context())
+		span.SetAttributes(tracing.RequestIDKey.String(id))
+		if traceID := tracing.TraceID(c.Request.Context()); traceID != "" {
+			c.Writer.Header().Set("X-Trace-ID", traceID)
+		}
 		c.Next()
 	}
 }
 
-func Logger() gin.HandlerFunc {
+// Logger logs every request once it has been handled: server errors at error level, client
+// errors at warn level and everything else at info level
+func Logger(logger *slog.Logger) gin.HandlerFunc {
+	logger = logging.Component(logger, "server")
 	return func(c *gin.Context) {
 		start := time.Now()
 		c.Next()
 		latency := time.Since(start)
 		status := c.Writer.Status()
-		log.Printf("%s %s -> %d (%s)", c.Request.Method, c.Request.URL.Path, status, latency.String())
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		logger.Log(c.Request.Context(), level, "request handled",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"duration_ms", latency.Milliseconds(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+// Metrics records request counts and latencies per route template, so path parameters do not
+// create a series per resource
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveHTTP(c.Request.Method, route, c.Writer.Status(), time.Since(start))
 	}
 }
 
@@ -32,7 +77,9 @@ func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, If-Match")
+		// Browsers hide response headers from scripts unless exposed; updates need the ETag for If-Match
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "ETag")
 		if c.Request.Method == http.MethodOptions {
 			c.AbortWithStatus(http.StatusNoContent)
 			return
@@ -52,7 +99,7 @@ func Timeout(timeout time.Duration) gin.HandlerFunc {
 		case <-done:
 			return
 		case <-time.After(timeout):
-			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{"error": "request timeout"})
+			response.Abort(c, response.NewError(http.StatusGatewayTimeout, response.CodeTimeout, "request timeout"))
 			return
 		}
 	}
@@ -1,16 +1,26 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"queue-manager/internal/logging"
+	"queue-manager/internal/metrics"
+	"queue-manager/internal/tracing"
+
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestRequestID(t *testing.T) {
@@ -54,6 +64,26 @@ func TestRequestID(t *testing.T) {
 	})
 }
 
+func TestRequestID_LinksTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	ctx, span := tp.Tracer("test").Start(context.Background(), "GET /test")
+	c.Request = httptest.NewRequest(http.MethodGet, "/test", nil).WithContext(ctx)
+
+	RequestID()(c)
+	span.End()
+
+	requestID := w.Header().Get("X-Request-ID")
+	assert.Equal(t, span.SpanContext().TraceID().String(), w.Header().Get("X-Trace-ID"))
+	ended := recorder.Ended()
+	require.Len(t, ended, 1)
+	assert.Contains(t, ended[0].Attributes(), tracing.RequestIDKey.String(requestID))
+}
+
 func TestLogger(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -62,7 +92,7 @@ func TestLogger(t *testing.T) {
 		c, _ := gin.CreateTestContext(w)
 		c.Request = httptest.NewRequest(http.MethodGet, "/test", nil)
 
-		handler := Logger()
+		handler := Logger(nil)
 		start := time.Now()
 		handler(c)
 		elapsed := time.Since(start)
@@ -79,7 +109,7 @@ func TestLogger(t *testing.T) {
 		c, _ := gin.CreateTestContext(w)
 		c.Request = httptest.NewRequest(http.MethodPost, "/slow", nil)
 
-		handler := Logger()
+		handler := Logger(nil)
 		
 		// Create a router with a slow handler
 		r := gin.New()
@@ -97,6 +127,29 @@ func TestLogger(t *testing.T) {
 	})
 }
 
+func TestLogger_RequestFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, slog.LevelInfo, logging.FormatJSON)
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(RequestID(), Logger(logger))
+	r.GET("/missing", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line), buf.String())
+	assert.Equal(t, "warn", line["level"])
+	assert.Equal(t, "server", line[logging.KeyComponent])
+	assert.Equal(t, w.Header().Get("X-Request-ID"), line[logging.KeyRequestID])
+	assert.Equal(t, "/missing", line["path"])
+	assert.Equal(t, float64(http.StatusNotFound), line["status"])
+}
+
 func TestCORS(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -110,7 +163,23 @@ func TestCORS(t *testing.T) {
 
 		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
 		assert.Equal(t, "GET, POST, PUT, DELETE, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
-		assert.Equal(t, "Content-Type, Authorization, X-Request-ID", w.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "Content-Type, Authorization, X-Request-ID, If-Match", w.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "ETag", w.Header().Get("Access-Control-Expose-Headers"))
+	})
+
+	t.Run("allows conditional writes from browsers", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodOptions, "/queues/orders", nil)
+		c.Request.Header.Set("Access-Control-Request-Method", http.MethodPut)
+		c.Request.Header.Set("Access-Control-Request-Headers", "authorization, if-match")
+
+		handler := CORS()
+		handler(c)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "If-Match")
+		assert.Equal(t, "ETag", w.Header().Get("Access-Control-Expose-Headers"))
 	})
 
 	t.Run("handles OPTIONS request", func(t *testing.T) {
@@ -184,6 +253,30 @@ func TestTimeout(t *testing.T) {
 		
 		assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
 		require.Equal(t, http.StatusGatewayTimeout, w.Code)
+		assert.Contains(t, w.Body.String(), `"message":"request timeout"`)
+		assert.Contains(t, w.Body.String(), `"code":"TIMEOUT"`)
 	})
 }
 
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Metrics())
+	r.GET("/items/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/items/42", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	metricsRecorder := httptest.NewRecorder()
+	metricsRouter := gin.New()
+	metricsRouter.GET("/metrics", gin.WrapH(metrics.Handler()))
+	metricsRouter.ServeHTTP(metricsRecorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	// Requests are labelled with the route template, not the concrete path
+	assert.Contains(t, metricsRecorder.Body.String(), `queue_manager_http_requests_total{method="GET",route="/items/:id",status="200"}`)
+	assert.NotContains(t, metricsRecorder.Body.String(), `/items/42`)
+}
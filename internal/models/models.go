@@ -92,3 +92,44 @@ type ServiceAssignment struct {
 	Notes        string    `json:"notes"`
 }
 
+// ReconciliationRun records a single reconciliation run
+type ReconciliationRun struct {
+	ID         int64     `json:"-"`
+	UUID       string    `json:"id"`
+	Trigger    string    `json:"trigger"`
+	RequestID  string    `json:"request_id,omitempty"`
+	PlanID     string    `json:"plan_id,omitempty"`
+	DryRun     bool      `json:"dry_run"`
+	Force      bool      `json:"force"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	Summary    JSONB     `json:"summary"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// ReconciliationAction records one action (or error) of a reconciliation run
+type ReconciliationAction struct {
+	ID           int64     `json:"-"`
+	Action       string    `json:"action"`
+	ResourceKind string    `json:"resource_kind,omitempty"`
+	ResourceName string    `json:"resource_name,omitempty"`
+	Detail       string    `json:"detail,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// WebhookDelivery records one attempt to deliver a webhook event to a sink
+type WebhookDelivery struct {
+	ID          int64     `json:"-"`
+	DeliveryID  string    `json:"delivery_id"`
+	Sink        string    `json:"sink"`
+	EventID     string    `json:"event_id"`
+	EventType   string    `json:"event_type"`
+	Attempt     int       `json:"attempt"`
+	Success     bool      `json:"success"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
@@ -0,0 +1,222 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"queue-manager/internal/logging"
+	"queue-manager/internal/reconciliation"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Channel is the Postgres notification channel the topology triggers send on
+// (see migrations/004_topology_notifications.sql)
+const Channel = "queue_manager_topology"
+
+// Event is the payload of a topology change notification
+type Event struct {
+	Table       string `json:"table"`
+	Op          string `json:"op"`
+	Exchange    string `json:"exchange,omitempty"`
+	Queue       string `json:"queue,omitempty"`
+	OldExchange string `json:"old_exchange,omitempty"`
+	OldQueue    string `json:"old_queue,omitempty"`
+}
+
+// ParseEvent decodes a notification payload
+func ParseEvent(payload string) (Event, error) {
+	var ev Event
+	if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+		return Event{}, err
+	}
+	if ev.Table == "" {
+		return Event{}, errors.New("notification payload has no table")
+	}
+	return ev, nil
+}
+
+// Scope returns the resources affected by the change
+func (e Event) Scope() reconciliation.Scope {
+	var scope reconciliation.Scope
+	switch e.Table {
+	case "exchanges":
+		scope.Exchanges = []string{e.Exchange, e.OldExchange}
+	case "queues", "service_assignments":
+		scope.Queues = []string{e.Queue, e.OldQueue}
+	case "bindings":
+		scope.Exchanges = []string{e.Exchange, e.OldExchange}
+		scope.Queues = []string{e.Queue, e.OldQueue}
+	}
+	// Drop empty names and duplicates
+	var cleaned reconciliation.Scope
+	cleaned.Merge(scope)
+	return cleaned
+}
+
+// Handler reconciles the resources in scope. A nil scope asks for a full reconciliation, which
+// is requested after reconnecting since notifications sent while disconnected are lost.
+type Handler func(scope *reconciliation.Scope)
+
+// Listener listens for topology change notifications on a dedicated connection and calls the
+// handler once changes have settled for the debounce period. Changes arriving during that
+// period are merged into a single call; a steady stream of changes is flushed after maxWait.
+type Listener struct {
+	uri      string
+	debounce time.Duration
+	maxWait  time.Duration
+	handle   Handler
+
+	changes chan change
+	cancel  context.CancelFunc
+	done    chan struct{}
+	logger  *slog.Logger
+}
+
+// change is a scope to reconcile, or a request for a full reconciliation
+type change struct {
+	scope reconciliation.Scope
+	full  bool
+}
+
+// NewListener creates a listener connecting to the database at uri
+func NewListener(uri string, debounce time.Duration, handle Handler) *Listener {
+	return &Listener{
+		uri:      uri,
+		debounce: debounce,
+		maxWait:  10 * debounce,
+		handle:   handle,
+		changes:  make(chan change, 256),
+		logger:   logging.Component(nil, "notify"),
+	}
+}
+
+// SetLogger replaces the listener's logger
+func (l *Listener) SetLogger(logger *slog.Logger) {
+	l.logger = logging.Component(logger, "notify")
+}
+
+// Start listens and dispatches changes in the background until Stop is called
+func (l *Listener) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.done = make(chan struct{})
+
+	go l.listen(ctx)
+	go func() {
+		defer close(l.done)
+		l.dispatch(ctx)
+	}()
+	l.logger.Info("listening for topology changes", "channel", Channel, "debounce", l.debounce)
+}
+
+// Stop closes the connection and waits for a running handler to return
+func (l *Listener) Stop() {
+	if l.cancel == nil {
+		return
+	}
+	l.cancel()
+	<-l.done
+	l.cancel = nil
+}
+
+// listen keeps a LISTEN session open, reconnecting with backoff when it fails
+func (l *Listener) listen(ctx context.Context) {
+	backoff := time.Second
+	reconnect := false
+	for {
+		err := l.session(ctx, reconnect, func() { backoff = time.Second })
+		if ctx.Err() != nil {
+			return
+		}
+		l.logger.Warn("listener connection failed, reconnecting", logging.Err(err), "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+		reconnect = true
+	}
+}
+
+// session runs a single LISTEN session until the connection fails or ctx is cancelled
+func (l *Listener) session(ctx context.Context, reconnect bool, connected func()) error {
+	conn, err := pgx.Connect(ctx, l.uri)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+	connected()
+	if reconnect {
+		l.logger.Info("listener reconnected, requesting a full reconciliation for changes missed meanwhile")
+		l.notify(ctx, change{full: true})
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		ev, err := ParseEvent(n.Payload)
+		if err != nil {
+			l.logger.Warn("ignoring malformed notification", "payload", n.Payload, logging.Err(err))
+			continue
+		}
+		l.logger.Debug("topology changed", "op", ev.Op, "table", ev.Table, "exchange", ev.Exchange, "queue", ev.Queue)
+		l.notify(ctx, change{scope: ev.Scope()})
+	}
+}
+
+func (l *Listener) notify(ctx context.Context, c change) {
+	select {
+	case l.changes <- c:
+	case <-ctx.Done():
+	}
+}
+
+// dispatch merges changes and calls the handler once they have settled
+func (l *Listener) dispatch(ctx context.Context) {
+	var (
+		pending *reconciliation.Scope
+		full    bool
+		first   time.Time
+		timer   = time.NewTimer(time.Hour)
+	)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-l.changes:
+			if pending == nil {
+				pending = &reconciliation.Scope{}
+				first = time.Now()
+				timer.Reset(l.debounce)
+			} else if time.Since(first) < l.maxWait {
+				timer.Reset(l.debounce)
+			}
+			pending.Merge(c.scope)
+			full = full || c.full
+		case <-timer.C:
+			scope := pending
+			if full {
+				scope = nil
+			}
+			pending, full = nil, false
+			l.handle(scope)
+		}
+	}
+}
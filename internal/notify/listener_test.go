@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"queue-manager/internal/reconciliation"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		expect  reconciliation.Scope
+		wantErr bool
+	}{
+		{
+			name:    "queue insert",
+			payload: `{"table":"queues","op":"INSERT","queue":"orders"}`,
+			expect:  reconciliation.Scope{Queues: []string{"orders"}},
+		},
+		{
+			name:    "exchange rename",
+			payload: `{"table":"exchanges","op":"UPDATE","exchange":"events.v2","old_exchange":"events"}`,
+			expect:  reconciliation.Scope{Exchanges: []string{"events.v2", "events"}},
+		},
+		{
+			name:    "binding delete",
+			payload: `{"table":"bindings","op":"DELETE","exchange":"events","queue":"orders"}`,
+			expect:  reconciliation.Scope{Exchanges: []string{"events"}, Queues: []string{"orders"}},
+		},
+		{
+			name:    "assignment update",
+			payload: `{"table":"service_assignments","op":"UPDATE","queue":"orders"}`,
+			expect:  reconciliation.Scope{Queues: []string{"orders"}},
+		},
+		{name: "malformed", payload: `not json`, wantErr: true},
+		{name: "missing table", payload: `{"op":"INSERT"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev, err := ParseEvent(tt.payload)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expect, ev.Scope())
+		})
+	}
+}
+
+func TestListener_DebouncesChanges(t *testing.T) {
+	calls := make(chan *reconciliation.Scope, 10)
+	l := NewListener("", 50*time.Millisecond, func(scope *reconciliation.Scope) { calls <- scope })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.dispatch(ctx)
+
+	l.notify(ctx, change{scope: reconciliation.Scope{Queues: []string{"q1"}}})
+	l.notify(ctx, change{scope: reconciliation.Scope{Queues: []string{"q1", "q2"}}})
+	l.notify(ctx, change{scope: reconciliation.Scope{Exchanges: []string{"ex1"}}})
+
+	select {
+	case scope := <-calls:
+		require.NotNil(t, scope)
+		assert.Equal(t, []string{"q1", "q2"}, scope.Queues)
+		assert.Equal(t, []string{"ex1"}, scope.Exchanges)
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+
+	select {
+	case <-calls:
+		t.Fatal("changes within the debounce period must be handled in a single call")
+	case <-time.After(150 * time.Millisecond):
+	}
+}
+
+func TestListener_FullReconciliationAfterReconnect(t *testing.T) {
+	calls := make(chan *reconciliation.Scope, 10)
+	l := NewListener("", 20*time.Millisecond, func(scope *reconciliation.Scope) { calls <- scope })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.dispatch(ctx)
+
+	l.notify(ctx, change{scope: reconciliation.Scope{Queues: []string{"q1"}}})
+	l.notify(ctx, change{full: true})
+
+	select {
+	case scope := <-calls:
+		assert.Nil(t, scope)
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+}
@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"errors"
+
+	"queue-manager/internal/leader"
+	"queue-manager/internal/logging"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/reconciliation"
+)
+
+// Reconcile returns a handler running targeted reconciliations with rec. Like the cron job it
+// only reconciles on the leader and while the provider is healthy; changes skipped here are
+// picked up by the periodic safety-net reconciliation.
+func Reconcile(rec *reconciliation.Reconciler, qp queue.Provider, e *leader.Elector) Handler {
+	return ReconcileAs(reconciliation.TriggerEvent, rec, qp, e)
+}
+
+// ReconcileAs is like Reconcile, recording the runs with the given trigger source
+func ReconcileAs(source string, rec *reconciliation.Reconciler, qp queue.Provider, e *leader.Elector) Handler {
+	logger := logging.Component(nil, "notify")
+	return func(scope *reconciliation.Scope) {
+		if !e.IsLeader() {
+			logger.Debug("this instance is not the leader, skipping reconciliation")
+			return
+		}
+		if hs := qp.Health(); !hs.OK {
+			logger.Warn("queue provider is unhealthy, skipping reconciliation", "details", hs.Details)
+			return
+		}
+
+		if scope == nil {
+			logger.Info("running full reconciliation")
+		} else {
+			logger.Info("running targeted reconciliation", "exchanges", scope.Exchanges, "queues", scope.Queues)
+		}
+		result, err := rec.Reconcile(context.Background(), reconciliation.Request{
+			Scope:   scope,
+			Trigger: reconciliation.Trigger{Source: source},
+		})
+		if err != nil && !errors.Is(err, reconciliation.ErrPruningAborted) {
+			logger.Error("reconciliation failed", logging.Err(err))
+			return
+		}
+		logger.Info("reconciliation completed", logging.KeyRunID, result.RunID, "summary", result.Summary())
+		if len(result.Errors) > 0 {
+			logger.Error("reconciliation had errors", logging.KeyRunID, result.RunID, "errors", result.Errors)
+		}
+	}
+}
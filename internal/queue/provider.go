@@ -1,10 +1,30 @@
 package queue
 
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// ErrNotFound is returned when the requested resource does not exist on the provider.
+var ErrNotFound = errors.New("resource not found")
+
+// ErrDeletePreconditionFailed is returned by DeleteQueueIf when the provider refused the
+// deletion because the queue still holds messages or has consumers attached.
+var ErrDeletePreconditionFailed = errors.New("delete precondition failed")
+
 type HealthStatus struct {
 	OK      bool
 	Details string
 }
 
+// QueueStatus describes the runtime state of a queue as reported by the provider.
+type QueueStatus struct {
+	Name      string
+	Messages  int
+	Consumers int
+}
+
 type Provider interface {
 	Connect() error
 	Close() error
@@ -22,8 +42,35 @@ type Provider interface {
 	ListExchanges() ([]string, error)
 	ListQueues() ([]string, error)
 	ListBindings(queueName string) ([][3]string, error) // returns [queue, exchange, routingKey]
+	InspectQueue(name string) (QueueStatus, error)      // returns ErrNotFound if the queue does not exist
 
 	// Delete resources
 	DeleteQueue(name string) error
+	DeleteQueueIf(name string, ifEmpty, ifUnused bool) error // returns ErrDeletePreconditionFailed if refused
 	DeleteExchange(name string) error
 }
+
+// QueueStatsLister is implemented by providers that can report the runtime state of all queues
+// in a single call
+type QueueStatsLister interface {
+	ListQueueStatuses() ([]QueueStatus, error)
+}
+
+// ContextBinder is implemented by providers that can run their calls under a context, so the
+// calls are traced as part of the caller's span
+type ContextBinder interface {
+	WithContext(ctx context.Context) Provider
+}
+
+// WithContext returns p bound to ctx if the provider supports it, and p itself otherwise
+func WithContext(ctx context.Context, p Provider) Provider {
+	if b, ok := p.(ContextBinder); ok && ctx != nil {
+		return b.WithContext(ctx)
+	}
+	return p
+}
+
+// LoggerSetter is implemented by providers that accept an injected logger
+type LoggerSetter interface {
+	SetLogger(l *slog.Logger)
+}
@@ -0,0 +1,170 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"queue-manager/internal/queue"
+)
+
+// DefaultVhost is the virtual host the provider manages
+const DefaultVhost = "/"
+
+// Definitions is a RabbitMQ definitions file, as exported by the management UI,
+// GET /api/definitions or rabbitmqctl export_definitions. Exchanges, queues and bindings are
+// typed; the other sections are kept as they are.
+type Definitions struct {
+	RabbitVersion    string               `json:"rabbit_version,omitempty"`
+	RabbitMQVersion  string               `json:"rabbitmq_version,omitempty"`
+	Users            []json.RawMessage    `json:"users,omitempty"`
+	Vhosts           []json.RawMessage    `json:"vhosts,omitempty"`
+	Permissions      []json.RawMessage    `json:"permissions,omitempty"`
+	TopicPermissions []json.RawMessage    `json:"topic_permissions,omitempty"`
+	Parameters       []json.RawMessage    `json:"parameters,omitempty"`
+	GlobalParameters []json.RawMessage    `json:"global_parameters,omitempty"`
+	Policies         []json.RawMessage    `json:"policies,omitempty"`
+	Queues           []QueueDefinition    `json:"queues"`
+	Exchanges        []ExchangeDefinition `json:"exchanges"`
+	Bindings         []BindingDefinition  `json:"bindings"`
+}
+
+// QueueDefinition is a queue in a definitions file. Vhost is empty in files exported for a
+// single virtual host.
+type QueueDefinition struct {
+	Name       string                 `json:"name"`
+	Vhost      string                 `json:"vhost,omitempty"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+// ExchangeDefinition is an exchange in a definitions file
+type ExchangeDefinition struct {
+	Name       string                 `json:"name"`
+	Vhost      string                 `json:"vhost,omitempty"`
+	Type       string                 `json:"type"`
+	Durable    bool                   `json:"durable"`
+	AutoDelete bool                   `json:"auto_delete"`
+	Internal   bool                   `json:"internal"`
+	Arguments  map[string]interface{} `json:"arguments"`
+}
+
+// BindingDefinition is a binding in a definitions file; DestinationType is queue or exchange
+type BindingDefinition struct {
+	Source          string                 `json:"source"`
+	Vhost           string                 `json:"vhost,omitempty"`
+	Destination     string                 `json:"destination"`
+	DestinationType string                 `json:"destination_type"`
+	RoutingKey      string                 `json:"routing_key"`
+	Arguments       map[string]interface{} `json:"arguments"`
+}
+
+// ParseDefinitions decodes a definitions file
+func ParseDefinitions(r io.Reader) (Definitions, error) {
+	var d Definitions
+	if err := json.NewDecoder(r).Decode(&d); err != nil {
+		return Definitions{}, fmt.Errorf("failed to parse definitions: %w", err)
+	}
+	return d, nil
+}
+
+// Topology returns the exchanges, queues and bindings of vhost in the same form as ListTopology:
+// system exchanges and bindings from the default exchange are left out. Resources without a vhost
+// belong to every vhost.
+func (d Definitions) Topology(vhost string) queue.Topology {
+	t := queue.Topology{
+		Exchanges: []queue.ExchangeInfo{},
+		Queues:    []queue.QueueInfo{},
+		Bindings:  []queue.BindingInfo{},
+		Timestamp: time.Now(),
+		Detailed:  true,
+
+		ExchangeBindings: []queue.ExchangeBindingInfo{},
+	}
+	in := func(v string) bool { return v == "" || v == vhost }
+
+	for _, x := range d.Exchanges {
+		if in(x.Vhost) && !isSystemExchange(x.Name) {
+			t.Exchanges = append(t.Exchanges, queue.ExchangeInfo{
+				Name: x.Name, Type: x.Type, Durable: x.Durable, AutoDelete: x.AutoDelete,
+				Internal: x.Internal, Arguments: x.Arguments,
+			})
+		}
+	}
+	for _, q := range d.Queues {
+		if in(q.Vhost) {
+			t.Queues = append(t.Queues, queue.QueueInfo{
+				Name: q.Name, Durable: q.Durable, AutoDelete: q.AutoDelete, Arguments: q.Arguments,
+			})
+		}
+	}
+	for _, b := range d.Bindings {
+		if !in(b.Vhost) || b.Source == "" {
+			continue
+		}
+		switch b.DestinationType {
+		case "queue":
+			t.Bindings = append(t.Bindings, queue.BindingInfo{
+				Exchange: b.Source, Queue: b.Destination, RoutingKey: b.RoutingKey, Arguments: b.Arguments,
+			})
+		case "exchange":
+			t.ExchangeBindings = append(t.ExchangeBindings, queue.ExchangeBindingInfo{
+				Source: b.Source, Destination: b.Destination, RoutingKey: b.RoutingKey, Arguments: b.Arguments,
+			})
+		}
+	}
+	return t
+}
+
+// NewDefinitions returns a definitions file declaring vhost and the exchanges, queues and bindings
+// of t in it, ready for rabbitmqctl import_definitions or the management UI. System
+// exchanges exist on every broker and cannot be declared, so they are left out; bindings from
+// them are kept.
+func NewDefinitions(vhost string, t queue.Topology) Definitions {
+	d := Definitions{
+		Vhosts:    []json.RawMessage{},
+		Queues:    []QueueDefinition{},
+		Exchanges: []ExchangeDefinition{},
+		Bindings:  []BindingDefinition{},
+	}
+	if v, err := json.Marshal(map[string]string{"name": vhost}); err == nil {
+		d.Vhosts = append(d.Vhosts, v)
+	}
+	for _, x := range t.Exchanges {
+		if isSystemExchange(x.Name) {
+			continue
+		}
+		d.Exchanges = append(d.Exchanges, ExchangeDefinition{
+			Name: x.Name, Vhost: vhost, Type: x.Type, Durable: x.Durable, AutoDelete: x.AutoDelete,
+			Internal: x.Internal, Arguments: orEmpty(x.Arguments),
+		})
+	}
+	for _, q := range t.Queues {
+		d.Queues = append(d.Queues, QueueDefinition{
+			Name: q.Name, Vhost: vhost, Durable: q.Durable, AutoDelete: q.AutoDelete, Arguments: orEmpty(q.Arguments),
+		})
+	}
+	for _, b := range t.Bindings {
+		d.Bindings = append(d.Bindings, BindingDefinition{
+			Source: b.Exchange, Vhost: vhost, Destination: b.Queue, DestinationType: "queue",
+			RoutingKey: b.RoutingKey, Arguments: orEmpty(b.Arguments),
+		})
+	}
+	for _, b := range t.ExchangeBindings {
+		d.Bindings = append(d.Bindings, BindingDefinition{
+			Source: b.Source, Vhost: vhost, Destination: b.Destination, DestinationType: "exchange",
+			RoutingKey: b.RoutingKey, Arguments: orEmpty(b.Arguments),
+		})
+	}
+	return d
+}
+
+// orEmpty returns args, or an empty map for nil: RabbitMQ rejects null arguments on import
+func orEmpty(args map[string]interface{}) map[string]interface{} {
+	if args == nil {
+		return map[string]interface{}{}
+	}
+	return args
+}
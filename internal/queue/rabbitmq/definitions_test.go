@@ -0,0 +1,78 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"queue-manager/internal/queue"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefinitions_Topology(t *testing.T) {
+	defs, err := ParseDefinitions(strings.NewReader(`{
+		"rabbit_version": "3.13.0",
+		"users": [{"name": "guest"}],
+		"exchanges": [
+			{"name": "orders", "vhost": "/", "type": "topic", "durable": true, "auto_delete": false, "internal": false, "arguments": {}},
+			{"name": "amq.topic", "vhost": "/", "type": "topic", "durable": true},
+			{"name": "billing", "vhost": "staging", "type": "direct", "durable": true}
+		],
+		"queues": [
+			{"name": "orders.created", "vhost": "/", "durable": true, "auto_delete": false, "arguments": {"x-queue-type": "quorum"}},
+			{"name": "billing.invoices", "vhost": "staging", "durable": true}
+		],
+		"bindings": [
+			{"source": "orders", "vhost": "/", "destination": "orders.created", "destination_type": "queue", "routing_key": "order.created", "arguments": {}},
+			{"source": "orders", "vhost": "/", "destination": "audit", "destination_type": "exchange", "routing_key": "#"}
+		]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "3.13.0", defs.RabbitVersion)
+	assert.Len(t, defs.Users, 1)
+
+	top := defs.Topology(DefaultVhost)
+	assert.True(t, top.Detailed)
+	assert.Equal(t, []queue.ExchangeInfo{{Name: "orders", Type: "topic", Durable: true, Arguments: map[string]interface{}{}}}, top.Exchanges)
+	require.Len(t, top.Queues, 1)
+	assert.Equal(t, "quorum", top.Queues[0].Arguments["x-queue-type"])
+	assert.Equal(t, []queue.BindingInfo{{Exchange: "orders", Queue: "orders.created", RoutingKey: "order.created", Arguments: map[string]interface{}{}}}, top.Bindings)
+	assert.Equal(t, []queue.ExchangeBindingInfo{{Source: "orders", Destination: "audit", RoutingKey: "#"}}, top.ExchangeBindings)
+
+	staging := defs.Topology("staging")
+	require.Len(t, staging.Exchanges, 1)
+	assert.Equal(t, "billing", staging.Exchanges[0].Name)
+
+	_, err = ParseDefinitions(strings.NewReader(`[]`))
+	assert.Error(t, err)
+}
+
+func TestNewDefinitions(t *testing.T) {
+	defs := NewDefinitions("staging", queue.Topology{
+		Exchanges: []queue.ExchangeInfo{
+			{Name: "orders", Type: "topic", Durable: true},
+			{Name: "amq.direct", Type: "direct", Durable: true},
+		},
+		Queues:   []queue.QueueInfo{{Name: "orders.created", Durable: true, Arguments: map[string]interface{}{"x-queue-type": "quorum"}}},
+		Bindings: []queue.BindingInfo{{Exchange: "orders", Queue: "orders.created", RoutingKey: "order.created"}},
+	})
+
+	var buf strings.Builder
+	require.NoError(t, json.NewEncoder(&buf).Encode(defs))
+	assert.JSONEq(t, `{
+		"vhosts": [{"name": "staging"}],
+		"exchanges": [{"name": "orders", "vhost": "staging", "type": "topic", "durable": true, "auto_delete": false, "internal": false, "arguments": {}}],
+		"queues": [{"name": "orders.created", "vhost": "staging", "durable": true, "auto_delete": false, "arguments": {"x-queue-type": "quorum"}}],
+		"bindings": [{"source": "orders", "vhost": "staging", "destination": "orders.created", "destination_type": "queue", "routing_key": "order.created", "arguments": {}}]
+	}`, buf.String())
+
+	// An exported file imports back to the same topology
+	parsed, err := ParseDefinitions(strings.NewReader(buf.String()))
+	require.NoError(t, err)
+	top := parsed.Topology("staging")
+	assert.Len(t, top.Exchanges, 1)
+	assert.Len(t, top.Queues, 1)
+	assert.Len(t, top.Bindings, 1)
+}
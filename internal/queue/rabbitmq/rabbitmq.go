@@ -1,15 +1,24 @@
 package rabbitmq
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
+	"queue-manager/internal/logging"
+	"queue-manager/internal/metrics"
 	"queue-manager/internal/queue"
+	"queue-manager/internal/tracing"
 
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Provider struct {
@@ -18,6 +27,18 @@ type Provider struct {
 	conn     *amqp.Connection
 	username string
 	password string
+	// ctx carries the caller's trace and log fields for management API requests and AMQP calls
+	ctx    context.Context
+	logger *slog.Logger
+}
+
+// httpClient traces management API requests as client spans named after the endpoint
+var httpClient = &http.Client{
+	Transport: otelhttp.NewTransport(http.DefaultTransport,
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return "rabbitmq " + r.Method + " " + endpointLabel(strings.TrimPrefix(r.URL.EscapedPath(), "/api"))
+		}),
+	),
 }
 
 func New(amqpURI string) *Provider {
@@ -51,7 +72,65 @@ func New(amqpURI string) *Provider {
 		httpURI:  httpURI,
 		username: username,
 		password: password,
+		ctx:      context.Background(),
+		logger:   logging.Component(nil, "provider").With("provider", "rabbitmq"),
+	}
+}
+
+// SetLogger replaces the provider's logger
+func (p *Provider) SetLogger(l *slog.Logger) {
+	p.logger = logging.Component(l, "provider").With("provider", "rabbitmq")
+}
+
+func (p *Provider) log() *slog.Logger {
+	if p.logger == nil {
+		return logging.Component(nil, "provider").With("provider", "rabbitmq")
 	}
+	return p.logger
+}
+
+// WithContext returns a copy of the provider whose calls are traced as children of the span in
+// ctx. The copy shares the connection that is open at the time of the call and is meant for
+// the duration of one operation, such as a reconciliation run.
+func (p *Provider) WithContext(ctx context.Context) queue.Provider {
+	c := *p
+	c.ctx = ctx
+	return &c
+}
+
+func (p *Provider) context() context.Context {
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// operation is an AMQP call in progress, traced in its own span
+type operation struct {
+	p        *Provider
+	name     string
+	resource slog.Attr
+	span     trace.Span
+}
+
+// startOp starts an AMQP operation such as "queue.declare" on the given resource
+func (p *Provider) startOp(name string, resource slog.Attr, attrs ...attribute.KeyValue) *operation {
+	attrs = append(attrs,
+		attribute.String("messaging.system", "rabbitmq"),
+		attribute.String("messaging.operation.name", name),
+	)
+	_, span := tracing.Start(p.context(), "rabbitmq "+name, attrs...)
+	return &operation{p: p, name: name, resource: resource, span: span}
+}
+
+// end ends the span and logs the outcome
+func (o *operation) end(err error) {
+	tracing.End(o.span, err)
+	if err != nil {
+		o.p.log().WarnContext(o.p.context(), "AMQP operation failed", "op", o.name, o.resource, logging.Err(err))
+		return
+	}
+	o.p.log().DebugContext(o.p.context(), "AMQP operation succeeded", "op", o.name, o.resource)
 }
 
 // NewWithHTTP creates a provider with explicit HTTP URI
@@ -114,7 +193,11 @@ func (p *Provider) channel() (*amqp.Channel, error) {
 	return p.conn.Channel()
 }
 
-func (p *Provider) DeclareExchange(name, kind string, durable bool) error {
+func (p *Provider) DeclareExchange(name, kind string, durable bool) (err error) {
+	op := p.startOp("exchange.declare", logging.Resource("exchange", name),
+		attribute.String("rabbitmq.exchange", name), attribute.String("rabbitmq.exchange.type", kind))
+	defer func() { op.end(err) }()
+
 	ch, err := p.channel()
 	if err != nil {
 		return err
@@ -123,7 +206,10 @@ func (p *Provider) DeclareExchange(name, kind string, durable bool) error {
 	return ch.ExchangeDeclare(name, kind, durable, false, false, false, nil)
 }
 
-func (p *Provider) DeclareQueue(name string, durable bool) error {
+func (p *Provider) DeclareQueue(name string, durable bool) (err error) {
+	op := p.startOp("queue.declare", logging.Resource("queue", name), attribute.String("rabbitmq.queue", name))
+	defer func() { op.end(err) }()
+
 	ch, err := p.channel()
 	if err != nil {
 		return err
@@ -133,7 +219,10 @@ func (p *Provider) DeclareQueue(name string, durable bool) error {
 	return err
 }
 
-func (p *Provider) BindQueue(queue, exchange, routingKey string) error {
+func (p *Provider) BindQueue(queue, exchange, routingKey string) (err error) {
+	op := p.startOp("queue.bind", bindingResource(queue, exchange, routingKey), bindingAttributes(queue, exchange, routingKey)...)
+	defer func() { op.end(err) }()
+
 	ch, err := p.channel()
 	if err != nil {
 		return err
@@ -142,7 +231,10 @@ func (p *Provider) BindQueue(queue, exchange, routingKey string) error {
 	return ch.QueueBind(queue, routingKey, exchange, false, nil)
 }
 
-func (p *Provider) UnbindQueue(queue, exchange, routingKey string) error {
+func (p *Provider) UnbindQueue(queue, exchange, routingKey string) (err error) {
+	op := p.startOp("queue.unbind", bindingResource(queue, exchange, routingKey), bindingAttributes(queue, exchange, routingKey)...)
+	defer func() { op.end(err) }()
+
 	ch, err := p.channel()
 	if err != nil {
 		return err
@@ -151,7 +243,11 @@ func (p *Provider) UnbindQueue(queue, exchange, routingKey string) error {
 	return ch.QueueUnbind(queue, routingKey, exchange, nil)
 }
 
-func (p *Provider) Publish(exchange, routingKey string, body []byte) error {
+func (p *Provider) Publish(exchange, routingKey string, body []byte) (err error) {
+	op := p.startOp("publish", logging.Resource("exchange", exchange),
+		attribute.String("rabbitmq.exchange", exchange), attribute.String("rabbitmq.routing_key", routingKey))
+	defer func() { op.end(err) }()
+
 	ch, err := p.channel()
 	if err != nil {
 		return err
@@ -190,7 +286,10 @@ func (p *Provider) Consume(queueName string) (<-chan []byte, func(ack bool) erro
 	return out, ackFn, nil
 }
 
-func (p *Provider) PurgeQueue(queueName string) error {
+func (p *Provider) PurgeQueue(queueName string) (err error) {
+	op := p.startOp("queue.purge", logging.Resource("queue", queueName), attribute.String("rabbitmq.queue", queueName))
+	defer func() { op.end(err) }()
+
 	ch, err := p.channel()
 	if err != nil {
 		return err
@@ -200,6 +299,19 @@ func (p *Provider) PurgeQueue(queueName string) error {
 	return err
 }
 
+// bindingResource names a binding the way reconciliation reports it
+func bindingResource(queue, exchange, routingKey string) slog.Attr {
+	return logging.Resource("binding", fmt.Sprintf("%s -> %s (%s)", exchange, queue, routingKey))
+}
+
+func bindingAttributes(queue, exchange, routingKey string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("rabbitmq.queue", queue),
+		attribute.String("rabbitmq.exchange", exchange),
+		attribute.String("rabbitmq.routing_key", routingKey),
+	}
+}
+
 // isSystemExchange checks if an exchange is a RabbitMQ system exchange
 func isSystemExchange(name string) bool {
 	if name == "" {
@@ -218,7 +330,7 @@ func (p *Provider) makeHTTPRequest(method, path string) (*http.Response, error)
 	}
 
 	fullURL := fmt.Sprintf("%s/api%s", p.httpURI, path)
-	req, err := http.NewRequest(method, fullURL, nil)
+	req, err := http.NewRequestWithContext(p.context(), method, fullURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request to %s: %w", fullURL, err)
 	}
@@ -226,15 +338,38 @@ func (p *Provider) makeHTTPRequest(method, path string) (*http.Response, error)
 	req.SetBasicAuth(p.username, p.password)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	start := time.Now()
+	resp, err := httpClient.Do(req)
 	if err != nil {
+		metrics.ObserveManagementAPI(method, endpointLabel(path), 0, time.Since(start))
+		p.log().WarnContext(p.context(), "management API request failed",
+			"method", method, "endpoint", endpointLabel(path), logging.Err(err))
 		return nil, fmt.Errorf("HTTP request failed to %s: %w", fullURL, err)
 	}
+	metrics.ObserveManagementAPI(method, endpointLabel(path), resp.StatusCode, time.Since(start))
+	p.log().Log(p.context(), logging.LevelTrace, "management API request",
+		"method", method, "endpoint", endpointLabel(path), "status", resp.StatusCode, "duration", time.Since(start))
 
 	return resp, nil
 }
 
+// endpointLabel replaces the vhost and resource names in a management API path with
+// placeholders, e.g. /queues/%2F/orders/bindings becomes /queues/{vhost}/{name}/bindings
+func endpointLabel(path string) string {
+	path, _, _ = strings.Cut(path, "?")
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i := range segments {
+		switch {
+		case i == 0, segments[i] == "bindings":
+		case i == 1:
+			segments[i] = "{vhost}"
+		default:
+			segments[i] = "{name}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
 // ListExchanges returns all exchange names from RabbitMQ (excluding system exchanges)
 func (p *Provider) ListExchanges() ([]string, error) {
 	// List exchanges in default vhost "/" (encoded as %2F)
@@ -312,6 +447,136 @@ func (p *Provider) ListQueues() ([]string, error) {
 	return names, nil
 }
 
+// ListQueueStatuses returns the message and consumer counts of all queues in a single request
+func (p *Provider) ListQueueStatuses() ([]queue.QueueStatus, error) {
+	resp, err := p.makeHTTPRequest("GET", "/queues?columns=name,messages,consumers")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queues: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list queues: HTTP %d", resp.StatusCode)
+	}
+
+	var queues []struct {
+		Name      string `json:"name"`
+		Messages  int    `json:"messages"`
+		Consumers int    `json:"consumers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&queues); err != nil {
+		return nil, fmt.Errorf("failed to decode queues response: %w", err)
+	}
+
+	statuses := make([]queue.QueueStatus, 0, len(queues))
+	for _, q := range queues {
+		statuses = append(statuses, queue.QueueStatus{Name: q.Name, Messages: q.Messages, Consumers: q.Consumers})
+	}
+	return statuses, nil
+}
+
+// ListTopology returns the exchanges, queues, queue bindings and exchange-to-exchange bindings of
+// the default vhost with their properties and the queues' runtime stats, in one management API
+// request per resource kind.
+// System exchanges and bindings from the default exchange are excluded, as in ListExchanges and
+// ListBindings.
+func (p *Provider) ListTopology() (queue.Topology, error) {
+	vhost := "%2F" // default vhost "/" is URL encoded
+	t := queue.Topology{Timestamp: time.Now()}
+
+	var exchanges []struct {
+		Name       string                 `json:"name"`
+		Type       string                 `json:"type"`
+		Durable    bool                   `json:"durable"`
+		AutoDelete bool                   `json:"auto_delete"`
+		Internal   bool                   `json:"internal"`
+		Arguments  map[string]interface{} `json:"arguments"`
+	}
+	if err := p.getJSON("/exchanges/"+vhost, &exchanges); err != nil {
+		return queue.Topology{}, fmt.Errorf("failed to list exchanges: %w", err)
+	}
+	t.Exchanges = make([]queue.ExchangeInfo, 0, len(exchanges))
+	for _, x := range exchanges {
+		if isSystemExchange(x.Name) {
+			continue
+		}
+		t.Exchanges = append(t.Exchanges, queue.ExchangeInfo{
+			Name: x.Name, Type: x.Type, Durable: x.Durable, AutoDelete: x.AutoDelete,
+			Internal: x.Internal, Arguments: x.Arguments,
+		})
+	}
+
+	var queues []struct {
+		Name            string                 `json:"name"`
+		Durable         bool                   `json:"durable"`
+		AutoDelete      bool                   `json:"auto_delete"`
+		Exclusive       bool                   `json:"exclusive"`
+		Arguments       map[string]interface{} `json:"arguments"`
+		State           string                 `json:"state"`
+		Consumers       int                    `json:"consumers"`
+		Messages        int                    `json:"messages"`
+		MessagesReady   int                    `json:"messages_ready"`
+		MessagesUnacked int                    `json:"messages_unacknowledged"`
+	}
+	columns := "name,durable,auto_delete,exclusive,arguments,state,consumers,messages,messages_ready,messages_unacknowledged"
+	if err := p.getJSON("/queues/"+vhost+"?columns="+columns, &queues); err != nil {
+		return queue.Topology{}, fmt.Errorf("failed to list queues: %w", err)
+	}
+	t.Queues = make([]queue.QueueInfo, 0, len(queues))
+	for _, q := range queues {
+		t.Queues = append(t.Queues, queue.QueueInfo{
+			Name: q.Name, Durable: q.Durable, AutoDelete: q.AutoDelete, Exclusive: q.Exclusive,
+			Arguments: q.Arguments, State: q.State, Consumers: q.Consumers, Messages: q.Messages,
+			MessagesReady: q.MessagesReady, MessagesUnacked: q.MessagesUnacked,
+		})
+	}
+
+	var bindings []struct {
+		Source          string                 `json:"source"`
+		Destination     string                 `json:"destination"`
+		DestinationType string                 `json:"destination_type"`
+		RoutingKey      string                 `json:"routing_key"`
+		Arguments       map[string]interface{} `json:"arguments"`
+	}
+	if err := p.getJSON("/bindings/"+vhost, &bindings); err != nil {
+		return queue.Topology{}, fmt.Errorf("failed to list bindings: %w", err)
+	}
+	t.Bindings = make([]queue.BindingInfo, 0, len(bindings))
+	t.ExchangeBindings = []queue.ExchangeBindingInfo{}
+	for _, b := range bindings {
+		switch {
+		case b.Source == "":
+		case b.DestinationType == "queue":
+			t.Bindings = append(t.Bindings, queue.BindingInfo{
+				Exchange: b.Source, Queue: b.Destination, RoutingKey: b.RoutingKey, Arguments: b.Arguments,
+			})
+		case b.DestinationType == "exchange":
+			t.ExchangeBindings = append(t.ExchangeBindings, queue.ExchangeBindingInfo{
+				Source: b.Source, Destination: b.Destination, RoutingKey: b.RoutingKey, Arguments: b.Arguments,
+			})
+		}
+	}
+
+	return t, nil
+}
+
+// getJSON requests path from the management API and decodes the JSON response into v
+func (p *Provider) getJSON(path string, v interface{}) error {
+	resp, err := p.makeHTTPRequest("GET", path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
 // ListBindings returns all bindings for a specific queue
 // Returns bindings as [queue, exchange, routingKey] tuples
 func (p *Provider) ListBindings(queueName string) ([][3]string, error) {
@@ -371,6 +636,71 @@ func (p *Provider) DeleteQueue(name string) error {
 	return nil
 }
 
+// InspectQueue returns the message and consumer counts of a queue from RabbitMQ
+func (p *Provider) InspectQueue(name string) (queue.QueueStatus, error) {
+	vhost := "%2F" // default vhost "/" is URL encoded
+	path := fmt.Sprintf("/queues/%s/%s", vhost, url.PathEscape(name))
+
+	resp, err := p.makeHTTPRequest("GET", path)
+	if err != nil {
+		return queue.QueueStatus{}, fmt.Errorf("failed to inspect queue: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return queue.QueueStatus{}, fmt.Errorf("failed to inspect queue %s: %w", name, queue.ErrNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return queue.QueueStatus{}, fmt.Errorf("failed to inspect queue: HTTP %d", resp.StatusCode)
+	}
+
+	var q struct {
+		Name      string `json:"name"`
+		Messages  int    `json:"messages"`
+		Consumers int    `json:"consumers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&q); err != nil {
+		return queue.QueueStatus{}, fmt.Errorf("failed to decode queue response: %w", err)
+	}
+
+	return queue.QueueStatus{Name: name, Messages: q.Messages, Consumers: q.Consumers}, nil
+}
+
+// DeleteQueueIf deletes a queue from RabbitMQ using the management API's if-empty and
+// if-unused conditions, so the broker refuses the deletion if the queue is still in use
+func (p *Provider) DeleteQueueIf(name string, ifEmpty, ifUnused bool) error {
+	vhost := "%2F" // default vhost "/" is URL encoded
+	path := fmt.Sprintf("/queues/%s/%s", vhost, url.PathEscape(name))
+
+	params := url.Values{}
+	if ifEmpty {
+		params.Set("if-empty", "true")
+	}
+	if ifUnused {
+		params.Set("if-unused", "true")
+	}
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+
+	resp, err := p.makeHTTPRequest("DELETE", path)
+	if err != nil {
+		return fmt.Errorf("failed to delete queue: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		// Not found is treated as success (idempotent)
+		return nil
+	case http.StatusBadRequest, http.StatusConflict, http.StatusPreconditionFailed:
+		// The management API answers with 400 when an if-empty/if-unused condition fails
+		return fmt.Errorf("failed to delete queue %s: HTTP %d: %w", name, resp.StatusCode, queue.ErrDeletePreconditionFailed)
+	default:
+		return fmt.Errorf("failed to delete queue: HTTP %d", resp.StatusCode)
+	}
+}
+
 // DeleteExchange deletes an exchange from RabbitMQ (excluding system exchanges)
 func (p *Provider) DeleteExchange(name string) error {
 	if isSystemExchange(name) {
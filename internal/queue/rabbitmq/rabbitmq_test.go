@@ -1,14 +1,21 @@
 package rabbitmq
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"queue-manager/internal/queue"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestNew(t *testing.T) {
@@ -465,6 +472,199 @@ func TestProvider_DeleteQueue(t *testing.T) {
 	})
 }
 
+func TestProvider_InspectQueue(t *testing.T) {
+	t.Run("successful inspect", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodGet, r.Method)
+			assert.Contains(t, r.URL.Path, "/api/queues")
+			assert.Contains(t, r.URL.Path, "test-queue")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": "test-queue", "messages": 7, "consumers": 2})
+		}))
+		defer server.Close()
+
+		p := New("amqp://localhost:5672/")
+		p.httpURI = server.URL
+
+		status, err := p.InspectQueue("test-queue")
+		require.NoError(t, err)
+		assert.Equal(t, queue.QueueStatus{Name: "test-queue", Messages: 7, Consumers: 2}, status)
+	})
+
+	t.Run("queue not found", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		p := New("amqp://localhost:5672/")
+		p.httpURI = server.URL
+
+		_, err := p.InspectQueue("nonexistent")
+		assert.ErrorIs(t, err, queue.ErrNotFound)
+	})
+}
+
+func TestProvider_ListQueueStatuses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/queues", r.URL.Path)
+		assert.Equal(t, "name,messages,consumers", r.URL.Query().Get("columns"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"name": "q1", "messages": 3, "consumers": 1},
+			{"name": "q2", "messages": 0, "consumers": 0},
+		})
+	}))
+	defer server.Close()
+
+	p := New("amqp://localhost:5672/")
+	p.httpURI = server.URL
+
+	statuses, err := p.ListQueueStatuses()
+	require.NoError(t, err)
+	assert.Equal(t, []queue.QueueStatus{
+		{Name: "q1", Messages: 3, Consumers: 1},
+		{Name: "q2", Messages: 0, Consumers: 0},
+	}, statuses)
+}
+
+func TestProvider_ListTopology(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.EscapedPath() {
+		case "/api/exchanges/%2F":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"name": "", "type": "direct", "durable": true},
+				{"name": "amq.topic", "type": "topic", "durable": true},
+				{"name": "orders", "type": "topic", "durable": true, "arguments": map[string]interface{}{"alternate-exchange": "unrouted"}},
+			})
+		case "/api/queues/%2F":
+			assert.Contains(t, r.URL.Query().Get("columns"), "messages_unacknowledged")
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"name": "q.orders", "durable": true, "state": "running", "consumers": 2,
+					"messages": 5, "messages_ready": 3, "messages_unacknowledged": 2,
+					"arguments": map[string]interface{}{"x-message-ttl": 60000}},
+			})
+		case "/api/bindings/%2F":
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"source": "", "destination": "q.orders", "destination_type": "queue", "routing_key": "q.orders"},
+				{"source": "orders", "destination": "q.orders", "destination_type": "queue", "routing_key": "order.*"},
+				{"source": "orders", "destination": "audit", "destination_type": "exchange", "routing_key": "#"},
+			})
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p := New("amqp://localhost:5672/")
+	p.httpURI = server.URL
+
+	topology, err := p.ListTopology()
+	require.NoError(t, err)
+	assert.False(t, topology.Timestamp.IsZero())
+	assert.Equal(t, []queue.ExchangeInfo{{
+		Name: "orders", Type: "topic", Durable: true,
+		Arguments: map[string]interface{}{"alternate-exchange": "unrouted"},
+	}}, topology.Exchanges)
+	assert.Equal(t, []queue.QueueInfo{{
+		Name: "q.orders", Durable: true, State: "running", Consumers: 2, Messages: 5,
+		MessagesReady: 3, MessagesUnacked: 2, Arguments: map[string]interface{}{"x-message-ttl": float64(60000)},
+	}}, topology.Queues)
+	assert.Equal(t, []queue.BindingInfo{{Exchange: "orders", Queue: "q.orders", RoutingKey: "order.*"}}, topology.Bindings)
+	assert.Equal(t, []queue.ExchangeBindingInfo{{Source: "orders", Destination: "audit", RoutingKey: "#"}}, topology.ExchangeBindings)
+}
+
+func TestProvider_WithContextTracesManagementAPI(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "reconciliation.run")
+	traceID := parent.SpanContext().TraceID().String()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The trace is propagated to the broker
+		assert.Contains(t, r.Header.Get("traceparent"), traceID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]map[string]interface{}{})
+	}))
+	defer server.Close()
+
+	p := New("amqp://localhost:5672/")
+	p.httpURI = server.URL
+
+	_, err := p.WithContext(ctx).ListBindings("orders")
+	require.NoError(t, err)
+	parent.End()
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+		assert.Equal(t, traceID, span.SpanContext().TraceID().String())
+	}
+	assert.Contains(t, names, "rabbitmq GET /queues/{vhost}/{name}/bindings")
+}
+
+func TestEndpointLabel(t *testing.T) {
+	tests := map[string]string{
+		"/queues":                          "/queues",
+		"/queues?columns=name":             "/queues",
+		"/exchanges/%2F":                   "/exchanges/{vhost}",
+		"/queues/%2F/orders":               "/queues/{vhost}/{name}",
+		"/queues/%2F/orders/bindings":      "/queues/{vhost}/{name}/bindings",
+		"/queues/%2F/orders?if-empty=true": "/queues/{vhost}/{name}",
+	}
+	for path, expected := range tests {
+		assert.Equal(t, expected, endpointLabel(path), path)
+	}
+}
+
+func TestProvider_DeleteQueueIf(t *testing.T) {
+	t.Run("sends if-empty and if-unused conditions", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodDelete, r.Method)
+			assert.Contains(t, r.URL.Path, "test-queue")
+			assert.Equal(t, "true", r.URL.Query().Get("if-empty"))
+			assert.Equal(t, "true", r.URL.Query().Get("if-unused"))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		p := New("amqp://localhost:5672/")
+		p.httpURI = server.URL
+
+		assert.NoError(t, p.DeleteQueueIf("test-queue", true, true))
+	})
+
+	t.Run("precondition failed", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		p := New("amqp://localhost:5672/")
+		p.httpURI = server.URL
+
+		err := p.DeleteQueueIf("busy-queue", true, true)
+		assert.ErrorIs(t, err, queue.ErrDeletePreconditionFailed)
+	})
+
+	t.Run("queue not found (idempotent)", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		p := New("amqp://localhost:5672/")
+		p.httpURI = server.URL
+
+		assert.NoError(t, p.DeleteQueueIf("nonexistent", true, true))
+	})
+}
+
 func TestProvider_DeleteExchange(t *testing.T) {
 	t.Run("successful delete", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
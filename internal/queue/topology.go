@@ -0,0 +1,222 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ExchangeInfo describes a live exchange and its properties
+type ExchangeInfo struct {
+	Name       string
+	Type       string // empty when the provider does not report it
+	Durable    bool
+	AutoDelete bool
+	Internal   bool
+	Arguments  map[string]interface{}
+}
+
+// QueueInfo describes a live queue, its properties and its runtime stats
+type QueueInfo struct {
+	Name       string
+	Durable    bool
+	AutoDelete bool
+	Exclusive  bool
+	Arguments  map[string]interface{}
+	// State is the broker's state of the queue (e.g. running, idle, flow, down); empty when unknown
+	State           string
+	Consumers       int
+	Messages        int
+	MessagesReady   int
+	MessagesUnacked int
+}
+
+// BindingInfo describes a live binding of a queue to an exchange
+type BindingInfo struct {
+	Exchange   string
+	Queue      string
+	RoutingKey string
+	Arguments  map[string]interface{}
+}
+
+// ExchangeBindingInfo describes a live binding of an exchange to another exchange: messages routed
+// by Source with a matching key are routed again by Destination
+type ExchangeBindingInfo struct {
+	Source      string
+	Destination string
+	RoutingKey  string
+	Arguments   map[string]interface{}
+}
+
+// Topology is a snapshot of the live exchanges, queues and bindings, sorted by name
+type Topology struct {
+	Exchanges []ExchangeInfo
+	Queues    []QueueInfo
+	Bindings  []BindingInfo
+	// ExchangeBindings are only reported by providers implementing TopologyLister
+	ExchangeBindings []ExchangeBindingInfo
+	// Timestamp is when the snapshot was taken
+	Timestamp time.Time
+	// Detailed is set when the provider reported resource properties (see TopologyLister);
+	// otherwise only names, exchange types if known, and queue stats are filled in
+	Detailed bool
+}
+
+// TopologyLister is implemented by providers that can report the live topology with resource
+// properties and runtime stats in a few calls
+type TopologyLister interface {
+	ListTopology() (Topology, error)
+}
+
+// ReadTopology returns a snapshot of the live topology. Providers that do not implement
+// TopologyLister are queried through the basic List methods, one call per queue for the
+// bindings, and report names and stats only.
+func ReadTopology(p Provider) (Topology, error) {
+	if l, ok := p.(TopologyLister); ok {
+		t, err := l.ListTopology()
+		if err != nil {
+			return Topology{}, err
+		}
+		t.Detailed = true
+		t.sort()
+		return t, nil
+	}
+
+	t := Topology{Exchanges: []ExchangeInfo{}, Queues: []QueueInfo{}, Bindings: []BindingInfo{}, Timestamp: time.Now()}
+	exchanges, err := p.ListExchanges()
+	if err != nil {
+		return Topology{}, err
+	}
+	for _, name := range exchanges {
+		t.Exchanges = append(t.Exchanges, ExchangeInfo{Name: name})
+	}
+
+	queues, err := p.ListQueues()
+	if err != nil {
+		return Topology{}, err
+	}
+	stats := map[string]QueueStatus{}
+	if l, ok := p.(QueueStatsLister); ok {
+		statuses, err := l.ListQueueStatuses()
+		if err != nil {
+			return Topology{}, err
+		}
+		for _, s := range statuses {
+			stats[s.Name] = s
+		}
+	}
+	for _, name := range queues {
+		s, ok := stats[name]
+		if !ok {
+			if s, err = p.InspectQueue(name); err != nil && !errors.Is(err, ErrNotFound) {
+				return Topology{}, err
+			}
+		}
+		t.Queues = append(t.Queues, QueueInfo{Name: name, Consumers: s.Consumers, Messages: s.Messages})
+
+		bindings, err := p.ListBindings(name)
+		if err != nil {
+			return Topology{}, err
+		}
+		for _, b := range bindings {
+			t.Bindings = append(t.Bindings, BindingInfo{Queue: b[0], Exchange: b[1], RoutingKey: b[2]})
+		}
+	}
+	t.sort()
+	return t, nil
+}
+
+func (t *Topology) sort() {
+	sort.Slice(t.Exchanges, func(i, j int) bool { return t.Exchanges[i].Name < t.Exchanges[j].Name })
+	sort.Slice(t.Queues, func(i, j int) bool { return t.Queues[i].Name < t.Queues[j].Name })
+	sort.Slice(t.Bindings, func(i, j int) bool {
+		a, b := t.Bindings[i], t.Bindings[j]
+		if a.Exchange != b.Exchange {
+			return a.Exchange < b.Exchange
+		}
+		if a.Queue != b.Queue {
+			return a.Queue < b.Queue
+		}
+		return a.RoutingKey < b.RoutingKey
+	})
+	sort.Slice(t.ExchangeBindings, func(i, j int) bool {
+		a, b := t.ExchangeBindings[i], t.ExchangeBindings[j]
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		if a.Destination != b.Destination {
+			return a.Destination < b.Destination
+		}
+		return a.RoutingKey < b.RoutingKey
+	})
+}
+
+// Filter returns the part of the topology related to the given queue and exchange; empty
+// filters match everything and both filters combine with AND. Like the expected topology
+// filters, filtering by queue keeps the exchanges bound to it and filtering by exchange keeps
+// the queues bound to it.
+func (t Topology) Filter(queue, exchange string) Topology {
+	if queue == "" && exchange == "" {
+		return t
+	}
+
+	out := Topology{Exchanges: []ExchangeInfo{}, Queues: []QueueInfo{}, Bindings: []BindingInfo{},
+		Timestamp: t.Timestamp, Detailed: t.Detailed}
+	boundQueues, boundExchanges := map[string]bool{}, map[string]bool{}
+	for _, b := range t.Bindings {
+		if (queue == "" || b.Queue == queue) && (exchange == "" || b.Exchange == exchange) {
+			out.Bindings = append(out.Bindings, b)
+			boundQueues[b.Queue] = true
+			boundExchanges[b.Exchange] = true
+		}
+	}
+	for _, q := range t.Queues {
+		if (queue == "" || q.Name == queue) && (exchange == "" || boundQueues[q.Name]) {
+			out.Queues = append(out.Queues, q)
+		}
+	}
+	for _, x := range t.Exchanges {
+		if (exchange == "" || x.Name == exchange) && (queue == "" || boundExchanges[x.Name]) {
+			out.Exchanges = append(out.Exchanges, x)
+		}
+	}
+	return out
+}
+
+// TopologyCache keeps the last snapshot of the live topology for a short time, so frequent
+// readers such as polling dashboards share one set of provider calls. Concurrent readers of an
+// expired snapshot wait for a single refresh. Failed reads are not cached.
+type TopologyCache struct {
+	provider Provider
+	ttl      time.Duration
+
+	mu       sync.Mutex
+	snapshot *Topology
+}
+
+// NewTopologyCache caches snapshots of p for ttl; a zero ttl reads the provider every time
+func NewTopologyCache(p Provider, ttl time.Duration) *TopologyCache {
+	return &TopologyCache{provider: p, ttl: ttl}
+}
+
+// Get returns a snapshot that is at most ttl old, reading the provider under ctx if needed.
+// The snapshot is shared with other readers and must not be modified.
+func (c *TopologyCache) Get(ctx context.Context) (Topology, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.snapshot != nil && time.Since(c.snapshot.Timestamp) < c.ttl {
+		return *c.snapshot, nil
+	}
+
+	t, err := ReadTopology(WithContext(ctx, c.provider))
+	if err != nil {
+		return Topology{}, err
+	}
+	if t.Timestamp.IsZero() {
+		t.Timestamp = time.Now()
+	}
+	c.snapshot = &t
+	return t, nil
+}
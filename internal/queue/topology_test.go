@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listOnlyProvider implements the basic List methods only; other calls panic
+type listOnlyProvider struct {
+	Provider
+	calls int
+	err   error
+}
+
+func (p *listOnlyProvider) ListExchanges() ([]string, error) {
+	p.calls++
+	return []string{"orders", "audit"}, p.err
+}
+
+func (p *listOnlyProvider) ListQueues() ([]string, error) {
+	return []string{"q.orders", "q.audit"}, nil
+}
+
+func (p *listOnlyProvider) InspectQueue(name string) (QueueStatus, error) {
+	if name == "q.audit" {
+		return QueueStatus{}, ErrNotFound // deleted in the meantime
+	}
+	return QueueStatus{Name: name, Messages: 4, Consumers: 1}, nil
+}
+
+func (p *listOnlyProvider) ListBindings(queue string) ([][3]string, error) {
+	if queue == "q.orders" {
+		return [][3]string{{queue, "orders", "order.*"}}, nil
+	}
+	return [][3]string{{queue, "audit", "#"}, {queue, "orders", "#"}}, nil
+}
+
+func TestReadTopology_Fallback(t *testing.T) {
+	topology, err := ReadTopology(&listOnlyProvider{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []ExchangeInfo{{Name: "audit"}, {Name: "orders"}}, topology.Exchanges)
+	assert.Equal(t, []QueueInfo{{Name: "q.audit"}, {Name: "q.orders", Messages: 4, Consumers: 1}}, topology.Queues)
+	assert.Equal(t, []BindingInfo{
+		{Exchange: "audit", Queue: "q.audit", RoutingKey: "#"},
+		{Exchange: "orders", Queue: "q.audit", RoutingKey: "#"},
+		{Exchange: "orders", Queue: "q.orders", RoutingKey: "order.*"},
+	}, topology.Bindings)
+}
+
+func TestTopology_Filter(t *testing.T) {
+	topology, err := ReadTopology(&listOnlyProvider{})
+	require.NoError(t, err)
+
+	byQueue := topology.Filter("q.orders", "")
+	assert.Equal(t, []ExchangeInfo{{Name: "orders"}}, byQueue.Exchanges)
+	assert.Len(t, byQueue.Queues, 1)
+	assert.Len(t, byQueue.Bindings, 1)
+
+	byExchange := topology.Filter("", "orders")
+	assert.Equal(t, []ExchangeInfo{{Name: "orders"}}, byExchange.Exchanges)
+	assert.Len(t, byExchange.Queues, 2)
+	assert.Len(t, byExchange.Bindings, 2)
+
+	both := topology.Filter("q.audit", "audit")
+	assert.Equal(t, []BindingInfo{{Exchange: "audit", Queue: "q.audit", RoutingKey: "#"}}, both.Bindings)
+
+	none := topology.Filter("missing", "")
+	assert.Empty(t, none.Exchanges)
+	assert.Empty(t, none.Queues)
+	assert.Empty(t, none.Bindings)
+}
+
+func TestTopologyCache(t *testing.T) {
+	p := &listOnlyProvider{}
+	cache := NewTopologyCache(p, time.Hour)
+
+	first, err := cache.Get(context.Background())
+	require.NoError(t, err)
+	second, err := cache.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.calls, "the second read is served from the cache")
+	assert.Equal(t, first.Timestamp, second.Timestamp)
+
+	// Without a TTL every read goes to the provider, and errors are returned
+	p.err = errors.New("connection refused")
+	_, err = NewTopologyCache(p, 0).Get(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, 2, p.calls)
+}
@@ -0,0 +1,130 @@
+package readiness
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"queue-manager/internal/models"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/reconciliation"
+)
+
+// Dependency states
+const (
+	Connected    = "connected"
+	Disconnected = "disconnected"
+	Disabled     = "disabled" // not configured, so not required
+)
+
+// Initial reconciliation states
+const (
+	Pending   = "pending"
+	Completed = "completed"
+	Failed    = "failed"
+	Skipped   = "skipped" // this instance does not declare the topology
+)
+
+// RetryAfter is how long orchestrators are asked to wait before probing again
+const RetryAfter = 15 * time.Second
+
+// pingTimeout bounds the database check so a hanging connection cannot stall the probe
+const pingTimeout = 2 * time.Second
+
+// Pinger checks the database connection; *sql.DB implements it
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Status is the outcome of a readiness check
+type Status struct {
+	Database              string `json:"database"`
+	Provider              string `json:"provider"`
+	InitialReconciliation string `json:"initialReconciliation"`
+}
+
+// Ready reports whether all required dependencies are connected and the topology was declared
+func (s Status) Ready() bool {
+	return s.Database != Disconnected && s.Provider != Disconnected &&
+		(s.InitialReconciliation == Completed || s.InitialReconciliation == Skipped)
+}
+
+// Tracker tracks whether the service is ready to serve traffic: the database answers a ping,
+// the provider reports healthy and the topology was declared once since startup. It implements
+// reconciliation.Observer to learn the outcome of the declaration.
+type Tracker struct {
+	db       Pinger
+	provider queue.Provider
+
+	mu      sync.Mutex
+	initial string
+}
+
+// NewTracker creates a tracker for the given dependencies; nil means not configured. The initial
+// reconciliation is pending until a run reports its outcome or Skip is called.
+func NewTracker(db Pinger, provider queue.Provider) *Tracker {
+	return &Tracker{db: db, provider: provider, initial: Pending}
+}
+
+// Skip marks the initial reconciliation as not required on this instance, e.g. on followers
+// or when the database is not configured. Later runs do not change it.
+func (t *Tracker) Skip() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.initial != Completed {
+		t.initial = Skipped
+	}
+}
+
+// Check returns the current status. A nil tracker tracks nothing and is always ready.
+func (t *Tracker) Check(ctx context.Context) Status {
+	if t == nil {
+		return Status{Database: Disabled, Provider: Disabled, InitialReconciliation: Skipped}
+	}
+
+	s := Status{Database: Disabled, Provider: Disabled}
+	if t.db != nil {
+		ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+		defer cancel()
+		s.Database = Connected
+		if err := t.db.PingContext(ctx); err != nil {
+			s.Database = Disconnected
+		}
+	}
+	if t.provider != nil {
+		s.Provider = Connected
+		if !t.provider.Health().OK {
+			s.Provider = Disconnected
+		}
+	}
+
+	t.mu.Lock()
+	s.InitialReconciliation = t.initial
+	t.mu.Unlock()
+	return s
+}
+
+// RunFinished records the outcome of the startup declaration. If it was skipped because the
+// provider was down, or failed, the next scheduled reconciliation that succeeds completes it.
+// Targeted and manual runs may cover only part of the topology, so they are not considered.
+func (t *Tracker) RunFinished(_ context.Context, run models.ReconciliationRun, _ []models.ReconciliationAction) {
+	if run.DryRun || (run.Trigger != reconciliation.TriggerStartup && run.Trigger != reconciliation.TriggerCron) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.initial == Completed || t.initial == Skipped {
+		return
+	}
+	switch run.Status {
+	case reconciliation.RunSucceeded, reconciliation.RunAborted:
+		// Aborted runs declared everything and only held back deletions
+		t.initial = Completed
+	default:
+		t.initial = Failed
+	}
+}
+
+// DriftObserved is part of reconciliation.Observer; drift does not affect readiness
+func (t *Tracker) DriftObserved(context.Context, reconciliation.DriftReport) {}
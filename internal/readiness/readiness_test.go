@@ -0,0 +1,77 @@
+package readiness
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"queue-manager/internal/models"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/reconciliation"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakePinger struct{ err error }
+
+func (p fakePinger) PingContext(context.Context) error { return p.err }
+
+// fakeProvider reports a fixed health; the embedded interface panics on any other call
+type fakeProvider struct {
+	queue.Provider
+	ok bool
+}
+
+func (p fakeProvider) Health() queue.HealthStatus { return queue.HealthStatus{OK: p.ok} }
+
+func finished(t *Tracker, trigger, status string) {
+	t.RunFinished(context.Background(), models.ReconciliationRun{Trigger: trigger, Status: status}, nil)
+}
+
+func TestTracker_Check(t *testing.T) {
+	ctx := context.Background()
+	tracker := NewTracker(fakePinger{}, fakeProvider{ok: true})
+	status := tracker.Check(ctx)
+	assert.Equal(t, Status{Database: Connected, Provider: Connected, InitialReconciliation: Pending}, status)
+	assert.False(t, status.Ready())
+
+	finished(tracker, reconciliation.TriggerStartup, reconciliation.RunSucceeded)
+	assert.True(t, tracker.Check(ctx).Ready())
+
+	tracker = NewTracker(fakePinger{err: errors.New("connection refused")}, fakeProvider{ok: false})
+	tracker.Skip()
+	status = tracker.Check(ctx)
+	assert.Equal(t, Status{Database: Disconnected, Provider: Disconnected, InitialReconciliation: Skipped}, status)
+	assert.False(t, status.Ready())
+}
+
+func TestTracker_NotConfigured(t *testing.T) {
+	var tracker *Tracker
+	assert.True(t, tracker.Check(context.Background()).Ready())
+
+	tracker = NewTracker(nil, nil)
+	tracker.Skip()
+	assert.Equal(t, Status{Database: Disabled, Provider: Disabled, InitialReconciliation: Skipped}, tracker.Check(context.Background()))
+	assert.True(t, tracker.Check(context.Background()).Ready())
+}
+
+func TestTracker_InitialReconciliation(t *testing.T) {
+	tracker := NewTracker(nil, nil)
+	initial := func() string { return tracker.Check(context.Background()).InitialReconciliation }
+
+	finished(tracker, reconciliation.TriggerStartup, reconciliation.RunPartial)
+	assert.Equal(t, Failed, initial())
+
+	// Targeted and manual runs may cover only part of the topology
+	finished(tracker, reconciliation.TriggerEvent, reconciliation.RunSucceeded)
+	finished(tracker, reconciliation.TriggerSync, reconciliation.RunSucceeded)
+	tracker.RunFinished(context.Background(), models.ReconciliationRun{Trigger: reconciliation.TriggerCron, Status: reconciliation.RunSucceeded, DryRun: true}, nil)
+	assert.Equal(t, Failed, initial())
+
+	finished(tracker, reconciliation.TriggerCron, reconciliation.RunAborted)
+	assert.Equal(t, Completed, initial())
+
+	// Once completed, later failures do not make the instance unready
+	finished(tracker, reconciliation.TriggerCron, reconciliation.RunFailed)
+	assert.Equal(t, Completed, initial())
+}
@@ -0,0 +1,431 @@
+package reconciliation
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"queue-manager/internal/bootstrap"
+	"queue-manager/internal/models"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/repository"
+)
+
+// ExpectedTopology is the expected side of a comparison, as stored in the database
+type ExpectedTopology struct {
+	Exchanges []models.Exchange
+	Queues    []models.Queue
+	Bindings  []models.Binding
+}
+
+// expectedFromBootstrap converts the names-only topology used for declaration. Exchanges and
+// queues are declared durable, so that is what they are expected to be.
+func expectedFromBootstrap(top bootstrap.Topology) ExpectedTopology {
+	expected := ExpectedTopology{}
+	for name, kind := range top.Exchanges {
+		expected.Exchanges = append(expected.Exchanges, models.Exchange{ExchangeName: name, ExchangeType: kind, Durable: true})
+	}
+	for _, name := range top.Queues {
+		expected.Queues = append(expected.Queues, models.Queue{QueueName: name, Durable: true})
+	}
+	for _, b := range top.Bindings {
+		expected.Bindings = append(expected.Bindings, models.Binding{QueueName: b[0], ExchangeName: b[1], RoutingKey: b[2]})
+	}
+	return expected
+}
+
+// actualTopology converts the state a plan is computed from. Queues whose bindings could not be
+// listed have none, so their expected bindings are reported missing and declared again.
+func actualTopology(actual *actualState) queue.Topology {
+	t := queue.Topology{}
+	for _, name := range actual.exchanges {
+		t.Exchanges = append(t.Exchanges, queue.ExchangeInfo{Name: name})
+	}
+	for _, name := range actual.queues {
+		t.Queues = append(t.Queues, queue.QueueInfo{Name: name})
+	}
+	for queueName, queueBindings := range actual.bindings {
+		for exchangeName, keys := range queueBindings {
+			for routingKey := range keys {
+				t.Bindings = append(t.Bindings, queue.BindingInfo{Queue: queueName, Exchange: exchangeName, RoutingKey: routingKey})
+			}
+		}
+	}
+	return t
+}
+
+// BindingRef identifies a binding
+type BindingRef struct {
+	Exchange   string `json:"exchange"`
+	Queue      string `json:"queue"`
+	RoutingKey string `json:"routing_key"`
+}
+
+func (b BindingRef) String() string {
+	return bindingName(b.Exchange, b.Queue, b.RoutingKey)
+}
+
+// ResourceSet lists resources by kind, sorted by name
+type ResourceSet struct {
+	Exchanges []string     `json:"exchanges"`
+	Queues    []string     `json:"queues"`
+	Bindings  []BindingRef `json:"bindings"`
+}
+
+func newResourceSet() ResourceSet {
+	return ResourceSet{Exchanges: []string{}, Queues: []string{}, Bindings: []BindingRef{}}
+}
+
+// Len returns the number of resources in the set
+func (s ResourceSet) Len() int {
+	return len(s.Exchanges) + len(s.Queues) + len(s.Bindings)
+}
+
+// FieldDiff is a property whose expected and actual values differ
+type FieldDiff struct {
+	Field    string      `json:"field"`
+	Expected interface{} `json:"expected"`
+	Actual   interface{} `json:"actual"`
+}
+
+// Mismatch is a resource that exists on the provider with other properties than expected. For
+// bindings, a live binding between the same exchange and queue with another routing key is
+// paired with the expected one; Expected and Actual identify both.
+type Mismatch struct {
+	Kind     string      `json:"kind"`
+	Name     string      `json:"name"`
+	Expected *BindingRef `json:"expected,omitempty"`
+	Actual   *BindingRef `json:"actual,omitempty"`
+	Fields   []FieldDiff `json:"fields"`
+}
+
+// Mismatches lists mismatched resources by kind
+type Mismatches struct {
+	Exchanges []Mismatch `json:"exchanges"`
+	Queues    []Mismatch `json:"queues"`
+	Bindings  []Mismatch `json:"bindings"`
+}
+
+// Len returns the number of mismatched resources
+func (m Mismatches) Len() int {
+	return len(m.Exchanges) + len(m.Queues) + len(m.Bindings)
+}
+
+// Diff groups the resources of the expected and the actual topology by how they compare:
+// missing on the provider, unexpected on the provider, present with other properties, or healthy.
+type Diff struct {
+	Missing    ResourceSet `json:"missing"`
+	Unexpected ResourceSet `json:"unexpected"`
+	Mismatched Mismatches  `json:"mismatched"`
+	Healthy    ResourceSet `json:"healthy"`
+}
+
+// Summary returns the number of resources per group
+func (d *Diff) Summary() map[string]int {
+	return map[string]int{
+		"missing":    d.Missing.Len(),
+		"unexpected": d.Unexpected.Len(),
+		"mismatched": d.Mismatched.Len(),
+		"healthy":    d.Healthy.Len(),
+	}
+}
+
+// InSync reports whether nothing is missing, unexpected or mismatched
+func (d *Diff) InSync() bool {
+	return d.Missing.Len() == 0 && d.Unexpected.Len() == 0 && d.Mismatched.Len() == 0
+}
+
+// Compare diffs the expected topology against the actual one without changing anything.
+// Properties (flags, arguments) are only compared when the actual topology is detailed; an
+// exchange type is compared whenever the provider reported it.
+func Compare(expected ExpectedTopology, actual queue.Topology) *Diff {
+	d := &Diff{
+		Missing:    newResourceSet(),
+		Unexpected: newResourceSet(),
+		Mismatched: Mismatches{Exchanges: []Mismatch{}, Queues: []Mismatch{}, Bindings: []Mismatch{}},
+		Healthy:    newResourceSet(),
+	}
+
+	// Exchanges
+	actualExchanges := map[string]queue.ExchangeInfo{}
+	for _, x := range actual.Exchanges {
+		actualExchanges[x.Name] = x
+	}
+	expectedExchanges := map[string]bool{}
+	for _, e := range expected.Exchanges {
+		expectedExchanges[e.ExchangeName] = true
+		x, ok := actualExchanges[e.ExchangeName]
+		if !ok {
+			d.Missing.Exchanges = append(d.Missing.Exchanges, e.ExchangeName)
+			continue
+		}
+		fields := []FieldDiff{}
+		if x.Type != "" && e.ExchangeType != "" && x.Type != e.ExchangeType {
+			fields = append(fields, FieldDiff{Field: "type", Expected: e.ExchangeType, Actual: x.Type})
+		}
+		if actual.Detailed {
+			fields = appendFlag(fields, "durable", e.Durable, x.Durable)
+			fields = appendFlag(fields, "auto_delete", e.AutoDelete, x.AutoDelete)
+			fields = appendFlag(fields, "internal", e.Internal, x.Internal)
+			fields = append(fields, diffArguments(e.Arguments, x.Arguments)...)
+		}
+		if len(fields) > 0 {
+			d.Mismatched.Exchanges = append(d.Mismatched.Exchanges, Mismatch{Kind: "exchange", Name: e.ExchangeName, Fields: fields})
+		} else {
+			d.Healthy.Exchanges = append(d.Healthy.Exchanges, e.ExchangeName)
+		}
+	}
+	for _, x := range actual.Exchanges {
+		if !expectedExchanges[x.Name] {
+			d.Unexpected.Exchanges = append(d.Unexpected.Exchanges, x.Name)
+		}
+	}
+
+	// Queues
+	actualQueues := map[string]queue.QueueInfo{}
+	for _, q := range actual.Queues {
+		actualQueues[q.Name] = q
+	}
+	expectedQueues := map[string]bool{}
+	for _, e := range expected.Queues {
+		expectedQueues[e.QueueName] = true
+		q, ok := actualQueues[e.QueueName]
+		if !ok {
+			d.Missing.Queues = append(d.Missing.Queues, e.QueueName)
+			continue
+		}
+		fields := []FieldDiff{}
+		if actual.Detailed {
+			fields = appendFlag(fields, "durable", e.Durable, q.Durable)
+			fields = appendFlag(fields, "auto_delete", e.AutoDelete, q.AutoDelete)
+			fields = append(fields, diffArguments(e.Arguments, q.Arguments)...)
+		}
+		if len(fields) > 0 {
+			d.Mismatched.Queues = append(d.Mismatched.Queues, Mismatch{Kind: "queue", Name: e.QueueName, Fields: fields})
+		} else {
+			d.Healthy.Queues = append(d.Healthy.Queues, e.QueueName)
+		}
+	}
+	for _, q := range actual.Queues {
+		if !expectedQueues[q.Name] {
+			d.Unexpected.Queues = append(d.Unexpected.Queues, q.Name)
+		}
+	}
+
+	compareBindings(d, expected.Bindings, actual)
+
+	sort.Strings(d.Missing.Exchanges)
+	sort.Strings(d.Missing.Queues)
+	sort.Strings(d.Unexpected.Exchanges)
+	sort.Strings(d.Unexpected.Queues)
+	sort.Strings(d.Healthy.Exchanges)
+	sort.Strings(d.Healthy.Queues)
+	for _, list := range [][]Mismatch{d.Mismatched.Exchanges, d.Mismatched.Queues, d.Mismatched.Bindings} {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	}
+	for _, list := range [][]BindingRef{d.Missing.Bindings, d.Unexpected.Bindings, d.Healthy.Bindings} {
+		sortBindings(list)
+	}
+	return d
+}
+
+// compareBindings matches bindings per exchange and queue pair. Bindings with the same routing
+// key are compared by arguments; the remaining expected and live bindings of a pair are paired
+// up in routing key order as mismatched, and whatever is left is missing or unexpected.
+func compareBindings(d *Diff, expected []models.Binding, actual queue.Topology) {
+	type pair struct{ exchange, queue string }
+	expectedByPair := map[pair]map[string]models.Binding{}
+	actualByPair := map[pair]map[string]queue.BindingInfo{}
+	pairs := []pair{}
+	for _, b := range expected {
+		p := pair{b.ExchangeName, b.QueueName}
+		if expectedByPair[p] == nil {
+			expectedByPair[p] = map[string]models.Binding{}
+			if actualByPair[p] == nil {
+				pairs = append(pairs, p)
+			}
+		}
+		expectedByPair[p][b.RoutingKey] = b
+	}
+	for _, b := range actual.Bindings {
+		p := pair{b.Exchange, b.Queue}
+		if actualByPair[p] == nil {
+			actualByPair[p] = map[string]queue.BindingInfo{}
+			if expectedByPair[p] == nil {
+				pairs = append(pairs, p)
+			}
+		}
+		actualByPair[p][b.RoutingKey] = b
+	}
+
+	for _, p := range pairs {
+		var missing, unexpected []string
+		for key, e := range expectedByPair[p] {
+			a, ok := actualByPair[p][key]
+			if !ok {
+				missing = append(missing, key)
+				continue
+			}
+			ref := BindingRef{Exchange: p.exchange, Queue: p.queue, RoutingKey: key}
+			var fields []FieldDiff
+			if actual.Detailed {
+				fields = diffArguments(e.Arguments, a.Arguments)
+			}
+			if len(fields) > 0 {
+				d.Mismatched.Bindings = append(d.Mismatched.Bindings, Mismatch{
+					Kind: "binding", Name: ref.String(), Expected: &ref, Actual: &ref, Fields: fields,
+				})
+			} else {
+				d.Healthy.Bindings = append(d.Healthy.Bindings, ref)
+			}
+		}
+		for key := range actualByPair[p] {
+			if _, ok := expectedByPair[p][key]; !ok {
+				unexpected = append(unexpected, key)
+			}
+		}
+		sort.Strings(missing)
+		sort.Strings(unexpected)
+
+		for len(missing) > 0 && len(unexpected) > 0 {
+			expectedRef := BindingRef{Exchange: p.exchange, Queue: p.queue, RoutingKey: missing[0]}
+			actualRef := BindingRef{Exchange: p.exchange, Queue: p.queue, RoutingKey: unexpected[0]}
+			d.Mismatched.Bindings = append(d.Mismatched.Bindings, Mismatch{
+				Kind: "binding", Name: expectedRef.String(), Expected: &expectedRef, Actual: &actualRef,
+				Fields: []FieldDiff{{Field: "routing_key", Expected: missing[0], Actual: unexpected[0]}},
+			})
+			missing, unexpected = missing[1:], unexpected[1:]
+		}
+		for _, key := range missing {
+			d.Missing.Bindings = append(d.Missing.Bindings, BindingRef{Exchange: p.exchange, Queue: p.queue, RoutingKey: key})
+		}
+		for _, key := range unexpected {
+			d.Unexpected.Bindings = append(d.Unexpected.Bindings, BindingRef{Exchange: p.exchange, Queue: p.queue, RoutingKey: key})
+		}
+	}
+}
+
+func appendFlag(fields []FieldDiff, name string, expected, actual bool) []FieldDiff {
+	if expected != actual {
+		fields = append(fields, FieldDiff{Field: name, Expected: expected, Actual: actual})
+	}
+	return fields
+}
+
+// diffArguments compares arguments key by key. Values are compared in their JSON form, so
+// numbers compare equal regardless of the Go type they were decoded into.
+func diffArguments(expected, actual map[string]interface{}) []FieldDiff {
+	fields := []FieldDiff{}
+	keys := map[string]bool{}
+	for k := range expected {
+		keys[k] = true
+	}
+	for k := range actual {
+		keys[k] = true
+	}
+	for _, k := range sortedKeys(keys) {
+		e, a := normalizeJSON(expected[k]), normalizeJSON(actual[k])
+		if !reflect.DeepEqual(e, a) {
+			fields = append(fields, FieldDiff{Field: "arguments." + k, Expected: e, Actual: a})
+		}
+	}
+	return fields
+}
+
+func normalizeJSON(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return fmt.Sprint(v)
+	}
+	return out
+}
+
+func sortBindings(list []BindingRef) {
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Exchange != b.Exchange {
+			return a.Exchange < b.Exchange
+		}
+		if a.Queue != b.Queue {
+			return a.Queue < b.Queue
+		}
+		return a.RoutingKey < b.RoutingKey
+	})
+}
+
+// ScopeActual returns the part of the actual topology to compare with an expected topology that
+// was loaded with filter. It keeps the live counterparts of the expected resources, and the live
+// resources the filter selects by the same relations as the repository: bindings of the queue
+// and exchange filtered by, and the queues and exchanges they connect. Live resources cannot be
+// attributed to a service, so a service filter only keeps the resources of the service's queues.
+func ScopeActual(actual queue.Topology, expected ExpectedTopology, filter repository.TopologyFilter) queue.Topology {
+	if filter == (repository.TopologyFilter{}) {
+		return actual
+	}
+
+	queues, exchanges, bindings := map[string]bool{}, map[string]bool{}, map[BindingRef]bool{}
+	for _, q := range expected.Queues {
+		queues[q.QueueName] = true
+	}
+	for _, x := range expected.Exchanges {
+		exchanges[x.ExchangeName] = true
+	}
+	for _, b := range expected.Bindings {
+		bindings[BindingRef{Exchange: b.ExchangeName, Queue: b.QueueName, RoutingKey: b.RoutingKey}] = true
+	}
+
+	out := queue.Topology{
+		Exchanges: []queue.ExchangeInfo{}, Queues: []queue.QueueInfo{}, Bindings: []queue.BindingInfo{},
+		Timestamp: actual.Timestamp, Detailed: actual.Detailed,
+	}
+	boundQueues, boundExchanges := map[string]bool{}, map[string]bool{}
+	for _, b := range actual.Bindings {
+		selected := (filter.Queue == "" || b.Queue == filter.Queue) &&
+			(filter.Exchange == "" || b.Exchange == filter.Exchange) &&
+			(filter.Service == "" || queues[b.Queue])
+		if selected || bindings[BindingRef{Exchange: b.Exchange, Queue: b.Queue, RoutingKey: b.RoutingKey}] {
+			out.Bindings = append(out.Bindings, b)
+			boundQueues[b.Queue] = true
+			boundExchanges[b.Exchange] = true
+		}
+	}
+	for _, q := range actual.Queues {
+		selected := filter.Service == "" && (filter.Queue == "" || q.Name == filter.Queue) &&
+			(filter.Exchange == "" || boundQueues[q.Name])
+		if selected || queues[q.Name] {
+			out.Queues = append(out.Queues, q)
+		}
+	}
+	for _, x := range actual.Exchanges {
+		selected := (filter.Exchange == "" || x.Name == filter.Exchange) &&
+			((filter.Queue == "" && filter.Service == "") || boundExchanges[x.Name])
+		if selected || exchanges[x.Name] {
+			out.Exchanges = append(out.Exchanges, x)
+		}
+	}
+	return out
+}
+
+// LoadExpected loads the expected topology matching filter from the database
+func LoadExpected(repo *repository.Repository, filter repository.TopologyFilter) (ExpectedTopology, error) {
+	var expected ExpectedTopology
+	var err error
+	if expected.Exchanges, _, err = repo.FindExchanges(filter, repository.Page{}); err != nil {
+		return ExpectedTopology{}, fmt.Errorf("failed to load expected exchanges: %w", err)
+	}
+	if expected.Queues, _, err = repo.FindQueues(filter, repository.Page{}); err != nil {
+		return ExpectedTopology{}, fmt.Errorf("failed to load expected queues: %w", err)
+	}
+	if expected.Bindings, _, err = repo.FindBindings(filter, repository.Page{}); err != nil {
+		return ExpectedTopology{}, fmt.Errorf("failed to load expected bindings: %w", err)
+	}
+	return expected, nil
+}
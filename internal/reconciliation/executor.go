@@ -0,0 +1,85 @@
+package reconciliation
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrAlreadyRunning is matched by the *AlreadyRunningError returned when a run is refused
+// because another one is changing the provider
+var ErrAlreadyRunning = errors.New("reconciliation already running")
+
+// RunInfo describes the run currently holding the executor
+type RunInfo struct {
+	RunID     string    `json:"runId"`
+	Trigger   string    `json:"trigger"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// AlreadyRunningError reports the run that is in progress
+type AlreadyRunningError struct {
+	Running RunInfo
+}
+
+func (e *AlreadyRunningError) Error() string {
+	return fmt.Sprintf("reconciliation already running: run %s (trigger %s) started at %s",
+		e.Running.RunID, e.Running.Trigger, e.Running.StartedAt.Format(time.RFC3339))
+}
+
+// Is makes errors.Is(err, ErrAlreadyRunning) match
+func (e *AlreadyRunningError) Is(target error) bool {
+	return target == ErrAlreadyRunning
+}
+
+// executor serializes the runs that change the provider, whatever triggered them. Runs either
+// wait for their turn (acquire) or are refused while another run is in progress (tryAcquire).
+type executor struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	current *RunInfo
+}
+
+func newExecutor() *executor {
+	e := &executor{}
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+// acquire waits until no other run is in progress
+func (e *executor) acquire(runID, trigger string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for e.current != nil {
+		e.cond.Wait()
+	}
+	e.current = &RunInfo{RunID: runID, Trigger: trigger, StartedAt: time.Now().UTC()}
+}
+
+// tryAcquire returns an *AlreadyRunningError instead of waiting
+func (e *executor) tryAcquire(runID, trigger string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.current != nil {
+		return &AlreadyRunningError{Running: *e.current}
+	}
+	e.current = &RunInfo{RunID: runID, Trigger: trigger, StartedAt: time.Now().UTC()}
+	return nil
+}
+
+func (e *executor) release() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.current = nil
+	e.cond.Signal()
+}
+
+func (e *executor) running() (RunInfo, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.current == nil {
+		return RunInfo{}, false
+	}
+	return *e.current, true
+}
@@ -0,0 +1,107 @@
+package reconciliation
+
+import (
+	"fmt"
+	"time"
+
+	"queue-manager/internal/repository"
+)
+
+// GracePolicy delays the deletion of unexpected resources. A resource is deleted once it has
+// been gone from the expectation for Period, or once it has been unexpected for Runs consecutive
+// runs. Period is measured from the soft-deletion of the resource's row or, for hard-deleted rows
+// and resources that only exist on the provider, from the first run that saw it unexpected. The
+// zero value disables the grace period and deletes unexpected resources immediately.
+type GracePolicy struct {
+	Period time.Duration
+	Runs   int
+}
+
+// Enabled reports whether deletions are delayed at all
+func (g GracePolicy) Enabled() bool {
+	return g.Period > 0 || g.Runs > 0
+}
+
+// ScheduledDeletion describes an unexpected resource that is still inside its grace period
+type ScheduledDeletion struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Deadline is when the resource leaves the grace window (nil if only Runs is configured)
+	Deadline *time.Time `json:"deadline,omitempty"`
+	// RunsRemaining is how many more runs the resource must stay unexpected (0 if not run-based)
+	RunsRemaining int    `json:"runsRemaining,omitempty"`
+	Reason        string `json:"reason"`
+
+	// exchange and queue are the ends of a binding, for scoping
+	exchange, queue string
+}
+
+// resourceKey identifies a provider resource across runs
+func resourceKey(kind, name string) string {
+	return kind + ":" + name
+}
+
+// bindingName formats a binding the same way everywhere it is reported
+func bindingName(exchange, queueName, routingKey string) string {
+	return fmt.Sprintf("%s -> %s (%s)", exchange, queueName, routingKey)
+}
+
+// tombstoneIndex maps resource keys to the time their rows were soft-deleted
+func tombstoneIndex(tombstones []repository.Tombstone) map[string]time.Time {
+	index := make(map[string]time.Time, len(tombstones))
+	for _, t := range tombstones {
+		var key string
+		switch t.Kind {
+		case "exchange":
+			key = resourceKey("exchange", t.ExchangeName)
+		case "queue":
+			key = resourceKey("queue", t.QueueName)
+		case "binding":
+			key = resourceKey("binding", bindingName(t.ExchangeName, t.QueueName, t.RoutingKey))
+		default:
+			continue
+		}
+		index[key] = t.DeletedAt
+	}
+	return index
+}
+
+// schedule decides whether an unexpected resource is due for deletion. runs is the number of
+// consecutive runs the resource has been unexpected, including the current one, and since when
+// the first of them saw it. It returns nil when the resource may be deleted now.
+func (g GracePolicy) schedule(kind, name string, deletedAt *time.Time, since time.Time, runs int, now time.Time) *ScheduledDeletion {
+	if !g.Enabled() {
+		return nil
+	}
+	if g.Runs > 0 && runs >= g.Runs {
+		return nil
+	}
+
+	scheduled := &ScheduledDeletion{Kind: kind, Name: name}
+	if g.Runs > 0 {
+		scheduled.RunsRemaining = g.Runs - runs
+	}
+
+	switch {
+	case deletedAt != nil && g.Period > 0:
+		deadline := deletedAt.Add(g.Period)
+		if !now.Before(deadline) {
+			return nil
+		}
+		scheduled.Deadline = &deadline
+		scheduled.Reason = fmt.Sprintf("soft-deleted at %s, grace period ends at %s",
+			deletedAt.Format(time.RFC3339), deadline.Format(time.RFC3339))
+	case g.Period > 0:
+		// Without a tombstone the period starts when the resource was first seen unexpected
+		deadline := since.Add(g.Period)
+		if !now.Before(deadline) {
+			return nil
+		}
+		scheduled.Deadline = &deadline
+		scheduled.Reason = fmt.Sprintf("unexpected since %s, grace period ends at %s",
+			since.Format(time.RFC3339), deadline.Format(time.RFC3339))
+	default:
+		scheduled.Reason = fmt.Sprintf("unexpected for %d of %d consecutive runs", runs, g.Runs)
+	}
+	return scheduled
+}
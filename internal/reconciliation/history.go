@@ -0,0 +1,156 @@
+package reconciliation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"queue-manager/internal/logging"
+	"queue-manager/internal/models"
+)
+
+// Trigger sources recorded in the run history
+const (
+	TriggerStartup = "startup"
+	TriggerCron    = "cron"
+	TriggerSync    = "sync"
+	TriggerEvent   = "event" // a change notification from the database
+	TriggerWrite   = "write" // a change made through the write API
+	TriggerFile    = "file"  // a change to the topology files
+)
+
+// Trigger identifies what started a reconciliation run
+type Trigger struct {
+	Source string
+	// RequestID is the X-Request-ID of the API call that started the run, if any
+	RequestID string
+}
+
+// Run statuses recorded in the run history
+const (
+	RunSucceeded = "succeeded"
+	RunPartial   = "partial" // completed with errors
+	RunAborted   = "aborted" // a pruning guard held back deletions
+	RunFailed    = "failed"  // no actions were taken
+)
+
+// RunHistory persists reconciliation runs. It is implemented by the repository.
+type RunHistory interface {
+	InsertReconciliationRun(run models.ReconciliationRun, actions []models.ReconciliationAction) error
+}
+
+// actionFailure is an action that failed while applying a plan
+type actionFailure struct {
+	action Action
+	err    string
+}
+
+// runStatus classifies the outcome of a run
+func runStatus(result *ReconciliationResult, err error) string {
+	switch {
+	case errors.Is(err, ErrPruningAborted):
+		return RunAborted
+	case err != nil:
+		return RunFailed
+	case len(result.Errors) > 0:
+		return RunPartial
+	default:
+		return RunSucceeded
+	}
+}
+
+// historyRecord converts a run's outcome into rows for the run history
+func historyRecord(runID string, trigger Trigger, dryRun, force bool, started time.Time,
+	result *ReconciliationResult, err error) (models.ReconciliationRun, []models.ReconciliationAction) {
+	summary := models.JSONB{}
+	for k, v := range result.Summary() {
+		summary[k] = v
+	}
+
+	run := models.ReconciliationRun{
+		UUID:       runID,
+		Trigger:    trigger.Source,
+		RequestID:  trigger.RequestID,
+		PlanID:     result.PlanID,
+		DryRun:     dryRun,
+		Force:      force,
+		Status:     runStatus(result, err),
+		Summary:    summary,
+		StartedAt:  started,
+		FinishedAt: time.Now().UTC(),
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	createDetail, deleteDetail := "missing on provider", "not in expected topology"
+	if dryRun {
+		createDetail, deleteDetail = "would create: "+createDetail, "would delete: "+deleteDetail
+	}
+
+	actions := []models.ReconciliationAction{}
+	add := func(action, kind, name, detail string) {
+		actions = append(actions, models.ReconciliationAction{Action: action, ResourceKind: kind, ResourceName: name, Detail: detail})
+	}
+	for _, name := range result.CreatedExchanges {
+		add("create", "exchange", name, createDetail)
+	}
+	for _, name := range result.CreatedQueues {
+		add("create", "queue", name, createDetail)
+	}
+	for _, b := range result.CreatedBindings {
+		add("create", "binding", bindingName(b[1], b[0], b[2]), createDetail)
+	}
+	for _, b := range result.DeletedBindings {
+		add("delete", "binding", bindingName(b[1], b[0], b[2]), deleteDetail)
+	}
+	for _, name := range result.DeletedQueues {
+		add("delete", "queue", name, deleteDetail)
+	}
+	for _, name := range result.DeletedExchanges {
+		add("delete", "exchange", name, deleteDetail)
+	}
+	for _, p := range result.PendingDeletions {
+		add("pending", p.Kind, p.Name, p.Reason)
+	}
+	for _, s := range result.ScheduledDeletions {
+		add("scheduled", s.Kind, s.Name, s.Reason)
+	}
+
+	// Failed actions are recorded against their resource, everything else as a run-level error
+	failed := map[string]bool{}
+	for _, f := range result.failures {
+		add("error", f.action.Kind, f.action.Name, f.err)
+		failed[f.err] = true
+	}
+	for _, msg := range result.Errors {
+		if !failed[msg] {
+			add("error", "", "", msg)
+		}
+	}
+	return run, actions
+}
+
+// record exports a run to the metrics, stores it in the history, if configured, and reports it to
+// the observers. Failures are logged, not returned: the history must never block reconciliation.
+func (r *Reconciler) record(ctx context.Context, runID string, trigger Trigger, dryRun, force bool, started time.Time,
+	result *ReconciliationResult, err error) {
+	observeRun(trigger, dryRun, started, result, err)
+
+	r.mu.Lock()
+	history, observers := r.history, append([]Observer{}, r.observers...)
+	r.mu.Unlock()
+	if history == nil && len(observers) == 0 {
+		return
+	}
+
+	run, actions := historyRecord(runID, trigger, dryRun, force, started, result, err)
+	if history != nil {
+		if err := history.InsertReconciliationRun(run, actions); err != nil {
+			logger(ctx).ErrorContext(ctx, "failed to record run", logging.KeyRunID, runID, logging.Err(err))
+		}
+	}
+	for _, o := range observers {
+		o.RunFinished(ctx, run, actions)
+	}
+}
@@ -0,0 +1,28 @@
+package reconciliation
+
+import (
+	"context"
+	"log/slog"
+
+	"queue-manager/internal/logging"
+)
+
+type loggerKey struct{}
+
+// withLogger makes the functions of a run log through l
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// logger returns the logger of the run in ctx, or the default reconciliation logger
+func logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && l != nil {
+		return l
+	}
+	return logging.Component(nil, "reconciliation")
+}
+
+// actionResource identifies the resource an action changes in log lines
+func actionResource(a Action) slog.Attr {
+	return logging.Resource(a.Kind, a.Name)
+}
@@ -0,0 +1,74 @@
+package reconciliation
+
+import (
+	"context"
+	"time"
+
+	"queue-manager/internal/metrics"
+)
+
+// observeRun exports a finished run to the metrics
+func observeRun(trigger Trigger, dryRun bool, started time.Time, result *ReconciliationResult, err error) {
+	metrics.ObserveRun(trigger.Source, runStatus(result, err), dryRun, time.Since(started))
+	if dryRun {
+		return
+	}
+	metrics.AddResources("created", "exchange", len(result.CreatedExchanges))
+	metrics.AddResources("created", "queue", len(result.CreatedQueues))
+	metrics.AddResources("created", "binding", len(result.CreatedBindings))
+	metrics.AddResources("deleted", "exchange", len(result.DeletedExchanges))
+	metrics.AddResources("deleted", "queue", len(result.DeletedQueues))
+	metrics.AddResources("deleted", "binding", len(result.DeletedBindings))
+	for _, f := range result.failures {
+		metrics.AddResources("errored", f.action.Kind, 1)
+	}
+}
+
+// driftReport lists the resources out of sync in a plan of the whole topology. When the plan was
+// executed, only what is left over counts: failed actions and held-back deletions.
+func driftReport(plan *Plan, result *ReconciliationResult) DriftReport {
+	report := DriftReport{Missing: []DriftResource{}, Unexpected: []DriftResource{}}
+	add := func(a Action) {
+		if a.Type == ActionCreate {
+			report.Missing = append(report.Missing, DriftResource{Kind: a.Kind, Name: a.Name})
+		} else {
+			report.Unexpected = append(report.Unexpected, DriftResource{Kind: a.Kind, Name: a.Name})
+		}
+	}
+
+	pending, scheduled := plan.PendingDeletions, plan.ScheduledDeletions
+	if result == nil {
+		for _, a := range plan.Actions {
+			add(a)
+		}
+	} else {
+		for _, f := range result.failures {
+			add(f.action)
+		}
+		pending, scheduled = result.PendingDeletions, result.ScheduledDeletions
+	}
+	for _, d := range pending {
+		report.Unexpected = append(report.Unexpected, DriftResource{Kind: d.Kind, Name: d.Name})
+	}
+	for _, d := range scheduled {
+		report.Unexpected = append(report.Unexpected, DriftResource{Kind: d.Kind, Name: d.Name})
+	}
+	return report
+}
+
+// observeDrift updates the drift gauges and tells the observers about the drift
+func (r *Reconciler) observeDrift(ctx context.Context, plan *Plan, result *ReconciliationResult) {
+	report := driftReport(plan, result)
+	missing, unexpected := metrics.Drift{}, metrics.Drift{}
+	for _, d := range report.Missing {
+		missing[d.Kind]++
+	}
+	for _, d := range report.Unexpected {
+		unexpected[d.Kind]++
+	}
+	metrics.SetDrift(missing, unexpected)
+
+	for _, o := range r.getObservers() {
+		o.DriftObserved(ctx, report)
+	}
+}
@@ -0,0 +1,33 @@
+package reconciliation
+
+import (
+	"context"
+
+	"queue-manager/internal/models"
+)
+
+// Observer is told about the outcome of reconciliations, e.g. to send notifications. It is
+// implemented by the webhook notifier. Both methods are called synchronously and must not block.
+type Observer interface {
+	// RunFinished receives every run, including dry runs, as recorded in the run history
+	RunFinished(ctx context.Context, run models.ReconciliationRun, actions []models.ReconciliationAction)
+	// DriftObserved receives the drift found by every plan of the whole topology, even when empty
+	DriftObserved(ctx context.Context, drift DriftReport)
+}
+
+// DriftReport lists the resources out of sync with the expected topology
+type DriftReport struct {
+	Missing    []DriftResource `json:"missing"`
+	Unexpected []DriftResource `json:"unexpected"`
+}
+
+// DriftResource is a resource missing on the provider or not in the expected topology
+type DriftResource struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// Empty reports whether the topology is in sync
+func (d DriftReport) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Unexpected) == 0
+}
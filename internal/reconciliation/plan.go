@@ -0,0 +1,481 @@
+package reconciliation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"queue-manager/internal/bootstrap"
+	"queue-manager/internal/logging"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/repository"
+	"queue-manager/internal/tracing"
+	"queue-manager/internal/validation"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ActionType is the kind of change an action makes on the provider
+type ActionType string
+
+const (
+	ActionCreate ActionType = "create"
+	ActionDelete ActionType = "delete"
+)
+
+// Action is a single ordered step of a plan
+type Action struct {
+	Type ActionType `json:"type"`
+	Kind string     `json:"kind"` // exchange, queue or binding
+	Name string     `json:"name"`
+	// ExchangeType is set when creating an exchange
+	ExchangeType string `json:"exchangeType,omitempty"`
+	// Queue, Exchange and RoutingKey are set for bindings
+	Queue      string `json:"queue,omitempty"`
+	Exchange   string `json:"exchange,omitempty"`
+	RoutingKey string `json:"routingKey,omitempty"`
+}
+
+// Plan is the serializable outcome of comparing expected and actual state. Actions are ordered so
+// that they can be applied as-is: creations first (exchanges, queues, bindings), then deletions
+// (bindings, queues, exchanges). The hashes identify the inputs the plan was computed from.
+type Plan struct {
+	ID           string    `json:"id"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ForceDelete  bool      `json:"forceDelete"`
+	ExpectedHash string    `json:"expectedHash"`
+	ActualHash   string    `json:"actualHash"`
+	Actions      []Action  `json:"actions"`
+	// Deletions held back at planning time are reported but never applied
+	PendingDeletions   []PendingDeletion   `json:"pendingDeletions"`
+	ScheduledDeletions []ScheduledDeletion `json:"scheduledDeletions"`
+	PruningAborted     bool                `json:"pruningAborted"`
+	AbortReason        string              `json:"abortReason,omitempty"`
+	// Errors raised while reading the actual state
+	Errors []string `json:"errors"`
+	// Findings of the validation of the expected topology; error findings block applying the plan
+	Findings  validation.Findings `json:"findings"`
+	AppliedAt *time.Time          `json:"appliedAt,omitempty"`
+
+	expectedCount   int
+	unexpectedRuns  map[string]int
+	unexpectedSince map[string]time.Time
+}
+
+// ErrPlanStale is returned by Apply when the expected or actual state changed since planning
+var ErrPlanStale = errors.New("plan is stale")
+
+// Summary returns the number of planned actions by type and kind
+func (p *Plan) Summary() map[string]int {
+	summary := map[string]int{
+		"exchangesToCreate":  0,
+		"queuesToCreate":     0,
+		"bindingsToCreate":   0,
+		"exchangesToDelete":  0,
+		"queuesToDelete":     0,
+		"bindingsToDelete":   0,
+		"pendingDeletions":   len(p.PendingDeletions),
+		"scheduledDeletions": len(p.ScheduledDeletions),
+		"errors":             len(p.Errors),
+	}
+	for _, a := range p.Actions {
+		if a.Type == ActionCreate {
+			summary[a.Kind+"sToCreate"]++
+		} else {
+			summary[a.Kind+"sToDelete"]++
+		}
+	}
+	return summary
+}
+
+// actualState is the provider state a plan is computed from
+type actualState struct {
+	exchanges []string
+	queues    []string
+	bindings  map[string]map[string]map[string]bool // queue -> exchange -> routingKey -> true
+	errors    []string
+}
+
+// loadState reads the expected topology from src, or from the database when src is nil, validates
+// it, and reads the actual state from the provider. Listing errors on the provider side are
+// collected rather than returned so a partial view can still be reconciled. Loading each side is
+// traced as its own phase.
+func loadState(ctx context.Context, qp queue.Provider, repo *repository.Repository, src bootstrap.TopologySource) (bootstrap.Topology, validation.Findings, *actualState, error) {
+	if qp == nil {
+		return bootstrap.Topology{}, nil, nil, fmt.Errorf("queue provider is nil")
+	}
+	if repo == nil {
+		return bootstrap.Topology{}, nil, nil, fmt.Errorf("repository is nil")
+	}
+
+	expectedCtx, span := tracing.Start(ctx, "reconciliation.load_expected")
+	if src == nil {
+		src = bootstrap.NewDBSource(repo)
+	}
+	source := src.Name()
+	defs, err := src.Load(expectedCtx)
+	expected := defs.Topology()
+	span.SetAttributes(attribute.String("reconciliation.source", source))
+	tracing.End(span, err)
+	if err != nil {
+		return expected, nil, nil, fmt.Errorf("failed to load expected topology: %w", err)
+	}
+
+	logger(ctx).InfoContext(ctx, "loaded expected topology", "source", source,
+		"exchanges", len(expected.Exchanges), "queues", len(expected.Queues), "bindings", len(expected.Bindings))
+
+	// Errors stop the run; warnings are only worth a look and are logged at a lower level
+	findings := validation.Validate(defs)
+	for _, f := range findings {
+		level, msg := slog.LevelInfo, "topology warning"
+		if f.Severity == validation.SeverityError {
+			level, msg = slog.LevelWarn, "invalid topology"
+		}
+		logger(ctx).Log(ctx, level, msg, "code", f.Code,
+			logging.Resource(f.Kind, f.Resource), "field", f.Field, "finding", f.Message)
+	}
+
+	actualCtx, span := tracing.Start(ctx, "reconciliation.load_actual")
+	defer span.End()
+	qp = queue.WithContext(actualCtx, qp)
+	actual := &actualState{bindings: make(map[string]map[string]map[string]bool)}
+
+	// Query actual state from provider
+	actual.exchanges, err = qp.ListExchanges()
+	if err != nil {
+		actual.errors = append(actual.errors, fmt.Sprintf("failed to list exchanges: %v", err))
+		actual.exchanges = []string{} // Continue with empty list
+	}
+
+	actual.queues, err = qp.ListQueues()
+	if err != nil {
+		actual.errors = append(actual.errors, fmt.Sprintf("failed to list queues: %v", err))
+		actual.queues = []string{} // Continue with empty list
+	}
+
+	// Store bindings as map[queue]map[exchange]map[routingKey]bool to avoid issues with colons in routing keys
+	totalActualBindings := 0
+	for _, queueName := range actual.queues {
+		bindings, err := qp.ListBindings(queueName)
+		if err != nil {
+			actual.errors = append(actual.errors, fmt.Sprintf("failed to list bindings for queue %s: %v", queueName, err))
+			continue
+		}
+		actual.bindings[queueName] = make(map[string]map[string]bool)
+		for _, b := range bindings {
+			exchangeName := b[1]
+			routingKey := b[2]
+			if actual.bindings[queueName][exchangeName] == nil {
+				actual.bindings[queueName][exchangeName] = make(map[string]bool)
+			}
+			actual.bindings[queueName][exchangeName][routingKey] = true
+			totalActualBindings++
+		}
+	}
+
+	logger(ctx).InfoContext(ctx, "loaded actual state",
+		"exchanges", len(actual.exchanges), "queues", len(actual.queues), "bindings", totalActualBindings, "errors", len(actual.errors))
+	span.SetAttributes(attribute.Int("reconciliation.errors", len(actual.errors)))
+
+	return expected, findings, actual, nil
+}
+
+// BuildPlan compares expected and actual state and returns the ordered actions needed to converge
+// them, without changing the provider. Grace periods, pruning guards and queue safety checks are
+// evaluated here, so held-back deletions are part of the plan rather than decided at apply time.
+func BuildPlan(qp queue.Provider, repo *repository.Repository, opts Options) (*Plan, error) {
+	return buildPlan(context.Background(), qp, repo, opts)
+}
+
+func buildPlan(ctx context.Context, qp queue.Provider, repo *repository.Repository, opts Options) (plan *Plan, err error) {
+	expected, findings, actual, err := loadState(ctx, qp, repo, opts.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := tracing.Start(ctx, "reconciliation.plan")
+	defer func() {
+		if plan != nil {
+			span.SetAttributes(attribute.Int("reconciliation.actions", len(plan.Actions)))
+		}
+		tracing.End(span, err)
+	}()
+	qp = queue.WithContext(ctx, qp)
+	repo = repo.WithContext(ctx)
+
+	plan = &Plan{
+		CreatedAt:          time.Now().UTC(),
+		ForceDelete:        opts.ForceDelete,
+		ExpectedHash:       hashExpected(expected),
+		ActualHash:         hashActual(actual),
+		Actions:            []Action{},
+		PendingDeletions:   []PendingDeletion{},
+		ScheduledDeletions: []ScheduledDeletion{},
+		Errors:             append([]string{}, actual.errors...),
+		Findings:           append(validation.Findings{}, findings...),
+		unexpectedRuns:     map[string]int{},
+		unexpectedSince:    map[string]time.Time{},
+	}
+
+	plan.expectedCount = len(expected.Exchanges) + len(expected.Queues) + len(expected.Bindings)
+	abortReason := ""
+	if !opts.ForceDelete {
+		abortReason = checkPruneGuards(plan.expectedCount, opts)
+	}
+
+	// Soft-deleted rows drive the grace period for resources that disappeared from the expectation
+	tombstones := map[string]time.Time{}
+	if opts.Grace.Enabled() && !opts.ForceDelete {
+		rows, err := repo.ListTombstones()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load soft-deleted resources: %w", err)
+		}
+		tombstones = tombstoneIndex(rows)
+	}
+	now := time.Now()
+
+	// pruneHeld reports whether a deletion must be held back, either because the resource is
+	// out of scope, still inside its grace period or because a guard stopped pruning. Held
+	// deletions in scope are recorded.
+	deletions := 0
+	pruneHeld := func(a Action) bool {
+		if !opts.Scope.covers(a) {
+			return true
+		}
+		kind, name := a.Kind, a.Name
+		key := resourceKey(kind, name)
+		runs := opts.UnexpectedRuns[key] + 1
+		plan.unexpectedRuns[key] = runs
+		since, ok := opts.UnexpectedSince[key]
+		if !ok {
+			since = now
+		}
+		plan.unexpectedSince[key] = since
+		if !opts.ForceDelete {
+			var deletedAt *time.Time
+			if t, ok := tombstones[key]; ok {
+				deletedAt = &t
+			}
+			if scheduled := opts.Grace.schedule(kind, name, deletedAt, since, runs, now); scheduled != nil {
+				scheduled.exchange, scheduled.queue = a.Exchange, a.Queue
+				plan.ScheduledDeletions = append(plan.ScheduledDeletions, *scheduled)
+				logger(ctx).InfoContext(ctx, "deletion scheduled", logging.Resource(kind, name), "reason", scheduled.Reason)
+				return true
+			}
+		}
+
+		reason := abortReason
+		if reason != "" {
+			plan.PruningAborted = true
+			plan.AbortReason = abortReason
+			reason = "pruning aborted: " + reason
+		} else if !opts.ForceDelete && opts.Guards.MaxDeletionsPerRun > 0 && deletions >= opts.Guards.MaxDeletionsPerRun {
+			reason = fmt.Sprintf("deletion limit of %d per run reached", opts.Guards.MaxDeletionsPerRun)
+		}
+		if reason == "" {
+			return false
+		}
+		plan.PendingDeletions = append(plan.PendingDeletions, PendingDeletion{Kind: kind, Name: name, Reason: reason, exchange: a.Exchange, queue: a.Queue})
+		logger(ctx).WarnContext(ctx, "deletion held back", logging.Resource(kind, name), "reason", reason)
+		return true
+	}
+
+	// The diff decides what is missing and what is unexpected; the plan adds the safety checks
+	diff := Compare(expectedFromBootstrap(expected), actualTopology(actual))
+	expectedQueuesMap := make(map[string]bool)
+	for _, name := range expected.Queues {
+		expectedQueuesMap[name] = true
+	}
+
+	// Create missing exchanges, in name order so plans are reproducible
+	for _, name := range diff.Missing.Exchanges {
+		plan.Actions = append(plan.Actions, Action{Type: ActionCreate, Kind: "exchange", Name: name, ExchangeType: expected.Exchanges[name]})
+	}
+
+	// Create missing queues
+	for _, name := range diff.Missing.Queues {
+		plan.Actions = append(plan.Actions, Action{Type: ActionCreate, Kind: "queue", Name: name})
+	}
+
+	// A binding with another routing key than expected is replaced: the expected binding is
+	// created and the live one deleted
+	toCreate := append([]BindingRef{}, diff.Missing.Bindings...)
+	toDelete := append([]BindingRef{}, diff.Unexpected.Bindings...)
+	for _, m := range diff.Mismatched.Bindings {
+		if *m.Expected != *m.Actual {
+			toCreate = append(toCreate, *m.Expected)
+			toDelete = append(toDelete, *m.Actual)
+		}
+	}
+
+	// Create missing bindings
+	sortBindings(toCreate)
+	for _, b := range toCreate {
+		plan.Actions = append(plan.Actions, bindingAction(ActionCreate, b.Queue, b.Exchange, b.RoutingKey))
+	}
+
+	// Delete extra bindings. Only bindings of expected queues are considered: the bindings of
+	// unexpected queues go away with the queue.
+	sort.Slice(toDelete, func(i, j int) bool {
+		a, b := toDelete[i], toDelete[j]
+		if a.Queue != b.Queue {
+			return a.Queue < b.Queue
+		}
+		if a.Exchange != b.Exchange {
+			return a.Exchange < b.Exchange
+		}
+		return a.RoutingKey < b.RoutingKey
+	})
+	for _, b := range toDelete {
+		if !expectedQueuesMap[b.Queue] {
+			continue
+		}
+		a := bindingAction(ActionDelete, b.Queue, b.Exchange, b.RoutingKey)
+		if pruneHeld(a) {
+			continue
+		}
+		deletions++
+		plan.Actions = append(plan.Actions, a)
+	}
+
+	// Delete extra queues (unless they still hold messages or have consumers)
+	for _, name := range diff.Unexpected.Queues {
+		a := Action{Type: ActionDelete, Kind: "queue", Name: name}
+		if pruneHeld(a) {
+			continue
+		}
+		if !opts.ForceDelete {
+			gone, reason, err := checkQueueDeletable(qp, name)
+			if err != nil {
+				plan.Errors = append(plan.Errors, fmt.Sprintf("failed to delete queue %s: %v", name, err))
+				continue
+			}
+			if reason != "" {
+				plan.PendingDeletions = append(plan.PendingDeletions, PendingDeletion{Kind: "queue", Name: name, Reason: reason})
+				logger(ctx).InfoContext(ctx, "queue pending deletion", logging.Resource("queue", name), "reason", reason)
+				continue
+			}
+			if gone {
+				continue // Queue disappeared in the meantime
+			}
+		}
+		deletions++
+		plan.Actions = append(plan.Actions, a)
+	}
+
+	// Delete extra exchanges
+	for _, name := range diff.Unexpected.Exchanges {
+		a := Action{Type: ActionDelete, Kind: "exchange", Name: name}
+		if pruneHeld(a) {
+			continue
+		}
+		deletions++
+		plan.Actions = append(plan.Actions, a)
+	}
+
+	return plan, nil
+}
+
+// bindingAction builds a create or delete action for a binding
+func bindingAction(t ActionType, queueName, exchangeName, routingKey string) Action {
+	return Action{
+		Type:       t,
+		Kind:       "binding",
+		Name:       bindingName(exchangeName, queueName, routingKey),
+		Queue:      queueName,
+		Exchange:   exchangeName,
+		RoutingKey: routingKey,
+	}
+}
+
+// checkQueueDeletable inspects an unexpected queue before planning its deletion. gone is true
+// when the queue no longer exists; a non-empty reason means the deletion must be held back.
+func checkQueueDeletable(qp queue.Provider, name string) (gone bool, reason string, err error) {
+	status, err := qp.InspectQueue(name)
+	if errors.Is(err, queue.ErrNotFound) {
+		return true, "", nil
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("inspect queue: %w", err)
+	}
+	if status.Messages > 0 {
+		return false, fmt.Sprintf("queue holds %d messages", status.Messages), nil
+	}
+	if status.Consumers > 0 {
+		return false, fmt.Sprintf("queue has %d active consumers", status.Consumers), nil
+	}
+	return false, "", nil
+}
+
+// hashExpected fingerprints the expected topology independently of map and row order
+func hashExpected(top bootstrap.Topology) string {
+	lines := make([]string, 0, len(top.Exchanges)+len(top.Queues)+len(top.Bindings))
+	for name, kind := range top.Exchanges {
+		lines = append(lines, "exchange\t"+name+"\t"+kind)
+	}
+	for _, name := range top.Queues {
+		lines = append(lines, "queue\t"+name)
+	}
+	for _, b := range top.Bindings {
+		lines = append(lines, "binding\t"+b[0]+"\t"+b[1]+"\t"+b[2])
+	}
+	return hashLines(lines)
+}
+
+// hashActual fingerprints the provider state a plan was computed from
+func hashActual(actual *actualState) string {
+	lines := make([]string, 0, len(actual.exchanges)+len(actual.queues))
+	for _, name := range actual.exchanges {
+		lines = append(lines, "exchange\t"+name)
+	}
+	for _, name := range actual.queues {
+		lines = append(lines, "queue\t"+name)
+	}
+	for queueName, queueBindings := range actual.bindings {
+		for exchangeName, keys := range queueBindings {
+			for routingKey := range keys {
+				lines = append(lines, "binding\t"+queueName+"\t"+exchangeName+"\t"+routingKey)
+			}
+		}
+	}
+	return hashLines(lines)
+}
+
+func hashLines(lines []string) string {
+	sort.Strings(lines)
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// dropDeletions turns the plan into a create-only plan
+func (p *Plan) dropDeletions() {
+	creates := []Action{}
+	for _, a := range p.Actions {
+		if a.Type == ActionCreate {
+			creates = append(creates, a)
+		}
+	}
+	p.Actions = creates
+	p.PendingDeletions = []PendingDeletion{}
+	p.ScheduledDeletions = []ScheduledDeletion{}
+	p.PruningAborted = false
+	p.AbortReason = ""
+}
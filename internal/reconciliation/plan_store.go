@@ -0,0 +1,106 @@
+package reconciliation
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxStoredPlans bounds the in-memory plan store; the oldest plans are evicted first
+const maxStoredPlans = 100
+
+var (
+	// ErrPlanNotFound is returned for unknown or evicted plan IDs
+	ErrPlanNotFound = errors.New("plan not found")
+	// ErrPlanAlreadyApplied is returned when a plan is applied twice, or while it is being applied
+	ErrPlanAlreadyApplied = errors.New("plan already applied")
+)
+
+// planStore keeps recently built plans so they can be reviewed and applied later
+type planStore struct {
+	mu       sync.Mutex
+	plans    map[string]*Plan
+	order    []string
+	applying map[string]bool
+}
+
+func newPlanStore() *planStore {
+	return &planStore{
+		plans:    map[string]*Plan{},
+		applying: map[string]bool{},
+	}
+}
+
+// add assigns the plan an ID and stores it
+func (s *planStore) add(plan *Plan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plan.ID = uuid.NewString()
+	s.plans[plan.ID] = plan
+	s.order = append(s.order, plan.ID)
+	for len(s.order) > maxStoredPlans {
+		oldest := s.order[0]
+		s.order = s.order[1:]
+		// A plan being applied is evicted when its claim is released
+		if !s.applying[oldest] {
+			delete(s.plans, oldest)
+		}
+	}
+}
+
+// get returns a copy of the stored plan
+func (s *planStore) get(id string) (Plan, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plan, ok := s.plans[id]
+	if !ok {
+		return Plan{}, false
+	}
+	return *plan, true
+}
+
+// claim reserves a plan for applying so it cannot be applied concurrently or twice
+func (s *planStore) claim(id string) (*Plan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	plan, ok := s.plans[id]
+	if !ok {
+		return nil, ErrPlanNotFound
+	}
+	if plan.AppliedAt != nil || s.applying[id] {
+		return nil, ErrPlanAlreadyApplied
+	}
+	s.applying[id] = true
+	copied := *plan
+	return &copied, nil
+}
+
+// release ends a claim; applied marks the plan as applied at the given time
+func (s *planStore) release(id string, applied bool, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.applying, id)
+	if !s.stored(id) {
+		delete(s.plans, id)
+		return
+	}
+	if plan, ok := s.plans[id]; ok && applied {
+		plan.AppliedAt = &at
+	}
+}
+
+// stored reports whether the plan has not been evicted
+func (s *planStore) stored(id string) bool {
+	for _, stored := range s.order {
+		if stored == id {
+			return true
+		}
+	}
+	return false
+}
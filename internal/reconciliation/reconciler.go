@@ -0,0 +1,320 @@
+package reconciliation
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"queue-manager/internal/bootstrap"
+	"queue-manager/internal/logging"
+	"queue-manager/internal/queue"
+	"queue-manager/internal/repository"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Reconciler runs reconciliations with a fixed set of pruning guards and grace policy. It
+// remembers the size of the expected topology at the last successful run so the shrink guard
+// can compare against it, and how many consecutive runs each resource has been unexpected and
+// since when. This state is kept in memory only: it starts over after a restart or a leader change.
+type Reconciler struct {
+	qp     queue.Provider
+	repo   *repository.Repository
+	guards Guards
+	grace  GracePolicy
+
+	mu              sync.Mutex
+	source          bootstrap.TopologySource
+	lastExpected    int
+	unexpectedRuns  map[string]int
+	unexpectedSince map[string]time.Time
+
+	plans     *planStore
+	history   RunHistory
+	observers []Observer
+	exec      *executor
+	logger    *slog.Logger
+}
+
+// NewReconciler creates a reconciler for the given provider and repository
+func NewReconciler(qp queue.Provider, repo *repository.Repository, guards Guards, grace GracePolicy) *Reconciler {
+	return &Reconciler{
+		qp:              qp,
+		repo:            repo,
+		guards:          guards,
+		grace:           grace,
+		unexpectedRuns:  map[string]int{},
+		unexpectedSince: map[string]time.Time{},
+		plans:           newPlanStore(),
+		exec:            newExecutor(),
+		logger:          logging.Component(nil, "reconciliation"),
+	}
+}
+
+// SetLogger replaces the reconciler's logger
+func (r *Reconciler) SetLogger(l *slog.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logger = logging.Component(l, "reconciliation")
+}
+
+func (r *Reconciler) log() *slog.Logger {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.logger
+}
+
+// runContext tags ctx with the run and the request that started it, for logs and traces
+func (r *Reconciler) runContext(ctx context.Context, runID string, trigger Trigger) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = logging.WithRunID(ctx, runID)
+	if trigger.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, trigger.RequestID)
+	}
+	return withLogger(ctx, r.log())
+}
+
+// Request describes a reconciliation run
+type Request struct {
+	DryRun bool
+	// Force deletes in-use queues, bypasses the pruning guards and resets the shrink baseline
+	Force bool
+	// CreateOnly declares missing resources without deleting anything, as done at startup
+	CreateOnly bool
+	// Scope limits the run to the given resources; nil reconciles the whole topology
+	Scope   *Scope
+	Trigger Trigger
+}
+
+// SetSource makes the reconciler read the expected topology from src instead of the database
+func (r *Reconciler) SetSource(src bootstrap.TopologySource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.source = src
+}
+
+// Source returns the source set with SetSource, or nil when the reconciler reads the database
+func (r *Reconciler) Source() bootstrap.TopologySource {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.source
+}
+
+// SetHistory makes the reconciler record every run, including dry runs, in the run history
+func (r *Reconciler) SetHistory(h RunHistory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.history = h
+}
+
+// AddObserver makes the reconciler report every run and the drift found by every plan of the
+// whole topology to o, in addition to the observers added before
+func (r *Reconciler) AddObserver(o Observer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observers = append(r.observers, o)
+}
+
+func (r *Reconciler) getObservers() []Observer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Observer{}, r.observers...)
+}
+
+// Reconcile performs a reconciliation of the whole topology, or of req.Scope if set. Runs that
+// change the provider are serialized: if another run is in progress, Reconcile waits for it to
+// finish. Dry runs only read, so they are not serialized; they store their plan, whose ID is
+// returned in the result so the reviewed plan can be applied later with Apply. The run is traced
+// as a child of the span in ctx.
+func (r *Reconciler) Reconcile(ctx context.Context, req Request) (*ReconciliationResult, error) {
+	runID := uuid.NewString()
+	if !req.DryRun {
+		r.exec.acquire(runID, req.Trigger.Source)
+		defer r.exec.release()
+	}
+	return r.run(ctx, runID, req)
+}
+
+// TryReconcile is like Reconcile but returns an *AlreadyRunningError (matching
+// ErrAlreadyRunning) instead of waiting when another run is in progress
+func (r *Reconciler) TryReconcile(ctx context.Context, req Request) (*ReconciliationResult, error) {
+	runID := uuid.NewString()
+	if !req.DryRun {
+		if err := r.exec.tryAcquire(runID, req.Trigger.Source); err != nil {
+			return newResult(), err
+		}
+		defer r.exec.release()
+	}
+	return r.run(ctx, runID, req)
+}
+
+// Running returns the run currently changing the provider, if any
+func (r *Reconciler) Running() (RunInfo, bool) {
+	return r.exec.running()
+}
+
+func (r *Reconciler) run(ctx context.Context, runID string, req Request) (*ReconciliationResult, error) {
+	ctx = r.runContext(ctx, runID, req.Trigger)
+	logger(ctx).InfoContext(ctx, "reconciliation started", "trigger", req.Trigger.Source,
+		"dry_run", req.DryRun, "force", req.Force, "create_only", req.CreateOnly, "scoped", req.Scope != nil)
+	ctx, span := startRun(ctx, runID, req.Trigger, req.DryRun,
+		attribute.Bool("reconciliation.force", req.Force),
+		attribute.Bool("reconciliation.create_only", req.CreateOnly),
+		attribute.Bool("reconciliation.scoped", req.Scope != nil),
+	)
+	started := time.Now().UTC()
+	result, err := r.reconcile(ctx, req)
+	result.RunID = runID
+	endRun(span, result, err)
+	r.record(ctx, runID, req.Trigger, req.DryRun, req.Force, started, result, err)
+	return result, err
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, req Request) (*ReconciliationResult, error) {
+	opts := r.options(req.Force)
+	opts.Scope = req.Scope
+	plan, err := buildPlan(ctx, r.qp, r.repo, opts)
+	if err != nil {
+		return newResult(), err
+	}
+	// Invalid topologies can be previewed but not applied
+	if err := plan.Findings.Err(); err != nil && !req.DryRun {
+		return blocked(ctx, plan.Findings, err)
+	}
+	if req.CreateOnly {
+		plan.dropDeletions()
+	}
+	plan.restrict(req.Scope)
+	// Only plans of the whole topology describe the drift
+	full := !req.CreateOnly && req.Scope == nil
+
+	if req.DryRun {
+		r.storePlan(ctx, plan)
+		if full {
+			r.observeDrift(ctx, plan, nil)
+		}
+		result, err := finishResult(ctx, previewPlan(ctx, plan))
+		result.PlanID = plan.ID
+		return result, err
+	}
+
+	result, err := finishResult(ctx, executePlan(ctx, r.qp, plan))
+	if full {
+		r.observeDrift(ctx, plan, result)
+	}
+	// Partial runs must not advance the grace counters or the shrink baseline
+	if full {
+		r.remember(result, err)
+	}
+	return result, err
+}
+
+// Plan builds and stores a plan without changing the provider
+func (r *Reconciler) Plan(ctx context.Context, force bool) (*Plan, error) {
+	ctx = withLogger(ctx, r.log())
+	plan, err := buildPlan(ctx, r.qp, r.repo, r.options(force))
+	if err != nil {
+		return nil, err
+	}
+	r.observeDrift(ctx, plan, nil)
+	r.storePlan(ctx, plan)
+	return plan, nil
+}
+
+// Drift builds a plan for reporting only: it is neither stored nor recorded in the run history
+func (r *Reconciler) Drift(ctx context.Context) (*Plan, error) {
+	ctx = withLogger(ctx, r.log())
+	plan, err := buildPlan(ctx, r.qp, r.repo, r.options(false))
+	if err != nil {
+		return nil, err
+	}
+	r.observeDrift(ctx, plan, nil)
+	return plan, nil
+}
+
+func (r *Reconciler) storePlan(ctx context.Context, plan *Plan) {
+	r.plans.add(plan)
+	logger(ctx).InfoContext(ctx, "stored plan", "plan_id", plan.ID, "actions", len(plan.Actions))
+}
+
+// GetPlan returns a stored plan
+func (r *Reconciler) GetPlan(id string) (Plan, bool) {
+	return r.plans.get(id)
+}
+
+// Apply applies a stored plan if the expected and actual state still match the plan's hashes.
+// A plan can only be applied once; a stale plan stays unapplied so the caller can plan again.
+// Like TryReconcile, Apply refuses to run while another run is in progress.
+func (r *Reconciler) Apply(ctx context.Context, id string, trigger Trigger) (*ReconciliationResult, error) {
+	runID := uuid.NewString()
+	if err := r.exec.tryAcquire(runID, trigger.Source); err != nil {
+		return newResult(), err
+	}
+	defer r.exec.release()
+
+	plan, err := r.plans.claim(id)
+	if err != nil {
+		return newResult(), err
+	}
+
+	ctx = r.runContext(ctx, runID, trigger)
+	ctx, span := startRun(ctx, runID, trigger, false, attribute.String("reconciliation.plan_id", id))
+	started := time.Now().UTC()
+	result, err := apply(ctx, r.qp, r.repo, r.options(false).Source, plan)
+	endRun(span, result, err)
+	executed := err == nil || errors.Is(err, ErrPruningAborted)
+	r.plans.release(id, executed, time.Now().UTC())
+	result.PlanID = id
+	result.RunID = runID
+	if executed {
+		r.remember(result, err)
+		r.observeDrift(ctx, plan, result)
+	}
+	r.record(ctx, runID, trigger, false, plan.ForceDelete, started, result, err)
+	return result, err
+}
+
+// options returns the run options with a snapshot of the state kept between runs
+func (r *Reconciler) options(force bool) Options {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unexpectedRuns := make(map[string]int, len(r.unexpectedRuns))
+	for k, v := range r.unexpectedRuns {
+		unexpectedRuns[k] = v
+	}
+	unexpectedSince := make(map[string]time.Time, len(r.unexpectedSince))
+	for k, v := range r.unexpectedSince {
+		unexpectedSince[k] = v
+	}
+	return Options{
+		ForceDelete:      force,
+		Guards:           r.guards,
+		Grace:            r.grace,
+		PreviousExpected: r.lastExpected,
+		UnexpectedRuns:   unexpectedRuns,
+		UnexpectedSince:  unexpectedSince,
+		Source:           r.source,
+	}
+}
+
+// remember records the outcome of a run that changed the provider
+func (r *Reconciler) remember(result *ReconciliationResult, err error) {
+	if result.unexpectedRuns == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Resources that are no longer unexpected (or were deleted) drop out of the count
+	r.unexpectedRuns = result.unexpectedRuns
+	r.unexpectedSince = result.unexpectedSince
+	if err == nil && len(result.Errors) == 0 {
+		r.lastExpected = result.expectedCount
+	}
+}
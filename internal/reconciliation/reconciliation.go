@@ -1,269 +1,336 @@
 package reconciliation
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"strings"
+	"time"
 
 	"queue-manager/internal/bootstrap"
+	"queue-manager/internal/logging"
 	"queue-manager/internal/queue"
 	"queue-manager/internal/repository"
+	"queue-manager/internal/tracing"
+	"queue-manager/internal/validation"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ReconciliationResult contains the results of a reconciliation operation
 type ReconciliationResult struct {
-	CreatedExchanges []string
-	CreatedQueues    []string
-	CreatedBindings  [][3]string // [queue, exchange, routingKey]
-	DeletedExchanges []string
-	DeletedQueues    []string
-	DeletedBindings  [][3]string // [queue, exchange, routingKey]
-	Errors           []string
+	CreatedExchanges   []string
+	CreatedQueues      []string
+	CreatedBindings    [][3]string // [queue, exchange, routingKey]
+	DeletedExchanges   []string
+	DeletedQueues      []string
+	DeletedBindings    [][3]string // [queue, exchange, routingKey]
+	PendingDeletions   []PendingDeletion
+	ScheduledDeletions []ScheduledDeletion
+	Errors             []string
+	// Findings of the validation of the expected topology
+	Findings validation.Findings
+	// PruningAborted is set when a guard stopped unexpected resources from being deleted
+	PruningAborted bool
+	AbortReason    string
+	// PlanID identifies the stored plan for dry runs and for runs applying a stored plan
+	PlanID string
+	// RunID identifies the run in the run history (set for runs started via a Reconciler)
+	RunID string
+
+	expectedCount   int                  // number of expected exchanges, queues and bindings
+	unexpectedRuns  map[string]int       // consecutive unexpected runs per resource key, including this one
+	unexpectedSince map[string]time.Time // when each resource key was first seen unexpected
+	failures        []actionFailure
+}
+
+// ErrPruningAborted is returned alongside the result when a guard held back all deletions
+var ErrPruningAborted = errors.New("pruning aborted")
+
+// PendingDeletion describes an unexpected resource whose deletion was held back
+type PendingDeletion struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+
+	// exchange and queue are the ends of a binding, for scoping
+	exchange, queue string
+}
+
+// Guards limit the blast radius of pruning (deleting unexpected resources)
+type Guards struct {
+	// AllowEmptyExpectation permits pruning when the expected topology is empty
+	AllowEmptyExpectation bool
+	// MaxShrinkPercent aborts pruning when the expected topology shrank by more than this
+	// percentage compared to the last successful run (0 disables the check)
+	MaxShrinkPercent int
+	// MaxDeletionsPerRun caps the number of resources deleted in a single run (0 means no cap)
+	MaxDeletionsPerRun int
+}
+
+// Options controls how a reconciliation run behaves
+type Options struct {
+	// DryRun computes the actions without changing the provider
+	DryRun bool
+	// ForceDelete deletes unexpected queues even if they hold messages or have consumers,
+	// and bypasses the pruning guards
+	ForceDelete bool
+	Guards      Guards
+	Grace       GracePolicy
+	// PreviousExpected is the size of the expected topology at the last successful run
+	PreviousExpected int
+	// UnexpectedRuns holds how many consecutive previous runs each resource key was unexpected
+	UnexpectedRuns map[string]int
+	// UnexpectedSince holds when each resource key was first seen unexpected by those runs
+	UnexpectedSince map[string]time.Time
+	// Source provides the expected topology; nil reads it from the database
+	Source bootstrap.TopologySource
+	// Scope limits the deletions that are planned, so that the deletion limit is only spent on
+	// resources in scope; nil plans deletions across the whole topology
+	Scope *Scope
 }
 
 // Summary returns a summary of the reconciliation
 func (r *ReconciliationResult) Summary() map[string]int {
 	return map[string]int{
-		"exchangesCreated": len(r.CreatedExchanges),
-		"queuesCreated":    len(r.CreatedQueues),
-		"bindingsCreated":  len(r.CreatedBindings),
-		"exchangesDeleted": len(r.DeletedExchanges),
-		"queuesDeleted":    len(r.DeletedQueues),
-		"bindingsDeleted":  len(r.DeletedBindings),
-		"errors":           len(r.Errors),
+		"exchangesCreated":   len(r.CreatedExchanges),
+		"queuesCreated":      len(r.CreatedQueues),
+		"bindingsCreated":    len(r.CreatedBindings),
+		"exchangesDeleted":   len(r.DeletedExchanges),
+		"queuesDeleted":      len(r.DeletedQueues),
+		"bindingsDeleted":    len(r.DeletedBindings),
+		"pendingDeletions":   len(r.PendingDeletions),
+		"scheduledDeletions": len(r.ScheduledDeletions),
+		"errors":             len(r.Errors),
 	}
 }
 
 // ReconcileTopology performs full reconciliation between expected (database) and actual (provider) state
 func ReconcileTopology(qp queue.Provider, repo *repository.Repository, dryRun bool) (*ReconciliationResult, error) {
-	result := &ReconciliationResult{
-		CreatedExchanges: []string{},
-		CreatedQueues:    []string{},
-		CreatedBindings:  [][3]string{},
-		DeletedExchanges: []string{},
-		DeletedQueues:    []string{},
-		DeletedBindings:  [][3]string{},
-		Errors:           []string{},
-	}
+	return ReconcileTopologyWithOptions(qp, repo, Options{DryRun: dryRun})
+}
 
-	if qp == nil {
-		return result, fmt.Errorf("queue provider is nil")
-	}
-	if repo == nil {
-		return result, fmt.Errorf("repository is nil")
-	}
+// ReconcileTopologyWithOptions performs full reconciliation using the given options. It builds a
+// plan and, unless this is a dry run, applies it right away. A topology with error findings is
+// not applied; the returned error matches validation.ErrInvalid.
+func ReconcileTopologyWithOptions(qp queue.Provider, repo *repository.Repository, opts Options) (result *ReconciliationResult, err error) {
+	ctx, span := tracing.Start(context.Background(), "reconciliation.run", attribute.Bool("reconciliation.dry_run", opts.DryRun))
+	ctx = logging.WithRunID(ctx, uuid.NewString())
+	defer func() { endRun(span, result, err) }()
 
-	// Load expected topology from database
-	expected, err := bootstrap.LoadTopologyFromDB(repo)
+	plan, err := buildPlan(ctx, qp, repo, opts)
 	if err != nil {
-		return result, fmt.Errorf("failed to load expected topology: %w", err)
+		return newResult(), err
 	}
 
-	log.Printf("[reconciliation] loaded expected topology: %d exchanges, %d queues, %d bindings",
-		len(expected.Exchanges), len(expected.Queues), len(expected.Bindings))
-
-	// Query actual state from provider
-	actualExchanges, err := qp.ListExchanges()
-	if err != nil {
-		result.Errors = append(result.Errors, fmt.Sprintf("failed to list exchanges: %v", err))
-		actualExchanges = []string{} // Continue with empty list
+	if err := plan.Findings.Err(); err != nil && !opts.DryRun {
+		return blocked(ctx, plan.Findings, err)
+	}
+	if opts.DryRun {
+		result = previewPlan(ctx, plan)
+	} else {
+		result = executePlan(ctx, qp, plan)
 	}
+	return finishResult(ctx, result)
+}
+
+// Apply executes a previously built plan. The expected and actual state are read again and the
+// plan is only applied if both still hash to the values it was computed from; otherwise
+// ErrPlanStale is returned and nothing is changed.
+func Apply(qp queue.Provider, repo *repository.Repository, plan *Plan) (*ReconciliationResult, error) {
+	return apply(context.Background(), qp, repo, nil, plan)
+}
 
-	actualQueues, err := qp.ListQueues()
+func apply(ctx context.Context, qp queue.Provider, repo *repository.Repository, src bootstrap.TopologySource, plan *Plan) (*ReconciliationResult, error) {
+	if plan == nil {
+		return newResult(), fmt.Errorf("plan is nil")
+	}
+	expected, findings, actual, err := loadState(ctx, qp, repo, src)
 	if err != nil {
-		result.Errors = append(result.Errors, fmt.Sprintf("failed to list queues: %v", err))
-		actualQueues = []string{} // Continue with empty list
+		return newResult(), err
 	}
-
-	// Build map of actual bindings
-	// Store as map[queue]map[exchange]map[routingKey]bool to avoid issues with colons in routing keys
-	actualBindingsMap := make(map[string]map[string]map[string]bool) // queue -> exchange -> routingKey -> true
-	totalActualBindings := 0
-	for _, queueName := range actualQueues {
-		bindings, err := qp.ListBindings(queueName)
-		if err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("failed to list bindings for queue %s: %v", queueName, err))
-			continue
-		}
-		actualBindingsMap[queueName] = make(map[string]map[string]bool)
-		for _, b := range bindings {
-			exchangeName := b[1]
-			routingKey := b[2]
-			if actualBindingsMap[queueName][exchangeName] == nil {
-				actualBindingsMap[queueName][exchangeName] = make(map[string]bool)
-			}
-			actualBindingsMap[queueName][exchangeName][routingKey] = true
-			totalActualBindings++
-		}
+	if err := findings.Err(); err != nil {
+		return blocked(ctx, findings, err)
 	}
-
-	log.Printf("[reconciliation] actual state: %d exchanges, %d queues, %d bindings",
-		len(actualExchanges), len(actualQueues), totalActualBindings)
-
-	// Reconcile exchanges: create missing ones
-	actualExchangesMap := make(map[string]bool)
-	for _, name := range actualExchanges {
-		actualExchangesMap[name] = true
+	if len(actual.errors) > 0 {
+		return newResult(), fmt.Errorf("failed to verify actual state: %s", strings.Join(actual.errors, "; "))
 	}
-
-	for name, kind := range expected.Exchanges {
-		if !actualExchangesMap[name] {
-			if dryRun {
-				result.CreatedExchanges = append(result.CreatedExchanges, name)
-				log.Printf("[reconciliation] [DRY RUN] would create exchange: %s (type: %s)", name, kind)
-			} else {
-				if err := qp.DeclareExchange(name, kind, true); err != nil {
-					result.Errors = append(result.Errors, fmt.Sprintf("failed to create exchange %s: %v", name, err))
-				} else {
-					result.CreatedExchanges = append(result.CreatedExchanges, name)
-					log.Printf("[reconciliation] created exchange: %s (type: %s)", name, kind)
-				}
-			}
-		}
+	if hash := hashExpected(expected); hash != plan.ExpectedHash {
+		return newResult(), fmt.Errorf("%w: expected topology changed since plan %s was created", ErrPlanStale, plan.ID)
 	}
-
-	// Reconcile exchanges: delete extra ones (excluding system exchanges)
-	for _, name := range actualExchanges {
-		if _, expected := expected.Exchanges[name]; !expected {
-			if dryRun {
-				result.DeletedExchanges = append(result.DeletedExchanges, name)
-				log.Printf("[reconciliation] [DRY RUN] would delete exchange: %s", name)
-			} else {
-				if err := qp.DeleteExchange(name); err != nil {
-					result.Errors = append(result.Errors, fmt.Sprintf("failed to delete exchange %s: %v", name, err))
-				} else {
-					result.DeletedExchanges = append(result.DeletedExchanges, name)
-					log.Printf("[reconciliation] deleted exchange: %s", name)
-				}
-			}
-		}
+	if hash := hashActual(actual); hash != plan.ActualHash {
+		return newResult(), fmt.Errorf("%w: provider state changed since plan %s was created", ErrPlanStale, plan.ID)
 	}
 
-	// Reconcile queues: create missing ones
-	actualQueuesMap := make(map[string]bool)
-	for _, name := range actualQueues {
-		actualQueuesMap[name] = true
+	logger(ctx).InfoContext(ctx, "applying plan", "plan_id", plan.ID, "actions", len(plan.Actions))
+	return finishResult(ctx, executePlan(ctx, qp, plan))
+}
+
+func newResult() *ReconciliationResult {
+	return &ReconciliationResult{
+		CreatedExchanges:   []string{},
+		CreatedQueues:      []string{},
+		CreatedBindings:    [][3]string{},
+		DeletedExchanges:   []string{},
+		DeletedQueues:      []string{},
+		DeletedBindings:    [][3]string{},
+		PendingDeletions:   []PendingDeletion{},
+		ScheduledDeletions: []ScheduledDeletion{},
+		Errors:             []string{},
+		Findings:           validation.Findings{},
+		unexpectedRuns:     map[string]int{},
+		unexpectedSince:    map[string]time.Time{},
 	}
+}
 
-	expectedQueuesMap := make(map[string]bool)
-	for _, name := range expected.Queues {
-		expectedQueuesMap[name] = true
-		if !actualQueuesMap[name] {
-			if dryRun {
-				result.CreatedQueues = append(result.CreatedQueues, name)
-				log.Printf("[reconciliation] [DRY RUN] would create queue: %s", name)
-			} else {
-				if err := qp.DeclareQueue(name, true); err != nil {
-					result.Errors = append(result.Errors, fmt.Sprintf("failed to create queue %s: %v", name, err))
-				} else {
-					result.CreatedQueues = append(result.CreatedQueues, name)
-					log.Printf("[reconciliation] created queue: %s", name)
-				}
-			}
-		}
+// resultFromPlan carries over everything decided at planning time
+func resultFromPlan(plan *Plan) *ReconciliationResult {
+	result := newResult()
+	result.PendingDeletions = append(result.PendingDeletions, plan.PendingDeletions...)
+	result.ScheduledDeletions = append(result.ScheduledDeletions, plan.ScheduledDeletions...)
+	result.Errors = append(result.Errors, plan.Errors...)
+	result.Findings = append(result.Findings, plan.Findings...)
+	result.PruningAborted = plan.PruningAborted
+	result.AbortReason = plan.AbortReason
+	result.expectedCount = plan.expectedCount
+	for k, v := range plan.unexpectedRuns {
+		result.unexpectedRuns[k] = v
 	}
+	for k, v := range plan.unexpectedSince {
+		result.unexpectedSince[k] = v
+	}
+	return result
+}
 
-	// Reconcile queues: delete extra ones
-	for _, name := range actualQueues {
-		if !expectedQueuesMap[name] {
-			if dryRun {
-				result.DeletedQueues = append(result.DeletedQueues, name)
-				log.Printf("[reconciliation] [DRY RUN] would delete queue: %s", name)
-			} else {
-				if err := qp.DeleteQueue(name); err != nil {
-					result.Errors = append(result.Errors, fmt.Sprintf("failed to delete queue %s: %v", name, err))
-				} else {
-					result.DeletedQueues = append(result.DeletedQueues, name)
-					log.Printf("[reconciliation] deleted queue: %s", name)
-				}
-			}
-		}
+// finishResult logs the outcome and turns an aborted pruning into ErrPruningAborted
+func finishResult(ctx context.Context, result *ReconciliationResult) (*ReconciliationResult, error) {
+	logger(ctx).InfoContext(ctx, "reconciliation completed", "summary", result.Summary())
+	if result.PruningAborted {
+		logger(ctx).WarnContext(ctx, "pruning aborted", "reason", result.AbortReason)
+		return result, fmt.Errorf("%w: %s", ErrPruningAborted, result.AbortReason)
 	}
+	return result, nil
+}
 
-	// Reconcile bindings: create missing ones
-	expectedBindingsMap := make(map[string]map[string]map[string]bool) // queue -> exchange -> routingKey -> true
-	for _, b := range expected.Bindings {
-		queueName := b[0]
-		exchangeName := b[1]
-		routingKey := b[2]
-		if expectedBindingsMap[queueName] == nil {
-			expectedBindingsMap[queueName] = make(map[string]map[string]bool)
-		}
-		if expectedBindingsMap[queueName][exchangeName] == nil {
-			expectedBindingsMap[queueName][exchangeName] = make(map[string]bool)
-		}
-		expectedBindingsMap[queueName][exchangeName][routingKey] = true
+// blocked refuses to change the provider because the expected topology has error findings
+func blocked(ctx context.Context, findings validation.Findings, err error) (*ReconciliationResult, error) {
+	logger(ctx).ErrorContext(ctx, "reconciliation blocked by invalid topology",
+		"errors", findings.Count(validation.SeverityError), "warnings", findings.Count(validation.SeverityWarning))
+	result := newResult()
+	result.Findings = append(result.Findings, findings...)
+	return result, err
+}
+
+// previewPlan reports what a plan would do without touching the provider
+func previewPlan(ctx context.Context, plan *Plan) *ReconciliationResult {
+	result := resultFromPlan(plan)
+	for _, a := range plan.Actions {
+		logger(ctx).InfoContext(ctx, "dry run: would "+string(a.Type)+" "+a.Kind, "action", a.Type, actionResource(a))
+		result.record(a)
 	}
+	return result
+}
 
-	for _, b := range expected.Bindings {
-		queueName := b[0]
-		exchangeName := b[1]
-		routingKey := b[2]
+// executePlan applies the plan's actions in order. Failed actions are recorded as errors and
+// do not stop the remaining actions. Each action is traced in its own span.
+func executePlan(ctx context.Context, qp queue.Provider, plan *Plan) *ReconciliationResult {
+	ctx, span := tracing.Start(ctx, "reconciliation.execute", attribute.Int("reconciliation.actions", len(plan.Actions)))
+	defer span.End()
 
-		// Check if binding exists
-		exists := false
-		if queueBindings, ok := actualBindingsMap[queueName]; ok {
-			if exchangeBindings, ok := queueBindings[exchangeName]; ok {
-				exists = exchangeBindings[routingKey]
+	result := resultFromPlan(plan)
+	for _, a := range plan.Actions {
+		actionCtx, actionSpan := tracing.Start(ctx, fmt.Sprintf("reconciliation.%s %s", a.Type, a.Kind),
+			attribute.String("reconciliation.action", string(a.Type)),
+			attribute.String("resource.kind", a.Kind),
+			attribute.String("resource.name", a.Name),
+		)
+		qp := queue.WithContext(actionCtx, qp)
+		var err error
+		switch {
+		case a.Type == ActionCreate && a.Kind == "exchange":
+			err = qp.DeclareExchange(a.Name, a.ExchangeType, true)
+		case a.Type == ActionCreate && a.Kind == "queue":
+			err = qp.DeclareQueue(a.Name, true)
+		case a.Type == ActionCreate && a.Kind == "binding":
+			err = qp.BindQueue(a.Queue, a.Exchange, a.RoutingKey)
+		case a.Type == ActionDelete && a.Kind == "binding":
+			err = qp.UnbindQueue(a.Queue, a.Exchange, a.RoutingKey)
+		case a.Type == ActionDelete && a.Kind == "queue":
+			var reason string
+			reason, err = deleteQueue(qp, a.Name, plan.ForceDelete)
+			if err == nil && reason != "" {
+				result.PendingDeletions = append(result.PendingDeletions, PendingDeletion{Kind: "queue", Name: a.Name, Reason: reason})
+				logger(ctx).InfoContext(actionCtx, "queue pending deletion", actionResource(a), "reason", reason)
+				actionSpan.SetAttributes(attribute.String("reconciliation.pending_reason", reason))
+				actionSpan.End()
+				continue
 			}
+		case a.Type == ActionDelete && a.Kind == "exchange":
+			err = qp.DeleteExchange(a.Name)
+		default:
+			err = fmt.Errorf("unsupported action")
 		}
 
-		if !exists {
-			if dryRun {
-				result.CreatedBindings = append(result.CreatedBindings, b)
-				log.Printf("[reconciliation] [DRY RUN] would create binding: %s -> %s (routing key: %s)",
-					exchangeName, queueName, routingKey)
-			} else {
-				if err := qp.BindQueue(queueName, exchangeName, routingKey); err != nil {
-					result.Errors = append(result.Errors, fmt.Sprintf("failed to create binding %s -> %s (routing key: %s): %v",
-						exchangeName, queueName, routingKey, err))
-				} else {
-					result.CreatedBindings = append(result.CreatedBindings, b)
-					log.Printf("[reconciliation] created binding: %s -> %s (routing key: %s)",
-						exchangeName, queueName, routingKey)
-				}
-			}
+		tracing.End(actionSpan, err)
+		if err != nil {
+			logger(ctx).ErrorContext(actionCtx, "action failed", "action", a.Type, actionResource(a), logging.Err(err))
+			msg := fmt.Sprintf("failed to %s %s %s: %v", a.Type, a.Kind, a.Name, err)
+			result.Errors = append(result.Errors, msg)
+			result.failures = append(result.failures, actionFailure{action: a, err: msg})
+			continue
 		}
+		logger(ctx).InfoContext(actionCtx, string(a.Type)+"d "+a.Kind, "action", a.Type, actionResource(a))
+		result.record(a)
 	}
+	return result
+}
 
-	// Reconcile bindings: delete extra ones
-	for queueName, queueBindings := range actualBindingsMap {
-		// Only check bindings for queues we expect
-		if !expectedQueuesMap[queueName] {
-			continue // Queue will be deleted, bindings will go with it
-		}
-
-		for exchangeName, exchangeBindings := range queueBindings {
-			for routingKey := range exchangeBindings {
-				// Check if this binding is expected
-				expected := false
-				if expectedQueueBindings, ok := expectedBindingsMap[queueName]; ok {
-					if expectedExchangeBindings, ok := expectedQueueBindings[exchangeName]; ok {
-						expected = expectedExchangeBindings[routingKey]
-					}
-				}
+// record adds a completed (or, for dry runs, planned) action to the result
+func (r *ReconciliationResult) record(a Action) {
+	switch {
+	case a.Type == ActionCreate && a.Kind == "exchange":
+		r.CreatedExchanges = append(r.CreatedExchanges, a.Name)
+	case a.Type == ActionCreate && a.Kind == "queue":
+		r.CreatedQueues = append(r.CreatedQueues, a.Name)
+	case a.Type == ActionCreate && a.Kind == "binding":
+		r.CreatedBindings = append(r.CreatedBindings, [3]string{a.Queue, a.Exchange, a.RoutingKey})
+	case a.Type == ActionDelete && a.Kind == "exchange":
+		r.DeletedExchanges = append(r.DeletedExchanges, a.Name)
+	case a.Type == ActionDelete && a.Kind == "queue":
+		r.DeletedQueues = append(r.DeletedQueues, a.Name)
+	case a.Type == ActionDelete && a.Kind == "binding":
+		r.DeletedBindings = append(r.DeletedBindings, [3]string{a.Queue, a.Exchange, a.RoutingKey})
+	}
+}
 
-				if !expected {
-					binding := [3]string{queueName, exchangeName, routingKey}
-					if dryRun {
-						result.DeletedBindings = append(result.DeletedBindings, binding)
-						log.Printf("[reconciliation] [DRY RUN] would delete binding: %s -> %s (routing key: %s)",
-							exchangeName, queueName, routingKey)
-					} else {
-						if err := qp.UnbindQueue(queueName, exchangeName, routingKey); err != nil {
-							result.Errors = append(result.Errors, fmt.Sprintf("failed to delete binding %s -> %s (routing key: %s): %v",
-								exchangeName, queueName, routingKey, err))
-						} else {
-							result.DeletedBindings = append(result.DeletedBindings, binding)
-							log.Printf("[reconciliation] deleted binding: %s -> %s (routing key: %s)",
-								exchangeName, queueName, routingKey)
-						}
-					}
-				}
-			}
+// checkPruneGuards returns a non-empty reason when the expected topology looks too
+// suspicious to delete anything based on it
+func checkPruneGuards(expectedCount int, opts Options) string {
+	if expectedCount == 0 && !opts.Guards.AllowEmptyExpectation {
+		return "expected topology is empty"
+	}
+	prev := opts.PreviousExpected
+	if opts.Guards.MaxShrinkPercent > 0 && prev > 0 && expectedCount < prev {
+		shrink := (prev - expectedCount) * 100 / prev
+		if shrink > opts.Guards.MaxShrinkPercent {
+			return fmt.Sprintf("expected topology shrank by %d%% (from %d to %d resources) since the last successful run, exceeding the %d%% limit",
+				shrink, prev, expectedCount, opts.Guards.MaxShrinkPercent)
 		}
 	}
-
-	log.Printf("[reconciliation] reconciliation completed: %+v", result.Summary())
-	return result, nil
+	return ""
 }
 
+// deleteQueue deletes an unexpected queue. Unless forced, the delete uses the provider's
+// if-empty/if-unused conditions to close the race with traffic that arrived after planning.
+// A non-empty reason is returned when the provider refused the deletion.
+func deleteQueue(qp queue.Provider, name string, force bool) (reason string, err error) {
+	if force {
+		return "", qp.DeleteQueue(name)
+	}
+	err = qp.DeleteQueueIf(name, true, true)
+	if errors.Is(err, queue.ErrDeletePreconditionFailed) {
+		return "provider refused deletion: queue is not empty or in use", nil
+	}
+	return "", err
+}
@@ -1,17 +1,30 @@
 package reconciliation
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"log/slog"
 	"testing"
 	"time"
 
+	"queue-manager/internal/bootstrap"
+	"queue-manager/internal/logging"
+	"queue-manager/internal/models"
 	"queue-manager/internal/queue"
 	"queue-manager/internal/repository"
+	"queue-manager/internal/validation"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // MockProvider is a mock implementation of queue.Provider
@@ -87,11 +100,21 @@ func (m *MockProvider) ListBindings(queueName string) ([][3]string, error) {
 	return args.Get(0).([][3]string), args.Error(1)
 }
 
+func (m *MockProvider) InspectQueue(name string) (queue.QueueStatus, error) {
+	args := m.Called(name)
+	return args.Get(0).(queue.QueueStatus), args.Error(1)
+}
+
 func (m *MockProvider) DeleteQueue(name string) error {
 	args := m.Called(name)
 	return args.Error(0)
 }
 
+func (m *MockProvider) DeleteQueueIf(name string, ifEmpty, ifUnused bool) error {
+	args := m.Called(name, ifEmpty, ifUnused)
+	return args.Error(0)
+}
+
 func (m *MockProvider) DeleteExchange(name string) error {
 	args := m.Called(name)
 	return args.Error(0)
@@ -113,6 +136,7 @@ func TestReconciliationResult_Summary(t *testing.T) {
 		DeletedExchanges: []string{"ex3"},
 		DeletedQueues:    []string{"q2"},
 		DeletedBindings:  [][3]string{{"q2", "ex3", "key2"}},
+		PendingDeletions: []PendingDeletion{{Kind: "queue", Name: "q3", Reason: "queue holds 5 messages"}},
 		Errors:           []string{"error1", "error2"},
 	}
 
@@ -123,6 +147,7 @@ func TestReconciliationResult_Summary(t *testing.T) {
 	assert.Equal(t, 1, summary["exchangesDeleted"])
 	assert.Equal(t, 1, summary["queuesDeleted"])
 	assert.Equal(t, 1, summary["bindingsDeleted"])
+	assert.Equal(t, 1, summary["pendingDeletions"])
 	assert.Equal(t, 2, summary["errors"])
 }
 
@@ -164,17 +189,41 @@ func TestReconcileTopology_EmptyTopology(t *testing.T) {
 	mockDB.ExpectQuery(`SELECT.*exchanges`).WillReturnRows(exchangesRows)
 	mockDB.ExpectQuery(`SELECT.*queues`).WillReturnRows(queuesRows)
 	mockDB.ExpectQuery(`SELECT.*bindings`).WillReturnRows(bindingsRows)
+	expectNoAssignments(mockDB)
 
 	mockProvider.On("ListExchanges").Return([]string{"extra-exchange"}, nil)
 	mockProvider.On("ListQueues").Return([]string{"extra-queue"}, nil)
 	mockProvider.On("ListBindings", "extra-queue").Return([][3]string{{"extra-queue", "extra-exchange", "key"}}, nil)
-	mockProvider.On("DeleteExchange", "extra-exchange").Return(nil)
-	mockProvider.On("DeleteQueue", "extra-queue").Return(nil)
-	// UnbindQueue might not be called if the queue is deleted (bindings go with it)
-	mockProvider.On("UnbindQueue", "extra-queue", "extra-exchange", "key").Maybe().Return(nil)
 
+	// An empty expectation must not wipe the cluster: pruning is aborted
 	result, err := ReconcileTopology(mockProvider, repo, false)
+	require.ErrorIs(t, err, ErrPruningAborted)
+	assert.True(t, result.PruningAborted)
+	assert.Equal(t, "expected topology is empty", result.AbortReason)
+	assert.Empty(t, result.DeletedExchanges)
+	assert.Empty(t, result.DeletedQueues)
+	assert.Len(t, result.PendingDeletions, 2)
+	mockProvider.AssertNotCalled(t, "DeleteExchange", "extra-exchange")
+	mockProvider.AssertNotCalled(t, "DeleteQueue", "extra-queue")
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconcileTopology_EmptyTopologyAllowed(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	expectEmptyTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{"extra-exchange"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"extra-queue"}, nil)
+	mockProvider.On("ListBindings", "extra-queue").Return([][3]string{{"extra-queue", "extra-exchange", "key"}}, nil)
+	mockProvider.On("DeleteExchange", "extra-exchange").Return(nil)
+	mockProvider.On("InspectQueue", "extra-queue").Return(queue.QueueStatus{Name: "extra-queue"}, nil)
+	mockProvider.On("DeleteQueueIf", "extra-queue", true, true).Return(nil)
+
+	result, err := ReconcileTopologyWithOptions(mockProvider, repo, Options{Guards: allowEmpty})
 	require.NoError(t, err)
+	assert.False(t, result.PruningAborted)
 	assert.Len(t, result.DeletedExchanges, 1)
 	assert.Len(t, result.DeletedQueues, 1)
 	mockProvider.AssertExpectations(t)
@@ -206,6 +255,7 @@ func TestReconcileTopology_CreateMissing(t *testing.T) {
 	mockDB.ExpectQuery(`SELECT.*exchanges`).WillReturnRows(exchangesRows)
 	mockDB.ExpectQuery(`SELECT.*queues`).WillReturnRows(queuesRows)
 	mockDB.ExpectQuery(`SELECT.*bindings`).WillReturnRows(bindingsRows)
+	expectNoAssignments(mockDB)
 
 	mockProvider.On("ListExchanges").Return([]string{}, nil)
 	mockProvider.On("ListQueues").Return([]string{}, nil)
@@ -248,6 +298,7 @@ func TestReconcileTopology_DryRun(t *testing.T) {
 	mockDB.ExpectQuery(`SELECT.*exchanges`).WillReturnRows(exchangesRows)
 	mockDB.ExpectQuery(`SELECT.*queues`).WillReturnRows(queuesRows)
 	mockDB.ExpectQuery(`SELECT.*bindings`).WillReturnRows(bindingsRows)
+	expectNoAssignments(mockDB)
 
 	mockProvider.On("ListExchanges").Return([]string{}, nil)
 	mockProvider.On("ListQueues").Return([]string{}, nil)
@@ -290,13 +341,15 @@ func TestReconcileTopology_DeleteExtra(t *testing.T) {
 	mockDB.ExpectQuery(`SELECT.*exchanges`).WillReturnRows(exchangesRows)
 	mockDB.ExpectQuery(`SELECT.*queues`).WillReturnRows(queuesRows)
 	mockDB.ExpectQuery(`SELECT.*bindings`).WillReturnRows(bindingsRows)
+	expectNoAssignments(mockDB)
 
 	mockProvider.On("ListExchanges").Return([]string{"ex1", "extra-ex"}, nil)
 	mockProvider.On("ListQueues").Return([]string{"q1", "extra-q"}, nil)
 	mockProvider.On("ListBindings", "q1").Return([][3]string{{"q1", "ex1", "key1"}}, nil)
 	mockProvider.On("ListBindings", "extra-q").Return([][3]string{{"extra-q", "extra-ex", "extra-key"}}, nil)
 	mockProvider.On("DeleteExchange", "extra-ex").Return(nil)
-	mockProvider.On("DeleteQueue", "extra-q").Return(nil)
+	mockProvider.On("InspectQueue", "extra-q").Return(queue.QueueStatus{Name: "extra-q"}, nil)
+	mockProvider.On("DeleteQueueIf", "extra-q", true, true).Return(nil)
 	// UnbindQueue is only called for bindings on queues that are NOT being deleted
 	// Since extra-q is being deleted, UnbindQueue won't be called (bindings go with queue deletion)
 
@@ -336,6 +389,7 @@ func TestReconcileTopology_ErrorHandling(t *testing.T) {
 	mockDB.ExpectQuery(`SELECT.*exchanges`).WillReturnRows(exchangesRows)
 	mockDB.ExpectQuery(`SELECT.*queues`).WillReturnRows(queuesRows)
 	mockDB.ExpectQuery(`SELECT.*bindings`).WillReturnRows(bindingsRows)
+	expectNoAssignments(mockDB)
 
 	mockProvider.On("ListExchanges").Return([]string{}, errors.New("list error"))
 	mockProvider.On("ListQueues").Return([]string{}, nil)
@@ -375,6 +429,7 @@ func TestReconcileTopology_BindingErrors(t *testing.T) {
 	mockDB.ExpectQuery(`SELECT.*exchanges`).WillReturnRows(exchangesRows)
 	mockDB.ExpectQuery(`SELECT.*queues`).WillReturnRows(queuesRows)
 	mockDB.ExpectQuery(`SELECT.*bindings`).WillReturnRows(bindingsRows)
+	expectNoAssignments(mockDB)
 
 	mockProvider.On("ListExchanges").Return([]string{"ex1"}, nil)
 	mockProvider.On("ListQueues").Return([]string{"q1"}, nil)
@@ -403,3 +458,1115 @@ func TestReconcileTopology_LoadTopologyError(t *testing.T) {
 	require.NoError(t, mockDB.ExpectationsWereMet())
 }
 
+
+// allowEmpty lets tests prune against an empty expected topology
+var allowEmpty = Guards{AllowEmptyExpectation: true}
+
+// expectEmptyTopology sets up the database mock to return no expected resources
+func expectEmptyTopology(mockDB sqlmock.Sqlmock) {
+	mockDB.ExpectQuery(`SELECT.*exchanges`).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"exchange_name", "exchange_type", "durable", "auto_delete", "internal",
+		"arguments", "description",
+	}))
+	mockDB.ExpectQuery(`SELECT.*queues`).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"queue_name", "durable", "auto_delete", "arguments", "description",
+	}))
+	mockDB.ExpectQuery(`SELECT.*bindings`).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"exchange_name", "queue_name", "routing_key", "arguments", "mandatory",
+	}))
+	expectNoAssignments(mockDB)
+}
+
+func TestReconcileTopology_SafeQueueDeletion(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        queue.QueueStatus
+		deleteErr     error
+		expectDelete  bool
+		expectReason  string
+		expectDeleted int
+	}{
+		{
+			name:         "queue with messages is held back",
+			status:       queue.QueueStatus{Name: "extra-q", Messages: 42},
+			expectReason: "queue holds 42 messages",
+		},
+		{
+			name:         "queue with consumers is held back",
+			status:       queue.QueueStatus{Name: "extra-q", Consumers: 2},
+			expectReason: "queue has 2 active consumers",
+		},
+		{
+			name:         "provider refuses deletion",
+			status:       queue.QueueStatus{Name: "extra-q"},
+			deleteErr:    queue.ErrDeletePreconditionFailed,
+			expectDelete: true,
+			expectReason: "provider refused deletion: queue is not empty or in use",
+		},
+		{
+			name:          "empty unused queue is deleted",
+			status:        queue.QueueStatus{Name: "extra-q"},
+			expectDelete:  true,
+			expectDeleted: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockProvider := new(MockProvider)
+			repo, mockDB := createMockRepository(t)
+			expectEmptyTopology(mockDB)
+
+			mockProvider.On("ListExchanges").Return([]string{}, nil)
+			mockProvider.On("ListQueues").Return([]string{"extra-q"}, nil)
+			mockProvider.On("ListBindings", "extra-q").Return([][3]string{}, nil)
+			mockProvider.On("InspectQueue", "extra-q").Return(tt.status, nil)
+			if tt.expectDelete {
+				mockProvider.On("DeleteQueueIf", "extra-q", true, true).Return(tt.deleteErr)
+			}
+
+			result, err := ReconcileTopologyWithOptions(mockProvider, repo, Options{Guards: allowEmpty})
+			require.NoError(t, err)
+			assert.Len(t, result.DeletedQueues, tt.expectDeleted)
+			if tt.expectReason != "" {
+				require.Len(t, result.PendingDeletions, 1)
+				assert.Equal(t, PendingDeletion{Kind: "queue", Name: "extra-q", Reason: tt.expectReason}, result.PendingDeletions[0])
+			} else {
+				assert.Empty(t, result.PendingDeletions)
+			}
+			assert.Empty(t, result.Errors)
+			mockProvider.AssertNotCalled(t, "DeleteQueue", "extra-q")
+			mockProvider.AssertExpectations(t)
+			require.NoError(t, mockDB.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestReconcileTopology_ForceDelete(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	expectEmptyTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{}, nil)
+	mockProvider.On("ListQueues").Return([]string{"extra-q"}, nil)
+	mockProvider.On("ListBindings", "extra-q").Return([][3]string{}, nil)
+	mockProvider.On("DeleteQueue", "extra-q").Return(nil)
+
+	result, err := ReconcileTopologyWithOptions(mockProvider, repo, Options{ForceDelete: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extra-q"}, result.DeletedQueues)
+	assert.Empty(t, result.PendingDeletions)
+	mockProvider.AssertNotCalled(t, "InspectQueue", "extra-q")
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconcileTopology_DryRunReportsPendingDeletion(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	expectEmptyTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{}, nil)
+	mockProvider.On("ListQueues").Return([]string{"busy-q", "idle-q"}, nil)
+	mockProvider.On("ListBindings", "busy-q").Return([][3]string{}, nil)
+	mockProvider.On("ListBindings", "idle-q").Return([][3]string{}, nil)
+	mockProvider.On("InspectQueue", "busy-q").Return(queue.QueueStatus{Name: "busy-q", Messages: 3}, nil)
+	mockProvider.On("InspectQueue", "idle-q").Return(queue.QueueStatus{Name: "idle-q"}, nil)
+
+	result, err := ReconcileTopologyWithOptions(mockProvider, repo, Options{DryRun: true, Guards: allowEmpty})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"idle-q"}, result.DeletedQueues)
+	require.Len(t, result.PendingDeletions, 1)
+	assert.Equal(t, "busy-q", result.PendingDeletions[0].Name)
+	mockProvider.AssertNotCalled(t, "DeleteQueueIf", "idle-q", true, true)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+// expectSingleQueueTopology sets up the database mock to expect only queue q1
+func expectSingleQueueTopology(mockDB sqlmock.Sqlmock) {
+	now := time.Now()
+	mockDB.ExpectQuery(`SELECT.*exchanges`).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"exchange_name", "exchange_type", "durable", "auto_delete", "internal",
+		"arguments", "description",
+	}))
+	mockDB.ExpectQuery(`SELECT.*queues`).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"queue_name", "durable", "auto_delete", "arguments", "description",
+	}).AddRow(1, "uuid1", now, now, nil, `{}`, "q1", true, false, `{}`, "Queue 1"))
+	mockDB.ExpectQuery(`SELECT.*bindings`).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"exchange_name", "queue_name", "routing_key", "arguments", "mandatory",
+	}))
+	expectNoAssignments(mockDB)
+}
+
+// expectNoAssignments sets up the database mock to expect the service assignments query, which
+// returns no rows
+func expectNoAssignments(mockDB sqlmock.Sqlmock) {
+	mockDB.ExpectQuery(`SELECT.*service_assignments`).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"service_name", "queue_name", "prefetch_count", "max_inflight", "notes",
+	}))
+}
+
+func TestReconcileTopology_ShrinkGuard(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	expectSingleQueueTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1", "q2"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+	mockProvider.On("ListBindings", "q2").Return([][3]string{}, nil)
+
+	// 10 resources last time, 1 now: a 90% shrink exceeds the 50% limit
+	result, err := ReconcileTopologyWithOptions(mockProvider, repo, Options{
+		Guards:           Guards{MaxShrinkPercent: 50},
+		PreviousExpected: 10,
+	})
+	require.ErrorIs(t, err, ErrPruningAborted)
+	assert.Contains(t, result.AbortReason, "shrank by 90%")
+	require.Len(t, result.PendingDeletions, 1)
+	assert.Equal(t, "q2", result.PendingDeletions[0].Name)
+	mockProvider.AssertNotCalled(t, "InspectQueue", "q2")
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconcileTopology_DeletionCap(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	expectSingleQueueTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{"extra-ex1", "extra-ex2"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+	mockProvider.On("DeleteExchange", "extra-ex1").Return(nil)
+
+	result, err := ReconcileTopologyWithOptions(mockProvider, repo, Options{Guards: Guards{MaxDeletionsPerRun: 1}})
+	require.NoError(t, err) // A capped run is not an aborted run
+	assert.False(t, result.PruningAborted)
+	assert.Equal(t, []string{"extra-ex1"}, result.DeletedExchanges)
+	require.Len(t, result.PendingDeletions, 1)
+	assert.Equal(t, PendingDeletion{Kind: "exchange", Name: "extra-ex2", Reason: "deletion limit of 1 per run reached"}, result.PendingDeletions[0])
+	mockProvider.AssertNotCalled(t, "DeleteExchange", "extra-ex2")
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconciler_ShrinkBaseline(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{MaxShrinkPercent: 50}, GracePolicy{})
+
+	// First run establishes the baseline (one queue)
+	expectSingleQueueTopology(mockDB)
+	mockProvider.On("ListExchanges").Return([]string{}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil).Once()
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+	_, err := rec.Reconcile(context.Background(), Request{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, rec.lastExpected)
+
+	// Second run with an empty expectation is aborted and keeps the baseline
+	expectEmptyTopology(mockDB)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil).Once()
+	result, err := rec.Reconcile(context.Background(), Request{})
+	require.ErrorIs(t, err, ErrPruningAborted)
+	assert.Len(t, result.PendingDeletions, 1)
+	assert.Equal(t, 1, rec.lastExpected)
+
+	// A forced run bypasses the guards and resets the baseline
+	expectEmptyTopology(mockDB)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil).Once()
+	mockProvider.On("DeleteQueue", "q1").Return(nil)
+	result, err = rec.Reconcile(context.Background(), Request{Force: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"q1"}, result.DeletedQueues)
+	assert.Equal(t, 0, rec.lastExpected)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func expectTombstones(mockDB sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mockDB.ExpectQuery(`SELECT 'exchange' AS kind`).WillReturnRows(rows)
+}
+
+func TestReconcileTopology_GracePeriodTombstones(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	expectSingleQueueTopology(mockDB)
+	now := time.Now()
+	expectTombstones(mockDB, sqlmock.NewRows([]string{"kind", "exchange_name", "queue_name", "routing_key", "deleted_at"}).
+		AddRow("exchange", "old-ex", "", "", now.Add(-2*time.Hour)).
+		AddRow("exchange", "recent-ex", "", "", now.Add(-10*time.Minute)))
+
+	mockProvider.On("ListExchanges").Return([]string{"old-ex", "recent-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+	mockProvider.On("DeleteExchange", "old-ex").Return(nil)
+
+	result, err := ReconcileTopologyWithOptions(mockProvider, repo, Options{Grace: GracePolicy{Period: time.Hour}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old-ex"}, result.DeletedExchanges)
+	require.Len(t, result.ScheduledDeletions, 1)
+	scheduled := result.ScheduledDeletions[0]
+	assert.Equal(t, "exchange", scheduled.Kind)
+	assert.Equal(t, "recent-ex", scheduled.Name)
+	require.NotNil(t, scheduled.Deadline)
+	assert.WithinDuration(t, now.Add(50*time.Minute), *scheduled.Deadline, time.Second)
+	assert.Equal(t, 1, result.Summary()["scheduledDeletions"])
+	mockProvider.AssertNotCalled(t, "DeleteExchange", "recent-ex")
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconcileTopology_GracePeriodForceDelete(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	expectSingleQueueTopology(mockDB) // No tombstone query: force ignores the grace period
+
+	mockProvider.On("ListExchanges").Return([]string{"extra-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+	mockProvider.On("DeleteExchange", "extra-ex").Return(nil)
+
+	result, err := ReconcileTopologyWithOptions(mockProvider, repo, Options{
+		ForceDelete: true,
+		Grace:       GracePolicy{Period: time.Hour, Runs: 3},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extra-ex"}, result.DeletedExchanges)
+	assert.Empty(t, result.ScheduledDeletions)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconcileTopology_TombstoneLoadError(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	expectSingleQueueTopology(mockDB)
+	mockDB.ExpectQuery(`SELECT 'exchange' AS kind`).WillReturnError(errors.New("database error"))
+
+	mockProvider.On("ListExchanges").Return([]string{"extra-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+
+	_, err := ReconcileTopologyWithOptions(mockProvider, repo, Options{Grace: GracePolicy{Period: time.Hour}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load soft-deleted resources")
+	mockProvider.AssertNotCalled(t, "DeleteExchange", "extra-ex")
+}
+
+func TestReconciler_GraceRuns(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{Runs: 2})
+	noTombstones := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"kind", "exchange_name", "queue_name", "routing_key", "deleted_at"})
+	}
+
+	mockProvider.On("ListExchanges").Return([]string{"extra-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+
+	// A dry run does not advance the counter
+	expectSingleQueueTopology(mockDB)
+	expectTombstones(mockDB, noTombstones())
+	result, err := rec.Reconcile(context.Background(), Request{DryRun: true})
+	require.NoError(t, err)
+	require.Len(t, result.ScheduledDeletions, 1)
+	assert.Equal(t, 1, result.ScheduledDeletions[0].RunsRemaining)
+
+	// First real run schedules the deletion
+	expectSingleQueueTopology(mockDB)
+	expectTombstones(mockDB, noTombstones())
+	result, err = rec.Reconcile(context.Background(), Request{})
+	require.NoError(t, err)
+	require.Len(t, result.ScheduledDeletions, 1)
+	assert.Equal(t, "unexpected for 1 of 2 consecutive runs", result.ScheduledDeletions[0].Reason)
+	assert.Nil(t, result.ScheduledDeletions[0].Deadline)
+	mockProvider.AssertNotCalled(t, "DeleteExchange", "extra-ex")
+
+	// Second consecutive run deletes it
+	expectSingleQueueTopology(mockDB)
+	expectTombstones(mockDB, noTombstones())
+	mockProvider.On("DeleteExchange", "extra-ex").Return(nil)
+	result, err = rec.Reconcile(context.Background(), Request{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extra-ex"}, result.DeletedExchanges)
+	assert.Empty(t, result.ScheduledDeletions)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconciler_GracePeriodWithoutTombstone(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{Period: time.Hour})
+	noTombstones := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"kind", "exchange_name", "queue_name", "routing_key", "deleted_at"})
+	}
+
+	mockProvider.On("ListExchanges").Return([]string{"extra-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+
+	// A resource without a soft-deleted row is kept for the period from the first run that saw it
+	expectSingleQueueTopology(mockDB)
+	expectTombstones(mockDB, noTombstones())
+	now := time.Now()
+	result, err := rec.Reconcile(context.Background(), Request{})
+	require.NoError(t, err)
+	require.Len(t, result.ScheduledDeletions, 1)
+	require.NotNil(t, result.ScheduledDeletions[0].Deadline)
+	assert.WithinDuration(t, now.Add(time.Hour), *result.ScheduledDeletions[0].Deadline, time.Second)
+	assert.Contains(t, result.ScheduledDeletions[0].Reason, "unexpected since")
+	mockProvider.AssertNotCalled(t, "DeleteExchange", "extra-ex")
+
+	// Later runs keep measuring from the first one
+	first := *result.ScheduledDeletions[0].Deadline
+	expectSingleQueueTopology(mockDB)
+	expectTombstones(mockDB, noTombstones())
+	result, err = rec.Reconcile(context.Background(), Request{})
+	require.NoError(t, err)
+	require.Len(t, result.ScheduledDeletions, 1)
+	assert.Equal(t, first, *result.ScheduledDeletions[0].Deadline)
+
+	// Once the period has elapsed it is deleted
+	rec.unexpectedSince[resourceKey("exchange", "extra-ex")] = now.Add(-2 * time.Hour)
+	expectSingleQueueTopology(mockDB)
+	expectTombstones(mockDB, noTombstones())
+	mockProvider.On("DeleteExchange", "extra-ex").Return(nil)
+	result, err = rec.Reconcile(context.Background(), Request{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extra-ex"}, result.DeletedExchanges)
+	assert.Empty(t, result.ScheduledDeletions)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+// expectBoundQueueTopology sets up the database mock to expect exchange ex1 bound to queue q1 with key k1
+func expectBoundQueueTopology(mockDB sqlmock.Sqlmock) {
+	now := time.Now()
+	mockDB.ExpectQuery(`SELECT.*exchanges`).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"exchange_name", "exchange_type", "durable", "auto_delete", "internal",
+		"arguments", "description",
+	}).AddRow(1, "uuid1", now, now, nil, `{}`, "ex1", "topic", true, false, false, `{}`, "Exchange 1"))
+	mockDB.ExpectQuery(`SELECT.*queues`).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"queue_name", "durable", "auto_delete", "arguments", "description",
+	}).AddRow(1, "uuid1", now, now, nil, `{}`, "q1", true, false, `{}`, "Queue 1"))
+	mockDB.ExpectQuery(`SELECT.*bindings`).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+		"exchange_name", "queue_name", "routing_key", "arguments", "mandatory",
+	}).AddRow(1, "uuid1", now, now, nil, `{}`, "ex1", "q1", "k1", `{}`, false))
+	expectNoAssignments(mockDB)
+}
+
+func TestBuildPlan_OrderedActions(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	expectBoundQueueTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{"old-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1", "old-q"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{{"q1", "old-ex", "stale"}}, nil)
+	mockProvider.On("ListBindings", "old-q").Return([][3]string{}, nil)
+	mockProvider.On("InspectQueue", "old-q").Return(queue.QueueStatus{Name: "old-q"}, nil)
+
+	plan, err := BuildPlan(mockProvider, repo, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []Action{
+		{Type: ActionCreate, Kind: "exchange", Name: "ex1", ExchangeType: "topic"},
+		{Type: ActionCreate, Kind: "binding", Name: "ex1 -> q1 (k1)", Queue: "q1", Exchange: "ex1", RoutingKey: "k1"},
+		{Type: ActionDelete, Kind: "binding", Name: "old-ex -> q1 (stale)", Queue: "q1", Exchange: "old-ex", RoutingKey: "stale"},
+		{Type: ActionDelete, Kind: "queue", Name: "old-q"},
+		{Type: ActionDelete, Kind: "exchange", Name: "old-ex"},
+	}, plan.Actions)
+	assert.Len(t, plan.ExpectedHash, 64)
+	assert.Len(t, plan.ActualHash, 64)
+	assert.Equal(t, 1, plan.Summary()["bindingsToDelete"])
+	// Planning never changes the provider
+	mockProvider.AssertNotCalled(t, "DeclareExchange", "ex1", "topic", true)
+	mockProvider.AssertNotCalled(t, "DeleteQueueIf", "old-q", true, true)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestPlanStore_EvictsPlanAfterApply(t *testing.T) {
+	store := newPlanStore()
+	first := &Plan{}
+	store.add(first)
+	_, err := store.claim(first.ID)
+	require.NoError(t, err)
+
+	// The plan being applied outlives its eviction until its claim is released
+	for i := 0; i < maxStoredPlans; i++ {
+		store.add(&Plan{})
+	}
+	assert.Len(t, store.order, maxStoredPlans)
+	assert.Len(t, store.plans, maxStoredPlans+1)
+
+	store.release(first.ID, true, time.Now())
+	assert.Len(t, store.plans, maxStoredPlans)
+	_, ok := store.get(first.ID)
+	assert.False(t, ok)
+}
+
+func TestReconciler_PlanAndApply(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+
+	mockProvider.On("ListExchanges").Return([]string{"ex1"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+
+	// A dry run stores its plan
+	expectBoundQueueTopology(mockDB)
+	preview, err := rec.Reconcile(context.Background(), Request{DryRun: true})
+	require.NoError(t, err)
+	require.NotEmpty(t, preview.PlanID)
+	assert.Equal(t, [][3]string{{"q1", "ex1", "k1"}}, preview.CreatedBindings)
+
+	plan, ok := rec.GetPlan(preview.PlanID)
+	require.True(t, ok)
+	assert.Nil(t, plan.AppliedAt)
+
+	// Applying re-reads the state, verifies the hashes and runs the stored actions
+	expectBoundQueueTopology(mockDB)
+	mockProvider.On("BindQueue", "q1", "ex1", "k1").Return(nil).Once()
+	result, err := rec.Apply(context.Background(), preview.PlanID, Trigger{})
+	require.NoError(t, err)
+	assert.Equal(t, preview.PlanID, result.PlanID)
+	assert.Equal(t, [][3]string{{"q1", "ex1", "k1"}}, result.CreatedBindings)
+
+	plan, _ = rec.GetPlan(preview.PlanID)
+	assert.NotNil(t, plan.AppliedAt)
+
+	// A plan can only be applied once
+	_, err = rec.Apply(context.Background(), preview.PlanID, Trigger{})
+	require.ErrorIs(t, err, ErrPlanAlreadyApplied)
+
+	_, err = rec.Apply(context.Background(), "unknown", Trigger{})
+	require.ErrorIs(t, err, ErrPlanNotFound)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconciler_ApplyStalePlan(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+
+	mockProvider.On("ListExchanges").Return([]string{"ex1"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil).Once()
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+
+	expectBoundQueueTopology(mockDB)
+	plan, err := rec.Plan(context.Background(), false)
+	require.NoError(t, err)
+
+	// A queue appeared on the broker since the plan was reviewed
+	expectBoundQueueTopology(mockDB)
+	mockProvider.On("ListQueues").Return([]string{"q1", "new-q"}, nil).Once()
+	mockProvider.On("ListBindings", "new-q").Return([][3]string{}, nil)
+	_, err = rec.Apply(context.Background(), plan.ID, Trigger{})
+	require.ErrorIs(t, err, ErrPlanStale)
+	assert.Contains(t, err.Error(), "provider state changed")
+	mockProvider.AssertNotCalled(t, "BindQueue", "q1", "ex1", "k1")
+
+	// A stale plan is left unapplied
+	stored, ok := rec.GetPlan(plan.ID)
+	require.True(t, ok)
+	assert.Nil(t, stored.AppliedAt)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+// recordingHistory captures recorded runs in memory
+type recordingHistory struct {
+	runs    []models.ReconciliationRun
+	actions [][]models.ReconciliationAction
+}
+
+func (h *recordingHistory) InsertReconciliationRun(run models.ReconciliationRun, actions []models.ReconciliationAction) error {
+	h.runs = append(h.runs, run)
+	h.actions = append(h.actions, actions)
+	return nil
+}
+
+func TestReconciler_RecordsRunHistory(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	history := &recordingHistory{}
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+	rec.SetHistory(history)
+	expectSingleQueueTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{"old-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{}, nil)
+	mockProvider.On("DeclareQueue", "q1", true).Return(nil)
+	mockProvider.On("DeleteExchange", "old-ex").Return(errors.New("access refused"))
+
+	result, err := rec.Reconcile(context.Background(), Request{Trigger: Trigger{Source: TriggerSync, RequestID: "req-42"}})
+	require.NoError(t, err)
+	require.NotEmpty(t, result.RunID)
+
+	require.Len(t, history.runs, 1)
+	run := history.runs[0]
+	assert.Equal(t, result.RunID, run.UUID)
+	assert.Equal(t, TriggerSync, run.Trigger)
+	assert.Equal(t, "req-42", run.RequestID)
+	assert.Equal(t, RunPartial, run.Status)
+	assert.False(t, run.FinishedAt.Before(run.StartedAt))
+	assert.Equal(t, 1, run.Summary["queuesCreated"])
+	assert.Equal(t, []models.ReconciliationAction{
+		{Action: "create", ResourceKind: "queue", ResourceName: "q1", Detail: "missing on provider"},
+		{Action: "error", ResourceKind: "exchange", ResourceName: "old-ex", Detail: "failed to delete exchange old-ex: access refused"},
+	}, history.actions[0])
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+// recordingObserver captures the runs and drift reported to the observer
+type recordingObserver struct {
+	runs  []models.ReconciliationRun
+	drift []DriftReport
+}
+
+func (o *recordingObserver) RunFinished(_ context.Context, run models.ReconciliationRun, _ []models.ReconciliationAction) {
+	o.runs = append(o.runs, run)
+}
+
+func (o *recordingObserver) DriftObserved(_ context.Context, drift DriftReport) {
+	o.drift = append(o.drift, drift)
+}
+
+func TestReconciler_NotifiesObserver(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	observer := &recordingObserver{}
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+	rec.AddObserver(observer)
+	expectSingleQueueTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{"old-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{}, nil)
+	mockProvider.On("DeclareQueue", "q1", true).Return(nil)
+	mockProvider.On("DeleteExchange", "old-ex").Return(errors.New("access refused"))
+
+	result, err := rec.Reconcile(context.Background(), Request{Trigger: Trigger{Source: TriggerCron}})
+	require.NoError(t, err)
+
+	require.Len(t, observer.runs, 1)
+	assert.Equal(t, result.RunID, observer.runs[0].UUID)
+	assert.Equal(t, RunPartial, observer.runs[0].Status)
+	// Only the exchange that could not be deleted is left over
+	require.Len(t, observer.drift, 1)
+	assert.Empty(t, observer.drift[0].Missing)
+	assert.Equal(t, []DriftResource{{Kind: "exchange", Name: "old-ex"}}, observer.drift[0].Unexpected)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconciler_Traces(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+	expectSingleQueueTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{"old-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{}, nil)
+	mockProvider.On("DeclareQueue", "q1", true).Return(nil)
+	mockProvider.On("DeleteExchange", "old-ex").Return(errors.New("access refused"))
+
+	result, err := rec.Reconcile(context.Background(), Request{Trigger: Trigger{Source: TriggerSync, RequestID: "req-42"}})
+	require.NoError(t, err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	run := spans["reconciliation.run"]
+	require.NotNil(t, run)
+	assert.Contains(t, run.Attributes(), attribute.String("reconciliation.run_id", result.RunID))
+	assert.Contains(t, run.Attributes(), attribute.String("http.request_id", "req-42"))
+	assert.Contains(t, run.Attributes(), attribute.String("reconciliation.status", RunPartial))
+
+	for _, name := range []string{"reconciliation.load_expected", "reconciliation.load_actual", "reconciliation.plan", "reconciliation.execute"} {
+		require.Contains(t, spans, name)
+		assert.Equal(t, run.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+	}
+	execute := spans["reconciliation.execute"]
+	assert.Equal(t, execute.SpanContext().SpanID(), spans["reconciliation.create queue"].Parent().SpanID())
+	assert.Equal(t, codes.Error, spans["reconciliation.delete exchange"].Status().Code)
+	// Repository queries are children of the phase that ran them
+	assert.Equal(t, spans["reconciliation.load_expected"].SpanContext().SpanID(), spans["repository.ListQueues"].Parent().SpanID())
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconciler_LogsRunFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, slog.LevelInfo, logging.FormatJSON)
+	require.NoError(t, err)
+
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+	rec.SetLogger(logger)
+	expectSingleQueueTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{}, nil)
+	mockProvider.On("ListQueues").Return([]string{}, nil)
+	mockProvider.On("DeclareQueue", "q1", true).Return(nil)
+
+	result, err := rec.Reconcile(context.Background(), Request{Trigger: Trigger{Source: TriggerSync, RequestID: "req-42"}})
+	require.NoError(t, err)
+
+	var created map[string]interface{}
+	for _, raw := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(raw, &line), string(raw))
+		assert.Equal(t, "reconciliation", line[logging.KeyComponent])
+		assert.Equal(t, result.RunID, line[logging.KeyRunID], line["message"])
+		assert.Equal(t, "req-42", line[logging.KeyRequestID], line["message"])
+		if line["message"] == "created queue" {
+			created = line
+		}
+	}
+	require.NotNil(t, created)
+	assert.Equal(t, map[string]interface{}{"kind": "queue", "name": "q1"}, created[logging.KeyResource])
+	mockProvider.AssertExpectations(t)
+}
+
+func TestReconciler_CreateOnly(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	history := &recordingHistory{}
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+	rec.SetHistory(history)
+	expectSingleQueueTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{"old-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{}, nil)
+	mockProvider.On("DeclareQueue", "q1", true).Return(nil)
+
+	result, err := rec.Reconcile(context.Background(), Request{CreateOnly: true, Trigger: Trigger{Source: TriggerStartup}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"q1"}, result.CreatedQueues)
+	assert.Empty(t, result.DeletedExchanges)
+	mockProvider.AssertNotCalled(t, "DeleteExchange", "old-ex")
+	require.Len(t, history.runs, 1)
+	assert.Equal(t, TriggerStartup, history.runs[0].Trigger)
+	assert.Equal(t, RunSucceeded, history.runs[0].Status)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconciler_Scope(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	history := &recordingHistory{}
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+	rec.SetHistory(history)
+	expectBoundQueueTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{"ex1", "old-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"old-q"}, nil)
+	mockProvider.On("ListBindings", "old-q").Return([][3]string{}, nil)
+	mockProvider.On("InspectQueue", "old-q").Return(queue.QueueStatus{Name: "old-q"}, nil).Maybe()
+	mockProvider.On("DeclareQueue", "q1", true).Return(nil)
+	mockProvider.On("BindQueue", "q1", "ex1", "k1").Return(nil)
+
+	result, err := rec.Reconcile(context.Background(), Request{
+		Scope:   &Scope{Queues: []string{"q1"}},
+		Trigger: Trigger{Source: TriggerEvent},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"q1"}, result.CreatedQueues)
+	assert.Equal(t, [][3]string{{"q1", "ex1", "k1"}}, result.CreatedBindings)
+	assert.Empty(t, result.DeletedExchanges)
+	assert.Empty(t, result.DeletedQueues)
+	mockProvider.AssertNotCalled(t, "DeleteExchange", "old-ex")
+	mockProvider.AssertNotCalled(t, "DeleteQueueIf", "old-q", true, true)
+	require.Len(t, history.runs, 1)
+	assert.Equal(t, TriggerEvent, history.runs[0].Trigger)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconciler_ScopeDeletionLimit(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{MaxDeletionsPerRun: 1}, GracePolicy{})
+	expectSingleQueueTopology(mockDB)
+
+	// Unrelated unexpected exchanges sort before the one in scope and exceed the limit
+	mockProvider.On("ListExchanges").Return([]string{"a-ex", "b-ex", "old-ex"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+	mockProvider.On("DeleteExchange", "old-ex").Return(nil)
+
+	result, err := rec.Reconcile(context.Background(), Request{
+		Scope:   &Scope{Exchanges: []string{"old-ex"}},
+		Trigger: Trigger{Source: TriggerEvent},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old-ex"}, result.DeletedExchanges)
+	assert.Empty(t, result.PendingDeletions)
+	mockProvider.AssertNotCalled(t, "DeleteExchange", "a-ex")
+	mockProvider.AssertNotCalled(t, "DeleteExchange", "b-ex")
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestPlanRestrict_HeldBindings(t *testing.T) {
+	// "a -> b" is a valid exchange name, so the scope must not be matched against binding names
+	plan := &Plan{
+		Actions: []Action{bindingAction(ActionDelete, "c", "a -> b", "k")},
+		PendingDeletions: []PendingDeletion{
+			{Kind: "binding", Name: bindingName("a -> b", "c", "k"), Reason: "limit", exchange: "a -> b", queue: "c"},
+			{Kind: "binding", Name: bindingName("a", "c", "k"), Reason: "limit", exchange: "a", queue: "c"},
+		},
+		ScheduledDeletions: []ScheduledDeletion{
+			{Kind: "binding", Name: bindingName("x", "a (k) -> q", "k"), Reason: "grace", exchange: "x", queue: "a (k) -> q"},
+			{Kind: "binding", Name: bindingName("a", "q", "k"), Reason: "grace", exchange: "a", queue: "q"},
+		},
+	}
+	plan.restrict(&Scope{Exchanges: []string{"a"}})
+
+	assert.Empty(t, plan.Actions)
+	require.Len(t, plan.PendingDeletions, 1)
+	assert.Equal(t, "a", plan.PendingDeletions[0].exchange)
+	require.Len(t, plan.ScheduledDeletions, 1)
+	assert.Equal(t, "a", plan.ScheduledDeletions[0].exchange)
+}
+
+// staticSource is a topology source returning fixed definitions
+type staticSource struct {
+	defs bootstrap.Definitions
+	err  error
+}
+
+func (s staticSource) Name() string { return "static" }
+
+func (s staticSource) Load(context.Context) (bootstrap.Definitions, error) { return s.defs, s.err }
+
+func TestReconciler_Source(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+	rec.SetSource(staticSource{defs: bootstrap.Definitions{
+		Exchanges: []models.Exchange{{ExchangeName: "ex1", ExchangeType: "topic"}},
+		Queues:    []models.Queue{{QueueName: "q1"}},
+		Bindings:  []models.Binding{{ExchangeName: "ex1", QueueName: "q1", RoutingKey: "k1"}},
+	}})
+
+	mockProvider.On("ListExchanges").Return([]string{"ex1"}, nil)
+	mockProvider.On("ListQueues").Return([]string{}, nil)
+	mockProvider.On("DeclareQueue", "q1", true).Return(nil)
+	mockProvider.On("BindQueue", "q1", "ex1", "k1").Return(nil)
+
+	// The database is not queried for the expected topology
+	result, err := rec.Reconcile(context.Background(), Request{CreateOnly: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"q1"}, result.CreatedQueues)
+	assert.Equal(t, [][3]string{{"q1", "ex1", "k1"}}, result.CreatedBindings)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+
+	t.Run("a failing source aborts the run", func(t *testing.T) {
+		rec.SetSource(staticSource{err: errors.New("invalid topology files")})
+		_, err := rec.Reconcile(context.Background(), Request{})
+		assert.ErrorContains(t, err, "failed to load expected topology: invalid topology files")
+	})
+}
+
+func TestReconciler_InvalidTopology(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, _ := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+	var buf bytes.Buffer
+	logger, err := logging.New(&buf, slog.LevelInfo, logging.FormatJSON)
+	require.NoError(t, err)
+	rec.SetLogger(logger)
+	rec.SetSource(staticSource{defs: bootstrap.Definitions{
+		Exchanges: []models.Exchange{{ExchangeName: "ex1", ExchangeType: "fanout"}},
+		Queues:    []models.Queue{{QueueName: "q1", Arguments: models.JSONB{"x-message-ttl": "60000"}}},
+		Bindings:  []models.Binding{{ExchangeName: "ex1", QueueName: "q1", RoutingKey: "k1"}},
+	}})
+	mockProvider.On("ListExchanges").Return([]string{}, nil)
+	mockProvider.On("ListQueues").Return([]string{}, nil)
+
+	// Errors block the run before anything is changed; the warning is reported alongside
+	result, err := rec.Reconcile(context.Background(), Request{})
+	require.ErrorIs(t, err, validation.ErrInvalid)
+	assert.ErrorContains(t, err, "queue q1: x-message-ttl must be a non-negative integer")
+	assert.Empty(t, result.CreatedQueues)
+	require.Len(t, result.Findings, 2)
+	assert.Equal(t, validation.CodeInvalidArgument, result.Findings[0].Code)
+	assert.Equal(t, validation.CodeRoutingKeyIgnored, result.Findings[1].Code)
+	mockProvider.AssertNotCalled(t, "DeclareQueue", "q1", true)
+
+	// Errors and warnings are logged apart, warnings at a lower level
+	levels := map[string]string{}
+	for _, raw := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(raw, &line), string(raw))
+		if code, ok := line["code"].(string); ok {
+			levels[code] = line["level"].(string) + " " + line["message"].(string)
+		}
+	}
+	assert.Equal(t, map[string]string{
+		validation.CodeInvalidArgument:   "warn invalid topology",
+		validation.CodeRoutingKeyIgnored: "info topology warning",
+	}, levels)
+
+	t.Run("dry runs preview the plan with its findings", func(t *testing.T) {
+		result, err := rec.Reconcile(context.Background(), Request{DryRun: true})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ex1"}, result.CreatedExchanges)
+		assert.Len(t, result.Findings, 2)
+
+		plan, ok := rec.GetPlan(result.PlanID)
+		require.True(t, ok)
+		_, err = rec.Apply(context.Background(), plan.ID, Trigger{Source: TriggerSync})
+		assert.ErrorIs(t, err, validation.ErrInvalid)
+	})
+}
+
+func TestReconciler_InvalidAssignmentInDatabase(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+	expectInvalidAssignment := func() {
+		now := time.Now()
+		mockDB.ExpectQuery(`SELECT.*exchanges`).WillReturnRows(sqlmock.NewRows([]string{
+			"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+			"exchange_name", "exchange_type", "durable", "auto_delete", "internal",
+			"arguments", "description",
+		}))
+		mockDB.ExpectQuery(`SELECT.*queues`).WillReturnRows(sqlmock.NewRows([]string{
+			"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+			"queue_name", "durable", "auto_delete", "arguments", "description",
+		}).AddRow(1, "uuid1", now, now, nil, `{}`, "q1", true, false, `{}`, "Queue 1"))
+		mockDB.ExpectQuery(`SELECT.*bindings`).WillReturnRows(sqlmock.NewRows([]string{
+			"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+			"exchange_name", "queue_name", "routing_key", "arguments", "mandatory",
+		}))
+		mockDB.ExpectQuery(`SELECT.*service_assignments`).WillReturnRows(sqlmock.NewRows([]string{
+			"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+			"service_name", "queue_name", "prefetch_count", "max_inflight", "notes",
+		}).AddRow(1, "uuid1", now, now, nil, `{}`, "order-service", "q1", 50, 20, ""))
+	}
+	mockProvider.On("ListExchanges").Return([]string{}, nil)
+	mockProvider.On("ListQueues").Return([]string{}, nil)
+
+	// Without a topology source the database is validated with its service assignments
+	expectInvalidAssignment()
+	result, err := rec.Reconcile(context.Background(), Request{})
+	require.ErrorIs(t, err, validation.ErrInvalid)
+	assert.ErrorContains(t, err, "assignment order-service -> q1: prefetch_count 50 exceeds max_inflight 20")
+	assert.Empty(t, result.CreatedQueues)
+	mockProvider.AssertNotCalled(t, "DeclareQueue", "q1", true)
+
+	// Plans of the same topology cannot be applied either
+	expectInvalidAssignment()
+	plan, err := rec.Plan(context.Background(), false)
+	require.NoError(t, err)
+	require.Len(t, plan.Findings, 1)
+	assert.Equal(t, validation.CodePrefetchExceeds, plan.Findings[0].Code)
+
+	expectInvalidAssignment()
+	_, err = rec.Apply(context.Background(), plan.ID, Trigger{Source: TriggerSync})
+	require.ErrorIs(t, err, validation.ErrInvalid)
+	mockProvider.AssertNotCalled(t, "DeclareQueue", "q1", true)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestReconciler_SerializesRuns(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	rec := NewReconciler(mockProvider, repo, Guards{}, GracePolicy{})
+	expectSingleQueueTopology(mockDB)
+
+	entered := make(chan struct{})
+	proceed := make(chan struct{})
+	mockProvider.On("ListExchanges").Run(func(mock.Arguments) {
+		close(entered)
+		<-proceed
+	}).Return([]string{}, nil).Once()
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{}, nil)
+
+	done := make(chan error)
+	go func() {
+		_, err := rec.Reconcile(context.Background(), Request{Trigger: Trigger{Source: TriggerCron}})
+		done <- err
+	}()
+	<-entered
+
+	running, ok := rec.Running()
+	require.True(t, ok)
+	assert.Equal(t, TriggerCron, running.Trigger)
+
+	_, err := rec.TryReconcile(context.Background(), Request{Trigger: Trigger{Source: TriggerSync}})
+	require.ErrorIs(t, err, ErrAlreadyRunning)
+	var alreadyRunning *AlreadyRunningError
+	require.ErrorAs(t, err, &alreadyRunning)
+	assert.Equal(t, running.RunID, alreadyRunning.Running.RunID)
+
+	_, err = rec.Apply(context.Background(), "some-plan", Trigger{Source: TriggerSync})
+	require.ErrorIs(t, err, ErrAlreadyRunning)
+
+	close(proceed)
+	require.NoError(t, <-done)
+	_, ok = rec.Running()
+	assert.False(t, ok)
+	mockProvider.AssertExpectations(t)
+	require.NoError(t, mockDB.ExpectationsWereMet())
+}
+
+func TestCompare(t *testing.T) {
+	expected := ExpectedTopology{
+		Exchanges: []models.Exchange{
+			{ExchangeName: "orders", ExchangeType: "topic", Durable: true},
+			{ExchangeName: "payments", ExchangeType: "direct", Durable: true},
+		},
+		Queues: []models.Queue{
+			{QueueName: "q.orders", Durable: true, Arguments: models.JSONB{"x-message-ttl": 60000}},
+			{QueueName: "q.payments", Durable: true},
+			{QueueName: "q.audit", Durable: true},
+		},
+		Bindings: []models.Binding{
+			{ExchangeName: "orders", QueueName: "q.orders", RoutingKey: "order.*"},
+			{ExchangeName: "orders", QueueName: "q.audit", RoutingKey: "#"},
+			{ExchangeName: "payments", QueueName: "q.payments", RoutingKey: "payment"},
+		},
+	}
+	actual := queue.Topology{
+		Detailed: true,
+		Exchanges: []queue.ExchangeInfo{
+			{Name: "orders", Type: "fanout", Durable: true},
+			{Name: "legacy", Type: "direct"},
+		},
+		Queues: []queue.QueueInfo{
+			{Name: "q.orders", Durable: true, Arguments: map[string]interface{}{"x-message-ttl": float64(60000)}},
+			{Name: "q.audit", Durable: false},
+			{Name: "q.legacy"},
+		},
+		Bindings: []queue.BindingInfo{
+			{Exchange: "orders", Queue: "q.orders", RoutingKey: "order.#"},
+			{Exchange: "orders", Queue: "q.audit", RoutingKey: "#"},
+			{Exchange: "legacy", Queue: "q.legacy", RoutingKey: "x"},
+		},
+	}
+
+	d := Compare(expected, actual)
+	assert.Equal(t, []string{"payments"}, d.Missing.Exchanges)
+	assert.Equal(t, []string{"q.payments"}, d.Missing.Queues)
+	assert.Equal(t, []BindingRef{{Exchange: "payments", Queue: "q.payments", RoutingKey: "payment"}}, d.Missing.Bindings)
+	assert.Equal(t, []string{"legacy"}, d.Unexpected.Exchanges)
+	assert.Equal(t, []string{"q.legacy"}, d.Unexpected.Queues)
+	assert.Equal(t, []BindingRef{{Exchange: "legacy", Queue: "q.legacy", RoutingKey: "x"}}, d.Unexpected.Bindings)
+
+	// The number type of arguments does not matter
+	assert.Equal(t, []string{"q.orders"}, d.Healthy.Queues)
+	assert.Equal(t, []BindingRef{{Exchange: "orders", Queue: "q.audit", RoutingKey: "#"}}, d.Healthy.Bindings)
+
+	require.Len(t, d.Mismatched.Exchanges, 1)
+	assert.Equal(t, []FieldDiff{{Field: "type", Expected: "topic", Actual: "fanout"}}, d.Mismatched.Exchanges[0].Fields)
+	require.Len(t, d.Mismatched.Queues, 1)
+	assert.Equal(t, "q.audit", d.Mismatched.Queues[0].Name)
+	assert.Equal(t, []FieldDiff{{Field: "durable", Expected: true, Actual: false}}, d.Mismatched.Queues[0].Fields)
+	require.Len(t, d.Mismatched.Bindings, 1)
+	assert.Equal(t, "order.*", d.Mismatched.Bindings[0].Expected.RoutingKey)
+	assert.Equal(t, "order.#", d.Mismatched.Bindings[0].Actual.RoutingKey)
+
+	assert.Equal(t, map[string]int{"missing": 3, "unexpected": 3, "mismatched": 3, "healthy": 2}, d.Summary())
+	assert.False(t, d.InSync())
+
+	// Without properties only existence and reported exchange types are compared
+	actual.Detailed = false
+	d = Compare(expected, actual)
+	assert.Equal(t, []string{"q.audit", "q.orders"}, d.Healthy.Queues)
+	assert.Len(t, d.Mismatched.Exchanges, 1)
+}
+
+func TestScopeActual(t *testing.T) {
+	actual := queue.Topology{
+		Exchanges: []queue.ExchangeInfo{{Name: "orders"}, {Name: "audit"}, {Name: "legacy"}},
+		Queues:    []queue.QueueInfo{{Name: "q.orders"}, {Name: "q.audit"}, {Name: "q.legacy"}},
+		Bindings: []queue.BindingInfo{
+			{Exchange: "orders", Queue: "q.orders", RoutingKey: "order.*"},
+			{Exchange: "audit", Queue: "q.orders", RoutingKey: "#"},
+			{Exchange: "orders", Queue: "q.audit", RoutingKey: "#"},
+			{Exchange: "legacy", Queue: "q.legacy", RoutingKey: "x"},
+		},
+	}
+	names := func(t queue.Topology) (exchanges, queues []string) {
+		for _, x := range t.Exchanges {
+			exchanges = append(exchanges, x.Name)
+		}
+		for _, q := range t.Queues {
+			queues = append(queues, q.Name)
+		}
+		return exchanges, queues
+	}
+
+	// The expected binding to "payments" is gone live, but the exchange itself is still compared
+	expected := ExpectedTopology{
+		Exchanges: []models.Exchange{{ExchangeName: "orders"}, {ExchangeName: "legacy"}},
+		Queues:    []models.Queue{{QueueName: "q.orders"}},
+		Bindings:  []models.Binding{{ExchangeName: "orders", QueueName: "q.orders", RoutingKey: "order.*"}},
+	}
+	scoped := ScopeActual(actual, expected, repository.TopologyFilter{Queue: "q.orders"})
+	exchanges, queues := names(scoped)
+	assert.ElementsMatch(t, []string{"orders", "audit", "legacy"}, exchanges)
+	assert.Equal(t, []string{"q.orders"}, queues)
+	assert.Len(t, scoped.Bindings, 2)
+
+	// Live queues cannot be attributed to a service: only the service's queues are kept
+	scoped = ScopeActual(actual, expected, repository.TopologyFilter{Service: "orders-api"})
+	exchanges, queues = names(scoped)
+	assert.ElementsMatch(t, []string{"orders", "audit", "legacy"}, exchanges)
+	assert.Equal(t, []string{"q.orders"}, queues)
+
+	scoped = ScopeActual(actual, ExpectedTopology{}, repository.TopologyFilter{Exchange: "orders"})
+	exchanges, queues = names(scoped)
+	assert.Equal(t, []string{"orders"}, exchanges)
+	assert.Equal(t, []string{"q.orders", "q.audit"}, queues)
+	assert.Len(t, scoped.Bindings, 2)
+
+	assert.Equal(t, actual, ScopeActual(actual, expected, repository.TopologyFilter{}))
+}
+
+func TestBuildPlan_ReplacesBindingWithOtherRoutingKey(t *testing.T) {
+	mockProvider := new(MockProvider)
+	repo, mockDB := createMockRepository(t)
+	expectBoundQueueTopology(mockDB)
+
+	mockProvider.On("ListExchanges").Return([]string{"ex1"}, nil)
+	mockProvider.On("ListQueues").Return([]string{"q1"}, nil)
+	mockProvider.On("ListBindings", "q1").Return([][3]string{{"q1", "ex1", "k2"}}, nil)
+
+	plan, err := BuildPlan(mockProvider, repo, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []Action{
+		bindingAction(ActionCreate, "q1", "ex1", "k1"),
+		bindingAction(ActionDelete, "q1", "ex1", "k2"),
+	}, plan.Actions)
+	mockProvider.AssertExpectations(t)
+}
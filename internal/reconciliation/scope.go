@@ -0,0 +1,89 @@
+package reconciliation
+
+// Scope limits a reconciliation run to the given exchanges and queues. Bindings are in scope
+// when their exchange or their queue is. A nil scope covers the whole topology.
+type Scope struct {
+	Exchanges []string `json:"exchanges,omitempty"`
+	Queues    []string `json:"queues,omitempty"`
+}
+
+// Empty reports whether the scope names no resources
+func (s *Scope) Empty() bool {
+	return s == nil || (len(s.Exchanges) == 0 && len(s.Queues) == 0)
+}
+
+// Merge adds the resources of other to the scope, skipping duplicates
+func (s *Scope) Merge(other Scope) {
+	s.Exchanges = appendUnique(s.Exchanges, other.Exchanges...)
+	s.Queues = appendUnique(s.Queues, other.Queues...)
+}
+
+// covers reports whether an action touches a resource in scope
+func (s *Scope) covers(a Action) bool {
+	return s.coversResource(a.Kind, a.Name, a.Exchange, a.Queue)
+}
+
+// coversResource reports whether a resource is in scope. exchange and queue are the ends of a
+// binding and are ignored for other kinds.
+func (s *Scope) coversResource(kind, name, exchange, queue string) bool {
+	if s == nil {
+		return true
+	}
+	switch kind {
+	case "exchange":
+		return contains(s.Exchanges, name)
+	case "queue":
+		return contains(s.Queues, name)
+	case "binding":
+		return contains(s.Exchanges, exchange) || contains(s.Queues, queue)
+	}
+	return false
+}
+
+// restrict drops every action and held-back deletion outside the scope
+func (p *Plan) restrict(s *Scope) {
+	if s == nil {
+		return
+	}
+	actions := []Action{}
+	for _, a := range p.Actions {
+		if s.covers(a) {
+			actions = append(actions, a)
+		}
+	}
+	p.Actions = actions
+
+	pending := []PendingDeletion{}
+	for _, d := range p.PendingDeletions {
+		if s.coversResource(d.Kind, d.Name, d.exchange, d.queue) {
+			pending = append(pending, d)
+		}
+	}
+	p.PendingDeletions = pending
+
+	scheduled := []ScheduledDeletion{}
+	for _, d := range p.ScheduledDeletions {
+		if s.coversResource(d.Kind, d.Name, d.exchange, d.queue) {
+			scheduled = append(scheduled, d)
+		}
+	}
+	p.ScheduledDeletions = scheduled
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if v != "" && !contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,40 @@
+package reconciliation
+
+import (
+	"context"
+	"errors"
+
+	"queue-manager/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startRun starts the root span of a run. The phases (load_expected, load_actual, plan,
+// execute) and every executed action become its children.
+func startRun(ctx context.Context, runID string, trigger Trigger, dryRun bool, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("reconciliation.run_id", runID),
+		attribute.String("reconciliation.trigger", trigger.Source),
+		attribute.Bool("reconciliation.dry_run", dryRun),
+	)
+	if trigger.RequestID != "" {
+		attrs = append(attrs, tracing.RequestIDKey.String(trigger.RequestID))
+	}
+	return tracing.Start(ctx, "reconciliation.run", attrs...)
+}
+
+// endRun records the run's status and ends its span. An aborted pruning is not a failure of
+// the run, so it does not mark the span as an error.
+func endRun(span trace.Span, result *ReconciliationResult, err error) {
+	if result != nil {
+		span.SetAttributes(
+			attribute.String("reconciliation.status", runStatus(result, err)),
+			attribute.Int("reconciliation.errors", len(result.Errors)),
+		)
+	}
+	if errors.Is(err, ErrPruningAborted) {
+		err = nil
+	}
+	tracing.End(span, err)
+}
@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"queue-manager/internal/models"
+)
+
+// TopologyFilter narrows down the expected topology returned by the Find methods. Filters
+// combine with AND and follow the relations between resources: filtering by queue also returns
+// the exchanges bound to it, filtering by exchange also returns the queues bound to it, and
+// filtering by service returns the queues assigned to it with their bindings and exchanges.
+type TopologyFilter struct {
+	Service  string
+	Queue    string
+	Exchange string
+}
+
+// Page selects part of a sorted list. A zero Limit returns all remaining items.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// sqlFilter collects WHERE conditions and their positional arguments
+type sqlFilter struct {
+	conditions []string
+	args       []interface{}
+}
+
+// param adds an argument and returns its placeholder
+func (f *sqlFilter) param(v interface{}) string {
+	f.args = append(f.args, v)
+	return fmt.Sprintf("$%d", len(f.args))
+}
+
+func (f *sqlFilter) where(condition string) {
+	f.conditions = append(f.conditions, condition)
+}
+
+func (f *sqlFilter) clause() string {
+	return "WHERE " + strings.Join(f.conditions, " AND ")
+}
+
+// assignedTo matches queues (by the name in column col) assigned to a service
+func assignedTo(col, service string) string {
+	return fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM queue_manager.service_assignments sa
+			WHERE sa.queue_name = %s AND sa.service_name = %s AND sa.deleted_at IS NULL
+		)`, col, service)
+}
+
+// boundTo matches queues (by the name in column col) bound to an exchange
+func boundTo(col, exchange string) string {
+	return fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM queue_manager.bindings bq
+			WHERE bq.queue_name = %s AND bq.exchange_name = %s AND bq.deleted_at IS NULL
+		)`, col, exchange)
+}
+
+// FindQueues returns a page of the active queues matching the filter, and the number of matches
+func (r *Repository) FindQueues(filter TopologyFilter, page Page) ([]models.Queue, int, error) {
+	f := &sqlFilter{}
+	f.where("q.deleted_at IS NULL")
+	if filter.Queue != "" {
+		f.where("q.queue_name = " + f.param(filter.Queue))
+	}
+	if filter.Service != "" {
+		f.where(assignedTo("q.queue_name", f.param(filter.Service)))
+	}
+	if filter.Exchange != "" {
+		f.where(boundTo("q.queue_name", f.param(filter.Exchange)))
+	}
+
+	return findPage(r, "FindQueues", `
+		SELECT q.id, q.uuid, q.created_at, q.updated_at, q.deleted_at, q.meta,
+		       q.queue_name, q.durable, q.auto_delete, q.arguments, COALESCE(q.description, '')
+		FROM queue_manager.queues q
+	`, "FROM queue_manager.queues q", f, "q.queue_name", page, scanQueue)
+}
+
+// FindExchanges returns a page of the active exchanges matching the filter, and the number of
+// matches. Filtering by queue or service returns the exchanges bound to the matching queues.
+func (r *Repository) FindExchanges(filter TopologyFilter, page Page) ([]models.Exchange, int, error) {
+	f := &sqlFilter{}
+	f.where("x.deleted_at IS NULL")
+	if filter.Exchange != "" {
+		f.where("x.exchange_name = " + f.param(filter.Exchange))
+	}
+	if filter.Queue != "" || filter.Service != "" {
+		bound := []string{"b.exchange_name = x.exchange_name", "b.deleted_at IS NULL"}
+		if filter.Queue != "" {
+			bound = append(bound, "b.queue_name = "+f.param(filter.Queue))
+		}
+		if filter.Service != "" {
+			bound = append(bound, assignedTo("b.queue_name", f.param(filter.Service)))
+		}
+		f.where(`EXISTS (
+			SELECT 1 FROM queue_manager.bindings b
+			WHERE ` + strings.Join(bound, " AND ") + `
+		)`)
+	}
+
+	return findPage(r, "FindExchanges", `
+		SELECT x.id, x.uuid, x.created_at, x.updated_at, x.deleted_at, x.meta,
+		       x.exchange_name, x.exchange_type, x.durable, x.auto_delete, x.internal,
+		       x.arguments, COALESCE(x.description, '')
+		FROM queue_manager.exchanges x
+	`, "FROM queue_manager.exchanges x", f, "x.exchange_name", page, scanExchange)
+}
+
+// FindBindings returns a page of the active bindings matching the filter, and the number of matches
+func (r *Repository) FindBindings(filter TopologyFilter, page Page) ([]models.Binding, int, error) {
+	f := &sqlFilter{}
+	f.where("b.deleted_at IS NULL")
+	if filter.Queue != "" {
+		f.where("b.queue_name = " + f.param(filter.Queue))
+	}
+	if filter.Exchange != "" {
+		f.where("b.exchange_name = " + f.param(filter.Exchange))
+	}
+	if filter.Service != "" {
+		f.where(assignedTo("b.queue_name", f.param(filter.Service)))
+	}
+
+	return findPage(r, "FindBindings", `
+		SELECT b.id, b.uuid, b.created_at, b.updated_at, b.deleted_at, b.meta,
+		       b.exchange_name, b.queue_name, b.routing_key, b.arguments, b.mandatory
+		FROM queue_manager.bindings b
+	`, "FROM queue_manager.bindings b", f, "b.exchange_name, b.queue_name, b.routing_key", page, scanBinding)
+}
+
+// FindServiceAssignments returns a page of the active service assignments matching the filter,
+// and the number of matches
+func (r *Repository) FindServiceAssignments(filter TopologyFilter, page Page) ([]models.ServiceAssignment, int, error) {
+	f := &sqlFilter{}
+	f.where("a.deleted_at IS NULL")
+	if filter.Service != "" {
+		f.where("a.service_name = " + f.param(filter.Service))
+	}
+	if filter.Queue != "" {
+		f.where("a.queue_name = " + f.param(filter.Queue))
+	}
+	if filter.Exchange != "" {
+		f.where(boundTo("a.queue_name", f.param(filter.Exchange)))
+	}
+
+	return findPage(r, "FindServiceAssignments", `
+		SELECT a.id, a.uuid, a.created_at, a.updated_at, a.deleted_at, a.meta,
+		       a.service_name, a.queue_name, COALESCE(a.prefetch_count, 0), COALESCE(a.max_inflight, 0),
+		       COALESCE(a.notes, '')
+		FROM queue_manager.service_assignments a
+	`, "FROM queue_manager.service_assignments a", f, "a.service_name, a.queue_name", page, scanServiceAssignment)
+}
+
+// findPage counts the rows matching f and loads the requested page of them, sorted by orderBy
+func findPage[T any](r *Repository, op, selectQuery, from string, f *sqlFilter, orderBy string, page Page,
+	scan func(scanner) (T, error)) ([]T, int, error) {
+	var total int
+	if err := r.queryRow(op, "SELECT COUNT(*) "+from+" "+f.clause(), f.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	items := []T{}
+	if total == 0 || page.Offset >= total {
+		return items, total, nil
+	}
+
+	query := selectQuery + f.clause() + "\nORDER BY " + orderBy
+	args := append([]interface{}{}, f.args...)
+	if page.Limit > 0 {
+		args = append(args, page.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if page.Offset > 0 {
+		args = append(args, page.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := r.query(op, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	r.debug("loaded page from database", "op", op, "count", len(items), "total", total)
+	return items, total, nil
+}
+
+func scanQueue(s scanner) (models.Queue, error) {
+	var q models.Queue
+	var deletedAt sql.NullTime
+	err := s.Scan(
+		&q.ID, &q.UUID, &q.CreatedAt, &q.UpdatedAt, &deletedAt,
+		&q.Meta, &q.QueueName, &q.Durable, &q.AutoDelete,
+		&q.Arguments, &q.Description,
+	)
+	if deletedAt.Valid {
+		q.DeletedAt = &deletedAt.Time
+	}
+	if q.Meta == nil {
+		q.Meta = models.JSONB{}
+	}
+	if q.Arguments == nil {
+		q.Arguments = models.JSONB{}
+	}
+	return q, err
+}
+
+func scanExchange(s scanner) (models.Exchange, error) {
+	var e models.Exchange
+	var deletedAt sql.NullTime
+	err := s.Scan(
+		&e.ID, &e.UUID, &e.CreatedAt, &e.UpdatedAt, &deletedAt,
+		&e.Meta, &e.ExchangeName, &e.ExchangeType, &e.Durable,
+		&e.AutoDelete, &e.Internal, &e.Arguments, &e.Description,
+	)
+	if deletedAt.Valid {
+		e.DeletedAt = &deletedAt.Time
+	}
+	if e.Meta == nil {
+		e.Meta = models.JSONB{}
+	}
+	if e.Arguments == nil {
+		e.Arguments = models.JSONB{}
+	}
+	return e, err
+}
+
+func scanBinding(s scanner) (models.Binding, error) {
+	var b models.Binding
+	var deletedAt sql.NullTime
+	err := s.Scan(
+		&b.ID, &b.UUID, &b.CreatedAt, &b.UpdatedAt, &deletedAt,
+		&b.Meta, &b.ExchangeName, &b.QueueName, &b.RoutingKey,
+		&b.Arguments, &b.Mandatory,
+	)
+	if deletedAt.Valid {
+		b.DeletedAt = &deletedAt.Time
+	}
+	if b.Meta == nil {
+		b.Meta = models.JSONB{}
+	}
+	if b.Arguments == nil {
+		b.Arguments = models.JSONB{}
+	}
+	return b, err
+}
+
+func scanServiceAssignment(s scanner) (models.ServiceAssignment, error) {
+	var a models.ServiceAssignment
+	var deletedAt sql.NullTime
+	err := s.Scan(
+		&a.ID, &a.UUID, &a.CreatedAt, &a.UpdatedAt, &deletedAt,
+		&a.Meta, &a.ServiceName, &a.QueueName, &a.PrefetchCount,
+		&a.MaxInflight, &a.Notes,
+	)
+	if deletedAt.Valid {
+		a.DeletedAt = &deletedAt.Time
+	}
+	if a.Meta == nil {
+		a.Meta = models.JSONB{}
+	}
+	return a, err
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var queueColumns = []string{
+	"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+	"queue_name", "durable", "auto_delete", "arguments", "description",
+}
+
+func TestRepository_FindQueues(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	now := time.Now()
+
+	t.Run("filters by service and exchange in SQL", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM queue_manager.queues q WHERE q.deleted_at IS NULL AND EXISTS \(.*sa.service_name = \$1.*\) AND EXISTS \(.*bq.exchange_name = \$2.*\)`).
+			WithArgs("orders-api", "ex.orders").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(`FROM queue_manager.queues q\s+WHERE .*ORDER BY q.queue_name LIMIT \$3 OFFSET \$4`).
+			WithArgs("orders-api", "ex.orders", 2, 2).
+			WillReturnRows(sqlmock.NewRows(queueColumns).
+				AddRow(3, "uuid3", now, now, nil, nil, "q.refunds", true, false, nil, ""))
+
+		queues, total, err := repo.FindQueues(TopologyFilter{Service: "orders-api", Exchange: "ex.orders"}, Page{Limit: 2, Offset: 2})
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		require.Len(t, queues, 1)
+		assert.Equal(t, "q.refunds", queues[0].QueueName)
+		assert.NotNil(t, queues[0].Arguments)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("skips the page query beyond the last match", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM queue_manager.queues q WHERE q.deleted_at IS NULL AND q.queue_name = \$1`).
+			WithArgs("q.orders").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		queues, total, err := repo.FindQueues(TopologyFilter{Queue: "q.orders"}, Page{Limit: 100, Offset: 100})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		assert.Empty(t, queues)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_FindExchanges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	now := time.Now()
+
+	// Exchanges bound to the queue, limited to queues of the service
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM queue_manager.exchanges x WHERE x.deleted_at IS NULL AND EXISTS \(\s*SELECT 1 FROM queue_manager.bindings b\s+WHERE b.exchange_name = x.exchange_name AND b.deleted_at IS NULL AND b.queue_name = \$1 AND EXISTS \(.*sa.service_name = \$2`).
+		WithArgs("q.orders", "orders-api").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`FROM queue_manager.exchanges x\s+WHERE .*ORDER BY x.exchange_name$`).
+		WithArgs("q.orders", "orders-api").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+			"exchange_name", "exchange_type", "durable", "auto_delete", "internal", "arguments", "description",
+		}).AddRow(1, "uuid1", now, now, nil, `{}`, "ex.orders", "topic", true, false, false, `{}`, ""))
+
+	exchanges, total, err := repo.FindExchanges(TopologyFilter{Queue: "q.orders", Service: "orders-api"}, Page{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, exchanges, 1)
+	assert.Equal(t, "topic", exchanges[0].ExchangeType)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_FindBindingsAndAssignments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	now := time.Now()
+	filter := TopologyFilter{Exchange: "ex.orders"}
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM queue_manager.bindings b WHERE b.deleted_at IS NULL AND b.exchange_name = \$1`).
+		WithArgs("ex.orders").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`FROM queue_manager.bindings b\s+WHERE .*ORDER BY b.exchange_name, b.queue_name, b.routing_key LIMIT \$2`).
+		WithArgs("ex.orders", 10).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+			"exchange_name", "queue_name", "routing_key", "arguments", "mandatory",
+		}).AddRow(1, "uuid1", now, now, nil, `{}`, "ex.orders", "q.orders", "order.*", `{}`, true))
+
+	bindings, total, err := repo.FindBindings(filter, Page{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, bindings, 1)
+	assert.Equal(t, "order.*", bindings[0].RoutingKey)
+
+	// Assignments of the queues bound to the exchange
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM queue_manager.service_assignments a WHERE a.deleted_at IS NULL AND EXISTS \(.*bq.queue_name = a.queue_name AND bq.exchange_name = \$1`).
+		WithArgs("ex.orders").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	assignments, total, err := repo.FindServiceAssignments(filter, Page{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 0, total)
+	assert.NotNil(t, assignments)
+	assert.Empty(t, assignments)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
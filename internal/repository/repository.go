@@ -1,20 +1,92 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"log/slog"
+	"time"
 
+	"queue-manager/internal/logging"
 	"queue-manager/internal/models"
+	"queue-manager/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Repository provides read-only access to queue manager data
+// Repository provides access to queue manager data. Reads go through its methods; changes to the
+// expected topology are made in a transaction with InTx.
 type Repository struct {
 	db *sql.DB
+	// ctx carries the caller's trace and log fields; queries run as child spans of it
+	ctx    context.Context
+	logger *slog.Logger
 }
 
 // NewRepository creates a new repository instance
 func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+	return &Repository{db: db, ctx: context.Background(), logger: logging.Component(nil, "repository")}
+}
+
+// SetLogger replaces the repository's logger
+func (r *Repository) SetLogger(l *slog.Logger) {
+	r.logger = logging.Component(l, "repository")
+}
+
+// debug logs a routine repository operation with the fields of the bound context
+func (r *Repository) debug(msg string, args ...any) {
+	logger := r.logger
+	if logger == nil {
+		logger = logging.Component(nil, "repository")
+	}
+	logger.DebugContext(r.context(), msg, args...)
+}
+
+// WithContext returns a copy of the repository whose queries use ctx, so they are traced as part
+// of the caller's span and cancelled with it. A nil repository stays nil.
+func (r *Repository) WithContext(ctx context.Context) *Repository {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.ctx = ctx
+	return &c
+}
+
+func (r *Repository) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// startSpan starts a span for a repository operation such as "ListQueues"
+func (r *Repository) startSpan(op string) (context.Context, trace.Span) {
+	return tracing.Start(r.context(), "repository."+op,
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", op),
+	)
+}
+
+// query runs a query in its own span. The span covers the query, not the iteration over rows.
+func (r *Repository) query(op, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := r.startSpan(op)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	tracing.End(span, err)
+	return rows, err
+}
+
+// queryRow runs a single-row query in its own span
+func (r *Repository) queryRow(op, query string, args ...any) *sql.Row {
+	ctx, span := r.startSpan(op)
+	row := r.db.QueryRowContext(ctx, query, args...)
+	err := row.Err()
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
+	tracing.End(span, err)
+	return row
 }
 
 // ListQueues returns all active queues from the queue_manager schema
@@ -26,7 +98,7 @@ func (r *Repository) ListQueues() ([]models.Queue, error) {
 		WHERE deleted_at IS NULL
 		ORDER BY queue_name
 	`
-	rows, err := r.db.Query(query)
+	rows, err := r.query("ListQueues", query)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +135,7 @@ func (r *Repository) ListQueues() ([]models.Queue, error) {
 		return nil, err
 	}
 
-	log.Printf("[repository] ListQueues: loaded %d queues from database", len(queues))
+	r.debug("loaded queues from database", "op", "ListQueues", "count", len(queues))
 	return queues, nil
 }
 
@@ -77,7 +149,7 @@ func (r *Repository) ListExchanges() ([]models.Exchange, error) {
 		WHERE deleted_at IS NULL
 		ORDER BY exchange_name
 	`
-	rows, err := r.db.Query(query)
+	rows, err := r.query("ListExchanges", query)
 	if err != nil {
 		return nil, err
 	}
@@ -114,7 +186,7 @@ func (r *Repository) ListExchanges() ([]models.Exchange, error) {
 		return nil, err
 	}
 
-	log.Printf("[repository] ListExchanges: loaded %d exchanges from database", len(exchanges))
+	r.debug("loaded exchanges from database", "op", "ListExchanges", "count", len(exchanges))
 	return exchanges, nil
 }
 
@@ -127,7 +199,7 @@ func (r *Repository) ListBindings() ([]models.Binding, error) {
 		WHERE deleted_at IS NULL
 		ORDER BY exchange_name, queue_name, routing_key
 	`
-	rows, err := r.db.Query(query)
+	rows, err := r.query("ListBindings", query)
 	if err != nil {
 		return nil, err
 	}
@@ -164,7 +236,7 @@ func (r *Repository) ListBindings() ([]models.Binding, error) {
 		return nil, err
 	}
 
-	log.Printf("[repository] ListBindings: loaded %d bindings from database", len(bindings))
+	r.debug("loaded bindings from database", "op", "ListBindings", "count", len(bindings))
 	return bindings, nil
 }
 
@@ -177,7 +249,7 @@ func (r *Repository) ListServiceAssignments() ([]models.ServiceAssignment, error
 		WHERE deleted_at IS NULL
 		ORDER BY service_name, queue_name
 	`
-	rows, err := r.db.Query(query)
+	rows, err := r.query("ListServiceAssignments", query)
 	if err != nil {
 		return nil, err
 	}
@@ -214,7 +286,7 @@ func (r *Repository) ListServiceAssignments() ([]models.ServiceAssignment, error
 func (r *Repository) GetQueueByName(name string) (*models.Queue, error) {
 	query := `
 		SELECT id, uuid, created_at, updated_at, deleted_at, meta,
-		       queue_name, durable, auto_delete, arguments, description
+		       queue_name, durable, auto_delete, arguments, COALESCE(description, '')
 		FROM queue_manager.queues
 		WHERE queue_name = $1 AND deleted_at IS NULL
 		LIMIT 1
@@ -222,7 +294,7 @@ func (r *Repository) GetQueueByName(name string) (*models.Queue, error) {
 	var q models.Queue
 	var deletedAt sql.NullTime
 
-	err := r.db.QueryRow(query, name).Scan(
+	err := r.queryRow("GetQueueByName", query, name).Scan(
 		&q.ID, &q.UUID, &q.CreatedAt, &q.UpdatedAt, &deletedAt,
 		&q.Meta, &q.QueueName, &q.Durable, &q.AutoDelete,
 		&q.Arguments, &q.Description,
@@ -252,7 +324,7 @@ func (r *Repository) GetExchangeByName(name string) (*models.Exchange, error) {
 	query := `
 		SELECT id, uuid, created_at, updated_at, deleted_at, meta,
 		       exchange_name, exchange_type, durable, auto_delete, internal,
-		       arguments, description
+		       arguments, COALESCE(description, '')
 		FROM queue_manager.exchanges
 		WHERE exchange_name = $1 AND deleted_at IS NULL
 		LIMIT 1
@@ -260,7 +332,7 @@ func (r *Repository) GetExchangeByName(name string) (*models.Exchange, error) {
 	var e models.Exchange
 	var deletedAt sql.NullTime
 
-	err := r.db.QueryRow(query, name).Scan(
+	err := r.queryRow("GetExchangeByName", query, name).Scan(
 		&e.ID, &e.UUID, &e.CreatedAt, &e.UpdatedAt, &deletedAt,
 		&e.Meta, &e.ExchangeName, &e.ExchangeType, &e.Durable,
 		&e.AutoDelete, &e.Internal, &e.Arguments, &e.Description,
@@ -309,7 +381,7 @@ func (r *Repository) GetQueuesByServiceName(serviceName string) ([]QueueWithAssi
 			AND q.deleted_at IS NULL
 		ORDER BY q.queue_name
 	`
-	rows, err := r.db.Query(query, serviceName)
+	rows, err := r.query("GetQueuesByServiceName", query, serviceName)
 	if err != nil {
 		return nil, err
 	}
@@ -350,7 +422,54 @@ func (r *Repository) GetQueuesByServiceName(serviceName string) ([]QueueWithAssi
 		return nil, err
 	}
 
-	log.Printf("[repository] GetQueuesByServiceName: loaded %d queues for service %s", len(results), serviceName)
+	r.debug("loaded queues of service", "op", "GetQueuesByServiceName", "service", serviceName, "count", len(results))
 	return results, nil
 }
 
+// Tombstone represents a soft-deleted exchange, queue or binding row
+type Tombstone struct {
+	Kind         string // "exchange", "queue" or "binding"
+	ExchangeName string // set for exchanges and bindings
+	QueueName    string // set for queues and bindings
+	RoutingKey   string // set for bindings
+	DeletedAt    time.Time
+}
+
+// ListTombstones returns all soft-deleted exchanges, queues and bindings
+func (r *Repository) ListTombstones() ([]Tombstone, error) {
+	query := `
+		SELECT 'exchange' AS kind, exchange_name, '' AS queue_name, '' AS routing_key, deleted_at
+		FROM queue_manager.exchanges
+		WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'queue' AS kind, '' AS exchange_name, queue_name, '' AS routing_key, deleted_at
+		FROM queue_manager.queues
+		WHERE deleted_at IS NOT NULL
+		UNION ALL
+		SELECT 'binding' AS kind, exchange_name, queue_name, routing_key, deleted_at
+		FROM queue_manager.bindings
+		WHERE deleted_at IS NOT NULL
+		ORDER BY kind, exchange_name, queue_name, routing_key
+	`
+	rows, err := r.query("ListTombstones", query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tombstones []Tombstone
+	for rows.Next() {
+		var t Tombstone
+		if err := rows.Scan(&t.Kind, &t.ExchangeName, &t.QueueName, &t.RoutingKey, &t.DeletedAt); err != nil {
+			return nil, err
+		}
+		tombstones = append(tombstones, t)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	r.debug("loaded soft-deleted resources from database", "op", "ListTombstones", "count", len(tombstones))
+	return tombstones, nil
+}
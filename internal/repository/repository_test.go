@@ -390,3 +390,37 @@ func TestRepository_DeletedAtHandling(t *testing.T) {
 }
 
 
+
+func TestRepository_ListTombstones(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+
+	t.Run("successful list", func(t *testing.T) {
+		deletedAt := time.Now().Add(-time.Hour)
+		rows := sqlmock.NewRows([]string{"kind", "exchange_name", "queue_name", "routing_key", "deleted_at"}).
+			AddRow("binding", "ex1", "q1", "key1", deletedAt).
+			AddRow("exchange", "ex2", "", "", deletedAt).
+			AddRow("queue", "", "q2", "", deletedAt)
+
+		mock.ExpectQuery(`SELECT 'exchange' AS kind`).WillReturnRows(rows)
+
+		tombstones, err := repo.ListTombstones()
+		require.NoError(t, err)
+		require.Len(t, tombstones, 3)
+		assert.Equal(t, Tombstone{Kind: "binding", ExchangeName: "ex1", QueueName: "q1", RoutingKey: "key1", DeletedAt: deletedAt}, tombstones[0])
+		assert.Equal(t, "ex2", tombstones[1].ExchangeName)
+		assert.Equal(t, "q2", tombstones[2].QueueName)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock.ExpectQuery(`SELECT 'exchange' AS kind`).WillReturnError(sql.ErrConnDone)
+
+		_, err := repo.ListTombstones()
+		assert.Error(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"queue-manager/internal/logging"
+	"queue-manager/internal/models"
+	"queue-manager/internal/tracing"
+)
+
+// RunFilter narrows down the reconciliation runs returned by ListReconciliationRuns
+type RunFilter struct {
+	// Resource only matches runs with an action on the resource with this name
+	Resource string
+	Trigger  string
+	Since    *time.Time
+	Until    *time.Time
+	Limit    int
+}
+
+// DefaultRunLimit is used when RunFilter.Limit is not set
+const DefaultRunLimit = 50
+
+// InsertReconciliationRun stores a run and its actions in a single transaction
+func (r *Repository) InsertReconciliationRun(run models.ReconciliationRun, actions []models.ReconciliationAction) (err error) {
+	ctx, span := r.startSpan("InsertReconciliationRun")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	summary := run.Summary
+	if summary == nil {
+		summary = models.JSONB{}
+	}
+
+	var runID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO queue_manager.reconciliation_runs
+		       (uuid, trigger, request_id, plan_id, dry_run, force, status, error, summary, started_at, finished_at)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, NULLIF($8, ''), $9, $10, $11)
+		RETURNING id
+	`, run.UUID, run.Trigger, run.RequestID, run.PlanID, run.DryRun, run.Force,
+		run.Status, run.Error, summary, run.StartedAt, run.FinishedAt).Scan(&runID)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range actions {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO queue_manager.reconciliation_actions
+			       (run_id, action, resource_kind, resource_name, detail)
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''))
+		`, runID, a.Action, a.ResourceKind, a.ResourceName, a.Detail)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	r.debug("stored reconciliation run", "op", "InsertReconciliationRun", logging.KeyRunID, run.UUID, "actions", len(actions))
+	return nil
+}
+
+// ListReconciliationRuns returns the most recent runs matching the filter, newest first
+func (r *Repository) ListReconciliationRuns(filter RunFilter) ([]models.ReconciliationRun, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	addCondition := func(format string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.Resource != "" {
+		addCondition(`EXISTS (
+			SELECT 1 FROM queue_manager.reconciliation_actions a
+			WHERE a.run_id = r.id AND a.resource_name = $%d
+		)`, filter.Resource)
+	}
+	if filter.Trigger != "" {
+		addCondition("r.trigger = $%d", filter.Trigger)
+	}
+	if filter.Since != nil {
+		addCondition("r.started_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		addCondition("r.started_at <= $%d", *filter.Until)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultRunLimit
+	}
+
+	query := `
+		SELECT r.id, r.uuid, r.trigger, COALESCE(r.request_id, ''), COALESCE(r.plan_id, ''),
+		       r.dry_run, r.force, r.status, COALESCE(r.error, ''), r.summary,
+		       r.started_at, r.finished_at
+		FROM queue_manager.reconciliation_runs r
+	`
+	if len(conditions) > 0 {
+		query += "WHERE " + strings.Join(conditions, " AND ") + "\n"
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf("ORDER BY r.started_at DESC LIMIT $%d", len(args))
+
+	rows, err := r.query("ListReconciliationRuns", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.ReconciliationRun{}
+	for rows.Next() {
+		run, err := scanReconciliationRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	r.debug("loaded reconciliation runs from database", "op", "ListReconciliationRuns", "count", len(runs))
+	return runs, nil
+}
+
+// GetReconciliationRun returns a run and its actions by UUID, or nil if it does not exist
+func (r *Repository) GetReconciliationRun(uuid string) (*models.ReconciliationRun, []models.ReconciliationAction, error) {
+	row := r.queryRow("GetReconciliationRun", `
+		SELECT r.id, r.uuid, r.trigger, COALESCE(r.request_id, ''), COALESCE(r.plan_id, ''),
+		       r.dry_run, r.force, r.status, COALESCE(r.error, ''), r.summary,
+		       r.started_at, r.finished_at
+		FROM queue_manager.reconciliation_runs r
+		WHERE r.uuid = $1
+	`, uuid)
+	run, err := scanReconciliationRun(row)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := r.query("GetReconciliationRun", `
+		SELECT id, action, COALESCE(resource_kind, ''), COALESCE(resource_name, ''),
+		       COALESCE(detail, ''), created_at
+		FROM queue_manager.reconciliation_actions
+		WHERE run_id = $1
+		ORDER BY id
+	`, run.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	actions := []models.ReconciliationAction{}
+	for rows.Next() {
+		var a models.ReconciliationAction
+		if err := rows.Scan(&a.ID, &a.Action, &a.ResourceKind, &a.ResourceName, &a.Detail, &a.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		actions = append(actions, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return &run, actions, nil
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanReconciliationRun(s scanner) (models.ReconciliationRun, error) {
+	var run models.ReconciliationRun
+	err := s.Scan(
+		&run.ID, &run.UUID, &run.Trigger, &run.RequestID, &run.PlanID,
+		&run.DryRun, &run.Force, &run.Status, &run.Error, &run.Summary,
+		&run.StartedAt, &run.FinishedAt,
+	)
+	if err != nil {
+		return run, err
+	}
+	if run.Summary == nil {
+		run.Summary = models.JSONB{}
+	}
+	run.DurationMs = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	return run, nil
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"queue-manager/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var runColumns = []string{
+	"id", "uuid", "trigger", "request_id", "plan_id",
+	"dry_run", "force", "status", "error", "summary",
+	"started_at", "finished_at",
+}
+
+func TestRepository_InsertReconciliationRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	started := time.Now()
+	run := models.ReconciliationRun{
+		UUID:       "run-uuid",
+		Trigger:    "sync",
+		RequestID:  "req-1",
+		Status:     "succeeded",
+		StartedAt:  started,
+		FinishedAt: started.Add(time.Second),
+	}
+	actions := []models.ReconciliationAction{
+		{Action: "create", ResourceKind: "queue", ResourceName: "q1", Detail: "missing on provider"},
+		{Action: "error", Detail: "failed to list exchanges: boom"},
+	}
+
+	t.Run("stores run and actions in one transaction", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO queue_manager.reconciliation_runs`).
+			WithArgs("run-uuid", "sync", "req-1", "", false, false, "succeeded", "", sqlmock.AnyArg(), started, started.Add(time.Second)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectExec(`INSERT INTO queue_manager.reconciliation_actions`).
+			WithArgs(int64(7), "create", "queue", "q1", "missing on provider").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`INSERT INTO queue_manager.reconciliation_actions`).
+			WithArgs(int64(7), "error", "", "", "failed to list exchanges: boom").
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		require.NoError(t, repo.InsertReconciliationRun(run, actions))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rolls back when an action fails", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO queue_manager.reconciliation_runs`).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+		mock.ExpectExec(`INSERT INTO queue_manager.reconciliation_actions`).
+			WillReturnError(errors.New("insert failed"))
+		mock.ExpectRollback()
+
+		err := repo.InsertReconciliationRun(run, actions)
+		assert.Error(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_ListReconciliationRuns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	now := time.Now()
+
+	t.Run("defaults", func(t *testing.T) {
+		mock.ExpectQuery(`FROM queue_manager.reconciliation_runs r\s+ORDER BY r.started_at DESC LIMIT \$1`).
+			WithArgs(DefaultRunLimit).
+			WillReturnRows(sqlmock.NewRows(runColumns).
+				AddRow(1, "run-1", "cron", "", "", false, false, "succeeded", "", []byte(`{"queuesCreated":1}`), now, now.Add(1500*time.Millisecond)))
+
+		runs, err := repo.ListReconciliationRuns(RunFilter{})
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		assert.Equal(t, "run-1", runs[0].UUID)
+		assert.Equal(t, int64(1500), runs[0].DurationMs)
+		assert.Equal(t, float64(1), runs[0].Summary["queuesCreated"])
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("filters by resource and time range", func(t *testing.T) {
+		since := now.Add(-time.Hour)
+		mock.ExpectQuery(`WHERE EXISTS \(.*a.resource_name = \$1\s*\) AND r.started_at >= \$2 AND r.started_at <= \$3\s+ORDER BY r.started_at DESC LIMIT \$4`).
+			WithArgs("q.orders", since, now, 10).
+			WillReturnRows(sqlmock.NewRows(runColumns))
+
+		runs, err := repo.ListReconciliationRuns(RunFilter{Resource: "q.orders", Since: &since, Until: &now, Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, runs)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_GetReconciliationRun(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	now := time.Now()
+
+	t.Run("found", func(t *testing.T) {
+		mock.ExpectQuery(`FROM queue_manager.reconciliation_runs r\s+WHERE r.uuid = \$1`).
+			WithArgs("run-1").
+			WillReturnRows(sqlmock.NewRows(runColumns).
+				AddRow(3, "run-1", "sync", "req-1", "", true, false, "succeeded", "", nil, now, now))
+		mock.ExpectQuery(`FROM queue_manager.reconciliation_actions`).
+			WithArgs(int64(3)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "action", "resource_kind", "resource_name", "detail", "created_at"}).
+				AddRow(1, "delete", "queue", "q.legacy", "not in expected topology", now))
+
+		run, actions, err := repo.GetReconciliationRun("run-1")
+		require.NoError(t, err)
+		require.NotNil(t, run)
+		assert.Equal(t, "req-1", run.RequestID)
+		assert.True(t, run.DryRun)
+		assert.NotNil(t, run.Summary)
+		require.Len(t, actions, 1)
+		assert.Equal(t, "q.legacy", actions[0].ResourceName)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		mock.ExpectQuery(`FROM queue_manager.reconciliation_runs r\s+WHERE r.uuid = \$1`).
+			WithArgs("missing").
+			WillReturnRows(sqlmock.NewRows(runColumns))
+
+		run, actions, err := repo.GetReconciliationRun("missing")
+		require.NoError(t, err)
+		assert.Nil(t, run)
+		assert.Nil(t, actions)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"queue-manager/internal/models"
+	"queue-manager/internal/tracing"
+)
+
+// Errors returned by the write methods of Tx; they are wrapped with the affected resource
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrStale is returned when the row was updated after the time the caller read it
+	ErrStale = errors.New("was modified since it was read")
+	// ErrInUse is returned when deleting an exchange or queue that active rows still refer to
+	ErrInUse = errors.New("is still in use")
+)
+
+// ReferenceError is returned when a binding or service assignment refers to an exchange or queue
+// that does not exist or was deleted
+type ReferenceError struct {
+	Kind string // "exchange" or "queue"
+	Name string
+}
+
+func (e *ReferenceError) Error() string {
+	return fmt.Sprintf("%s %q does not exist", e.Kind, e.Name)
+}
+
+const (
+	queueReturning = `RETURNING id, uuid, created_at, updated_at, deleted_at, meta,
+		          queue_name, durable, auto_delete, arguments, COALESCE(description, '')`
+	exchangeReturning = `RETURNING id, uuid, created_at, updated_at, deleted_at, meta,
+		          exchange_name, exchange_type, durable, auto_delete, internal,
+		          arguments, COALESCE(description, '')`
+	bindingReturning = `RETURNING id, uuid, created_at, updated_at, deleted_at, meta,
+		          exchange_name, queue_name, routing_key, arguments, mandatory`
+	assignmentReturning = `RETURNING id, uuid, created_at, updated_at, deleted_at, meta,
+		          service_name, queue_name, COALESCE(prefetch_count, 0), COALESCE(max_inflight, 0),
+		          COALESCE(notes, '')`
+)
+
+// Tx changes the expected topology within a database transaction. Deletes are soft: they set
+// deleted_at, so the reconciler's deletion grace period applies to them. Updates and deletes
+// take the updated_at the caller read; a zero time skips the check.
+type Tx struct {
+	tx  *sql.Tx
+	ctx context.Context
+}
+
+// InTx runs fn in a transaction, committing it when fn returns nil and rolling it back otherwise
+func (r *Repository) InTx(fn func(tx *Tx) error) (err error) {
+	ctx, span := r.startSpan("InTx")
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(&Tx{tx: tx, ctx: ctx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	r.debug("committed topology changes", "op", "InTx")
+	return nil
+}
+
+// CreateQueue inserts a queue. A soft-deleted queue with the same name is restored.
+func (t *Tx) CreateQueue(q models.Queue) (models.Queue, error) {
+	created, err := scanQueue(t.tx.QueryRowContext(t.ctx, `
+		INSERT INTO queue_manager.queues AS q (meta, queue_name, durable, auto_delete, arguments, description)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (queue_name) DO UPDATE
+		SET deleted_at = NULL, meta = EXCLUDED.meta, durable = EXCLUDED.durable,
+		    auto_delete = EXCLUDED.auto_delete, arguments = EXCLUDED.arguments,
+		    description = EXCLUDED.description
+		WHERE q.deleted_at IS NOT NULL
+		`+queueReturning,
+		jsonb(q.Meta), q.QueueName, q.Durable, q.AutoDelete, jsonb(q.Arguments), q.Description))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Queue{}, fmt.Errorf("queue %q %w", q.QueueName, ErrAlreadyExists)
+	}
+	return created, err
+}
+
+// UpdateQueue replaces the properties of the active queue named q.QueueName
+func (t *Tx) UpdateQueue(q models.Queue, unmodifiedSince time.Time) (models.Queue, error) {
+	updated, err := scanQueue(t.tx.QueryRowContext(t.ctx, `
+		UPDATE queue_manager.queues
+		SET meta = $2, durable = $3, auto_delete = $4, arguments = $5, description = $6
+		WHERE queue_name = $1 AND deleted_at IS NULL AND ($7::timestamptz IS NULL OR updated_at = $7)
+		`+queueReturning,
+		q.QueueName, jsonb(q.Meta), q.Durable, q.AutoDelete, jsonb(q.Arguments), q.Description,
+		nullTime(unmodifiedSince)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Queue{}, t.notUpdated("queue", "queues", "queue_name", q.QueueName)
+	}
+	return updated, err
+}
+
+// DeleteQueue soft-deletes the active queue with the given name. Queues with active bindings or
+// service assignments are not deleted.
+func (t *Tx) DeleteQueue(name string, unmodifiedSince time.Time) (models.Queue, error) {
+	deleted, err := scanQueue(t.tx.QueryRowContext(t.ctx, `
+		UPDATE queue_manager.queues
+		SET deleted_at = NOW()
+		WHERE queue_name = $1 AND deleted_at IS NULL AND ($2::timestamptz IS NULL OR updated_at = $2)
+		`+queueReturning,
+		name, nullTime(unmodifiedSince)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Queue{}, t.notUpdated("queue", "queues", "queue_name", name)
+	}
+	if err != nil {
+		return models.Queue{}, err
+	}
+
+	var bindings, assignments int
+	err = t.tx.QueryRowContext(t.ctx, `
+		SELECT (SELECT COUNT(*) FROM queue_manager.bindings WHERE queue_name = $1 AND deleted_at IS NULL),
+		       (SELECT COUNT(*) FROM queue_manager.service_assignments WHERE queue_name = $1 AND deleted_at IS NULL)
+	`, name).Scan(&bindings, &assignments)
+	if err != nil {
+		return models.Queue{}, err
+	}
+	if bindings > 0 || assignments > 0 {
+		return models.Queue{}, fmt.Errorf("queue %q %w: %d bindings and %d service assignments refer to it",
+			name, ErrInUse, bindings, assignments)
+	}
+	return deleted, nil
+}
+
+// CreateExchange inserts an exchange. A soft-deleted exchange with the same name is restored.
+func (t *Tx) CreateExchange(e models.Exchange) (models.Exchange, error) {
+	created, err := scanExchange(t.tx.QueryRowContext(t.ctx, `
+		INSERT INTO queue_manager.exchanges AS x
+		       (meta, exchange_name, exchange_type, durable, auto_delete, internal, arguments, description)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (exchange_name) DO UPDATE
+		SET deleted_at = NULL, meta = EXCLUDED.meta, exchange_type = EXCLUDED.exchange_type,
+		    durable = EXCLUDED.durable, auto_delete = EXCLUDED.auto_delete, internal = EXCLUDED.internal,
+		    arguments = EXCLUDED.arguments, description = EXCLUDED.description
+		WHERE x.deleted_at IS NOT NULL
+		`+exchangeReturning,
+		jsonb(e.Meta), e.ExchangeName, e.ExchangeType, e.Durable, e.AutoDelete, e.Internal,
+		jsonb(e.Arguments), e.Description))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Exchange{}, fmt.Errorf("exchange %q %w", e.ExchangeName, ErrAlreadyExists)
+	}
+	return created, err
+}
+
+// UpdateExchange replaces the properties of the active exchange named e.ExchangeName
+func (t *Tx) UpdateExchange(e models.Exchange, unmodifiedSince time.Time) (models.Exchange, error) {
+	updated, err := scanExchange(t.tx.QueryRowContext(t.ctx, `
+		UPDATE queue_manager.exchanges
+		SET meta = $2, exchange_type = $3, durable = $4, auto_delete = $5, internal = $6,
+		    arguments = $7, description = $8
+		WHERE exchange_name = $1 AND deleted_at IS NULL AND ($9::timestamptz IS NULL OR updated_at = $9)
+		`+exchangeReturning,
+		e.ExchangeName, jsonb(e.Meta), e.ExchangeType, e.Durable, e.AutoDelete, e.Internal,
+		jsonb(e.Arguments), e.Description, nullTime(unmodifiedSince)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Exchange{}, t.notUpdated("exchange", "exchanges", "exchange_name", e.ExchangeName)
+	}
+	return updated, err
+}
+
+// DeleteExchange soft-deletes the active exchange with the given name. Exchanges with active
+// bindings are not deleted.
+func (t *Tx) DeleteExchange(name string, unmodifiedSince time.Time) (models.Exchange, error) {
+	deleted, err := scanExchange(t.tx.QueryRowContext(t.ctx, `
+		UPDATE queue_manager.exchanges
+		SET deleted_at = NOW()
+		WHERE exchange_name = $1 AND deleted_at IS NULL AND ($2::timestamptz IS NULL OR updated_at = $2)
+		`+exchangeReturning,
+		name, nullTime(unmodifiedSince)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Exchange{}, t.notUpdated("exchange", "exchanges", "exchange_name", name)
+	}
+	if err != nil {
+		return models.Exchange{}, err
+	}
+
+	var bindings int
+	err = t.tx.QueryRowContext(t.ctx, `
+		SELECT COUNT(*) FROM queue_manager.bindings WHERE exchange_name = $1 AND deleted_at IS NULL
+	`, name).Scan(&bindings)
+	if err != nil {
+		return models.Exchange{}, err
+	}
+	if bindings > 0 {
+		return models.Exchange{}, fmt.Errorf("exchange %q %w: %d bindings refer to it", name, ErrInUse, bindings)
+	}
+	return deleted, nil
+}
+
+// CreateBinding inserts a binding between an active exchange and an active queue. A soft-deleted
+// binding with the same exchange, queue and routing key is restored.
+func (t *Tx) CreateBinding(b models.Binding) (models.Binding, error) {
+	if err := t.requireActive("exchange", "exchanges", "exchange_name", b.ExchangeName); err != nil {
+		return models.Binding{}, err
+	}
+	if err := t.requireActive("queue", "queues", "queue_name", b.QueueName); err != nil {
+		return models.Binding{}, err
+	}
+
+	created, err := scanBinding(t.tx.QueryRowContext(t.ctx, `
+		INSERT INTO queue_manager.bindings AS b (meta, exchange_name, queue_name, routing_key, arguments, mandatory)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (exchange_name, queue_name, routing_key) DO UPDATE
+		SET deleted_at = NULL, meta = EXCLUDED.meta, arguments = EXCLUDED.arguments,
+		    mandatory = EXCLUDED.mandatory
+		WHERE b.deleted_at IS NOT NULL
+		`+bindingReturning,
+		jsonb(b.Meta), b.ExchangeName, b.QueueName, b.RoutingKey, jsonb(b.Arguments), b.Mandatory))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Binding{}, fmt.Errorf("binding %s -> %s (%s) %w", b.ExchangeName, b.QueueName, b.RoutingKey, ErrAlreadyExists)
+	}
+	return created, err
+}
+
+// UpdateBinding replaces the arguments, mandatory flag and meta of the active binding with the
+// UUID b.UUID. The exchange, queue and routing key identify the binding and cannot be changed.
+func (t *Tx) UpdateBinding(b models.Binding, unmodifiedSince time.Time) (models.Binding, error) {
+	updated, err := scanBinding(t.tx.QueryRowContext(t.ctx, `
+		UPDATE queue_manager.bindings
+		SET meta = $2, arguments = $3, mandatory = $4
+		WHERE uuid = $1 AND deleted_at IS NULL AND ($5::timestamptz IS NULL OR updated_at = $5)
+		`+bindingReturning,
+		b.UUID, jsonb(b.Meta), jsonb(b.Arguments), b.Mandatory, nullTime(unmodifiedSince)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Binding{}, t.notUpdated("binding", "bindings", "uuid", b.UUID)
+	}
+	return updated, err
+}
+
+// DeleteBinding soft-deletes the active binding with the given UUID
+func (t *Tx) DeleteBinding(uuid string, unmodifiedSince time.Time) (models.Binding, error) {
+	deleted, err := scanBinding(t.tx.QueryRowContext(t.ctx, `
+		UPDATE queue_manager.bindings
+		SET deleted_at = NOW()
+		WHERE uuid = $1 AND deleted_at IS NULL AND ($2::timestamptz IS NULL OR updated_at = $2)
+		`+bindingReturning,
+		uuid, nullTime(unmodifiedSince)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Binding{}, t.notUpdated("binding", "bindings", "uuid", uuid)
+	}
+	return deleted, err
+}
+
+// CreateServiceAssignment assigns an active queue to a service. A soft-deleted assignment of the
+// same queue to the same service is restored.
+func (t *Tx) CreateServiceAssignment(a models.ServiceAssignment) (models.ServiceAssignment, error) {
+	if err := t.requireActive("queue", "queues", "queue_name", a.QueueName); err != nil {
+		return models.ServiceAssignment{}, err
+	}
+
+	created, err := scanServiceAssignment(t.tx.QueryRowContext(t.ctx, `
+		INSERT INTO queue_manager.service_assignments AS a
+		       (meta, service_name, queue_name, prefetch_count, max_inflight, notes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (service_name, queue_name) DO UPDATE
+		SET deleted_at = NULL, meta = EXCLUDED.meta, prefetch_count = EXCLUDED.prefetch_count,
+		    max_inflight = EXCLUDED.max_inflight, notes = EXCLUDED.notes
+		WHERE a.deleted_at IS NOT NULL
+		`+assignmentReturning,
+		jsonb(a.Meta), a.ServiceName, a.QueueName, a.PrefetchCount, a.MaxInflight, a.Notes))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ServiceAssignment{}, fmt.Errorf("assignment of queue %q to service %q %w", a.QueueName, a.ServiceName, ErrAlreadyExists)
+	}
+	return created, err
+}
+
+// UpdateServiceAssignment replaces the settings of the active assignment with the UUID a.UUID.
+// The service and queue identify the assignment and cannot be changed.
+func (t *Tx) UpdateServiceAssignment(a models.ServiceAssignment, unmodifiedSince time.Time) (models.ServiceAssignment, error) {
+	updated, err := scanServiceAssignment(t.tx.QueryRowContext(t.ctx, `
+		UPDATE queue_manager.service_assignments
+		SET meta = $2, prefetch_count = $3, max_inflight = $4, notes = $5
+		WHERE uuid = $1 AND deleted_at IS NULL AND ($6::timestamptz IS NULL OR updated_at = $6)
+		`+assignmentReturning,
+		a.UUID, jsonb(a.Meta), a.PrefetchCount, a.MaxInflight, a.Notes, nullTime(unmodifiedSince)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ServiceAssignment{}, t.notUpdated("service assignment", "service_assignments", "uuid", a.UUID)
+	}
+	return updated, err
+}
+
+// DeleteServiceAssignment soft-deletes the active assignment with the given UUID
+func (t *Tx) DeleteServiceAssignment(uuid string, unmodifiedSince time.Time) (models.ServiceAssignment, error) {
+	deleted, err := scanServiceAssignment(t.tx.QueryRowContext(t.ctx, `
+		UPDATE queue_manager.service_assignments
+		SET deleted_at = NOW()
+		WHERE uuid = $1 AND deleted_at IS NULL AND ($2::timestamptz IS NULL OR updated_at = $2)
+		`+assignmentReturning,
+		uuid, nullTime(unmodifiedSince)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ServiceAssignment{}, t.notUpdated("service assignment", "service_assignments", "uuid", uuid)
+	}
+	return deleted, err
+}
+
+// notUpdated explains why an update of an active row matched nothing: the row does not exist
+// (or was deleted), or it was modified after unmodifiedSince
+func (t *Tx) notUpdated(kind, table, column, key string) error {
+	var exists bool
+	err := t.tx.QueryRowContext(t.ctx, fmt.Sprintf(
+		`SELECT EXISTS (SELECT 1 FROM queue_manager.%s WHERE %s = $1 AND deleted_at IS NULL)`, table, column,
+	), key).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%s %q %w", kind, key, ErrNotFound)
+	}
+	return fmt.Errorf("%s %q %w", kind, key, ErrStale)
+}
+
+// requireActive returns a *ReferenceError unless an active row has the given name
+func (t *Tx) requireActive(kind, table, column, name string) error {
+	var exists bool
+	err := t.tx.QueryRowContext(t.ctx, fmt.Sprintf(
+		`SELECT EXISTS (SELECT 1 FROM queue_manager.%s WHERE %s = $1 AND deleted_at IS NULL)`, table, column,
+	), name).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return &ReferenceError{Kind: kind, Name: name}
+	}
+	return nil
+}
+
+// GetBinding returns the active binding with the given UUID, or nil if there is none
+func (r *Repository) GetBinding(uuid string) (*models.Binding, error) {
+	b, err := scanBinding(r.queryRow("GetBinding", `
+		SELECT id, uuid, created_at, updated_at, deleted_at, meta,
+		       exchange_name, queue_name, routing_key, arguments, mandatory
+		FROM queue_manager.bindings
+		WHERE uuid = $1 AND deleted_at IS NULL
+	`, uuid))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// GetServiceAssignment returns the active service assignment with the given UUID, or nil if
+// there is none
+func (r *Repository) GetServiceAssignment(uuid string) (*models.ServiceAssignment, error) {
+	a, err := scanServiceAssignment(r.queryRow("GetServiceAssignment", `
+		SELECT id, uuid, created_at, updated_at, deleted_at, meta,
+		       service_name, queue_name, COALESCE(prefetch_count, 0), COALESCE(max_inflight, 0),
+		       COALESCE(notes, '')
+		FROM queue_manager.service_assignments
+		WHERE uuid = $1 AND deleted_at IS NULL
+	`, uuid))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// jsonb stores nil maps as empty JSON objects, the columns' default
+func jsonb(m models.JSONB) models.JSONB {
+	if m == nil {
+		return models.JSONB{}
+	}
+	return m
+}
+
+// nullTime passes the zero time as NULL
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"queue-manager/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var bindingColumns = []string{
+	"id", "uuid", "created_at", "updated_at", "deleted_at", "meta",
+	"exchange_name", "queue_name", "routing_key", "arguments", "mandatory",
+}
+
+func TestTx_CreateQueue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	now := time.Now()
+
+	t.Run("inserts or restores a soft-deleted queue", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO queue_manager.queues AS q .*ON CONFLICT \(queue_name\) DO UPDATE.*WHERE q.deleted_at IS NOT NULL`).
+			WithArgs(models.JSONB{}, "q.orders", true, false, models.JSONB{"x-queue-type": "quorum"}, "").
+			WillReturnRows(sqlmock.NewRows(queueColumns).
+				AddRow(1, "uuid1", now, now, nil, `{}`, "q.orders", true, false, []byte(`{"x-queue-type":"quorum"}`), ""))
+		mock.ExpectCommit()
+
+		var created models.Queue
+		err := repo.InTx(func(tx *Tx) error {
+			var err error
+			created, err = tx.CreateQueue(models.Queue{
+				QueueName: "q.orders", Durable: true, Arguments: models.JSONB{"x-queue-type": "quorum"},
+			})
+			return err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "uuid1", created.UUID)
+		assert.Equal(t, "quorum", created.Arguments["x-queue-type"])
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reports an active queue with the same name", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO queue_manager.queues`).
+			WillReturnRows(sqlmock.NewRows(queueColumns))
+		mock.ExpectRollback()
+
+		err := repo.InTx(func(tx *Tx) error {
+			_, err := tx.CreateQueue(models.Queue{QueueName: "q.orders", Durable: true})
+			return err
+		})
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+		assert.EqualError(t, err, `queue "q.orders" already exists`)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestTx_UpdateQueue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	read := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	update := func() error {
+		return repo.InTx(func(tx *Tx) error {
+			_, err := tx.UpdateQueue(models.Queue{QueueName: "q.orders", Durable: true}, read)
+			return err
+		})
+	}
+
+	t.Run("refuses a queue modified since it was read", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`UPDATE queue_manager.queues\s+SET .*WHERE queue_name = \$1 AND deleted_at IS NULL AND \(\$7::timestamptz IS NULL OR updated_at = \$7\)`).
+			WithArgs("q.orders", models.JSONB{}, true, false, models.JSONB{}, "", read).
+			WillReturnRows(sqlmock.NewRows(queueColumns))
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM queue_manager.queues WHERE queue_name = \$1 AND deleted_at IS NULL\)`).
+			WithArgs("q.orders").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectRollback()
+
+		err := update()
+		assert.ErrorIs(t, err, ErrStale)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("reports a missing queue", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`UPDATE queue_manager.queues`).
+			WillReturnRows(sqlmock.NewRows(queueColumns))
+		mock.ExpectQuery(`SELECT EXISTS`).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectRollback()
+
+		err := update()
+		assert.ErrorIs(t, err, ErrNotFound)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestTx_DeleteQueue_InUse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE queue_manager.queues\s+SET deleted_at = NOW\(\)`).
+		WithArgs("q.orders", nil).
+		WillReturnRows(sqlmock.NewRows(queueColumns).
+			AddRow(1, "uuid1", now, now, now, `{}`, "q.orders", true, false, `{}`, ""))
+	mock.ExpectQuery(`SELECT \(SELECT COUNT\(\*\) FROM queue_manager.bindings`).
+		WithArgs("q.orders").
+		WillReturnRows(sqlmock.NewRows([]string{"bindings", "assignments"}).AddRow(2, 1))
+	mock.ExpectRollback()
+
+	err = repo.InTx(func(tx *Tx) error {
+		_, err := tx.DeleteQueue("q.orders", time.Time{})
+		return err
+	})
+	assert.ErrorIs(t, err, ErrInUse)
+	assert.EqualError(t, err, `queue "q.orders" is still in use: 2 bindings and 1 service assignments refer to it`)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTx_CreateBinding(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	now := time.Now()
+	binding := models.Binding{ExchangeName: "ex.orders", QueueName: "q.orders", RoutingKey: "order.*"}
+
+	t.Run("binds an active exchange and queue", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM queue_manager.exchanges WHERE exchange_name = \$1`).
+			WithArgs("ex.orders").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM queue_manager.queues WHERE queue_name = \$1`).
+			WithArgs("q.orders").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(`INSERT INTO queue_manager.bindings AS b .*ON CONFLICT \(exchange_name, queue_name, routing_key\)`).
+			WithArgs(models.JSONB{}, "ex.orders", "q.orders", "order.*", models.JSONB{}, false).
+			WillReturnRows(sqlmock.NewRows(bindingColumns).
+				AddRow(1, "uuid1", now, now, nil, `{}`, "ex.orders", "q.orders", "order.*", `{}`, false))
+		mock.ExpectCommit()
+
+		err := repo.InTx(func(tx *Tx) error {
+			_, err := tx.CreateBinding(binding)
+			return err
+		})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("refuses an unknown exchange", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM queue_manager.exchanges`).
+			WithArgs("ex.orders").
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		mock.ExpectRollback()
+
+		err := repo.InTx(func(tx *Tx) error {
+			_, err := tx.CreateBinding(binding)
+			return err
+		})
+		var ref *ReferenceError
+		require.True(t, errors.As(err, &ref))
+		assert.Equal(t, &ReferenceError{Kind: "exchange", Name: "ex.orders"}, ref)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
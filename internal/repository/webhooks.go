@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"queue-manager/internal/models"
+)
+
+// DeliveryFilter narrows down the webhook delivery attempts returned by ListWebhookDeliveries
+type DeliveryFilter struct {
+	Sink      string
+	EventType string
+	// Failed only matches attempts that did not succeed
+	Failed bool
+	Limit  int
+}
+
+// DefaultDeliveryLimit is used when DeliveryFilter.Limit is not set
+const DefaultDeliveryLimit = 50
+
+// InsertWebhookDelivery stores one delivery attempt
+func (r *Repository) InsertWebhookDelivery(d models.WebhookDelivery) error {
+	row := r.queryRow("InsertWebhookDelivery", `
+		INSERT INTO queue_manager.webhook_deliveries
+		       (delivery_id, sink, event_id, event_type, attempt, success, status_code, error, duration_ms, attempted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, ''), $9, $10)
+		RETURNING id
+	`, d.DeliveryID, d.Sink, d.EventID, d.EventType, d.Attempt, d.Success, d.StatusCode, d.Error,
+		d.DurationMs, d.AttemptedAt)
+	if err := row.Scan(&d.ID); err != nil {
+		return err
+	}
+
+	r.debug("stored webhook delivery attempt", "op", "InsertWebhookDelivery", "sink", d.Sink, "attempt", d.Attempt)
+	return nil
+}
+
+// ListWebhookDeliveries returns the most recent delivery attempts matching the filter, newest first
+func (r *Repository) ListWebhookDeliveries(filter DeliveryFilter) ([]models.WebhookDelivery, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	addCondition := func(format string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+
+	if filter.Sink != "" {
+		addCondition("sink = $%d", filter.Sink)
+	}
+	if filter.EventType != "" {
+		addCondition("event_type = $%d", filter.EventType)
+	}
+	if filter.Failed {
+		conditions = append(conditions, "NOT success")
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultDeliveryLimit
+	}
+
+	query := `
+		SELECT id, delivery_id, sink, event_id, event_type, attempt, success,
+		       COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, attempted_at
+		FROM queue_manager.webhook_deliveries
+	`
+	if len(conditions) > 0 {
+		query += "WHERE " + strings.Join(conditions, " AND ") + "\n"
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf("ORDER BY attempted_at DESC, id DESC LIMIT $%d", len(args))
+
+	rows, err := r.query("ListWebhookDeliveries", query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.DeliveryID, &d.Sink, &d.EventID, &d.EventType, &d.Attempt, &d.Success,
+			&d.StatusCode, &d.Error, &d.DurationMs, &d.AttemptedAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	r.debug("loaded webhook deliveries from database", "op", "ListWebhookDeliveries", "count", len(deliveries))
+	return deliveries, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"queue-manager/internal/models"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var deliveryColumns = []string{
+	"id", "delivery_id", "sink", "event_id", "event_type", "attempt", "success",
+	"status_code", "error", "duration_ms", "attempted_at",
+}
+
+func TestRepository_InsertWebhookDelivery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	now := time.Now()
+	mock.ExpectQuery(`INSERT INTO queue_manager.webhook_deliveries`).
+		WithArgs("delivery-1", "ops", "event-1", "drift.detected", 2, false, 503, "unexpected status 503", int64(12), now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	err = repo.InsertWebhookDelivery(models.WebhookDelivery{
+		DeliveryID: "delivery-1", Sink: "ops", EventID: "event-1", EventType: "drift.detected",
+		Attempt: 2, StatusCode: 503, Error: "unexpected status 503", DurationMs: 12, AttemptedAt: now,
+	})
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_ListWebhookDeliveries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	now := time.Now()
+
+	t.Run("defaults", func(t *testing.T) {
+		mock.ExpectQuery(`FROM queue_manager.webhook_deliveries\s+ORDER BY attempted_at DESC, id DESC LIMIT \$1`).
+			WithArgs(DefaultDeliveryLimit).
+			WillReturnRows(sqlmock.NewRows(deliveryColumns).
+				AddRow(1, "delivery-1", "ops", "event-1", "drift.detected", 1, true, 200, "", 8, now))
+
+		deliveries, err := repo.ListWebhookDeliveries(DeliveryFilter{})
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, "ops", deliveries[0].Sink)
+		assert.True(t, deliveries[0].Success)
+		assert.Equal(t, 200, deliveries[0].StatusCode)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("filters by sink, event type and failures", func(t *testing.T) {
+		mock.ExpectQuery(`WHERE sink = \$1 AND event_type = \$2 AND NOT success\s+ORDER BY attempted_at DESC, id DESC LIMIT \$3`).
+			WithArgs("ops", "provider.health_changed", 10).
+			WillReturnRows(sqlmock.NewRows(deliveryColumns))
+
+		deliveries, err := repo.ListWebhookDeliveries(DeliveryFilter{Sink: "ops", EventType: "provider.health_changed", Failed: true, Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
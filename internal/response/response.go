@@ -0,0 +1,229 @@
+// Package response writes every HTTP response body of the service. Bodies use the envelope from
+// @apis/response-format.md ({message, data, metadata}); clients that still expect the previous
+// {success, data, error} shape can ask for it with Accept: application/vnd.queue-manager.v1+json
+// while they migrate. Every body carries the request ID.
+package response
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDKey is the gin context key holding the request ID set by middleware.RequestID
+const RequestIDKey = "request_id"
+
+// Media types selecting the response version
+const (
+	MediaTypeV1 = "application/vnd.queue-manager.v1+json"
+	MediaTypeV2 = "application/vnd.queue-manager.v2+json"
+)
+
+// Response versions
+const (
+	V1 = 1 // {success, data, error}, deprecated
+	V2 = 2 // {message, data, metadata}
+)
+
+// VersionHeader reports the version a response was rendered in
+const VersionHeader = "X-API-Version"
+
+// Code identifies the kind of error, so clients do not have to parse messages
+type Code string
+
+const (
+	CodeInvalidRequest        Code = "INVALID_REQUEST"
+	CodeInvalidParameter      Code = "INVALID_PARAMETER"
+	CodeNotFound              Code = "NOT_FOUND"
+	CodeMethodNotAllowed      Code = "METHOD_NOT_ALLOWED"
+	CodeUnauthorized          Code = "UNAUTHORIZED"
+	CodeForbidden             Code = "FORBIDDEN"
+	CodeResourceNotFound      Code = "RESOURCE_NOT_FOUND"
+	CodeAlreadyExists         Code = "ALREADY_EXISTS"
+	CodeResourceInUse         Code = "RESOURCE_IN_USE"
+	CodePreconditionFailed    Code = "PRECONDITION_FAILED"
+	CodePreconditionRequired  Code = "PRECONDITION_REQUIRED"
+	CodeServiceUnavailable    Code = "SERVICE_UNAVAILABLE"
+	CodeNotReady              Code = "NOT_READY"
+	CodeNotLeader             Code = "NOT_LEADER"
+	CodeDatabaseError         Code = "DATABASE_ERROR"
+	CodeProviderError         Code = "PROVIDER_ERROR"
+	CodeReconciliationError   Code = "RECONCILIATION_ERROR"
+	CodeReconciliationAborted Code = "RECONCILIATION_ABORTED"
+	CodeInvalidTopology       Code = "INVALID_TOPOLOGY"
+	CodeAlreadyRunning        Code = "ALREADY_RUNNING"
+	CodePlanNotFound          Code = "PLAN_NOT_FOUND"
+	CodePlanAlreadyApplied    Code = "PLAN_ALREADY_APPLIED"
+	CodePlanStale             Code = "PLAN_STALE"
+	CodeRunNotFound           Code = "RUN_NOT_FOUND"
+	CodeJobNotFound           Code = "JOB_NOT_FOUND"
+	CodeTimeout               Code = "TIMEOUT"
+	CodeInternal              Code = "INTERNAL_ERROR"
+)
+
+// Envelope is the response format specified in @apis/response-format.md
+type Envelope struct {
+	Message  string                 `json:"message"`
+	Data     interface{}            `json:"data"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// FieldError describes an invalid request field or parameter, reported in metadata.errors
+type FieldError struct {
+	Field string `json:"field"`
+	Issue string `json:"issue"`
+}
+
+// Error is an error response. The code is reported in metadata.code, field errors in
+// metadata.errors; Data and Metadata carry additional context, e.g. the run in progress.
+type Error struct {
+	Status   int
+	Code     Code
+	Message  string
+	Fields   []FieldError
+	Data     interface{}
+	Metadata map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// NewError creates an error response
+func NewError(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Invalid creates a 400 response for the given field errors
+func Invalid(fields ...FieldError) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request", Fields: fields}
+}
+
+// InvalidParameter creates a 400 response for a single invalid parameter
+func InvalidParameter(field, issue string) *Error {
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeInvalidParameter,
+		Message: field + " " + issue,
+		Fields:  []FieldError{{Field: field, Issue: issue}},
+	}
+}
+
+// WithData attaches data to the error response
+func (e *Error) WithData(data interface{}) *Error {
+	e.Data = data
+	return e
+}
+
+// WithMetadata adds a metadata entry to the error response
+func (e *Error) WithMetadata(key string, value interface{}) *Error {
+	if e.Metadata == nil {
+		e.Metadata = map[string]interface{}{}
+	}
+	e.Metadata[key] = value
+	return e
+}
+
+// legacy is the deprecated V1 body
+type legacy struct {
+	Success   bool                   `json:"success"`
+	Data      interface{}            `json:"data,omitempty"`
+	Error     *legacyError           `json:"error,omitempty"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+}
+
+type legacyError struct {
+	Code    Code         `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+}
+
+// OK writes a 200 response with message "ok"
+func OK(c *gin.Context, data interface{}) {
+	JSON(c, http.StatusOK, "ok", data, nil)
+}
+
+// JSON writes a successful response
+func JSON(c *gin.Context, status int, message string, data interface{}, metadata map[string]interface{}) {
+	write(c, status, message, data, metadata, nil)
+}
+
+// Fail writes an error response
+func Fail(c *gin.Context, e *Error) {
+	write(c, e.Status, e.Message, e.Data, e.Metadata, e)
+}
+
+// Abort writes an error response and stops the remaining handlers
+func Abort(c *gin.Context, e *Error) {
+	c.Abort()
+	Fail(c, e)
+}
+
+func write(c *gin.Context, status int, message string, data interface{}, metadata map[string]interface{}, e *Error) {
+	requestID := c.GetString(RequestIDKey)
+	version := Version(c.Request)
+	c.Header(VersionHeader, strconv.Itoa(version))
+
+	if version == V1 {
+		body := legacy{Success: e == nil, Data: data, Metadata: metadata, RequestID: requestID}
+		if e != nil {
+			body.Error = &legacyError{Code: e.Code, Message: e.Message, Fields: e.Fields}
+		}
+		c.JSON(status, body)
+		return
+	}
+
+	md := make(map[string]interface{}, len(metadata)+3)
+	for k, v := range metadata {
+		md[k] = v
+	}
+	if e != nil {
+		md["code"] = e.Code
+		if len(e.Fields) > 0 {
+			md["errors"] = e.Fields
+		}
+	}
+	if requestID != "" {
+		md["requestId"] = requestID
+	}
+	c.JSON(status, Envelope{Message: message, Data: data, Metadata: md})
+}
+
+// Version returns the response version requested in the Accept header: V1 for the deprecated
+// media type or application/json;version=1, V2 otherwise
+func Version(r *http.Request) int {
+	if r == nil {
+		return V2
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			if mediaType == MediaTypeV1 || (mediaType == "application/json" && params["version"] == "1") {
+				return V1
+			}
+		}
+	}
+	return V2
+}
+
+// NoRoute answers requests for unknown routes
+func NoRoute(c *gin.Context) {
+	Fail(c, NewError(http.StatusNotFound, CodeNotFound, "route not found"))
+}
+
+// NoMethod answers requests with a method the route does not support
+func NoMethod(c *gin.Context) {
+	Fail(c, NewError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "method not allowed"))
+}
+
+// Recovery answers requests whose handler panicked; use it with gin.CustomRecovery
+func Recovery(c *gin.Context, _ interface{}) {
+	Abort(c, NewError(http.StatusInternalServerError, CodeInternal, "internal error"))
+}
@@ -0,0 +1,106 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, accept string, handler gin.HandlerFunc) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/test", func(c *gin.Context) {
+		c.Set(RequestIDKey, "req-1")
+		handler(c)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w, body
+}
+
+func TestJSON(t *testing.T) {
+	w, body := serve(t, "", func(c *gin.Context) {
+		JSON(c, http.StatusOK, "ok", []string{"a"}, map[string]interface{}{"total": 1})
+	})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get(VersionHeader))
+	assert.Equal(t, "ok", body["message"])
+	assert.Equal(t, []interface{}{"a"}, body["data"])
+	assert.Equal(t, map[string]interface{}{"total": float64(1), "requestId": "req-1"}, body["metadata"])
+}
+
+func TestFail(t *testing.T) {
+	w, body := serve(t, "", func(c *gin.Context) {
+		Fail(c, Invalid(FieldError{Field: "pageSize", Issue: "must be between 1 and 500"}))
+	})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid request", body["message"])
+	assert.Nil(t, body["data"])
+	assert.Equal(t, map[string]interface{}{
+		"code":      "INVALID_REQUEST",
+		"errors":    []interface{}{map[string]interface{}{"field": "pageSize", "issue": "must be between 1 and 500"}},
+		"requestId": "req-1",
+	}, body["metadata"])
+}
+
+func TestFail_V1(t *testing.T) {
+	w, body := serve(t, MediaTypeV1, func(c *gin.Context) {
+		Fail(c, NewError(http.StatusConflict, CodeAlreadyRunning, "reconciliation already running").
+			WithData(map[string]string{"runId": "r1"}))
+	})
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "1", w.Header().Get(VersionHeader))
+	assert.Equal(t, false, body["success"])
+	assert.Equal(t, map[string]interface{}{"runId": "r1"}, body["data"])
+	assert.Equal(t, map[string]interface{}{"code": "ALREADY_RUNNING", "message": "reconciliation already running"}, body["error"])
+	assert.Equal(t, "req-1", body["request_id"])
+	assert.NotContains(t, body, "message")
+}
+
+func TestVersion(t *testing.T) {
+	for accept, want := range map[string]int{
+		"":                                   V2,
+		"application/json":                   V2,
+		"*/*":                                V2,
+		MediaTypeV2:                          V2,
+		MediaTypeV1:                          V1,
+		"application/json; version=1":        V1,
+		"text/html, " + MediaTypeV1 + ";q=1": V1,
+		"not a media type":                   V2,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		assert.Equal(t, want, Version(req), accept)
+	}
+}
+
+func TestInvalidParameter(t *testing.T) {
+	w, body := serve(t, "", func(c *gin.Context) {
+		Fail(c, InvalidParameter("limit", "must be between 1 and 500"))
+	})
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "limit must be between 1 and 500", body["message"])
+	metadata := body["metadata"].(map[string]interface{})
+	assert.Equal(t, "INVALID_PARAMETER", metadata["code"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"field": "limit", "issue": "must be between 1 and 500"}}, metadata["errors"])
+}
@@ -0,0 +1,279 @@
+// Package routing simulates how the broker routes a published message through a topology, to
+// answer why a message did or did not reach a queue.
+package routing
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"queue-manager/internal/queue"
+)
+
+// Message is what a publisher sends: the exchange, the routing key and the headers
+type Message struct {
+	Exchange   string                 `json:"exchange"`
+	RoutingKey string                 `json:"routing_key"`
+	Headers    map[string]interface{} `json:"headers,omitempty"`
+}
+
+// Binding is a binding the message matched
+type Binding struct {
+	Source string `json:"source"`
+	// Destination is a queue or, for exchange-to-exchange bindings, an exchange
+	Destination     string                 `json:"destination"`
+	DestinationType string                 `json:"destination_type"`
+	RoutingKey      string                 `json:"routing_key"`
+	Arguments       map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// Hop is one exchange on the way to a queue. The message leaves it through Binding, or, when none
+// of the exchange's bindings matched, through its alternate exchange.
+type Hop struct {
+	Exchange          string   `json:"exchange"`
+	ExchangeType      string   `json:"exchange_type"`
+	Binding           *Binding `json:"binding,omitempty"`
+	AlternateExchange string   `json:"alternate_exchange,omitempty"`
+}
+
+// Delivery is a queue the message reaches and the hops that lead to it
+type Delivery struct {
+	Queue string `json:"queue"`
+	Path  []Hop  `json:"path"`
+}
+
+// Result is the outcome of a simulation. Notes explain why the message was dropped at an exchange
+// or could not be evaluated, e.g. an unknown exchange or an unsupported exchange type.
+type Result struct {
+	Routed     bool       `json:"routed"`
+	Deliveries []Delivery `json:"deliveries"`
+	Notes      []string   `json:"notes"`
+}
+
+// systemExchanges are the exchanges every broker declares, which providers do not report
+var systemExchanges = map[string]string{
+	"":            "direct",
+	"amq.direct":  "direct",
+	"amq.topic":   "topic",
+	"amq.fanout":  "fanout",
+	"amq.match":   "headers",
+	"amq.headers": "headers",
+}
+
+// Simulate routes msg through t the way RabbitMQ does. Each queue receives the message once, via
+// the first path found; exchange-to-exchange bindings and alternate exchanges are followed, and
+// cycles are cut. Messages published to the default exchange go to the queue named by the
+// routing key.
+func Simulate(t queue.Topology, msg Message) Result {
+	s := simulation{
+		exchanges: make(map[string]queue.ExchangeInfo, len(t.Exchanges)),
+		queues:    make(map[string]bool, len(t.Queues)),
+		bindings:  map[string][]Binding{},
+		delivered: map[string]bool{},
+		visited:   map[string]bool{},
+		result:    Result{Deliveries: []Delivery{}, Notes: []string{}},
+	}
+	for _, x := range t.Exchanges {
+		s.exchanges[x.Name] = x
+	}
+	for _, q := range t.Queues {
+		s.queues[q.Name] = true
+	}
+	for _, b := range t.Bindings {
+		s.bindings[b.Exchange] = append(s.bindings[b.Exchange], Binding{
+			Source: b.Exchange, Destination: b.Queue, DestinationType: "queue", RoutingKey: b.RoutingKey, Arguments: b.Arguments,
+		})
+	}
+	for _, b := range t.ExchangeBindings {
+		s.bindings[b.Source] = append(s.bindings[b.Source], Binding{
+			Source: b.Source, Destination: b.Destination, DestinationType: "exchange", RoutingKey: b.RoutingKey, Arguments: b.Arguments,
+		})
+	}
+
+	if x, ok := s.exchanges[msg.Exchange]; ok && x.Internal {
+		s.note("exchange %q is internal; publishers cannot send to it directly", msg.Exchange)
+	} else {
+		s.route(msg, msg.Exchange, nil)
+	}
+	s.result.Routed = len(s.result.Deliveries) > 0
+	return s.result
+}
+
+type simulation struct {
+	exchanges map[string]queue.ExchangeInfo
+	queues    map[string]bool
+	bindings  map[string][]Binding // by source exchange
+	delivered map[string]bool
+	visited   map[string]bool
+	result    Result
+}
+
+func (s *simulation) note(format string, args ...interface{}) {
+	s.result.Notes = append(s.result.Notes, fmt.Sprintf(format, args...))
+}
+
+// route routes msg at exchange name, reached through path
+func (s *simulation) route(msg Message, name string, path []Hop) {
+	if s.visited[name] {
+		return
+	}
+	s.visited[name] = true
+
+	kind, args, ok := s.exchange(name)
+	if !ok {
+		s.note("exchange %q does not exist; the message is dropped", name)
+		return
+	}
+
+	var matched []Binding
+	if name == "" {
+		// The default exchange is bound to every queue with the queue's name
+		if s.queues[msg.RoutingKey] {
+			matched = append(matched, Binding{Source: "", Destination: msg.RoutingKey, DestinationType: "queue", RoutingKey: msg.RoutingKey})
+		}
+	} else {
+		for _, b := range s.bindings[name] {
+			match, supported := matches(kind, b, msg)
+			if !supported {
+				s.note("exchange %q has type %q, whose routing cannot be simulated", name, kind)
+				break
+			}
+			if match {
+				matched = append(matched, b)
+			}
+		}
+	}
+
+	if len(matched) == 0 {
+		if ae, ok := args["alternate-exchange"].(string); ok && ae != "" {
+			s.route(msg, ae, append(clonePath(path), Hop{Exchange: name, ExchangeType: kind, AlternateExchange: ae}))
+			return
+		}
+		s.note("no binding of exchange %q matches the message and it has no alternate exchange; the message is dropped there", name)
+		return
+	}
+
+	for _, b := range matched {
+		b := b
+		hops := append(clonePath(path), Hop{Exchange: name, ExchangeType: kind, Binding: &b})
+		if b.DestinationType == "exchange" {
+			s.route(msg, b.Destination, hops)
+			continue
+		}
+		if !s.queues[b.Destination] {
+			s.note("queue %q bound to exchange %q does not exist", b.Destination, name)
+			continue
+		}
+		if !s.delivered[b.Destination] {
+			s.delivered[b.Destination] = true
+			s.result.Deliveries = append(s.result.Deliveries, Delivery{Queue: b.Destination, Path: hops})
+		}
+	}
+}
+
+// exchange returns the type and arguments of an exchange, including the system exchanges
+func (s *simulation) exchange(name string) (string, map[string]interface{}, bool) {
+	if x, ok := s.exchanges[name]; ok {
+		return x.Type, x.Arguments, true
+	}
+	if kind, ok := systemExchanges[name]; ok {
+		return kind, nil, true
+	}
+	return "", nil, false
+}
+
+func clonePath(path []Hop) []Hop {
+	return append(make([]Hop, 0, len(path)+1), path...)
+}
+
+// matches reports whether binding b of an exchange of the given type routes msg; supported is
+// false for exchange types whose routing is not simulated (plugins)
+func matches(kind string, b Binding, msg Message) (match, supported bool) {
+	switch kind {
+	case "direct":
+		return b.RoutingKey == msg.RoutingKey, true
+	case "fanout":
+		return true, true
+	case "topic":
+		return TopicMatch(b.RoutingKey, msg.RoutingKey), true
+	case "headers":
+		return HeadersMatch(b.Arguments, msg.Headers), true
+	}
+	return false, false
+}
+
+// TopicMatch reports whether a topic binding key matches a routing key. Both are split into
+// dot-separated words; * matches exactly one word and # matches zero or more words.
+func TopicMatch(pattern, key string) bool {
+	return topicMatch(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func topicMatch(pattern, words []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			// Try every number of words for #, including none
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(words); i++ {
+				if topicMatch(rest, words[i:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(words) == 0 {
+				return false
+			}
+		default:
+			if len(words) == 0 || words[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, words = pattern[1:], words[1:]
+	}
+	return len(words) == 0
+}
+
+// HeadersMatch reports whether a headers binding with the given arguments matches the headers.
+// x-match is all (the default) or any; arguments starting with "x-" are not compared, unless
+// x-match is all-with-x or any-with-x. A binding without arguments to compare matches with all
+// and never matches with any.
+func HeadersMatch(args, headers map[string]interface{}) bool {
+	mode, _ := args["x-match"].(string)
+	if mode == "" {
+		mode = "all"
+	}
+	withX := strings.HasSuffix(mode, "-with-x")
+	matchAny := strings.HasPrefix(mode, "any")
+
+	for k, want := range args {
+		if k == "x-match" || (!withX && strings.HasPrefix(k, "x-")) {
+			continue
+		}
+		got, ok := headers[k]
+		equal := ok && reflect.DeepEqual(normalize(got), normalize(want))
+		if matchAny && equal {
+			return true
+		}
+		if !matchAny && !equal {
+			return false
+		}
+	}
+	return !matchAny
+}
+
+// normalize converts numbers to float64, so 5 and 5.0 decoded from different sources compare equal
+func normalize(v interface{}) interface{} {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case float32:
+		return float64(n)
+	}
+	return v
+}
@@ -0,0 +1,114 @@
+package routing
+
+import (
+	"testing"
+
+	"queue-manager/internal/queue"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicMatch(t *testing.T) {
+	tests := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"order.created", "order.created", true},
+		{"order.*", "order.created", true},
+		{"order.*", "order.created.eu", false},
+		{"order.*", "order", false},
+		{"order.#", "order", true},
+		{"order.#", "order.created.eu", true},
+		{"#.eu", "order.created.eu", true},
+		{"#", "", true},
+		{"*.*.eu", "order.created.eu", true},
+		{"order.#.eu", "order.eu", true},
+		{"order.#.eu", "order.created.us", false},
+		{"order.created", "order.cancelled", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, TopicMatch(tt.pattern, tt.key), "%q ~ %q", tt.pattern, tt.key)
+	}
+}
+
+func TestHeadersMatch(t *testing.T) {
+	headers := map[string]interface{}{"region": "eu", "priority": 5}
+	assert.True(t, HeadersMatch(map[string]interface{}{"region": "eu", "priority": float64(5)}, headers))
+	assert.True(t, HeadersMatch(map[string]interface{}{"x-match": "all", "region": "eu", "x-ignored": "y"}, headers))
+	assert.False(t, HeadersMatch(map[string]interface{}{"region": "eu", "format": "pdf"}, headers))
+	assert.True(t, HeadersMatch(map[string]interface{}{"x-match": "any", "region": "us", "priority": float64(5)}, headers))
+	assert.False(t, HeadersMatch(map[string]interface{}{"x-match": "any", "region": "us"}, headers))
+	assert.False(t, HeadersMatch(map[string]interface{}{"x-match": "all-with-x", "region": "eu", "x-tenant": "a"}, headers))
+}
+
+// topology has a topic exchange forwarding to a fanout exchange, an alternate exchange for
+// unroutable messages and a headers exchange
+var topology = queue.Topology{
+	Exchanges: []queue.ExchangeInfo{
+		{Name: "audit", Type: "fanout"},
+		{Name: "invoices", Type: "headers"},
+		{Name: "orders", Type: "topic", Arguments: map[string]interface{}{"alternate-exchange": "unrouted"}},
+		{Name: "unrouted", Type: "fanout"},
+	},
+	Queues: []queue.QueueInfo{{Name: "audit.log"}, {Name: "invoices.eu"}, {Name: "orders.created"}, {Name: "orders.unrouted"}},
+	Bindings: []queue.BindingInfo{
+		{Exchange: "audit", Queue: "audit.log"},
+		{Exchange: "audit", Queue: "orders.created"},
+		{Exchange: "invoices", Queue: "invoices.eu", Arguments: map[string]interface{}{"x-match": "all", "region": "eu"}},
+		{Exchange: "orders", Queue: "orders.created", RoutingKey: "order.created"},
+		{Exchange: "unrouted", Queue: "orders.unrouted"},
+	},
+	ExchangeBindings: []queue.ExchangeBindingInfo{
+		{Source: "orders", Destination: "audit", RoutingKey: "order.#"},
+		{Source: "audit", Destination: "orders"},
+	},
+}
+
+func TestSimulate(t *testing.T) {
+	t.Run("follows exchange-to-exchange bindings once per queue", func(t *testing.T) {
+		r := Simulate(topology, Message{Exchange: "orders", RoutingKey: "order.created"})
+		require.True(t, r.Routed)
+		require.Len(t, r.Deliveries, 2)
+
+		assert.Equal(t, "orders.created", r.Deliveries[0].Queue)
+		require.Len(t, r.Deliveries[0].Path, 1)
+		assert.Equal(t, "order.created", r.Deliveries[0].Path[0].Binding.RoutingKey)
+
+		assert.Equal(t, "audit.log", r.Deliveries[1].Queue)
+		path := r.Deliveries[1].Path
+		require.Len(t, path, 2)
+		assert.Equal(t, Binding{Source: "orders", Destination: "audit", DestinationType: "exchange", RoutingKey: "order.#"}, *path[0].Binding)
+		assert.Equal(t, "fanout", path[1].ExchangeType)
+		assert.Equal(t, "audit.log", path[1].Binding.Destination)
+	})
+
+	t.Run("falls back to the alternate exchange", func(t *testing.T) {
+		r := Simulate(topology, Message{Exchange: "orders", RoutingKey: "invoice.paid"})
+		require.Len(t, r.Deliveries, 1)
+		assert.Equal(t, "orders.unrouted", r.Deliveries[0].Queue)
+		assert.Equal(t, Hop{Exchange: "orders", ExchangeType: "topic", AlternateExchange: "unrouted"}, r.Deliveries[0].Path[0])
+	})
+
+	t.Run("matches headers", func(t *testing.T) {
+		r := Simulate(topology, Message{Exchange: "invoices", Headers: map[string]interface{}{"region": "eu"}})
+		require.Len(t, r.Deliveries, 1)
+		assert.Equal(t, "invoices.eu", r.Deliveries[0].Queue)
+
+		r = Simulate(topology, Message{Exchange: "invoices", Headers: map[string]interface{}{"region": "us"}})
+		assert.False(t, r.Routed)
+		assert.Equal(t, []string{`no binding of exchange "invoices" matches the message and it has no alternate exchange; the message is dropped there`}, r.Notes)
+	})
+
+	t.Run("routes the default exchange by queue name", func(t *testing.T) {
+		r := Simulate(topology, Message{Exchange: "", RoutingKey: "audit.log"})
+		require.Len(t, r.Deliveries, 1)
+		assert.Equal(t, "audit.log", r.Deliveries[0].Queue)
+	})
+
+	t.Run("reports unknown exchanges", func(t *testing.T) {
+		r := Simulate(topology, Message{Exchange: "payments", RoutingKey: "paid"})
+		assert.False(t, r.Routed)
+		assert.Equal(t, []string{`exchange "payments" does not exist; the message is dropped`}, r.Notes)
+	})
+}
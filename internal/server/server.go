@@ -2,39 +2,68 @@ package server
 
 import (
 	"net/http"
+	"strconv"
 
 	"queue-manager/api"
 	"queue-manager/internal/config"
+	"queue-manager/internal/metrics"
 	"queue-manager/internal/middleware"
-	"queue-manager/internal/queue"
-	"queue-manager/internal/repository"
+	"queue-manager/internal/readiness"
+	"queue-manager/internal/response"
+	"queue-manager/internal/tracing"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 type Server struct {
 	engine *gin.Engine
 	cfg    config.Config
-	repo   *repository.Repository
-	qp     queue.Provider
+	deps   api.Dependencies
 }
 
-func New(cfg config.Config, repo *repository.Repository, qp queue.Provider) *Server {
+func New(cfg config.Config, deps api.Dependencies) *Server {
 	r := gin.New()
+	r.HandleMethodNotAllowed = true
+	// Tracing comes before RequestID so the request ID can be recorded on the server span;
+	// Prometheus scrapes are not traced
+	tracer := otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(func(req *http.Request) bool {
+		return req.URL.Path != "/metrics"
+	}))
 	// Minimal middleware for Phase 1 (enhanced in Phase 6)
-	r.Use(gin.Recovery(), middleware.RequestID(), middleware.Logger(), middleware.CORS(), middleware.Timeout(30_000_000_000)) // 30s
+	r.Use(gin.CustomRecovery(response.Recovery), tracer, middleware.RequestID(), middleware.Logger(deps.Logger), middleware.Metrics(), middleware.CORS(), middleware.Timeout(30_000_000_000)) // 30s
 
 	// Routes
 	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		response.JSON(c, http.StatusOK, "healthy", map[string]interface{}{"status": "ok", "leadership": deps.Leader.Status()}, nil)
 	})
-	api.RegisterRoutes(r, repo, qp)
+	r.GET("/ready", ready(deps.Readiness))
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	api.RegisterRoutes(r, deps)
+	r.NoRoute(response.NoRoute)
+	r.NoMethod(response.NoMethod)
 
 	return &Server{
 		engine: r,
 		cfg:    cfg,
-		repo:   repo,
-		qp:     qp,
+		deps:   deps,
+	}
+}
+
+// ready handles GET /ready, the readiness probe. Not ready is reported as 503 with a Retry-After
+// header, so Kubernetes and load balancers stop routing traffic until the dependencies recover.
+func ready(tracker *readiness.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := tracker.Check(c.Request.Context())
+		if status.Ready() {
+			response.JSON(c, http.StatusOK, "ready", status, nil)
+			return
+		}
+		retryAfter := int(readiness.RetryAfter.Seconds())
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		response.Fail(c, response.NewError(http.StatusServiceUnavailable, response.CodeNotReady, "not ready").
+			WithData(status).
+			WithMetadata("retryAfterSeconds", retryAfter))
 	}
 }
 
@@ -3,14 +3,17 @@ package server
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"queue-manager/api"
 	"queue-manager/internal/config"
+	"queue-manager/internal/readiness"
 )
 
 func TestHealthEndpoint(t *testing.T) {
 	cfg := config.Config{AppHost: "127.0.0.1", AppPort: "0"}
-	s := New(cfg, nil, nil)
+	s := New(cfg, api.Dependencies{})
 
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
 	w := httptest.NewRecorder()
@@ -22,3 +25,83 @@ func TestHealthEndpoint(t *testing.T) {
 }
 
 
+
+func TestMetricsEndpoint(t *testing.T) {
+	cfg := config.Config{AppHost: "127.0.0.1", AppPort: "0"}
+	s := New(cfg, api.Dependencies{})
+
+	// Serve one request first so the HTTP metrics have a sample
+	s.Engine().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	s.Engine().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `queue_manager_http_requests_total{method="GET",route="/health",status="200"}`) {
+		t.Fatalf("expected HTTP request metric, got %s", w.Body.String())
+	}
+}
+
+func TestReadyEndpoint(t *testing.T) {
+	cfg := config.Config{AppHost: "127.0.0.1", AppPort: "0"}
+
+	// Nothing to track: ready
+	w := httptest.NewRecorder()
+	New(cfg, api.Dependencies{}).Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"message":"ready"`) {
+		t.Fatalf("expected ready, got %d %s", w.Code, w.Body.String())
+	}
+
+	// The startup declaration has not run yet
+	w = httptest.NewRecorder()
+	deps := api.Dependencies{Readiness: readiness.NewTracker(nil, nil)}
+	New(cfg, deps).Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "15" {
+		t.Fatalf("expected Retry-After: 15, got %q", w.Header().Get("Retry-After"))
+	}
+	for _, want := range []string{`"message":"not ready"`, `"initialReconciliation":"pending"`, `"retryAfterSeconds":15`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected %s in %s", want, w.Body.String())
+		}
+	}
+}
+
+func TestResponseEnvelope(t *testing.T) {
+	cfg := config.Config{AppHost: "127.0.0.1", AppPort: "0"}
+	s := New(cfg, api.Dependencies{})
+
+	w := httptest.NewRecorder()
+	s.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	for _, want := range []string{`"message":"healthy"`, `"requestId":"` + w.Header().Get("X-Request-ID") + `"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("expected %s in %s", want, w.Body.String())
+		}
+	}
+
+	w = httptest.NewRecorder()
+	s.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), `"code":"NOT_FOUND"`) {
+		t.Fatalf("expected 404 NOT_FOUND, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.Engine().ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/health", nil))
+	if w.Code != http.StatusMethodNotAllowed || !strings.Contains(w.Body.String(), `"code":"METHOD_NOT_ALLOWED"`) {
+		t.Fatalf("expected 405 METHOD_NOT_ALLOWED, got %d %s", w.Code, w.Body.String())
+	}
+
+	// The previous shape is still served on request
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("Accept", "application/vnd.queue-manager.v1+json")
+	w = httptest.NewRecorder()
+	s.Engine().ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"success":true`) || w.Header().Get("X-API-Version") != "1" {
+		t.Fatalf("expected the v1 shape, got %s", w.Body.String())
+	}
+}
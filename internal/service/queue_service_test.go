@@ -83,11 +83,21 @@ func (m *MockProvider) ListBindings(queueName string) ([][3]string, error) {
 	return args.Get(0).([][3]string), args.Error(1)
 }
 
+func (m *MockProvider) InspectQueue(name string) (queue.QueueStatus, error) {
+	args := m.Called(name)
+	return args.Get(0).(queue.QueueStatus), args.Error(1)
+}
+
 func (m *MockProvider) DeleteQueue(name string) error {
 	args := m.Called(name)
 	return args.Error(0)
 }
 
+func (m *MockProvider) DeleteQueueIf(name string, ifEmpty, ifUnused bool) error {
+	args := m.Called(name, ifEmpty, ifUnused)
+	return args.Error(0)
+}
+
 func (m *MockProvider) DeleteExchange(name string) error {
 	args := m.Called(name)
 	return args.Error(0)
@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"queue-manager/internal/config"
+	"queue-manager/internal/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName identifies this service in traces (OTEL_SERVICE_NAME overrides it)
+const ServiceName = "queue-manager"
+
+// RequestIDKey is the span attribute linking a trace to the X-Request-ID of the HTTP request
+const RequestIDKey = attribute.Key("http.request_id")
+
+// Setup installs the global tracer provider exporting via OTLP/HTTP. The exporter endpoint,
+// headers and protocol come from the standard OTEL_EXPORTER_OTLP_* variables. When tracing is
+// disabled the global no-op provider is kept, so instrumented code costs next to nothing.
+// The returned function flushes pending spans and must be called on shutdown.
+func Setup(ctx context.Context, cfg config.Config) (func(context.Context) error, error) {
+	if !cfg.TracingEnabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewSchemaless(semconv.ServiceName(ServiceName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+	// Attributes from OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+	if envRes, err := resource.New(ctx, resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, envRes); err == nil {
+			res = merged
+		}
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	logging.Component(nil, "tracing").Info("OpenTelemetry tracing enabled", "sample_ratio", cfg.TracingSampleRatio)
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer used by all components
+func Tracer() trace.Tracer {
+	return otel.Tracer(ServiceName)
+}
+
+// Start starts a span using the service tracer
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceID returns the trace ID of the span in ctx, or "" when the context is not traced
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
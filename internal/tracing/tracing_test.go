@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"queue-manager/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestSetup_Disabled(t *testing.T) {
+	before := otel.GetTracerProvider()
+	shutdown, err := Setup(context.Background(), config.Config{})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+	assert.Equal(t, before, otel.GetTracerProvider(), "disabled tracing must keep the global provider")
+}
+
+func TestSetup_Enabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://127.0.0.1:1")
+	shutdown, err := Setup(context.Background(), config.Config{TracingEnabled: true, TracingSampleRatio: 1})
+	require.NoError(t, err)
+	_, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider)
+	assert.True(t, ok)
+
+	ctx, span := Start(context.Background(), "test")
+	assert.NotEmpty(t, TraceID(ctx))
+	span.End()
+	// Nothing listens on the endpoint; shutdown must still return once the context ends
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = shutdown(ctx)
+}
+
+func TestTraceID_Untraced(t *testing.T) {
+	assert.Empty(t, TraceID(context.Background()))
+}
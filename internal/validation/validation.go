@@ -0,0 +1,307 @@
+// Package validation checks an expected topology for mistakes the database and the broker accept
+// but that break routing or consumers, before the topology is applied.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"queue-manager/internal/bootstrap"
+)
+
+// Severity tells whether a finding blocks applying the topology
+type Severity string
+
+const (
+	// SeverityError findings block reconciliation until they are fixed
+	SeverityError Severity = "error"
+	// SeverityWarning findings are reported but do not block anything
+	SeverityWarning Severity = "warning"
+)
+
+// Finding codes
+const (
+	CodeUnknownExchange     = "unknown_exchange"
+	CodeUnknownQueue        = "unknown_queue"
+	CodeRoutingKeyIgnored   = "routing_key_ignored"
+	CodeInvalidTopicPattern = "invalid_topic_pattern"
+	CodeInvalidArgument     = "invalid_argument"
+	CodeUnknownDeadLetter   = "unknown_dead_letter_exchange"
+	CodeUnknownAlternate    = "unknown_alternate_exchange"
+	CodePrefetchExceeds     = "prefetch_exceeds_max_inflight"
+)
+
+// Finding is one problem in the topology. Resource names the resource the way the API reports
+// it; Field is the property at fault, e.g. "routing_key" or "arguments.x-message-ttl".
+type Finding struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Kind     string   `json:"kind"`
+	Resource string   `json:"resource"`
+	Field    string   `json:"field,omitempty"`
+	Message  string   `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s %s: %s", f.Kind, f.Resource, f.Message)
+}
+
+// Findings are the problems found in a topology, ordered by kind and resource
+type Findings []Finding
+
+// Count returns the number of findings of severity s
+func (fs Findings) Count(s Severity) int {
+	n := 0
+	for _, f := range fs {
+		if f.Severity == s {
+			n++
+		}
+	}
+	return n
+}
+
+// Err returns an *Error listing the error findings, or nil if there are none
+func (fs Findings) Err() error {
+	var errs Findings
+	for _, f := range fs {
+		if f.Severity == SeverityError {
+			errs = append(errs, f)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &Error{Findings: errs}
+}
+
+// ErrInvalid matches the errors returned for topologies with error findings
+var ErrInvalid = errors.New("topology is invalid")
+
+// Error reports the error findings that block applying a topology
+type Error struct {
+	Findings Findings
+}
+
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		msgs[i] = f.String()
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalid, strings.Join(msgs, "; "))
+}
+
+// Is makes errors.Is(err, ErrInvalid) match
+func (e *Error) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+// Kinds of resources findings refer to
+const (
+	kindExchange   = "exchange"
+	kindQueue      = "queue"
+	kindBinding    = "binding"
+	kindAssignment = "assignment"
+)
+
+// Validate checks the definitions and returns what it found. Assignments are only checked when
+// the definitions include them.
+func Validate(d bootstrap.Definitions) Findings {
+	v := validator{
+		exchanges: make(map[string]string, len(d.Exchanges)),
+		queues:    make(map[string]bool, len(d.Queues)),
+	}
+	for _, e := range d.Exchanges {
+		v.exchanges[e.ExchangeName] = e.ExchangeType
+	}
+	for _, q := range d.Queues {
+		v.queues[q.QueueName] = true
+	}
+
+	for _, e := range d.Exchanges {
+		v.exchangeArguments(e.ExchangeName, e.Arguments)
+	}
+	for _, q := range d.Queues {
+		v.queueArguments(q.QueueName, q.Arguments)
+	}
+	for _, b := range d.Bindings {
+		v.binding(b.ExchangeName, b.QueueName, b.RoutingKey)
+	}
+	for _, a := range d.Assignments {
+		name := fmt.Sprintf("%s -> %s", a.ServiceName, a.QueueName)
+		if !v.queues[a.QueueName] {
+			v.add(SeverityError, CodeUnknownQueue, kindAssignment, name, "queue_name",
+				fmt.Sprintf("queue %q is not declared", a.QueueName))
+		}
+		if a.PrefetchCount > a.MaxInflight {
+			v.add(SeverityError, CodePrefetchExceeds, kindAssignment, name, "prefetch_count",
+				fmt.Sprintf("prefetch_count %d exceeds max_inflight %d; the consumer would receive more messages than it may process", a.PrefetchCount, a.MaxInflight))
+		}
+	}
+
+	sort.SliceStable(v.findings, func(i, j int) bool {
+		a, b := v.findings[i], v.findings[j]
+		if kindOrder[a.Kind] != kindOrder[b.Kind] {
+			return kindOrder[a.Kind] < kindOrder[b.Kind]
+		}
+		return a.Resource < b.Resource
+	})
+	return v.findings
+}
+
+var kindOrder = map[string]int{kindExchange: 0, kindQueue: 1, kindBinding: 2, kindAssignment: 3}
+
+type validator struct {
+	exchanges map[string]string // name -> type
+	queues    map[string]bool
+	findings  Findings
+}
+
+func (v *validator) add(s Severity, code, kind, resource, field, msg string) {
+	v.findings = append(v.findings, Finding{Severity: s, Code: code, Kind: kind, Resource: resource, Field: field, Message: msg})
+}
+
+// exchangeExists reports whether messages can be published to the exchange: declared ones, and
+// the default and amq.* exchanges every broker has
+func (v *validator) exchangeExists(name string) bool {
+	_, ok := v.exchanges[name]
+	return ok || name == "" || strings.HasPrefix(name, "amq.")
+}
+
+func (v *validator) exchangeArguments(name string, args map[string]interface{}) {
+	if ae, ok := args["alternate-exchange"]; ok {
+		s, isString := ae.(string)
+		switch {
+		case !isString:
+			v.add(SeverityError, CodeInvalidArgument, kindExchange, name, "arguments.alternate-exchange",
+				fmt.Sprintf("alternate-exchange must be a string, got %s", typeName(ae)))
+		case !v.exchangeExists(s):
+			v.add(SeverityError, CodeUnknownAlternate, kindExchange, name, "arguments.alternate-exchange",
+				fmt.Sprintf("alternate exchange %q is not declared; unroutable messages would be dropped", s))
+		}
+	}
+}
+
+// integerArguments are the queue arguments RabbitMQ only accepts as non-negative integers
+var integerArguments = []string{
+	"x-message-ttl", "x-expires", "x-max-length", "x-max-length-bytes", "x-max-priority", "x-delivery-limit",
+}
+
+// queueTypes are the values of x-queue-type
+var queueTypes = map[string]bool{"classic": true, "quorum": true, "stream": true}
+
+func (v *validator) queueArguments(name string, args map[string]interface{}) {
+	for _, key := range integerArguments {
+		val, ok := args[key]
+		if !ok {
+			continue
+		}
+		if !nonNegativeInteger(val) {
+			v.add(SeverityError, CodeInvalidArgument, kindQueue, name, "arguments."+key,
+				fmt.Sprintf("%s must be a non-negative integer, got %s; the broker refuses to declare the queue", key, describe(val)))
+		}
+	}
+	if t, ok := args["x-queue-type"]; ok {
+		if s, isString := t.(string); !isString || !queueTypes[s] {
+			v.add(SeverityError, CodeInvalidArgument, kindQueue, name, "arguments.x-queue-type",
+				fmt.Sprintf("x-queue-type must be classic, quorum or stream, got %s", describe(t)))
+		}
+	}
+	if rk, ok := args["x-dead-letter-routing-key"]; ok {
+		if _, isString := rk.(string); !isString {
+			v.add(SeverityError, CodeInvalidArgument, kindQueue, name, "arguments.x-dead-letter-routing-key",
+				fmt.Sprintf("x-dead-letter-routing-key must be a string, got %s", typeName(rk)))
+		}
+	}
+	if dlx, ok := args["x-dead-letter-exchange"]; ok {
+		s, isString := dlx.(string)
+		switch {
+		case !isString:
+			v.add(SeverityError, CodeInvalidArgument, kindQueue, name, "arguments.x-dead-letter-exchange",
+				fmt.Sprintf("x-dead-letter-exchange must be a string, got %s", typeName(dlx)))
+		case !v.exchangeExists(s):
+			v.add(SeverityError, CodeUnknownDeadLetter, kindQueue, name, "arguments.x-dead-letter-exchange",
+				fmt.Sprintf("dead letter exchange %q is not declared; dead-lettered messages would be dropped", s))
+		}
+	}
+}
+
+func (v *validator) binding(exchange, queueName, routingKey string) {
+	name := fmt.Sprintf("%s -> %s (%s)", exchange, queueName, routingKey)
+	kind, declared := v.exchanges[exchange]
+	if !v.exchangeExists(exchange) {
+		v.add(SeverityError, CodeUnknownExchange, kindBinding, name, "exchange_name",
+			fmt.Sprintf("exchange %q is not declared", exchange))
+	}
+	if !v.queues[queueName] {
+		v.add(SeverityError, CodeUnknownQueue, kindBinding, name, "queue_name",
+			fmt.Sprintf("queue %q is not declared", queueName))
+	}
+	if !declared || routingKey == "" {
+		return
+	}
+	switch kind {
+	case "fanout", "headers":
+		v.add(SeverityWarning, CodeRoutingKeyIgnored, kindBinding, name, "routing_key",
+			fmt.Sprintf("%s exchanges ignore routing keys; every matching message reaches the queue regardless of %q", kind, routingKey))
+	case "topic":
+		if word, ok := invalidTopicWord(routingKey); ok {
+			v.add(SeverityError, CodeInvalidTopicPattern, kindBinding, name, "routing_key",
+				fmt.Sprintf("%q mixes a wildcard with other characters; * and # only match as whole dot-separated words", word))
+		}
+	}
+}
+
+// invalidTopicWord returns the first word of a topic binding key that contains * or # but is not
+// exactly one of them: RabbitMQ matches such words literally, which is never what was meant
+func invalidTopicWord(key string) (string, bool) {
+	for _, word := range strings.Split(key, ".") {
+		if word != "*" && word != "#" && strings.ContainsAny(word, "*#") {
+			return word, true
+		}
+	}
+	return "", false
+}
+
+// nonNegativeInteger reports whether a decoded value is a whole number of at least zero. JSON
+// decodes numbers as float64, YAML as int.
+func nonNegativeInteger(v interface{}) bool {
+	switch n := v.(type) {
+	case float64:
+		return n >= 0 && n == math.Trunc(n)
+	case int:
+		return n >= 0
+	case int64:
+		return n >= 0
+	}
+	return false
+}
+
+// describe formats an argument value for a message, e.g. `"60000" (string)`
+func describe(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q (string)", s)
+	}
+	return fmt.Sprintf("%v (%s)", v, typeName(v))
+}
+
+// typeName names the JSON type of a decoded value
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64, int, int64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
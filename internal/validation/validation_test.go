@@ -0,0 +1,78 @@
+package validation
+
+import (
+	"testing"
+
+	"queue-manager/internal/bootstrap"
+	"queue-manager/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	findings := Validate(bootstrap.Definitions{
+		Exchanges: []models.Exchange{
+			{ExchangeName: "orders", ExchangeType: "topic", Arguments: models.JSONB{"alternate-exchange": "unrouted"}},
+			{ExchangeName: "broadcast", ExchangeType: "fanout"},
+			{ExchangeName: "retry", ExchangeType: "direct"},
+		},
+		Queues: []models.Queue{
+			{QueueName: "orders.created", Arguments: models.JSONB{"x-message-ttl": "60000", "x-queue-type": "quorum"}},
+			{QueueName: "orders.failed", Arguments: models.JSONB{"x-dead-letter-exchange": "dead.letter", "x-max-length": float64(1000)}},
+			{QueueName: "orders.retry", Arguments: models.JSONB{"x-dead-letter-exchange": "retry", "x-expires": 60000}},
+			{QueueName: "notifications", Arguments: models.JSONB{"x-dead-letter-exchange": ""}},
+		},
+		Bindings: []models.Binding{
+			{ExchangeName: "orders", QueueName: "orders.created", RoutingKey: "order.*.created.#"},
+			{ExchangeName: "orders", QueueName: "orders.failed", RoutingKey: "order.fail*"},
+			{ExchangeName: "broadcast", QueueName: "notifications", RoutingKey: "all"},
+			{ExchangeName: "broadcast", QueueName: "orders.retry"},
+			{ExchangeName: "amq.topic", QueueName: "notifications", RoutingKey: "#"},
+			{ExchangeName: "billing", QueueName: "invoices", RoutingKey: "invoice"},
+		},
+		Assignments: []models.ServiceAssignment{
+			{ServiceName: "order-service", QueueName: "orders.created", PrefetchCount: 50, MaxInflight: 20},
+			{ServiceName: "order-service", QueueName: "orders.failed", PrefetchCount: 10, MaxInflight: 10},
+		},
+	})
+
+	type finding struct {
+		severity Severity
+		code     string
+		resource string
+		field    string
+	}
+	got := make([]finding, len(findings))
+	for i, f := range findings {
+		got[i] = finding{f.Severity, f.Code, f.Resource, f.Field}
+	}
+	assert.Equal(t, []finding{
+		{SeverityError, CodeUnknownAlternate, "orders", "arguments.alternate-exchange"},
+		{SeverityError, CodeInvalidArgument, "orders.created", "arguments.x-message-ttl"},
+		{SeverityError, CodeUnknownDeadLetter, "orders.failed", "arguments.x-dead-letter-exchange"},
+		{SeverityError, CodeUnknownExchange, "billing -> invoices (invoice)", "exchange_name"},
+		{SeverityError, CodeUnknownQueue, "billing -> invoices (invoice)", "queue_name"},
+		{SeverityWarning, CodeRoutingKeyIgnored, "broadcast -> notifications (all)", "routing_key"},
+		{SeverityError, CodeInvalidTopicPattern, "orders -> orders.failed (order.fail*)", "routing_key"},
+		{SeverityError, CodePrefetchExceeds, "order-service -> orders.created", "prefetch_count"},
+	}, got)
+	assert.Equal(t, `x-message-ttl must be a non-negative integer, got "60000" (string); the broker refuses to declare the queue`, findings[1].Message)
+	assert.Equal(t, 7, findings.Count(SeverityError))
+	assert.Equal(t, 1, findings.Count(SeverityWarning))
+}
+
+func TestFindings_Err(t *testing.T) {
+	assert.NoError(t, Findings{}.Err())
+	assert.NoError(t, Findings{{Severity: SeverityWarning, Code: CodeRoutingKeyIgnored}}.Err())
+
+	err := Findings{
+		{Severity: SeverityWarning, Code: CodeRoutingKeyIgnored, Kind: "binding", Resource: "b", Message: "ignored"},
+		{Severity: SeverityError, Code: CodeUnknownQueue, Kind: "assignment", Resource: "svc -> q", Message: `queue "q" is not declared`},
+	}.Err()
+	require.ErrorIs(t, err, ErrInvalid)
+	assert.EqualError(t, err, `topology is invalid: assignment svc -> q: queue "q" is not declared`)
+	var invalid *Error
+	require.ErrorAs(t, err, &invalid)
+	assert.Len(t, invalid.Findings, 1)
+}
@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"queue-manager/internal/logging"
+	"queue-manager/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// maxBackoff caps the wait between two attempts
+const maxBackoff = 5 * time.Minute
+
+// work delivers the events queued for a sink one at a time until the notifier stops
+func (n *Notifier) work(s *sink) {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.stop:
+			return
+		case p := <-s.queue:
+			n.deliver(p.ctx, s, p.event)
+		}
+	}
+}
+
+// deliver sends an event to a sink, retrying with exponential backoff on network errors, 429
+// and 5xx responses. Every attempt is recorded in the delivery log.
+func (n *Notifier) deliver(ctx context.Context, s *sink, ev Event) {
+	deliveryID := uuid.NewString()
+	ctx = logging.With(ctx, "sink", s.Name, "event", ev.Type, "delivery_id", deliveryID)
+
+	body, err := s.render(ev)
+	if err != nil {
+		// Retrying cannot fix a broken template
+		n.record(ctx, s, ev, deliveryID, 1, 0, time.Now().UTC(), err)
+		n.logger.ErrorContext(ctx, "failed to render webhook payload", logging.Err(err))
+		return
+	}
+
+	backoff := n.opts.Backoff
+	for attempt := 1; ; attempt++ {
+		started := time.Now().UTC()
+		status, err := n.send(ctx, s, ev, deliveryID, body)
+		n.record(ctx, s, ev, deliveryID, attempt, status, started, err)
+		if err == nil {
+			n.logger.DebugContext(ctx, "webhook delivered", "attempt", attempt, "status", status)
+			return
+		}
+		if attempt >= n.opts.MaxAttempts || !retryable(status) {
+			n.logger.ErrorContext(ctx, "webhook delivery failed", "attempts", attempt, logging.Err(err))
+			return
+		}
+
+		n.logger.WarnContext(ctx, "webhook delivery failed, retrying", "attempt", attempt,
+			"retry_in", backoff.String(), logging.Err(err))
+		select {
+		case <-n.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// send makes one delivery attempt and returns the response status, 0 if there was none
+func (n *Notifier) send(ctx context.Context, s *sink, ev Event, deliveryID string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "queue-manager-webhook")
+	req.Header.Set(HeaderEvent, ev.Type)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if s.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(s.Secret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable reports whether an attempt that ended with this status may succeed later.
+// Status 0 means the request failed before a response was received.
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// render builds the payload of an event: the event itself as JSON, or the sink's template
+func (s *sink) render(ev Event) ([]byte, error) {
+	if s.tmpl == nil {
+		return json.Marshal(ev)
+	}
+	var buf bytes.Buffer
+	if err := s.tmpl.Execute(&buf, ev); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, errors.New("template did not produce valid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+// record stores a delivery attempt, if a delivery log is configured
+func (n *Notifier) record(ctx context.Context, s *sink, ev Event, deliveryID string, attempt, status int,
+	started time.Time, err error) {
+	n.mu.Lock()
+	deliveries := n.deliveries
+	n.mu.Unlock()
+	if deliveries == nil {
+		return
+	}
+
+	d := models.WebhookDelivery{
+		DeliveryID:  deliveryID,
+		Sink:        s.Name,
+		EventID:     ev.ID,
+		EventType:   ev.Type,
+		Attempt:     attempt,
+		Success:     err == nil,
+		StatusCode:  status,
+		DurationMs:  time.Since(started).Milliseconds(),
+		AttemptedAt: started,
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	if err := deliveries.InsertWebhookDelivery(d); err != nil {
+		n.logger.ErrorContext(ctx, "failed to record webhook delivery", logging.Err(err))
+	}
+}
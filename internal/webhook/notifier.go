@@ -0,0 +1,254 @@
+package webhook
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"queue-manager/internal/logging"
+	"queue-manager/internal/models"
+	"queue-manager/internal/reconciliation"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// queueSize is the number of events buffered per sink; further events are dropped
+const queueSize = 100
+
+// Options configures deliveries and the errors-persisting threshold
+type Options struct {
+	// MaxAttempts is the number of delivery attempts per event, including the first
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles with every further retry
+	Backoff time.Duration
+	// Timeout limits each attempt
+	Timeout time.Duration
+	// ErrorRuns is the number of consecutive runs with errors that triggers EventErrorsPersisting
+	ErrorRuns int
+}
+
+// DeliveryLog records delivery attempts. It is implemented by the repository.
+type DeliveryLog interface {
+	InsertWebhookDelivery(d models.WebhookDelivery) error
+}
+
+// Notifier turns reconciliation outcomes and provider health checks into events and delivers
+// them to the configured sinks in the background. It implements reconciliation.Observer and
+// cron.HealthObserver.
+type Notifier struct {
+	sinks  []*sink
+	opts   Options
+	client *http.Client
+	logger *slog.Logger
+
+	mu         sync.Mutex
+	deliveries DeliveryLog
+	errorRuns  int    // consecutive runs with errors
+	drift      string // fingerprint of the drift last notified, "" when in sync
+	healthy    *bool  // last known provider health, nil before the first check
+
+	started bool
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// sink is a configured sink and its queue of pending events
+type sink struct {
+	Sink
+	tmpl   *template.Template
+	events map[string]bool
+	queue  chan pending
+}
+
+// pending is an event waiting to be delivered; ctx carries the log fields and trace of its origin
+type pending struct {
+	ctx   context.Context
+	event Event
+}
+
+// NewNotifier creates a notifier for the given sinks. Call Start to begin delivering.
+func NewNotifier(sinks []Sink, opts Options) (*Notifier, error) {
+	if opts.MaxAttempts < 1 {
+		opts.MaxAttempts = 1
+	}
+	if opts.ErrorRuns < 1 {
+		opts.ErrorRuns = 1
+	}
+	n := &Notifier{
+		opts: opts,
+		client: &http.Client{
+			Timeout:   opts.Timeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+		logger: logging.Component(nil, "webhook"),
+		stop:   make(chan struct{}),
+	}
+	for _, s := range sinks {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+		tmpl, _ := parseTemplate(s)
+		events := map[string]bool{}
+		for _, e := range s.Events {
+			events[e] = true
+		}
+		n.sinks = append(n.sinks, &sink{Sink: s, tmpl: tmpl, events: events, queue: make(chan pending, queueSize)})
+	}
+	return n, nil
+}
+
+// SetLogger replaces the notifier's logger
+func (n *Notifier) SetLogger(l *slog.Logger) {
+	n.logger = logging.Component(l, "webhook")
+}
+
+// SetDeliveryLog records every delivery attempt in l
+func (n *Notifier) SetDeliveryLog(l DeliveryLog) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.deliveries = l
+}
+
+// Start starts one delivery worker per sink
+func (n *Notifier) Start() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.started {
+		return
+	}
+	n.started = true
+	for _, s := range n.sinks {
+		n.wg.Add(1)
+		go n.work(s)
+	}
+	n.logger.Info("webhook notifications enabled", "sinks", len(n.sinks))
+}
+
+// Stop stops the workers. Retries waiting for their backoff are abandoned.
+func (n *Notifier) Stop() {
+	n.mu.Lock()
+	if !n.started {
+		n.mu.Unlock()
+		return
+	}
+	n.started = false
+	n.mu.Unlock()
+	close(n.stop)
+	n.wg.Wait()
+}
+
+// Publish queues an event for every sink subscribed to its type without waiting for delivery
+func (n *Notifier) Publish(ctx context.Context, eventType string, data map[string]interface{}) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ev := Event{ID: uuid.NewString(), Type: eventType, Time: time.Now().UTC(), Data: data}
+	// The event outlives the run or request that raised it
+	ctx = context.WithoutCancel(ctx)
+	for _, s := range n.sinks {
+		if len(s.events) > 0 && !s.events[eventType] {
+			continue
+		}
+		select {
+		case s.queue <- pending{ctx: ctx, event: ev}:
+		default:
+			n.logger.WarnContext(ctx, "webhook queue full, dropping event", "sink", s.Name, "event", eventType)
+		}
+	}
+}
+
+// RunFinished notifies about runs that changed resources and about errors persisting across
+// runs. Dry runs are ignored.
+func (n *Notifier) RunFinished(ctx context.Context, run models.ReconciliationRun, actions []models.ReconciliationAction) {
+	if run.DryRun {
+		return
+	}
+
+	changes, errs := []models.ReconciliationAction{}, []string{}
+	for _, a := range actions {
+		switch a.Action {
+		case "create", "delete":
+			changes = append(changes, a)
+		case "error":
+			errs = append(errs, a.Detail)
+		}
+	}
+	if run.Status == reconciliation.RunFailed && len(errs) == 0 {
+		errs = append(errs, run.Error)
+	}
+
+	if len(changes) > 0 {
+		n.Publish(ctx, EventChanged, map[string]interface{}{"run": run, "changes": changes})
+	}
+
+	n.mu.Lock()
+	if len(errs) == 0 {
+		n.errorRuns = 0
+	} else {
+		n.errorRuns++
+	}
+	// Sent once per streak, when it reaches the threshold
+	persisting := len(errs) > 0 && n.errorRuns == n.opts.ErrorRuns
+	streak := n.errorRuns
+	n.mu.Unlock()
+
+	if persisting {
+		n.Publish(ctx, EventErrorsPersisting, map[string]interface{}{
+			"run":              run,
+			"consecutive_runs": streak,
+			"errors":           errs,
+		})
+	}
+}
+
+// DriftObserved notifies about drift unless the same resources were already reported
+func (n *Notifier) DriftObserved(ctx context.Context, drift reconciliation.DriftReport) {
+	fingerprint := driftFingerprint(drift)
+
+	n.mu.Lock()
+	changed := fingerprint != n.drift
+	n.drift = fingerprint
+	n.mu.Unlock()
+
+	if changed && !drift.Empty() {
+		n.Publish(ctx, EventDrift, map[string]interface{}{
+			"missing":    drift.Missing,
+			"unexpected": drift.Unexpected,
+		})
+	}
+}
+
+// ProviderHealth notifies when the provider health changes. The provider is assumed healthy
+// before the first check, so a provider that is down from the start is reported as well.
+func (n *Notifier) ProviderHealth(ctx context.Context, healthy bool, details string) {
+	n.mu.Lock()
+	previous := n.healthy == nil || *n.healthy
+	n.healthy = &healthy
+	n.mu.Unlock()
+
+	if healthy != previous {
+		n.Publish(ctx, EventProviderHealth, map[string]interface{}{
+			"healthy": healthy,
+			"details": details,
+		})
+	}
+}
+
+// driftFingerprint identifies a set of drifted resources independently of their order
+func driftFingerprint(drift reconciliation.DriftReport) string {
+	keys := []string{}
+	for _, d := range drift.Missing {
+		keys = append(keys, "missing/"+d.Kind+"/"+d.Name)
+	}
+	for _, d := range drift.Unexpected {
+		keys = append(keys, "unexpected/"+d.Kind+"/"+d.Name)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\n")
+}
@@ -0,0 +1,231 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"queue-manager/internal/models"
+	"queue-manager/internal/reconciliation"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingLog captures delivery attempts in memory
+type recordingLog struct {
+	mu         sync.Mutex
+	deliveries []models.WebhookDelivery
+}
+
+func (l *recordingLog) InsertWebhookDelivery(d models.WebhookDelivery) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deliveries = append(l.deliveries, d)
+	return nil
+}
+
+func (l *recordingLog) all() []models.WebhookDelivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]models.WebhookDelivery{}, l.deliveries...)
+}
+
+// received is a request captured by the test server
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// newServer answers with the given statuses in turn, then 200
+func newServer(t *testing.T, statuses ...int) (*httptest.Server, chan received) {
+	t.Helper()
+	requests := make(chan received, 10)
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header.Clone(), body: body}
+		mu.Lock()
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func newTestNotifier(t *testing.T, sinks []Sink, opts Options) (*Notifier, *recordingLog) {
+	t.Helper()
+	if opts.Backoff == 0 {
+		opts.Backoff = time.Millisecond
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = time.Second
+	}
+	n, err := NewNotifier(sinks, opts)
+	require.NoError(t, err)
+	log := &recordingLog{}
+	n.SetDeliveryLog(log)
+	n.Start()
+	t.Cleanup(n.Stop)
+	return n, log
+}
+
+func waitFor(t *testing.T, requests chan received) received {
+	t.Helper()
+	select {
+	case r := <-requests:
+		return r
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook not delivered")
+		return received{}
+	}
+}
+
+func TestNotifier_DeliversSignedEvent(t *testing.T) {
+	srv, requests := newServer(t)
+	n, log := newTestNotifier(t, []Sink{{Name: "ops", URL: srv.URL, Secret: "s3cret"}}, Options{MaxAttempts: 3})
+
+	n.Publish(context.Background(), EventProviderHealth, map[string]interface{}{"healthy": false})
+	req := waitFor(t, requests)
+
+	var ev Event
+	require.NoError(t, json.Unmarshal(req.body, &ev))
+	assert.Equal(t, EventProviderHealth, ev.Type)
+	assert.Equal(t, false, ev.Data["healthy"])
+	assert.Equal(t, EventProviderHealth, req.header.Get(HeaderEvent))
+	assert.NotEmpty(t, req.header.Get(HeaderDelivery))
+	assert.Equal(t, Sign("s3cret", req.header.Get(HeaderTimestamp), req.body), req.header.Get(HeaderSignature))
+
+	require.Eventually(t, func() bool { return len(log.all()) == 1 }, time.Second, 5*time.Millisecond)
+	d := log.all()[0]
+	assert.True(t, d.Success)
+	assert.Equal(t, 200, d.StatusCode)
+	assert.Equal(t, ev.ID, d.EventID)
+	assert.Equal(t, "ops", d.Sink)
+}
+
+func TestNotifier_RetriesWithBackoff(t *testing.T) {
+	srv, requests := newServer(t, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	n, log := newTestNotifier(t, []Sink{{Name: "ops", URL: srv.URL}}, Options{MaxAttempts: 5})
+
+	n.Publish(context.Background(), EventDrift, map[string]interface{}{})
+	for i := 0; i < 3; i++ {
+		waitFor(t, requests)
+	}
+
+	require.Eventually(t, func() bool { return len(log.all()) == 3 }, time.Second, 5*time.Millisecond)
+	attempts := log.all()
+	for i, d := range attempts {
+		assert.Equal(t, i+1, d.Attempt)
+		assert.Equal(t, attempts[0].DeliveryID, d.DeliveryID, "attempts share the delivery ID")
+	}
+	assert.Equal(t, 503, attempts[0].StatusCode)
+	assert.Equal(t, "unexpected status 503", attempts[0].Error)
+	assert.True(t, attempts[2].Success)
+}
+
+func TestNotifier_GivesUp(t *testing.T) {
+	srv, requests := newServer(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadRequest)
+	n, log := newTestNotifier(t, []Sink{{Name: "ops", URL: srv.URL}}, Options{MaxAttempts: 2})
+
+	n.Publish(context.Background(), EventDrift, nil)
+	waitFor(t, requests)
+	waitFor(t, requests)
+	require.Eventually(t, func() bool { return len(log.all()) == 2 }, time.Second, 5*time.Millisecond)
+
+	// Client errors are not retried
+	n.Publish(context.Background(), EventDrift, nil)
+	waitFor(t, requests)
+	require.Eventually(t, func() bool { return len(log.all()) == 3 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, log.all(), 3)
+	assert.Equal(t, 400, log.all()[2].StatusCode)
+}
+
+func TestNotifier_TemplateAndEventFilter(t *testing.T) {
+	srv, requests := newServer(t)
+	n, log := newTestNotifier(t, []Sink{
+		{Name: "chat", URL: srv.URL, Events: []string{EventDrift},
+			Template: `{"text": {{ printf "%d resources missing" (len .Data.missing) | json }}}`},
+		{Name: "broken", URL: srv.URL, Template: `{"text": {{ .Type }}}`},
+	}, Options{MaxAttempts: 3})
+
+	n.Publish(context.Background(), EventProviderHealth, nil)
+	n.Publish(context.Background(), EventDrift, map[string]interface{}{"missing": []string{"q1", "q2"}})
+
+	req := waitFor(t, requests)
+	assert.JSONEq(t, `{"text": "2 resources missing"}`, string(req.body))
+
+	// The broken template renders invalid JSON: recorded once, never sent
+	require.Eventually(t, func() bool { return len(log.all()) == 3 }, time.Second, 5*time.Millisecond)
+	failed := 0
+	for _, d := range log.all() {
+		if d.Sink == "broken" {
+			assert.False(t, d.Success)
+			assert.Contains(t, d.Error, "valid JSON")
+			failed++
+		}
+	}
+	assert.Equal(t, 2, failed)
+	assert.Empty(t, requests)
+}
+
+// publishedEvents subscribes a sink to every event and returns the types received
+func publishedEvents(t *testing.T, opts Options, publish func(n *Notifier)) []string {
+	t.Helper()
+	srv, requests := newServer(t)
+	n, log := newTestNotifier(t, []Sink{{Name: "all", URL: srv.URL}}, opts)
+	publish(n)
+
+	types := []string{}
+	time.Sleep(50 * time.Millisecond)
+	for len(requests) > 0 {
+		var ev Event
+		require.NoError(t, json.Unmarshal((<-requests).body, &ev))
+		types = append(types, ev.Type)
+	}
+	assert.Len(t, log.all(), len(types))
+	return types
+}
+
+func TestNotifier_RunFinished(t *testing.T) {
+	ctx := context.Background()
+	changed := []models.ReconciliationAction{{Action: "create", ResourceKind: "queue", ResourceName: "q1"}}
+	failed := []models.ReconciliationAction{{Action: "error", ResourceKind: "queue", ResourceName: "q2", Detail: "access refused"}}
+
+	types := publishedEvents(t, Options{MaxAttempts: 1, ErrorRuns: 2}, func(n *Notifier) {
+		n.RunFinished(ctx, models.ReconciliationRun{DryRun: true, Status: reconciliation.RunPartial}, append(changed, failed...))
+		n.RunFinished(ctx, models.ReconciliationRun{Status: reconciliation.RunSucceeded}, changed)
+		n.RunFinished(ctx, models.ReconciliationRun{Status: reconciliation.RunPartial}, failed)
+		n.RunFinished(ctx, models.ReconciliationRun{Status: reconciliation.RunPartial}, failed)
+		// The streak is only reported once
+		n.RunFinished(ctx, models.ReconciliationRun{Status: reconciliation.RunPartial}, failed)
+	})
+	assert.Equal(t, []string{EventChanged, EventErrorsPersisting}, types)
+}
+
+func TestNotifier_DriftAndHealth(t *testing.T) {
+	ctx := context.Background()
+	drift := reconciliation.DriftReport{Missing: []reconciliation.DriftResource{{Kind: "queue", Name: "q1"}}}
+
+	types := publishedEvents(t, Options{MaxAttempts: 1}, func(n *Notifier) {
+		n.DriftObserved(ctx, drift)
+		n.DriftObserved(ctx, drift) // same drift
+		n.DriftObserved(ctx, reconciliation.DriftReport{})
+		n.DriftObserved(ctx, drift) // drift is back
+		n.ProviderHealth(ctx, true, "ok")
+		n.ProviderHealth(ctx, false, "connection closed")
+		n.ProviderHealth(ctx, false, "connection closed")
+		n.ProviderHealth(ctx, true, "reconnected")
+	})
+	assert.Equal(t, []string{EventDrift, EventDrift, EventProviderHealth, EventProviderHealth}, types)
+}
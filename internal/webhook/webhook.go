@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"text/template"
+	"time"
+)
+
+// Event types sent to webhook sinks
+const (
+	// EventDrift is sent when a plan of the whole topology finds resources out of sync, once per
+	// distinct set of resources
+	EventDrift = "drift.detected"
+	// EventChanged is sent when a reconciliation created or deleted resources
+	EventChanged = "reconciliation.changed"
+	// EventErrorsPersisting is sent when the configured number of consecutive runs had errors
+	EventErrorsPersisting = "reconciliation.errors_persisting"
+	// EventProviderHealth is sent when the queue provider becomes healthy or unhealthy
+	EventProviderHealth = "provider.health_changed"
+)
+
+// EventTypes lists every event type a sink can subscribe to
+var EventTypes = []string{EventDrift, EventChanged, EventErrorsPersisting, EventProviderHealth}
+
+// Request headers set on every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// HeaderSignature is set when the sink has a secret, see Sign
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Event is a notification. Without a template, sinks receive it as JSON.
+type Event struct {
+	ID   string                 `json:"id"`
+	Type string                 `json:"type"`
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// Sink is a webhook endpoint as configured in the webhooks file
+type Sink struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Secret signs the payloads; SecretEnv names an environment variable holding it instead
+	Secret    string `json:"secret,omitempty"`
+	SecretEnv string `json:"secret_env,omitempty"`
+	// Events limits the sink to the given event types; empty means all
+	Events []string `json:"events,omitempty"`
+	// Template is a Go text/template rendering the payload from the Event; it must produce JSON
+	Template string            `json:"template,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+// file is the format of the webhooks file
+type file struct {
+	Sinks []Sink `json:"sinks"`
+}
+
+// LoadSinks reads and validates the sinks defined in a webhooks file
+func LoadSinks(path string) ([]Sink, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhooks file: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse webhooks file %s: %w", path, err)
+	}
+
+	names := map[string]bool{}
+	for i := range f.Sinks {
+		s := &f.Sinks[i]
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("invalid webhook sink %d in %s: %w", i+1, path, err)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("duplicate webhook sink %q in %s", s.Name, path)
+		}
+		names[s.Name] = true
+		if s.SecretEnv != "" {
+			s.Secret = os.Getenv(s.SecretEnv)
+			if s.Secret == "" {
+				return nil, fmt.Errorf("webhook sink %q: %s is not set", s.Name, s.SecretEnv)
+			}
+		}
+	}
+	return f.Sinks, nil
+}
+
+func (s Sink) validate() error {
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("sink %q: url must be an absolute http(s) URL", s.Name)
+	}
+	if s.Secret != "" && s.SecretEnv != "" {
+		return fmt.Errorf("sink %q: set either secret or secret_env", s.Name)
+	}
+	for _, e := range s.Events {
+		if !knownEvent(e) {
+			return fmt.Errorf("sink %q: unknown event type %q", s.Name, e)
+		}
+	}
+	if _, err := parseTemplate(s); err != nil {
+		return fmt.Errorf("sink %q: %w", s.Name, err)
+	}
+	return nil
+}
+
+func knownEvent(t string) bool {
+	for _, e := range EventTypes {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTemplate parses the sink's payload template, or returns nil when it has none. Templates
+// can use the json function to embed any value, e.g. {"text": {{ json .Type }}}.
+func parseTemplate(s Sink) (*template.Template, error) {
+	if s.Template == "" {
+		return nil, nil
+	}
+	t, err := template.New(s.Name).Option("missingkey=zero").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(s.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return t, nil
+}
+
+// Sign returns the signature header value for a payload: the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the sink secret, prefixed with "sha256=". Receivers recompute
+// it from the X-Webhook-Timestamp header and the raw body, and should reject old timestamps.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
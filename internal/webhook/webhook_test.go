@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadSinks(t *testing.T) {
+	t.Setenv("OPS_WEBHOOK_SECRET", "s3cret")
+	path := writeFile(t, `{"sinks": [
+		{"name": "ops", "url": "https://hooks.example.com/ops", "secret_env": "OPS_WEBHOOK_SECRET",
+		 "events": ["drift.detected", "provider.health_changed"]},
+		{"name": "chat", "url": "http://chat.local/hook", "template": "{\"text\": {{ json .Type }}}",
+		 "headers": {"Authorization": "Bearer token"}}
+	]}`)
+
+	sinks, err := LoadSinks(path)
+	require.NoError(t, err)
+	require.Len(t, sinks, 2)
+	assert.Equal(t, "s3cret", sinks[0].Secret)
+	assert.Equal(t, []string{EventDrift, EventProviderHealth}, sinks[0].Events)
+	assert.Equal(t, "Bearer token", sinks[1].Headers["Authorization"])
+}
+
+func TestLoadSinks_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"missing name":      `{"sinks": [{"url": "https://example.com"}]}`,
+		"relative url":      `{"sinks": [{"name": "a", "url": "/hook"}]}`,
+		"unknown event":     `{"sinks": [{"name": "a", "url": "https://example.com", "events": ["queue.created"]}]}`,
+		"broken template":   `{"sinks": [{"name": "a", "url": "https://example.com", "template": "{{ .Type"}]}`,
+		"duplicate name":    `{"sinks": [{"name": "a", "url": "https://example.com"}, {"name": "a", "url": "https://example.org"}]}`,
+		"unset secret env":  `{"sinks": [{"name": "a", "url": "https://example.com", "secret_env": "QM_TEST_UNSET_SECRET"}]}`,
+		"secret and env":    `{"sinks": [{"name": "a", "url": "https://example.com", "secret": "x", "secret_env": "HOME"}]}`,
+		"malformed content": `{"sinks": `,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadSinks(writeFile(t, content))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := LoadSinks(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestSign(t *testing.T) {
+	// Reference value: printf '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686",
+		Sign("secret", "1700000000", []byte(`{"a":1}`)))
+}
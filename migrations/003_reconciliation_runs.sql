@@ -0,0 +1,49 @@
+-- Migration: Reconciliation run history
+-- Records every reconciliation run and the actions it took, so changes on the provider can be traced back
+
+BEGIN;
+
+-- ============================================================================
+-- RECONCILIATION_RUNS TABLE
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS queue_manager.reconciliation_runs (
+    id BIGSERIAL PRIMARY KEY,
+    uuid UUID NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+    trigger TEXT NOT NULL,
+    request_id TEXT,
+    plan_id TEXT,
+    dry_run BOOLEAN NOT NULL DEFAULT false,
+    force BOOLEAN NOT NULL DEFAULT false,
+    status TEXT NOT NULL,
+    error TEXT,
+    summary JSONB DEFAULT '{}'::jsonb,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL
+);
+
+-- Indexes for reconciliation_runs
+CREATE INDEX IF NOT EXISTS idx_reconciliation_runs_started_at
+    ON queue_manager.reconciliation_runs(started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_reconciliation_runs_trigger
+    ON queue_manager.reconciliation_runs(trigger);
+
+-- ============================================================================
+-- RECONCILIATION_ACTIONS TABLE
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS queue_manager.reconciliation_actions (
+    id BIGSERIAL PRIMARY KEY,
+    run_id BIGINT NOT NULL REFERENCES queue_manager.reconciliation_runs(id) ON DELETE CASCADE,
+    action TEXT NOT NULL, -- create, delete, pending, scheduled, error
+    resource_kind TEXT,   -- exchange, queue, binding (empty for run-level errors)
+    resource_name TEXT,
+    detail TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for reconciliation_actions
+CREATE INDEX IF NOT EXISTS idx_reconciliation_actions_run_id
+    ON queue_manager.reconciliation_actions(run_id);
+CREATE INDEX IF NOT EXISTS idx_reconciliation_actions_resource_name
+    ON queue_manager.reconciliation_actions(resource_name);
+
+COMMIT;
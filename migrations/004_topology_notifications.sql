@@ -0,0 +1,66 @@
+-- Migration: Topology change notifications
+-- Sends a NOTIFY on every change to the topology tables so queue-manager can reconcile the
+-- affected resources right away instead of waiting for the next periodic run
+
+BEGIN;
+
+-- Create function sending the changed resource names on the queue_manager_topology channel.
+-- Only names are sent: NOTIFY payloads are limited to 8000 bytes.
+CREATE OR REPLACE FUNCTION queue_manager.notify_topology_change()
+RETURNS TRIGGER AS $$
+DECLARE
+    rec JSONB;
+    old_rec JSONB;
+    payload JSONB;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        rec := to_jsonb(OLD);
+    ELSE
+        rec := to_jsonb(NEW);
+    END IF;
+
+    payload := jsonb_build_object(
+        'table', TG_TABLE_NAME,
+        'op', TG_OP,
+        'exchange', rec->>'exchange_name',
+        'queue', rec->>'queue_name'
+    );
+
+    -- A rename leaves the old resource behind on the broker, so report the old names as well
+    IF TG_OP = 'UPDATE' THEN
+        old_rec := to_jsonb(OLD);
+        IF old_rec->>'exchange_name' IS DISTINCT FROM rec->>'exchange_name' THEN
+            payload := payload || jsonb_build_object('old_exchange', old_rec->>'exchange_name');
+        END IF;
+        IF old_rec->>'queue_name' IS DISTINCT FROM rec->>'queue_name' THEN
+            payload := payload || jsonb_build_object('old_queue', old_rec->>'queue_name');
+        END IF;
+    END IF;
+
+    PERFORM pg_notify('queue_manager_topology', jsonb_strip_nulls(payload)::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Triggers for topology changes
+CREATE TRIGGER trigger_queues_notify
+    AFTER INSERT OR UPDATE OR DELETE ON queue_manager.queues
+    FOR EACH ROW
+    EXECUTE FUNCTION queue_manager.notify_topology_change();
+
+CREATE TRIGGER trigger_exchanges_notify
+    AFTER INSERT OR UPDATE OR DELETE ON queue_manager.exchanges
+    FOR EACH ROW
+    EXECUTE FUNCTION queue_manager.notify_topology_change();
+
+CREATE TRIGGER trigger_bindings_notify
+    AFTER INSERT OR UPDATE OR DELETE ON queue_manager.bindings
+    FOR EACH ROW
+    EXECUTE FUNCTION queue_manager.notify_topology_change();
+
+CREATE TRIGGER trigger_service_assignments_notify
+    AFTER INSERT OR UPDATE OR DELETE ON queue_manager.service_assignments
+    FOR EACH ROW
+    EXECUTE FUNCTION queue_manager.notify_topology_change();
+
+COMMIT;
@@ -0,0 +1,31 @@
+-- Migration: Webhook delivery log
+-- Records every attempt to deliver a webhook notification, so failing sinks can be diagnosed
+
+BEGIN;
+
+-- ============================================================================
+-- WEBHOOK_DELIVERIES TABLE
+-- ============================================================================
+CREATE TABLE IF NOT EXISTS queue_manager.webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id UUID NOT NULL, -- shared by all attempts to deliver one event to one sink
+    sink TEXT NOT NULL,
+    event_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    attempt INT NOT NULL,
+    success BOOLEAN NOT NULL,
+    status_code INT,           -- empty when no response was received
+    error TEXT,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Indexes for webhook_deliveries
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_attempted_at
+    ON queue_manager.webhook_deliveries(attempted_at DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_delivery_id
+    ON queue_manager.webhook_deliveries(delivery_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_sink_event
+    ON queue_manager.webhook_deliveries(sink, event_type);
+
+COMMIT;